@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"movinglake.com/haven/handler"
+)
+
+// RunCreateAPIKey implements `haven create-api-key`, which prints a new API key granted the
+// scopes. It is how the first admin key is created once the server requires keys.
+func RunCreateAPIKey(args []string, env Env) int {
+	flags := flag.NewFlagSet("create-api-key", flag.ContinueOnError)
+	flags.SetOutput(env.Stderr)
+	name := flags.String("name", "", "name telling what the key is used by")
+	scopes := flags.String("scopes", handler.ScopeAdmin, "comma separated scopes of the key: ingest, validate, read or admin")
+	namespace := flags.String("namespace", "", "namespace the key is bound to, empty for every namespace")
+	flags.Usage = func() {
+		fmt.Fprintln(env.Stderr, "usage: haven create-api-key -name <name> [-scopes <scopes>] [-namespace <namespace>]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *name == "" || flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+	db, err := env.ConnectDB()
+	if err != nil {
+		fmt.Fprintf(env.Stderr, "failed to connect to db: %v\n", err)
+		return 1
+	}
+	h := handler.NewHavenAPIHandler(db, nil)
+	key, row, err := h.CreateAPIKey(handler.CreateAPIKeyRequest{Name: *name, Scopes: strings.Split(*scopes, ","), Namespace: *namespace})
+	if err != nil {
+		fmt.Fprintf(env.Stderr, "failed to create api key: %v\n", err)
+		return 1
+	}
+	fmt.Fprintln(env.Stdout, key)
+	fmt.Fprintf(env.Stderr, "created api key %d (%s) with scopes %s, it cannot be shown again\n", row.ID, row.Prefix, row.Scopes)
+	return 0
+}
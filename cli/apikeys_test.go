@@ -0,0 +1,26 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"movinglake.com/haven/wrappers"
+)
+
+func TestRunCreateAPIKey(t *testing.T) {
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	env, stdout, stderr := testEnv(db)
+	assert.Equal(t, 2, RunCreateAPIKey(nil, env))
+	assert.Equal(t, 1, RunCreateAPIKey([]string{"-name", "ci", "-scopes", "ingest,write"}, env))
+	assert.Contains(t, stderr.String(), `unknown api key scope "write"`)
+
+	assert.Equal(t, 0, RunCreateAPIKey([]string{"-name", "ci", "-scopes", "ingest,validate"}, env), stderr.String())
+	key := strings.TrimSpace(stdout.String())
+	assert.True(t, strings.HasPrefix(key, "hvn_"))
+	row := db.APIKeys[1]
+	assert.Equal(t, "ci", row.Name)
+	assert.Equal(t, "ingest,validate", row.Scopes)
+	assert.True(t, strings.HasPrefix(key, row.Prefix))
+	assert.NotContains(t, row.Hash, key[len(row.Prefix):])
+}
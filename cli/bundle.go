@@ -0,0 +1,155 @@
+package cli
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"movinglake.com/haven/handler"
+)
+
+// RunBundle implements `haven bundle export` and `haven bundle import`, the command line
+// equivalents of /api/v1/export and /api/v1/import.
+func RunBundle(args []string, env Env) int {
+	if len(args) == 0 {
+		fmt.Fprintln(env.Stderr, "usage: haven bundle export|import [flags]")
+		return 2
+	}
+	switch args[0] {
+	case "export":
+		return runBundleExport(args[1:], env)
+	case "import":
+		return runBundleImport(args[1:], env)
+	}
+	fmt.Fprintf(env.Stderr, "unknown bundle command %q, available commands: export, import\n", args[0])
+	return 2
+}
+
+// writeBundle writes the bundle as JSON to the file, gzipped if its name ends in ".gz", or to
+// stdout if the name is empty.
+func writeBundle(bundle *handler.Bundle, path string, env Env) error {
+	if path == "" {
+		return encodeBundle(bundle, env.Stdout)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(path, ".gz") {
+		err = gzipBundle(bundle, f)
+	} else {
+		err = encodeBundle(bundle, f)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func encodeBundle(bundle *handler.Bundle, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(bundle)
+}
+
+// gzipBundle writes the bundle gzipped. Most of it is only written when the gzip writer is
+// closed, together with the trailer, so the errors of Close are returned too.
+func gzipBundle(bundle *handler.Bundle, w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	if err := encodeBundle(bundle, gz); err != nil {
+		gz.Close()
+		return err
+	}
+	return gz.Close()
+}
+
+func runBundleExport(args []string, env Env) int {
+	flags := flag.NewFlagSet("bundle export", flag.ContinueOnError)
+	flags.SetOutput(env.Stderr)
+	withPayloads := flags.Bool("reference-payloads", false, "include the reference payloads of the versions")
+	out := flags.String("o", "", "file to write the bundle to, gzipped if it ends in .gz (default stdout)")
+	namespace := namespaceFlag(flags)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if !validNamespace(env, *namespace) {
+		return 2
+	}
+	db, err := env.ConnectDB()
+	if err != nil {
+		fmt.Fprintf(env.Stderr, "failed to connect to db: %v\n", err)
+		return 1
+	}
+	bundle, err := handler.NewHavenAPIHandler(db, nil).InNamespace(*namespace).ExportBundle(*withPayloads)
+	if err != nil {
+		fmt.Fprintf(env.Stderr, "failed to export bundle: %v\n", err)
+		return 1
+	}
+	if err := writeBundle(bundle, *out, env); err != nil {
+		fmt.Fprintf(env.Stderr, "failed to write bundle: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(env.Stderr, "exported %d resources\n", len(bundle.Resources))
+	return 0
+}
+
+func runBundleImport(args []string, env Env) int {
+	flags := flag.NewFlagSet("bundle import", flag.ContinueOnError)
+	flags.SetOutput(env.Stderr)
+	mode := flags.String("mode", handler.ImportModeMerge, "import mode: merge, replace or dry-run")
+	namespace := namespaceFlag(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(env.Stderr, "usage: haven bundle import [-mode merge|replace|dry-run] [-namespace name] <bundle file>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	if !validNamespace(env, *namespace) {
+		return 2
+	}
+	r, err := openFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(env.Stderr, "failed to open bundle: %v\n", err)
+		return 1
+	}
+	defer r.Close()
+	var bundle handler.Bundle
+	if err := json.NewDecoder(r).Decode(&bundle); err != nil {
+		fmt.Fprintf(env.Stderr, "failed to parse bundle: %v\n", err)
+		return 1
+	}
+	db, err := env.ConnectDB()
+	if err != nil {
+		fmt.Fprintf(env.Stderr, "failed to connect to db: %v\n", err)
+		return 1
+	}
+	results, err := handler.NewHavenAPIHandler(db, nil).InNamespace(*namespace).ImportBundle(&bundle, *mode)
+	if err != nil {
+		fmt.Fprintf(env.Stderr, "failed to import bundle: %v\n", err)
+		return 1
+	}
+	conflicts := 0
+	for _, r := range results {
+		fmt.Fprintf(env.Stdout, "%s: %s\n", r.Resource, r.Action)
+		for _, c := range r.Changes {
+			fmt.Fprintf(env.Stdout, "  %s\n", c)
+		}
+		if r.Action == handler.ImportActionConflict {
+			conflicts++
+		}
+	}
+	if conflicts > 0 {
+		fmt.Fprintf(env.Stderr, "%d conflicting resources were not imported\n", conflicts)
+		return 1
+	}
+	return 0
+}
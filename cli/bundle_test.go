@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"movinglake.com/haven/handler"
+	"movinglake.com/haven/wrappers"
+)
+
+func TestRunBundle(t *testing.T) {
+	dir := t.TempDir()
+	bundle := filepath.Join(dir, "bundle.json.gz")
+
+	source := wrappers.NewTestDB().(*wrappers.TestDB)
+	env, _, stderr := testEnv(source)
+	payloads := writeFile(t, dir, "users.ndjson", "{\"name\": \"Juan\"}\n{\"name\": \"Ana\", \"age\": 30}\n")
+	assert.Equal(t, 0, RunImport([]string{payloads}, env), stderr.String())
+
+	env, _, stderr = testEnv(source)
+	assert.Equal(t, 0, RunBundle([]string{"export", "-reference-payloads", "-o", bundle}, env), stderr.String())
+	assert.Contains(t, stderr.String(), "exported 1 resources")
+
+	target := wrappers.NewTestDB().(*wrappers.TestDB)
+	env, stdout, stderr := testEnv(target)
+	assert.Equal(t, 0, RunBundle([]string{"import", bundle}, env), stderr.String())
+	assert.Equal(t, "users: created\n", stdout.String())
+	assert.Equal(t, source.Resource["users"].Schema, target.Resource["users"].Schema)
+	assert.Equal(t, 2, len(target.ResourceVersions))
+	assert.Equal(t, 2, len(target.ReferencePayloads))
+
+	// Conflicts fail the merge and are listed.
+	target.Save(&wrappers.Resource{Name: "users", Schema: `{"type": "object"}`, Version: 3}, nil)
+	env, stdout, stderr = testEnv(target)
+	assert.Equal(t, 1, RunBundle([]string{"import", bundle}, env))
+	assert.Contains(t, stdout.String(), "users: conflict\n  + /$id:")
+	assert.Contains(t, stderr.String(), "1 conflicting resources were not imported")
+
+	env, stdout, _ = testEnv(target)
+	assert.Equal(t, 0, RunBundle([]string{"import", "-mode", "replace", bundle}, env))
+	assert.Contains(t, stdout.String(), "users: replaced\n")
+	assert.Equal(t, uint(4), target.Resource["users"].Version)
+
+	// Bundles move the resources of a namespace.
+	env, _, stderr = testEnv(target)
+	assert.Equal(t, 0, RunBundle([]string{"import", "-namespace", "team", bundle}, env), stderr.String())
+	assert.Equal(t, source.Resource["users"].Schema, target.Resource["team:users"].Schema)
+	env, stdout, _ = testEnv(target)
+	assert.Equal(t, 0, RunBundle([]string{"export", "-namespace", "team"}, env))
+	assert.Contains(t, stdout.String(), `"name": "users"`)
+	assert.Contains(t, stdout.String(), `"version": 2`)
+	assert.NotContains(t, stdout.String(), `"version": 4`)
+
+	// Without -o the bundle goes to stdout.
+	env, stdout, _ = testEnv(target)
+	assert.Equal(t, 0, RunBundle([]string{"export"}, env))
+	assert.Contains(t, stdout.String(), `"format_version": 1`)
+}
+
+func TestRunBundleErrors(t *testing.T) {
+	dir := t.TempDir()
+	bundle := writeFile(t, dir, "bundle.json", `{"format_version": 1, "resources": []}`)
+	bad := writeFile(t, dir, "bad.json", `{"format_version": `)
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	cases := []struct {
+		name     string
+		args     []string
+		dbErrors map[string]error
+		connErr  error
+		wantCode int
+	}{
+		{name: "no command", wantCode: 2},
+		{name: "unknown command", args: []string{"sync"}, wantCode: 2},
+		{name: "import without file", args: []string{"import"}, wantCode: 2},
+		{name: "export unknown flag", args: []string{"export", "-nope"}, wantCode: 2},
+		{name: "import unknown flag", args: []string{"import", "-nope", bundle}, wantCode: 2},
+		{name: "missing file", args: []string{"import", filepath.Join(dir, "missing.json")}, wantCode: 1},
+		{name: "bad bundle", args: []string{"import", bad}, wantCode: 1},
+		{name: "unknown mode", args: []string{"import", "-mode", "overwrite", bundle}, wantCode: 1},
+		{name: "import invalid namespace", args: []string{"import", "-namespace", "a b", bundle}, wantCode: 2},
+		{name: "export invalid namespace", args: []string{"export", "-namespace", "a b"}, wantCode: 2},
+		{name: "import db connection fails", args: []string{"import", bundle}, connErr: gorm.ErrInvalidDB, wantCode: 1},
+		{name: "export db connection fails", args: []string{"export"}, connErr: gorm.ErrInvalidDB, wantCode: 1},
+		{name: "export db fails", args: []string{"export"}, dbErrors: map[string]error{"GetAllResources": gorm.ErrInvalidDB}, wantCode: 1},
+		{name: "export to missing dir", args: []string{"export", "-o", filepath.Join(dir, "missing", "b.json")}, wantCode: 1},
+		{name: "ok", args: []string{"import", bundle}, wantCode: 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db.Errors = tc.dbErrors
+			env, _, _ := testEnv(db)
+			env.ConnectDB = func() (wrappers.DB, error) { return db, tc.connErr }
+			assert.Equal(t, tc.wantCode, RunBundle(tc.args, env))
+		})
+	}
+}
+
+// shortWriter fails once more than n bytes are written.
+type shortWriter struct {
+	n int
+}
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		return 0, errors.New("no space left on device")
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestGzipBundle(t *testing.T) {
+	bundle := &handler.Bundle{FormatVersion: handler.BundleFormatVersion}
+	assert.NoError(t, gzipBundle(bundle, &shortWriter{n: 1 << 10}))
+	// Only the gzip header fits, the rest fails when the writer is closed.
+	assert.Error(t, gzipBundle(bundle, &shortWriter{n: 10}))
+}
@@ -0,0 +1,187 @@
+// Package cli implements the haven subcommands that run alongside the server.
+package cli
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"movinglake.com/haven/handler"
+	"movinglake.com/haven/handler/jsonutils"
+	"movinglake.com/haven/wrappers"
+)
+
+// Env is the environment a command runs in.
+type Env struct {
+	Stdout io.Writer
+	Stderr io.Writer
+	// ConnectDB opens the Haven DB. Commands only call it when they need the DB.
+	ConnectDB func() (wrappers.DB, error)
+}
+
+// namespaceFlag adds the -namespace flag of the commands working on the resources in the DB.
+func namespaceFlag(flags *flag.FlagSet) *string {
+	return flags.String("namespace", wrappers.DefaultNamespace, "namespace of the resources")
+}
+
+// validNamespace reports an invalid -namespace value.
+func validNamespace(env Env, namespace string) bool {
+	if handler.ValidNamespace(namespace) {
+		return true
+	}
+	fmt.Fprintf(env.Stderr, "invalid namespace %q\n", namespace)
+	return false
+}
+
+// payloadExtensions are the extensions of the files read from directories. Any of them may be
+// followed by ".gz".
+var payloadExtensions = []string{".json", ".ndjson", ".jsonl"}
+
+// inputFile is a file of payloads found under the command arguments.
+type inputFile struct {
+	path string
+	// rel is the path relative to the directory argument it was found in, or the file name
+	// for file arguments.
+	rel string
+}
+
+// trimPayloadExt removes the ".gz" and payload extensions from the file name.
+func trimPayloadExt(name string) string {
+	name = strings.TrimSuffix(name, ".gz")
+	for _, ext := range payloadExtensions {
+		if strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+	return name
+}
+
+func isPayloadFile(name string) bool {
+	return trimPayloadExt(name) != strings.TrimSuffix(name, ".gz")
+}
+
+// collectFiles lists the files named by the arguments. Directories are walked recursively for
+// files with payload extensions.
+func collectFiles(args []string) ([]inputFile, error) {
+	var files []inputFile
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, inputFile{path: arg, rel: filepath.Base(arg)})
+			continue
+		}
+		var found []inputFile
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || !isPayloadFile(d.Name()) {
+				return nil
+			}
+			rel, err := filepath.Rel(arg, path)
+			if err != nil {
+				return err
+			}
+			found = append(found, inputFile{path: path, rel: filepath.ToSlash(rel)})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(found, func(i, j int) bool { return found[i].path < found[j].path })
+		files = append(files, found...)
+	}
+	return files, nil
+}
+
+// gzipFile closes both the gzip reader and the underlying file.
+type gzipFile struct {
+	*gzip.Reader
+	f *os.File
+}
+
+func (g *gzipFile) Close() error {
+	g.Reader.Close()
+	return g.f.Close()
+}
+
+// openFile opens the file, decompressing it if its name ends in ".gz".
+func openFile(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return f, nil
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to decompress %s: %w", path, err)
+	}
+	return &gzipFile{Reader: gz, f: f}, nil
+}
+
+// readPayloads calls fn with every JSON value of the file and its position in the file. Files may hold a single JSON
+// document or newline delimited JSON, and are decompressed if their name ends in ".gz".
+func readPayloads(path string, fn func(index int, payload any) error) error {
+	r, err := openFile(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	dec := json.NewDecoder(r)
+	for i := 0; ; i++ {
+		var payload any
+		if err := dec.Decode(&payload); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to parse payload %d of %s: %w", i, path, err)
+		}
+		if err := fn(i, payload); err != nil {
+			return err
+		}
+	}
+}
+
+// resourceName expands the path template for the file. The template may contain {base}, the
+// file name without extensions, {dir}, the name of the directory of the file, and {path}, the
+// path of the file without extensions relative to the imported directory.
+func resourceName(template string, f inputFile) string {
+	rel := trimPayloadExt(f.rel)
+	dir := path.Base(path.Dir(f.rel))
+	if dir == "." {
+		dir = ""
+	}
+	return strings.NewReplacer(
+		"{base}", path.Base(rel),
+		"{dir}", dir,
+		"{path}", rel,
+	).Replace(template)
+}
+
+// payloadResource returns the string at the field of the payload, or fileName if the field is
+// not set or not found.
+func payloadResource(fileName, field string, payload any) string {
+	if field == "" {
+		return fileName
+	}
+	if v, ok := jsonutils.ValueAtPath(payload, field); ok {
+		if s, ok := v.(string); ok && s != "" {
+			return s
+		}
+	}
+	return fileName
+}
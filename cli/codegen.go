@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"movinglake.com/haven/handler"
+	"movinglake.com/haven/handler/schemaconv"
+)
+
+// RunCodegen implements `haven codegen`. It writes the Go or TypeScript types of the
+// resources, read from the DB or from a schema export directory, to a single file.
+func RunCodegen(args []string, env Env) int {
+	flags := flag.NewFlagSet("codegen", flag.ContinueOnError)
+	flags.SetOutput(env.Stderr)
+	lang := flags.String("lang", handler.LangGo, "language of the types, go or typescript")
+	pkg := flags.String("package", handler.DefaultGoPackage, "package of the Go code")
+	schemas := flags.String("schemas", "", "directory of <resource>.schema.json files to read instead of the DB")
+	out := flags.String("o", "", "file to write the code to (default stdout)")
+	namespace := namespaceFlag(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(env.Stderr, "usage: haven codegen [flags] <resource>...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	if !validNamespace(env, *namespace) {
+		return 2
+	}
+
+	var list []schemaconv.Schema
+	if *schemas != "" {
+		load := dirSchemaLoader(*schemas)
+		for _, name := range flags.Args() {
+			schema, err := load(name)
+			if err != nil {
+				fmt.Fprintf(env.Stderr, "failed to load schema: %v\n", err)
+				return 1
+			}
+			if schema == nil {
+				fmt.Fprintf(env.Stderr, "resource not found: %s\n", name)
+				return 1
+			}
+			list = append(list, schemaconv.Schema{Resource: name, Schema: schema})
+		}
+	} else {
+		db, err := env.ConnectDB()
+		if err != nil {
+			fmt.Fprintf(env.Stderr, "failed to connect to db: %v\n", err)
+			return 1
+		}
+		h := handler.NewHavenAPIHandler(db, nil).InNamespace(*namespace)
+		for _, name := range flags.Args() {
+			schema, err := h.ResourceSchema(name)
+			if err != nil {
+				fmt.Fprintf(env.Stderr, "failed to load schema: %v\n", err)
+				return 1
+			}
+			list = append(list, *schema)
+		}
+	}
+
+	code, err := handler.GenerateCode(*lang, *pkg, list)
+	if err != nil {
+		fmt.Fprintf(env.Stderr, "failed to generate code: %v\n", err)
+		return 1
+	}
+	if *out == "" {
+		env.Stdout.Write(code)
+		return 0
+	}
+	if err := os.WriteFile(*out, code, 0o644); err != nil {
+		fmt.Fprintf(env.Stderr, "failed to write code: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"movinglake.com/haven/handler/jsonutils"
+	"movinglake.com/haven/wrappers"
+)
+
+func TestRunCodegen(t *testing.T) {
+	dir := t.TempDir()
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	db.Save(&wrappers.Resource{Model: gorm.Model{ID: 1}, Name: "users", Schema: usersSchema, Version: 4}, nil)
+
+	env, stdout, stderr := testEnv(db)
+	assert.Equal(t, 0, RunCodegen([]string{"-lang", "typescript", "users"}, env), stderr.String())
+	assert.Contains(t, stdout.String(), "//   users version 4\n")
+	assert.Contains(t, stdout.String(), "export interface Users {\n  age: number;\n  name: string;\n}\n")
+
+	// Schema directories need no DB.
+	schemas := filepath.Join(dir, "schemas")
+	writeFile(t, schemas, jsonutils.SchemaFileName("/api/v1/users"), usersSchema)
+	writeFile(t, schemas, "pets.schema.json", `{"type": "object", "properties": {"name": {"type": "string"}}}`)
+	out := filepath.Join(dir, "models.go")
+	env, _, stderr = testEnv(nil)
+	args := []string{"-schemas", schemas, "-package", "api", "-o", out, "/api/v1/users", "pets"}
+	assert.Equal(t, 0, RunCodegen(args, env), stderr.String())
+	code, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, string(code), "//   /api/v1/users\n//   pets\n\npackage api\n")
+	assert.Contains(t, string(code), "type APIV1Users struct {")
+	assert.Contains(t, string(code), "type Pets struct {\n\tName *string `json:\"name,omitempty\"`\n}")
+}
+
+func TestRunCodegenErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "bad.schema.json", "not json")
+	writeFile(t, dir, "date.schema.json", `{"type": "date"}`)
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	db.Save(&wrappers.Resource{Model: gorm.Model{ID: 1}, Name: "users", Schema: usersSchema, Version: 1}, nil)
+	cases := []struct {
+		name     string
+		args     []string
+		dbErrors map[string]error
+		connErr  error
+		wantCode int
+	}{
+		{name: "no resources", wantCode: 2},
+		{name: "unknown flag", args: []string{"-nope", "users"}, wantCode: 2},
+		{name: "unknown language", args: []string{"-lang", "rust", "users"}, wantCode: 1},
+		{name: "bad package", args: []string{"-package", "a-b", "users"}, wantCode: 1},
+		{name: "missing resource", args: []string{"pets"}, wantCode: 1},
+		{name: "missing file", args: []string{"-schemas", dir, "pets"}, wantCode: 1},
+		{name: "bad file", args: []string{"-schemas", dir, "bad"}, wantCode: 1},
+		{name: "unsupported schema", args: []string{"-schemas", dir, "date"}, wantCode: 1},
+		{name: "db connection fails", args: []string{"users"}, connErr: gorm.ErrInvalidDB, wantCode: 1},
+		{name: "db read fails", args: []string{"users"}, dbErrors: map[string]error{"GetResource": gorm.ErrInvalidDB}, wantCode: 1},
+		{name: "bad output", args: []string{"-o", filepath.Join(dir, "missing", "models.go"), "users"}, wantCode: 1},
+		{name: "ok", args: []string{"users"}, wantCode: 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db.Errors = tc.dbErrors
+			env, _, _ := testEnv(db)
+			env.ConnectDB = func() (wrappers.DB, error) { return db, tc.connErr }
+			assert.Equal(t, tc.wantCode, RunCodegen(tc.args, env))
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sort"
+
+	"movinglake.com/haven/handler"
+	"movinglake.com/haven/handler/jsonutils"
+	"movinglake.com/haven/wrappers"
+)
+
+// applier applies payloads to the schema of a resource.
+type applier interface {
+	AddPayload(resource string, payload any) error
+}
+
+// dryRunApplier applies payloads to in-memory copies of the schemas.
+type dryRunApplier struct {
+	// db holds the starting schemas. It is nil when running offline.
+	db      wrappers.DB
+	initial map[string]map[string]any
+	schemas map[string]map[string]any
+}
+
+func newDryRunApplier(db wrappers.DB) *dryRunApplier {
+	return &dryRunApplier{
+		db:      db,
+		initial: make(map[string]map[string]any),
+		schemas: make(map[string]map[string]any),
+	}
+}
+
+// load returns the current schema of the resource, reading it from the DB the first time.
+func (d *dryRunApplier) load(resource string) (map[string]any, error) {
+	if schema, ok := d.schemas[resource]; ok {
+		return schema, nil
+	}
+	raw := "{}"
+	if d.db != nil {
+		r, err := d.db.GetResource(resource, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get resource from db: %v", err)
+		}
+		if r != nil && r.Schema != "" {
+			raw = r.Schema
+		}
+	}
+	// ApplyPayload changes the schema in place, so keep a separate copy of the initial schema.
+	initial := make(map[string]any)
+	schema := make(map[string]any)
+	if err := json.Unmarshal([]byte(raw), &initial); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal schema: %v", err)
+	}
+	json.Unmarshal([]byte(raw), &schema)
+	d.initial[resource] = initial
+	d.schemas[resource] = schema
+	return schema, nil
+}
+
+func (d *dryRunApplier) AddPayload(resource string, payload any) error {
+	schema, err := d.load(resource)
+	if err != nil {
+		return err
+	}
+	newSchema, err := jsonutils.ApplyPayload(schema, payload, resource)
+	if err != nil {
+		return fmt.Errorf("failed to apply payload: %v", err)
+	}
+	if newSchema == nil {
+		return nil
+	}
+	// Round trip the schema through JSON like the server does when saving it, so that later
+	// payloads expand the same schema the server would.
+	b, err := json.Marshal(newSchema)
+	if err != nil {
+		return fmt.Errorf("failed to marshal new schema: %v", err)
+	}
+	schema = make(map[string]any)
+	if err := json.Unmarshal(b, &schema); err != nil {
+		return fmt.Errorf("failed to unmarshal new schema: %v", err)
+	}
+	d.schemas[resource] = schema
+	return nil
+}
+
+// printDiffs prints the changes to the schema of every resource.
+func (d *dryRunApplier) printDiffs(env Env) {
+	names := make([]string, 0, len(d.schemas))
+	for name := range d.schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		changes := jsonutils.DiffSchemas(d.initial[name], d.schemas[name])
+		switch {
+		case len(d.initial[name]) == 0:
+			fmt.Fprintf(env.Stdout, "resource %s: new\n", name)
+		case len(changes) == 0:
+			fmt.Fprintf(env.Stdout, "resource %s: no changes\n", name)
+			continue
+		default:
+			fmt.Fprintf(env.Stdout, "resource %s: %d changes\n", name, len(changes))
+		}
+		for _, c := range changes {
+			fmt.Fprintf(env.Stdout, "  %s\n", c)
+		}
+	}
+}
+
+// RunImport implements `haven import`. It applies the payloads of JSON, NDJSON and gzipped
+// NDJSON files to the schemas of their resources and returns the exit code.
+func RunImport(args []string, env Env) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.SetOutput(env.Stderr)
+	template := flags.String("template", "{base}", "resource name template, using {base}, {dir} and {path} of each file")
+	field := flags.String("field", "", "dot separated payload field holding the resource name, falling back to -template")
+	dryRun := flags.Bool("dry-run", false, "print the schema changes without saving them")
+	offline := flags.Bool("offline", false, "with -dry-run, start from empty schemas instead of the DB")
+	every := flags.Int("progress", 1000, "report progress every n payloads")
+	namespace := namespaceFlag(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(env.Stderr, "usage: haven import [flags] <file or directory>...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	if *offline && !*dryRun {
+		fmt.Fprintln(env.Stderr, "-offline requires -dry-run")
+		return 2
+	}
+	if !validNamespace(env, *namespace) {
+		return 2
+	}
+
+	files, err := collectFiles(flags.Args())
+	if err != nil {
+		fmt.Fprintf(env.Stderr, "failed to list files: %v\n", err)
+		return 1
+	}
+
+	var db wrappers.DB
+	var app applier
+	if !*offline {
+		global, err := env.ConnectDB()
+		if err != nil {
+			fmt.Fprintf(env.Stderr, "failed to connect to db: %v\n", err)
+			return 1
+		}
+		db = global.WithNamespace(*namespace)
+		app = handler.NewHavenAPIHandler(global, nil).InNamespace(*namespace)
+	}
+	var dryRunApp *dryRunApplier
+	if *dryRun {
+		dryRunApp = newDryRunApplier(db)
+		app = dryRunApp
+	}
+
+	var imported, failed int
+	counts := make(map[string]int)
+	for i, f := range files {
+		fileName := resourceName(*template, f)
+		err := readPayloads(f.path, func(_ int, payload any) error {
+			name := payloadResource(fileName, *field, payload)
+			if err := app.AddPayload(name, payload); err != nil {
+				failed++
+				fmt.Fprintf(env.Stderr, "%s: failed to import payload into %s: %v\n", f.path, name, err)
+				return nil
+			}
+			imported++
+			counts[name]++
+			if *every > 0 && imported%*every == 0 {
+				fmt.Fprintf(env.Stderr, "imported %d payloads (file %d/%d)\n", imported, i+1, len(files))
+			}
+			return nil
+		})
+		if err != nil {
+			failed++
+			fmt.Fprintf(env.Stderr, "%v\n", err)
+		}
+	}
+	fmt.Fprintf(env.Stderr, "imported %d payloads from %d files into %d resources, %d failures\n", imported, len(files), len(counts), failed)
+
+	if *dryRun {
+		dryRunApp.printDiffs(env)
+	} else {
+		names := make([]string, 0, len(counts))
+		for name := range counts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			r, err := db.GetResource(name, nil)
+			if err != nil || r == nil {
+				continue
+			}
+			fmt.Fprintf(env.Stdout, "resource %s: %d payloads, version %d\n", name, counts[name], r.Version)
+		}
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,165 @@
+package cli
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"movinglake.com/haven/wrappers"
+)
+
+// writeFile writes the content to dir/name, compressing it if the name ends in ".gz".
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	data := []byte(content)
+	if strings.HasSuffix(name, ".gz") {
+		var b bytes.Buffer
+		gz := gzip.NewWriter(&b)
+		gz.Write(data)
+		gz.Close()
+		data = b.Bytes()
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func testEnv(db wrappers.DB) (Env, *bytes.Buffer, *bytes.Buffer) {
+	var stdout, stderr bytes.Buffer
+	return Env{
+		Stdout:    &stdout,
+		Stderr:    &stderr,
+		ConnectDB: func() (wrappers.DB, error) { return db, nil },
+	}, &stdout, &stderr
+}
+
+func TestResourceName(t *testing.T) {
+	f := inputFile{path: "/data/exports/orders/2024-01.ndjson.gz", rel: "orders/2024-01.ndjson.gz"}
+	cases := map[string]string{
+		"{base}":        "2024-01",
+		"{dir}":         "orders",
+		"{path}":        "orders/2024-01",
+		"/api/v1/{dir}": "/api/v1/orders",
+	}
+	for template, want := range cases {
+		assert.Equal(t, want, resourceName(template, f), template)
+	}
+	assert.Equal(t, "", resourceName("{dir}", inputFile{rel: "users.json"}))
+}
+
+func TestRunImport(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "users/a.json", `{"name": "Juan", "age": 35}`)
+	writeFile(t, dir, "users/b.ndjson", "{\"name\": \"Ana\"}\n{\"name\": \"Eva\", \"email\": \"eva@example.com\"}\n")
+	writeFile(t, dir, "orders/c.ndjson.gz", "{\"id\": 1}\n{\"id\": 2, \"total\": 3.5}\n")
+	writeFile(t, dir, "notes.txt", "not a payload")
+
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	env, stdout, stderr := testEnv(db)
+	code := RunImport([]string{"-template", "{dir}", "-progress", "2", dir}, env)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Contains(t, stderr.String(), "imported 2 payloads (file 1/3)")
+	assert.Contains(t, stderr.String(), "imported 5 payloads from 3 files into 2 resources, 0 failures")
+	assert.Equal(t, "resource orders: 2 payloads, version 2\nresource users: 3 payloads, version 3\n", stdout.String())
+	assert.Contains(t, db.Resource["users"].Schema, "email")
+	assert.Equal(t, 5, len(db.ResourceVersions))
+
+	// Other namespaces keep their own resources.
+	env, stdout, stderr = testEnv(db)
+	code = RunImport([]string{"-template", "{dir}", "-namespace", "team", dir}, env)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Equal(t, "resource orders: 2 payloads, version 2\nresource users: 3 payloads, version 3\n", stdout.String())
+	assert.Equal(t, "team", db.Resource["team:users"].Namespace)
+	assert.Equal(t, uint(3), db.Resource["users"].Version)
+}
+
+func TestRunImportField(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "events.ndjson", "{\"type\": \"click\", \"x\": 1}\n{\"type\": \"view\"}\n{\"other\": true}\n")
+
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	env, _, stderr := testEnv(db)
+	assert.Equal(t, 0, RunImport([]string{"-field", "type", path}, env), stderr.String())
+	for _, name := range []string{"click", "view", "events"} {
+		if _, ok := db.Resource[name]; !ok {
+			t.Errorf("resource %s was not imported", name)
+		}
+	}
+}
+
+func TestRunImportDryRun(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "users.ndjson", "{\"name\": \"Juan\", \"age\": 35}\n{\"name\": \"Ana\"}\n")
+
+	// Offline the schemas start empty.
+	env, stdout, stderr := testEnv(nil)
+	env.ConnectDB = func() (wrappers.DB, error) {
+		t.Fatal("dry run offline connected to the DB")
+		return nil, nil
+	}
+	assert.Equal(t, 0, RunImport([]string{"-dry-run", "-offline", path}, env), stderr.String())
+	assert.Contains(t, stdout.String(), "resource users: new\n")
+	assert.Contains(t, stdout.String(), `+ /properties: {"age":{"type":"number"},"name":{"type":"string"}}`)
+
+	// Otherwise they start from the DB, which is left untouched.
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	schema := `{"type": "object", "additionalProperties": false, "required": ["name"], "properties": {"name": {"type": "string"}}}`
+	db.Save(&wrappers.Resource{Model: gorm.Model{ID: 1}, Name: "users", Schema: schema, Version: 1}, nil)
+	env, stdout, stderr = testEnv(db)
+	assert.Equal(t, 0, RunImport([]string{"-dry-run", path}, env), stderr.String())
+	assert.Equal(t, "resource users: 1 changes\n  + /properties/age: {\"type\":\"number\"}\n", stdout.String())
+	assert.Equal(t, schema, db.Resource["users"].Schema)
+	assert.Equal(t, uint(1), db.Resource["users"].Version)
+
+	// No changes.
+	writeFile(t, dir, "users.ndjson", "{\"name\": \"Juan\"}\n")
+	env, stdout, _ = testEnv(db)
+	assert.Equal(t, 0, RunImport([]string{"-dry-run", path}, env))
+	assert.Equal(t, "resource users: no changes\n", stdout.String())
+}
+
+func TestRunImportErrors(t *testing.T) {
+	dir := t.TempDir()
+	good := writeFile(t, dir, "users.ndjson", "{\"name\": \"Juan\"}\n")
+	bad := writeFile(t, dir, "bad.json", "{\"name\": ")
+	badGz := writeFile(t, dir, "bad.ndjson.gz", "")
+	os.WriteFile(badGz, []byte("not gzip"), 0o644)
+
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	cases := []struct {
+		name     string
+		args     []string
+		dbErrors map[string]error
+		connErr  error
+		wantCode int
+	}{
+		{name: "no arguments", wantCode: 2},
+		{name: "unknown flag", args: []string{"-nope", good}, wantCode: 2},
+		{name: "offline without dry run", args: []string{"-offline", good}, wantCode: 2},
+		{name: "invalid namespace", args: []string{"-namespace", "Team", good}, wantCode: 2},
+		{name: "missing file", args: []string{filepath.Join(dir, "missing.json")}, wantCode: 1},
+		{name: "bad json", args: []string{bad}, wantCode: 1},
+		{name: "bad gzip", args: []string{badGz}, wantCode: 1},
+		{name: "db connection fails", args: []string{good}, connErr: gorm.ErrInvalidDB, wantCode: 1},
+		{name: "db save fails", args: []string{good}, dbErrors: map[string]error{"Save": gorm.ErrInvalidDB}, wantCode: 1},
+		{name: "ok", args: []string{good}, wantCode: 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db.Errors = tc.dbErrors
+			env, _, _ := testEnv(db)
+			env.ConnectDB = func() (wrappers.DB, error) { return db, tc.connErr }
+			assert.Equal(t, tc.wantCode, RunImport(tc.args, env))
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"movinglake.com/haven/handler"
+	"movinglake.com/haven/handler/schemaconv"
+)
+
+// schemaExtensions are the extensions of the schema documents read from directories.
+var schemaExtensions = []string{".json", ".yaml", ".yml"}
+
+// mappingFlag collects repeated -map "operation=resource" flags.
+type mappingFlag map[string]string
+
+func (m mappingFlag) String() string {
+	return fmt.Sprint(map[string]string(m))
+}
+
+func (m mappingFlag) Set(v string) error {
+	i := strings.LastIndex(v, "=")
+	if i < 1 {
+		return fmt.Errorf("mapping %q is not operation=resource", v)
+	}
+	m[v[:i]] = v[i+1:]
+	return nil
+}
+
+// readDocument reads a JSON or YAML document.
+func readDocument(path string) (any, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	ext := filepath.Ext(path)
+	if ext != ".yaml" && ext != ".yml" {
+		if err := json.Unmarshal(b, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+		return doc, nil
+	}
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	// Round trip through JSON so numbers and maps have the same types as JSON documents.
+	if b, err = json.Marshal(doc); err != nil {
+		return nil, fmt.Errorf("failed to convert %s to JSON: %v", path, err)
+	}
+	doc = nil
+	return doc, json.Unmarshal(b, &doc)
+}
+
+// schemaFiles lists the schema documents named by the arguments, walking directories.
+func schemaFiles(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		err := filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			for _, ext := range schemaExtensions {
+				if path == arg || strings.HasSuffix(d.Name(), ext) {
+					abs, err := filepath.Abs(path)
+					if err != nil {
+						return err
+					}
+					files = append(files, filepath.ToSlash(abs))
+					return nil
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// RunImportSchemas implements `haven import-schemas`, the command line equivalent of
+// /api/v1/import_schemas. It creates resources from the responses of an OpenAPI document or
+// from JSON Schema files.
+func RunImportSchemas(args []string, env Env) int {
+	flags := flag.NewFlagSet("import-schemas", flag.ContinueOnError)
+	flags.SetOutput(env.Stderr)
+	template := flags.String("template", schemaconv.DefaultTemplate, "OpenAPI resource name template, using {path}, {method}, {status} and {operationId}")
+	mapping := mappingFlag{}
+	flags.Var(mapping, "map", `OpenAPI response to resource mapping, e.g. "createPet=pets" or "POST /pets 201=pets" (repeatable, an empty name skips the response)`)
+	refs := flags.String("refs", "", "directory of JSON Schema documents referenced by the imported ones")
+	dryRun := flags.Bool("dry-run", false, "report the resources that would be created without creating them")
+	namespace := namespaceFlag(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(env.Stderr, "usage: haven import-schemas [flags] <openapi document | JSON Schema files or directories>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	if !validNamespace(env, *namespace) {
+		return 2
+	}
+
+	files, err := schemaFiles(flags.Args())
+	if err != nil {
+		fmt.Fprintf(env.Stderr, "failed to list files: %v\n", err)
+		return 1
+	}
+	if len(files) == 0 {
+		fmt.Fprintf(env.Stderr, "no schema files found in %s\n", strings.Join(flags.Args(), ", "))
+		flags.Usage()
+		return 2
+	}
+	docs := schemaconv.Documents{}
+	for _, f := range files {
+		if docs[f], err = readDocument(f); err != nil {
+			fmt.Fprintln(env.Stderr, err)
+			return 1
+		}
+	}
+	request := handler.ImportSchemasRequest{Template: *template, Mapping: mapping, DryRun: *dryRun}
+	var openAPI map[string]any
+	if len(files) == 1 {
+		openAPI, _ = docs[files[0]].(map[string]any)
+	}
+	if openAPI != nil && openAPI["openapi"] != nil {
+		request.OpenAPI = openAPI
+	} else {
+		request.Resources = files
+		if *refs != "" {
+			referenced, err := schemaFiles([]string{*refs})
+			if err != nil {
+				fmt.Fprintf(env.Stderr, "failed to list files: %v\n", err)
+				return 1
+			}
+			for _, f := range referenced {
+				if _, ok := docs[f]; ok {
+					continue
+				}
+				if docs[f], err = readDocument(f); err != nil {
+					fmt.Fprintln(env.Stderr, err)
+					return 1
+				}
+			}
+		}
+		request.Schemas = docs
+	}
+	imported, err := handler.ReadSchemas(&request)
+	if err != nil {
+		fmt.Fprintf(env.Stderr, "failed to read schemas: %v\n", err)
+		return 1
+	}
+
+	db, err := env.ConnectDB()
+	if err != nil {
+		fmt.Fprintf(env.Stderr, "failed to connect to db: %v\n", err)
+		return 1
+	}
+	results, err := handler.NewHavenAPIHandler(db, nil).InNamespace(*namespace).ImportSchemas(imported, *dryRun)
+	for _, r := range results {
+		fmt.Fprintf(env.Stdout, "%s: %s (%s)\n", r.Resource, r.Action, r.Source)
+	}
+	if err != nil {
+		fmt.Fprintf(env.Stderr, "failed to import schemas: %v\n", err)
+		return 1
+	}
+	return 0
+}
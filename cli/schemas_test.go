@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"movinglake.com/haven/wrappers"
+)
+
+const petstoreYAML = `openapi: 3.0.3
+paths:
+  /pets:
+    get:
+      responses:
+        "200":
+          content:
+            application/json:
+              schema:
+                type: array
+                items:
+                  $ref: "#/components/schemas/Pet"
+    post:
+      operationId: createPet
+      responses:
+        "201":
+          content:
+            application/json:
+              schema:
+                $ref: "#/components/schemas/Pet"
+components:
+  schemas:
+    Pet:
+      type: object
+      required: [name]
+      properties:
+        name: {type: string, nullable: true}
+`
+
+func TestRunImportSchemas(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "petstore.yaml", petstoreYAML)
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+
+	env, stdout, stderr := testEnv(db)
+	args := []string{"-dry-run", "-map", "createPet=pet", filepath.Join(dir, "petstore.yaml")}
+	assert.Equal(t, 0, RunImportSchemas(args, env), stderr.String())
+	assert.Equal(t, "/pets: created (GET /pets 200)\npet: created (POST /pets 201)\n", stdout.String())
+	assert.Empty(t, db.Resource)
+
+	env, _, stderr = testEnv(db)
+	args = []string{"-map", "createPet=pet", filepath.Join(dir, "petstore.yaml")}
+	assert.Equal(t, 0, RunImportSchemas(args, env), stderr.String())
+	assert.Contains(t, db.Resource["pet"].Schema, `"name":{"type":["string","null"]}`)
+
+	// JSON Schema files with references to other documents.
+	schemas := filepath.Join(dir, "schemas")
+	writeFile(t, schemas, "users.schema.json", `{"type": "object", "properties": {"pet": {"$ref": "../defs/pet.json"}}}`)
+	writeFile(t, filepath.Join(dir, "defs"), "pet.json", `{"type": "object"}`)
+	env, stdout, stderr = testEnv(db)
+	args = []string{"-refs", filepath.Join(dir, "defs"), schemas}
+	assert.Equal(t, 0, RunImportSchemas(args, env), stderr.String())
+	assert.Contains(t, stdout.String(), "users: created (")
+	assert.Contains(t, db.Resource["users"].Schema, `"pet":{"type":"object"}`)
+
+	// Existing resources are left untouched.
+	env, stdout, stderr = testEnv(db)
+	assert.Equal(t, 0, RunImportSchemas(args, env), stderr.String())
+	assert.Contains(t, stdout.String(), "users: exists (")
+}
+
+func TestRunImportSchemasErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "bad.json", `{`)
+	writeFile(t, dir, "ref.json", `{"$ref": "missing.json"}`)
+	cases := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{name: "no arguments", want: 2},
+		{name: "no schema files", args: []string{t.TempDir()}, want: 2},
+		{name: "bad mapping", args: []string{"-map", "nope", dir}, want: 2},
+		{name: "missing file", args: []string{filepath.Join(dir, "missing.json")}, want: 1},
+		{name: "bad json", args: []string{filepath.Join(dir, "bad.json")}, want: 1},
+		{name: "bad ref", args: []string{filepath.Join(dir, "ref.json")}, want: 1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			env, _, _ := testEnv(wrappers.NewTestDB())
+			assert.Equal(t, tc.want, RunImportSchemas(tc.args, env))
+		})
+	}
+}
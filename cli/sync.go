@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"movinglake.com/haven/gitsync"
+	"movinglake.com/haven/handler"
+)
+
+// RunSync implements `haven sync import`, which sets the schemas changed in the git working
+// tree as new versions, like /api/v1/sync/import. The flags default to the SCHEMA_SYNC_*
+// variables used by the server.
+func RunSync(args []string, env Env) int {
+	if len(args) == 0 || args[0] != "import" {
+		fmt.Fprintln(env.Stderr, "usage: haven sync import [flags]")
+		return 2
+	}
+	flags := flag.NewFlagSet("sync import", flag.ContinueOnError)
+	flags.SetOutput(env.Stderr)
+	dir := flags.String("dir", os.Getenv("SCHEMA_SYNC_DIR"), "git working tree of the schemas")
+	remote := flags.String("remote", os.Getenv("SCHEMA_SYNC_REMOTE"), "git remote to pull from and push to")
+	branch := flags.String("branch", os.Getenv("SCHEMA_SYNC_BRANCH"), "git branch of the schemas (default main)")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if *dir == "" {
+		fmt.Fprintln(env.Stderr, "a working tree is required, set -dir or SCHEMA_SYNC_DIR")
+		return 2
+	}
+	db, err := env.ConnectDB()
+	if err != nil {
+		fmt.Fprintf(env.Stderr, "failed to connect to db: %v\n", err)
+		return 1
+	}
+	h := handler.NewHavenAPIHandler(db, nil)
+	syncer := gitsync.New(gitsync.Config{Dir: *dir, Remote: *remote, Branch: *branch}, h)
+	if err := syncer.Init(); err != nil {
+		fmt.Fprintf(env.Stderr, "failed to init working tree: %v\n", err)
+		return 1
+	}
+	h.OnVersion(syncer.VersionAdded)
+	updated, err := syncer.Import()
+	for _, name := range updated {
+		fmt.Fprintf(env.Stdout, "%s: updated\n", name)
+	}
+	if err != nil {
+		fmt.Fprintf(env.Stderr, "failed to import schemas: %v\n", err)
+		return 1
+	}
+	// Write the imported versions back before exiting.
+	if _, err := syncer.Flush(); err != nil {
+		fmt.Fprintf(env.Stderr, "failed to write imported schemas to the working tree: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(env.Stderr, "updated %d resources\n", len(updated))
+	return 0
+}
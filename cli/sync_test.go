@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"movinglake.com/haven/wrappers"
+)
+
+func TestRunSync(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "schemas")
+	writeFile(t, dir, "users.schema.json", usersSchema)
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+
+	env, stdout, stderr := testEnv(db)
+	assert.Equal(t, 0, RunSync([]string{"import", "-dir", dir}, env), stderr.String())
+	assert.Equal(t, "users: updated\n", stdout.String())
+	assert.Equal(t, uint(1), db.Resource["users"].Version)
+
+	// The imported schema is committed to the tree.
+	out, err := exec.Command("git", "-C", dir, "log", "--format=%s").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Set users schema to version 1\n", string(out))
+
+	env, stdout, _ = testEnv(db)
+	assert.Equal(t, 0, RunSync([]string{"import", "-dir", dir}, env))
+	assert.Equal(t, "", stdout.String())
+}
+
+func TestRunSyncErrors(t *testing.T) {
+	dir := t.TempDir()
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	writeFile(t, dir, "bad/users.schema.json", "not json")
+	cases := []struct {
+		name     string
+		args     []string
+		connErr  error
+		wantCode int
+	}{
+		{name: "no command", wantCode: 2},
+		{name: "unknown command", args: []string{"export"}, wantCode: 2},
+		{name: "unknown flag", args: []string{"import", "-nope"}, wantCode: 2},
+		{name: "no dir", args: []string{"import", "-dir", ""}, wantCode: 2},
+		{name: "db connection fails", args: []string{"import", "-dir", dir}, connErr: gorm.ErrInvalidDB, wantCode: 1},
+		{name: "bad remote", args: []string{"import", "-dir", filepath.Join(dir, "tree"), "-remote", filepath.Join(dir, "missing.git")}, wantCode: 1},
+		{name: "bad schema", args: []string{"import", "-dir", filepath.Join(dir, "bad")}, wantCode: 1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			env, _, _ := testEnv(db)
+			env.ConnectDB = func() (wrappers.DB, error) { return db, tc.connErr }
+			assert.Equal(t, tc.wantCode, RunSync(tc.args, env))
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/andres-movl/gojsonschema"
+	"movinglake.com/haven/handler"
+	"movinglake.com/haven/handler/jsonutils"
+	"movinglake.com/haven/wrappers"
+)
+
+// Output formats of `haven validate`.
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+// schemaLoader returns the schema of a resource, or nil if the resource has no schema.
+type schemaLoader func(resource string) (map[string]any, error)
+
+// dbSchemaLoader loads the schemas stored in the DB.
+func dbSchemaLoader(db wrappers.DB) schemaLoader {
+	return func(resource string) (map[string]any, error) {
+		r, err := db.GetResource(resource, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get resource from db: %v", err)
+		}
+		if r == nil {
+			return nil, nil
+		}
+		schema := make(map[string]any)
+		if err := json.Unmarshal([]byte(r.Schema), &schema); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal schema of %s: %v", resource, err)
+		}
+		return schema, nil
+	}
+}
+
+// dirSchemaLoader loads the schemas of a schema export directory, where the schema of every
+// resource is in a file named by jsonutils.SchemaFileName.
+func dirSchemaLoader(dir string) schemaLoader {
+	return func(resource string) (map[string]any, error) {
+		b, err := os.ReadFile(filepath.Join(dir, jsonutils.SchemaFileName(resource)))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		schema := make(map[string]any)
+		if err := json.Unmarshal(b, &schema); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal schema of %s: %v", resource, err)
+		}
+		return schema, nil
+	}
+}
+
+type compiledSchema struct {
+	schema   map[string]any
+	goSchema *gojsonschema.Schema
+}
+
+// validationResult is the outcome of validating a payload, printed as a JSON line with
+// -format json.
+type validationResult struct {
+	File             string                  `json:"file"`
+	Index            int                     `json:"index"`
+	Resource         string                  `json:"resource"`
+	Valid            bool                    `json:"valid"`
+	Error            string                  `json:"error,omitempty"`
+	ValidationErrors []handler.ErrorResponse `json:"validation_errors,omitempty"`
+}
+
+func printResult(env Env, format string, r validationResult) {
+	if format == formatJSON {
+		b, _ := json.Marshal(r)
+		fmt.Fprintln(env.Stdout, string(b))
+		return
+	}
+	if r.Error != "" {
+		fmt.Fprintf(env.Stdout, "%s:%d: %s: %s\n", r.File, r.Index, r.Resource, r.Error)
+		return
+	}
+	fmt.Fprintf(env.Stdout, "%s:%d: %s: %d validation errors\n", r.File, r.Index, r.Resource, len(r.ValidationErrors))
+	for _, e := range r.ValidationErrors {
+		location := e.InstanceLocation
+		if location == "" {
+			location = "(root)"
+		}
+		fmt.Fprintf(env.Stdout, "  %s: %s (%s at %s)\n", location, e.Description, e.Type, e.KeywordLocation)
+	}
+}
+
+// RunValidate implements `haven validate`. It validates the payloads of JSON and NDJSON files
+// against the schemas stored in the DB or in a schema export directory and returns the exit
+// code, which is not zero if any payload is invalid.
+func RunValidate(args []string, env Env) int {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	flags.SetOutput(env.Stderr)
+	schemas := flags.String("schemas", "", "directory of <resource>.schema.json files to validate against instead of the DB")
+	resource := flags.String("resource", "", "resource of all the payloads, overriding -template")
+	template := flags.String("template", "{base}", "resource name template, using {base}, {dir} and {path} of each file")
+	field := flags.String("field", "", "dot separated payload field holding the resource name, falling back to -template")
+	format := flags.String("format", formatText, "output format of the failures, text or json")
+	namespace := namespaceFlag(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(env.Stderr, "usage: haven validate [flags] <file or directory>...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	if *format != formatText && *format != formatJSON {
+		fmt.Fprintf(env.Stderr, "unknown format %q\n", *format)
+		return 2
+	}
+	if !validNamespace(env, *namespace) {
+		return 2
+	}
+	if *resource != "" {
+		*template = *resource
+		*field = ""
+	}
+
+	files, err := collectFiles(flags.Args())
+	if err != nil {
+		fmt.Fprintf(env.Stderr, "failed to list files: %v\n", err)
+		return 1
+	}
+	var load schemaLoader
+	if *schemas != "" {
+		load = dirSchemaLoader(*schemas)
+	} else {
+		db, err := env.ConnectDB()
+		if err != nil {
+			fmt.Fprintf(env.Stderr, "failed to connect to db: %v\n", err)
+			return 1
+		}
+		load = dbSchemaLoader(db.WithNamespace(*namespace))
+	}
+
+	compiled := make(map[string]*compiledSchema)
+	compile := func(name string) (*compiledSchema, error) {
+		if c, ok := compiled[name]; ok {
+			return c, nil
+		}
+		schema, err := load(name)
+		if err != nil {
+			return nil, err
+		}
+		if schema == nil {
+			return nil, fmt.Errorf("resource not found: %s", name)
+		}
+		goSchema, err := jsonutils.CompileSchema(schema)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile schema of %s: %v", name, err)
+		}
+		compiled[name] = &compiledSchema{schema: schema, goSchema: goSchema}
+		return compiled[name], nil
+	}
+
+	var total, invalid, failed int
+	for _, f := range files {
+		fileName := resourceName(*template, f)
+		err := readPayloads(f.path, func(index int, payload any) error {
+			total++
+			r := validationResult{
+				File:     f.path,
+				Index:    index,
+				Resource: payloadResource(fileName, *field, payload),
+			}
+			c, err := compile(r.Resource)
+			if err != nil {
+				failed++
+				r.Error = err.Error()
+				printResult(env, *format, r)
+				return nil
+			}
+			result, err := c.goSchema.Validate(gojsonschema.NewGoLoader(payload))
+			if err != nil {
+				failed++
+				r.Error = fmt.Sprintf("failed to validate payload: %v", err)
+				printResult(env, *format, r)
+				return nil
+			}
+			if !result.Valid() {
+				invalid++
+				r.ValidationErrors = handler.ToErrorResponses(c.schema, result)
+				printResult(env, *format, r)
+			}
+			return nil
+		})
+		if err != nil {
+			failed++
+			fmt.Fprintf(env.Stderr, "%v\n", err)
+		}
+	}
+	fmt.Fprintf(env.Stderr, "validated %d payloads from %d files, %d invalid, %d failures\n", total, len(files), invalid, failed)
+	if invalid > 0 || failed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"movinglake.com/haven/handler/jsonutils"
+	"movinglake.com/haven/wrappers"
+)
+
+const usersSchema = `{
+	"type": "object",
+	"additionalProperties": false,
+	"required": ["name", "age"],
+	"properties": {
+		"name": {"type": "string"},
+		"age": {"type": "number"}
+	}
+}`
+
+func TestRunValidate(t *testing.T) {
+	dir := t.TempDir()
+	valid := writeFile(t, dir, "data/users.ndjson", "{\"name\": \"Juan\", \"age\": 35}\n{\"name\": \"Ana\", \"age\": 30}\n")
+	invalid := writeFile(t, dir, "data/more/users.json.gz", `{"name": 1}`)
+
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	db.Save(&wrappers.Resource{Model: gorm.Model{ID: 1}, Name: "users", Schema: usersSchema, Version: 1}, nil)
+
+	env, stdout, stderr := testEnv(db)
+	assert.Equal(t, 0, RunValidate([]string{valid}, env), stdout.String())
+	assert.Equal(t, "", stdout.String())
+	assert.Contains(t, stderr.String(), "validated 2 payloads from 1 files, 0 invalid, 0 failures")
+
+	env, stdout, stderr = testEnv(db)
+	assert.Equal(t, 1, RunValidate([]string{filepath.Join(dir, "data")}, env))
+	assert.Equal(t, invalid+`:0: users: 2 validation errors
+  (root): age is required (required at /required)
+  /name: Invalid type. Expected: string, given: integer (invalid_type at /properties/name/type)
+`, stdout.String())
+	assert.Contains(t, stderr.String(), "validated 3 payloads from 2 files, 1 invalid, 0 failures")
+
+	// JSON lines carry the same errors as the API.
+	env, stdout, _ = testEnv(db)
+	assert.Equal(t, 1, RunValidate([]string{"-format", "json", invalid}, env))
+	var r validationResult
+	if err := json.Unmarshal(stdout.Bytes(), &r); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "users", r.Resource)
+	assert.False(t, r.Valid)
+	assert.Equal(t, 2, len(r.ValidationErrors))
+	assert.Equal(t, "/name", r.ValidationErrors[1].InstanceLocation)
+	assert.Equal(t, "(root).name.", r.ValidationErrors[1].Context["path"])
+}
+
+func TestRunValidateSchemaDir(t *testing.T) {
+	dir := t.TempDir()
+	schemas := filepath.Join(dir, "schemas")
+	writeFile(t, schemas, jsonutils.SchemaFileName("/api/v1/users"), usersSchema)
+	payloads := writeFile(t, dir, "events.ndjson", strings.Join([]string{
+		`{"kind": "/api/v1/users", "name": "Juan", "age": 35}`,
+		`{"kind": "/api/v1/pets"}`,
+	}, "\n"))
+
+	env, stdout, stderr := testEnv(nil)
+	env.ConnectDB = func() (wrappers.DB, error) {
+		t.Fatal("validate with -schemas connected to the DB")
+		return nil, nil
+	}
+	assert.Equal(t, 1, RunValidate([]string{"-schemas", schemas, "-field", "kind", payloads}, env))
+	// The extra kind field is not allowed by the schema.
+	assert.Contains(t, stdout.String(), payloads+":0: /api/v1/users: 1 validation errors\n")
+	assert.Contains(t, stdout.String(), payloads+":1: /api/v1/pets: resource not found: /api/v1/pets\n")
+	assert.Contains(t, stderr.String(), "1 invalid, 1 failures")
+
+	env, stdout, _ = testEnv(nil)
+	writeFile(t, dir, "user.json", `{"name": "Juan", "age": 35}`)
+	assert.Equal(t, 0, RunValidate([]string{"-schemas", schemas, "-resource", "/api/v1/users", filepath.Join(dir, "user.json")}, env), stdout.String())
+}
+
+func TestRunValidateErrors(t *testing.T) {
+	dir := t.TempDir()
+	good := writeFile(t, dir, "users.json", `{"name": "Juan", "age": 35}`)
+	bad := writeFile(t, dir, "bad.json", `{"name": `)
+	writeFile(t, dir, "schemas/users.schema.json", "not json")
+
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	db.Save(&wrappers.Resource{Model: gorm.Model{ID: 1}, Name: "users", Schema: usersSchema, Version: 1}, nil)
+	db.Save(&wrappers.Resource{Model: gorm.Model{ID: 2}, Name: "broken", Schema: "not json", Version: 1}, nil)
+	cases := []struct {
+		name     string
+		args     []string
+		dbErrors map[string]error
+		connErr  error
+		wantCode int
+	}{
+		{name: "no arguments", wantCode: 2},
+		{name: "unknown format", args: []string{"-format", "xml", good}, wantCode: 2},
+		{name: "missing file", args: []string{filepath.Join(dir, "missing.json")}, wantCode: 1},
+		{name: "bad json", args: []string{bad}, wantCode: 1},
+		{name: "db connection fails", args: []string{good}, connErr: gorm.ErrInvalidDB, wantCode: 1},
+		{name: "db read fails", args: []string{good}, dbErrors: map[string]error{"GetResource": gorm.ErrInvalidDB}, wantCode: 1},
+		{name: "bad schema in db", args: []string{"-resource", "broken", good}, wantCode: 1},
+		{name: "bad schema file", args: []string{"-schemas", filepath.Join(dir, "schemas"), good}, wantCode: 1},
+		{name: "ok", args: []string{good}, wantCode: 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db.Errors = tc.dbErrors
+			env, _, _ := testEnv(db)
+			env.ConnectDB = func() (wrappers.DB, error) { return db, tc.connErr }
+			assert.Equal(t, tc.wantCode, RunValidate(tc.args, env))
+		})
+	}
+}
@@ -0,0 +1,333 @@
+// Package consumer feeds the records of a message broker into Haven. Records are applied to
+// or validated against the schema of a resource and their offsets are only committed once
+// Haven has committed the results to the DB.
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"movinglake.com/haven/handler/jsonutils"
+	"movinglake.com/haven/telemetry"
+)
+
+// Modes of processing the records of a topic.
+const (
+	// ModeAdd applies the records to the schema of the resource, like /api/v1/add_payload.
+	ModeAdd = "add"
+	// ModeValidate validates the records against the schema of the resource, like
+	// /api/v1/validate_payload.
+	ModeValidate = "validate"
+)
+
+// Record is a message read from a topic.
+type Record struct {
+	Topic     string
+	Partition int
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Headers   map[string]string
+}
+
+// Reader reads records from a message broker.
+type Reader interface {
+	// Fetch blocks until the next record is available or the context is done.
+	Fetch(ctx context.Context) (Record, error)
+	// Commit marks the record and all the previous records of its partition as processed.
+	Commit(ctx context.Context, r Record) error
+	Close() error
+}
+
+// Writer writes records to a message broker.
+type Writer interface {
+	// Write writes the record to its topic.
+	Write(ctx context.Context, r Record) error
+	Close() error
+}
+
+// Headers of the records written to the dead-letter topic.
+const (
+	HeaderError     = "haven-error"
+	HeaderTopic     = "haven-topic"
+	HeaderPartition = "haven-partition"
+	HeaderOffset    = "haven-offset"
+)
+
+// Processor applies or validates payloads. It is implemented by handler.HavenAPIHandler.
+type Processor interface {
+	AddPayload(resource string, payload any) error
+	ValidatePayload(resource string, payload any, recordFailures bool) error
+}
+
+// TopicConfig configures how the records of a topic map to a Haven resource. The resource is
+// taken from the first of ResourceHeader, ResourceField or Resource that is set, falling back
+// to the topic name.
+type TopicConfig struct {
+	Topic string
+	// Mode is ModeAdd or ModeValidate.
+	Mode string
+	// Resource is a fixed resource name for all the records of the topic.
+	Resource string
+	// ResourceHeader is the record header holding the resource name.
+	ResourceHeader string
+	// ResourceField is the dot separated path of the payload field holding the resource name.
+	ResourceField string
+	// RecordFailures quarantines invalid payloads in ModeValidate.
+	RecordFailures bool
+}
+
+// resourceName returns the resource the record maps to.
+func (tc TopicConfig) resourceName(r Record, payload any) (string, error) {
+	switch {
+	case tc.ResourceHeader != "":
+		name, ok := r.Headers[tc.ResourceHeader]
+		if !ok || name == "" {
+			return "", fmt.Errorf("record has no %s header", tc.ResourceHeader)
+		}
+		return name, nil
+	case tc.ResourceField != "":
+		v, ok := jsonutils.ValueAtPath(payload, tc.ResourceField)
+		name, isString := v.(string)
+		if !ok || !isString || name == "" {
+			return "", fmt.Errorf("payload has no string field %s", tc.ResourceField)
+		}
+		return name, nil
+	case tc.Resource != "":
+		return tc.Resource, nil
+	}
+	return r.Topic, nil
+}
+
+// ParseTopics parses a comma separated list of topic configurations. Each entry has the form
+// topic[:mode[:source]] where mode is "add" (default) or "validate" and source is one of
+// "name=<resource>", "header=<header>" or "field=<path>". E.g.
+// "orders,clicks:validate:field=type,events:add:header=x-resource".
+func ParseTopics(spec string) ([]TopicConfig, error) {
+	var topics []TopicConfig
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		tc := TopicConfig{Topic: parts[0], Mode: ModeAdd}
+		if tc.Topic == "" {
+			return nil, fmt.Errorf("missing topic name in %q", entry)
+		}
+		if len(parts) > 1 {
+			tc.Mode = parts[1]
+		}
+		if tc.Mode != ModeAdd && tc.Mode != ModeValidate {
+			return nil, fmt.Errorf("unknown mode %q for topic %s", tc.Mode, tc.Topic)
+		}
+		if len(parts) > 2 {
+			kind, value, ok := strings.Cut(parts[2], "=")
+			if !ok || value == "" {
+				return nil, fmt.Errorf("invalid resource source %q for topic %s", parts[2], tc.Topic)
+			}
+			switch kind {
+			case "name":
+				tc.Resource = value
+			case "header":
+				tc.ResourceHeader = value
+			case "field":
+				tc.ResourceField = value
+			default:
+				return nil, fmt.Errorf("unknown resource source %q for topic %s", kind, tc.Topic)
+			}
+		}
+		topics = append(topics, tc)
+	}
+	if len(topics) == 0 {
+		return nil, errors.New("no topics configured")
+	}
+	return topics, nil
+}
+
+// TopicNames returns the names of the configured topics.
+func TopicNames(topics []TopicConfig) []string {
+	names := make([]string, 0, len(topics))
+	for _, tc := range topics {
+		names = append(names, tc.Topic)
+	}
+	return names
+}
+
+// permanentError is an error that retrying the record will not fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+// isTemporary reports whether processing the record again may succeed. Errors that do not say
+// otherwise are retried so that no record is lost.
+func isTemporary(err error) bool {
+	var perm *permanentError
+	if errors.As(err, &perm) {
+		return false
+	}
+	var temp interface{ Temporary() bool }
+	if errors.As(err, &temp) {
+		return temp.Temporary()
+	}
+	return true
+}
+
+// Consumer reads records and hands them to a Processor.
+type Consumer struct {
+	reader    Reader
+	processor Processor
+	topics    map[string]TopicConfig
+	// MinBackoff and MaxBackoff bound the wait between retries of a failing record.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// MaxAttempts is how many times a record failing with temporary errors is processed before
+	// it is dead-lettered. It only applies with a DeadLetter writer, without one or when zero
+	// records are retried until they succeed.
+	MaxAttempts int
+	// DeadLetter, if set, is written the records that fail permanently to DeadLetterTopic.
+	// Otherwise they are logged and skipped. The offset of a record is not committed until it
+	// has been dead-lettered.
+	DeadLetter      Writer
+	DeadLetterTopic string
+}
+
+func New(reader Reader, processor Processor, topics []TopicConfig) *Consumer {
+	c := &Consumer{
+		reader:     reader,
+		processor:  processor,
+		topics:     make(map[string]TopicConfig),
+		MinBackoff: 100 * time.Millisecond,
+		MaxBackoff: 30 * time.Second,
+	}
+	for _, tc := range topics {
+		c.topics[tc.Topic] = tc
+	}
+	return c
+}
+
+// handle processes a single record.
+func (c *Consumer) handle(r Record) error {
+	tc, ok := c.topics[r.Topic]
+	if !ok {
+		return &permanentError{fmt.Errorf("no configuration for topic %s", r.Topic)}
+	}
+	var payload any
+	if err := json.Unmarshal(r.Value, &payload); err != nil {
+		return &permanentError{fmt.Errorf("failed to parse record: %v", err)}
+	}
+	resource, err := tc.resourceName(r, payload)
+	if err != nil {
+		return &permanentError{err}
+	}
+	if tc.Mode == ModeValidate {
+		return c.processor.ValidatePayload(resource, payload, tc.RecordFailures)
+	}
+	return c.processor.AddPayload(resource, payload)
+}
+
+// process handles the record, retrying temporary failures with exponential backoff until it
+// succeeds or the context is done. Records with permanent failures, or out of attempts, are
+// dead-lettered.
+func (c *Consumer) process(ctx context.Context, r Record) error {
+	backoff := c.MinBackoff
+	for attempt := 1; ; attempt++ {
+		err := c.handle(r)
+		if err == nil {
+			telemetry.ConsumedRecords.WithLabelValues(r.Topic, "processed").Inc()
+			return nil
+		}
+		if !isTemporary(err) || (c.DeadLetter != nil && c.MaxAttempts > 0 && attempt >= c.MaxAttempts) {
+			return c.deadLetter(ctx, r, err)
+		}
+		telemetry.ConsumedRecords.WithLabelValues(r.Topic, "retried").Inc()
+		log.Printf("failed to process record %d of %s/%d, retrying in %v: %v", r.Offset, r.Topic, r.Partition, backoff, err)
+		if err := c.sleep(ctx, &backoff); err != nil {
+			return err
+		}
+	}
+}
+
+// sleep waits for backoff and doubles it, up to MaxBackoff.
+func (c *Consumer) sleep(ctx context.Context, backoff *time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(*backoff):
+	}
+	*backoff *= 2
+	if *backoff > c.MaxBackoff {
+		*backoff = c.MaxBackoff
+	}
+	return nil
+}
+
+// deadLetter writes the record that failed with err to the dead-letter topic, retrying until it
+// succeeds or the context is done. Without a DeadLetter writer the record is skipped.
+func (c *Consumer) deadLetter(ctx context.Context, r Record, err error) error {
+	if c.DeadLetter == nil {
+		telemetry.ConsumedRecords.WithLabelValues(r.Topic, "skipped").Inc()
+		log.Printf("skipping record %d of %s/%d: %v", r.Offset, r.Topic, r.Partition, err)
+		return nil
+	}
+	headers := make(map[string]string, len(r.Headers)+4)
+	for k, v := range r.Headers {
+		headers[k] = v
+	}
+	headers[HeaderError] = err.Error()
+	headers[HeaderTopic] = r.Topic
+	headers[HeaderPartition] = strconv.Itoa(r.Partition)
+	headers[HeaderOffset] = strconv.FormatInt(r.Offset, 10)
+	dead := Record{Topic: c.DeadLetterTopic, Key: r.Key, Value: r.Value, Headers: headers}
+	backoff := c.MinBackoff
+	for {
+		werr := c.DeadLetter.Write(ctx, dead)
+		if werr == nil {
+			break
+		}
+		log.Printf("failed to dead-letter record %d of %s/%d, retrying in %v: %v", r.Offset, r.Topic, r.Partition, backoff, werr)
+		if err := c.sleep(ctx, &backoff); err != nil {
+			return err
+		}
+	}
+	telemetry.ConsumedRecords.WithLabelValues(r.Topic, "dead_lettered").Inc()
+	log.Printf("dead-lettered record %d of %s/%d to %s: %v", r.Offset, r.Topic, r.Partition, c.DeadLetterTopic, err)
+	return nil
+}
+
+// Run consumes records until the context is done. The offset of a record is committed only
+// after it has been processed, so records being processed when the consumer stops are read
+// again on the next run.
+func (c *Consumer) Run(ctx context.Context) error {
+	for {
+		r, err := c.reader.Fetch(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to fetch record: %w", err)
+		}
+		if err := c.process(ctx, r); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if err := c.reader.Commit(ctx, r); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to commit offset %d of %s/%d: %w", r.Offset, r.Topic, r.Partition, err)
+		}
+	}
+}
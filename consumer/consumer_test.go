@@ -0,0 +1,314 @@
+package consumer_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"gorm.io/gorm"
+	"movinglake.com/haven/consumer"
+	"movinglake.com/haven/handler"
+	"movinglake.com/haven/wrappers"
+)
+
+func TestParseTopics(t *testing.T) {
+	cases := []struct {
+		spec    string
+		want    []consumer.TopicConfig
+		wantErr bool
+	}{
+		{
+			spec: "orders, clicks:validate:field=type,events:add:header=x-resource,raw:add:name=users",
+			want: []consumer.TopicConfig{
+				{Topic: "orders", Mode: consumer.ModeAdd},
+				{Topic: "clicks", Mode: consumer.ModeValidate, ResourceField: "type"},
+				{Topic: "events", Mode: consumer.ModeAdd, ResourceHeader: "x-resource"},
+				{Topic: "raw", Mode: consumer.ModeAdd, Resource: "users"},
+			},
+		},
+		{spec: "", wantErr: true},
+		{spec: ":add", wantErr: true},
+		{spec: "orders:delete", wantErr: true},
+		{spec: "orders:add:users", wantErr: true},
+		{spec: "orders:add:column=type", wantErr: true},
+	}
+	for _, tc := range cases {
+		got, err := consumer.ParseTopics(tc.spec)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("ParseTopics(%q) error = %v, wantErr %v", tc.spec, err, tc.wantErr)
+			continue
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("ParseTopics(%q) got a diff: %s", tc.spec, diff)
+		}
+	}
+}
+
+// fakeProcessor records the processed payloads and fails while failures is positive.
+type fakeProcessor struct {
+	mu        sync.Mutex
+	failures  int
+	err       error
+	added     []string
+	validated []string
+}
+
+func (f *fakeProcessor) fail() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failures > 0 {
+		f.failures--
+		return f.err
+	}
+	return nil
+}
+
+func (f *fakeProcessor) AddPayload(resource string, payload any) error {
+	if err := f.fail(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.added = append(f.added, resource)
+	return nil
+}
+
+func (f *fakeProcessor) ValidatePayload(resource string, payload any, recordFailures bool) error {
+	if err := f.fail(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.validated = append(f.validated, resource)
+	return nil
+}
+
+// temporaryError is an error that tells the consumer whether to retry.
+type temporaryError bool
+
+func (e temporaryError) Error() string   { return "failed" }
+func (e temporaryError) Temporary() bool { return bool(e) }
+
+// waitFor polls cond until it holds or a second passes.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatal("timed out waiting for the consumer")
+}
+
+func runConsumer(c *consumer.Consumer) (context.CancelFunc, chan error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Run(ctx)
+	}()
+	return cancel, done
+}
+
+func TestConsumerRouting(t *testing.T) {
+	reader := consumer.NewMemoryReader()
+	proc := &fakeProcessor{}
+	topics, _ := consumer.ParseTopics("orders,clicks:validate:field=meta.type,events:add:header=resource,raw:add:name=users")
+	c := consumer.New(reader, proc, topics)
+
+	reader.Produce("orders", []byte(`{"id": 1}`), nil)
+	reader.Produce("clicks", []byte(`{"meta": {"type": "click"}}`), nil)
+	reader.Produce("clicks", []byte(`{"meta": {}}`), nil)
+	reader.Produce("events", []byte(`{"id": 1}`), map[string]string{"resource": "signups"})
+	reader.Produce("events", []byte(`{"id": 1}`), nil)
+	reader.Produce("raw", []byte(`not json`), nil)
+	reader.Produce("raw", []byte(`{"id": 1}`), nil)
+	reader.Produce("unknown", []byte(`{"id": 1}`), nil)
+
+	cancel, done := runConsumer(c)
+	waitFor(t, func() bool { return reader.Committed("unknown") == 1 })
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run() = %v", err)
+	}
+
+	// Records that cannot be mapped to a resource are skipped and committed.
+	if diff := cmp.Diff([]string{"orders", "signups", "users"}, proc.added); diff != "" {
+		t.Errorf("added resources got a diff: %s", diff)
+	}
+	if diff := cmp.Diff([]string{"click"}, proc.validated); diff != "" {
+		t.Errorf("validated resources got a diff: %s", diff)
+	}
+	for topic, want := range map[string]int64{"orders": 1, "clicks": 2, "events": 2, "raw": 2} {
+		if got := reader.Committed(topic); got != want {
+			t.Errorf("Committed(%s) = %d, want %d", topic, got, want)
+		}
+	}
+}
+
+func TestConsumerRetries(t *testing.T) {
+	reader := consumer.NewMemoryReader()
+	proc := &fakeProcessor{failures: 3, err: temporaryError(true)}
+	c := consumer.New(reader, proc, []consumer.TopicConfig{{Topic: "orders", Mode: consumer.ModeAdd}})
+	c.MinBackoff = time.Millisecond
+	c.MaxBackoff = 2 * time.Millisecond
+
+	reader.Produce("orders", []byte(`{"id": 1}`), nil)
+	cancel, done := runConsumer(c)
+	waitFor(t, func() bool { return reader.Committed("orders") == 1 })
+	cancel()
+	<-done
+	if len(proc.added) != 1 {
+		t.Errorf("got %d processed records, want 1", len(proc.added))
+	}
+
+	// Permanent failures are skipped.
+	proc.failures = 1
+	proc.err = temporaryError(false)
+	reader.Produce("orders", []byte(`{"id": 2}`), nil)
+	cancel, done = runConsumer(c)
+	waitFor(t, func() bool { return reader.Committed("orders") == 2 })
+	cancel()
+	<-done
+	if len(proc.added) != 1 {
+		t.Errorf("got %d processed records, want 1", len(proc.added))
+	}
+}
+
+func TestConsumerCommitsAfterDB(t *testing.T) {
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	h := handler.NewHavenAPIHandler(db, nil)
+	reader := consumer.NewMemoryReader()
+	c := consumer.New(reader, h, []consumer.TopicConfig{
+		{Topic: "users", Mode: consumer.ModeAdd},
+		{Topic: "users-check", Mode: consumer.ModeValidate, Resource: "users", RecordFailures: true},
+	})
+	c.MinBackoff = time.Millisecond
+	c.MaxBackoff = time.Millisecond
+
+	// The DB fails so the record is retried and its offset is not committed.
+	db.Errors = map[string]error{"Save": gorm.ErrInvalidDB}
+	reader.Produce("users", []byte(`{"name": "Juan", "age": 35}`), nil)
+	cancel, done := runConsumer(c)
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run() = %v", err)
+	}
+	if got := reader.Committed("users"); got != 0 {
+		t.Fatalf("Committed(users) = %d, want 0", got)
+	}
+
+	// A new consumer reads the record again once the DB is back.
+	db.Errors = nil
+	reader.Rewind()
+	reader.Produce("users-check", []byte(`{"name": "Ana"}`), nil)
+	cancel, done = runConsumer(c)
+	waitFor(t, func() bool { return reader.Committed("users-check") == 1 })
+	cancel()
+	<-done
+
+	if got := reader.Committed("users"); got != 1 {
+		t.Errorf("Committed(users) = %d, want 1", got)
+	}
+	if r := db.Resource["users"]; r.Version != 1 {
+		t.Errorf("users version = %d, want 1", r.Version)
+	}
+	if len(db.Quarantine) != 1 {
+		t.Errorf("got %d quarantined payloads, want 1", len(db.Quarantine))
+	}
+}
+
+func TestConsumerErrorClasses(t *testing.T) {
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	h := handler.NewHavenAPIHandler(db, nil)
+	db.Save(&wrappers.Resource{Name: "broken", Schema: `{"type": 5}`}, nil)
+	db.Save(&wrappers.Resource{Name: "corrupt", Schema: `{"type":`}, nil)
+	reader := consumer.NewMemoryReader()
+	dlq := consumer.NewMemoryWriter()
+	c := consumer.New(reader, h, []consumer.TopicConfig{
+		{Topic: "users", Mode: consumer.ModeAdd},
+		{Topic: "broken", Mode: consumer.ModeAdd},
+		{Topic: "corrupt", Mode: consumer.ModeValidate},
+	})
+	c.MinBackoff = time.Millisecond
+	c.MaxBackoff = time.Millisecond
+	c.DeadLetter = dlq
+	c.DeadLetterTopic = "haven-dlq"
+
+	// Payloads the schema cannot be expanded with, or validated against, are dead-lettered.
+	reader.Produce("broken", []byte(`{"id": 1}`), map[string]string{"source": "api"})
+	reader.Produce("corrupt", []byte(`{"id": 2}`), nil)
+	cancel, done := runConsumer(c)
+	waitFor(t, func() bool { return reader.Committed("broken") == 1 && reader.Committed("corrupt") == 1 })
+	cancel()
+	<-done
+	dead := dlq.Records()
+	if len(dead) != 2 {
+		t.Fatalf("got %d dead-lettered records, want 2", len(dead))
+	}
+	if dead[0].Topic != "haven-dlq" || string(dead[0].Value) != `{"id": 1}` {
+		t.Errorf("dead-lettered record = %+v", dead[0])
+	}
+	delete(dead[0].Headers, consumer.HeaderError)
+	want := map[string]string{"source": "api", consumer.HeaderTopic: "broken", consumer.HeaderPartition: "0", consumer.HeaderOffset: "0"}
+	if diff := cmp.Diff(want, dead[0].Headers); diff != "" {
+		t.Errorf("dead-lettered headers got a diff: %s", diff)
+	}
+
+	// Failing DB reads are retried without committing the offset, however many attempts fail.
+	db.Errors = map[string]error{"SelectResourceForUpdate": gorm.ErrInvalidDB}
+	reader.Produce("users", []byte(`{"name": "Juan"}`), nil)
+	cancel, done = runConsumer(c)
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run() = %v", err)
+	}
+	if got := reader.Committed("users"); got != 0 {
+		t.Errorf("Committed(users) = %d, want 0", got)
+	}
+	if got := len(dlq.Records()); got != 2 {
+		t.Errorf("got %d dead-lettered records, want 2", got)
+	}
+
+	// Unless the attempts are capped, in which case the record is dead-lettered.
+	c.MaxAttempts = 3
+	reader.Rewind()
+	cancel, done = runConsumer(c)
+	waitFor(t, func() bool { return reader.Committed("users") == 1 })
+	cancel()
+	<-done
+	if got := len(dlq.Records()); got != 3 {
+		t.Errorf("got %d dead-lettered records, want 3", got)
+	}
+	if _, ok := db.Resource["users"]; ok {
+		t.Error("users was created")
+	}
+
+	// Records are not committed until they are dead-lettered.
+	dlq.SetErr(errors.New("dlq unavailable"))
+	reader.Produce("users", []byte(`{"name": "Ana"}`), nil)
+	cancel, done = runConsumer(c)
+	time.Sleep(20 * time.Millisecond)
+	if got := reader.Committed("users"); got != 1 {
+		t.Errorf("Committed(users) = %d, want 1", got)
+	}
+	dlq.SetErr(nil)
+	waitFor(t, func() bool { return reader.Committed("users") == 2 })
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run() = %v", err)
+	}
+}
+
+func TestMemoryReaderClose(t *testing.T) {
+	reader := consumer.NewMemoryReader()
+	reader.Close()
+	c := consumer.New(reader, &fakeProcessor{}, nil)
+	if err := c.Run(context.Background()); err == nil || errors.Is(err, context.Canceled) {
+		t.Errorf("Run() = %v, want a fetch error", err)
+	}
+}
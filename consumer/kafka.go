@@ -0,0 +1,89 @@
+package consumer
+
+import (
+	"context"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaReader reads records from Kafka, or any broker speaking the Kafka protocol, as a member
+// of a consumer group.
+// Ignore this type for coverage since it mostly uses external dependencies.
+type KafkaReader struct {
+	r *kafka.Reader
+}
+
+func NewKafkaReader(brokers []string, groupID string, topics []string) *KafkaReader {
+	return &KafkaReader{
+		r: kafka.NewReader(kafka.ReaderConfig{
+			Brokers:     brokers,
+			GroupID:     groupID,
+			GroupTopics: topics,
+		}),
+	}
+}
+
+func (k *KafkaReader) Fetch(ctx context.Context) (Record, error) {
+	m, err := k.r.FetchMessage(ctx)
+	if err != nil {
+		return Record{}, err
+	}
+	headers := make(map[string]string, len(m.Headers))
+	for _, h := range m.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+	return Record{
+		Topic:     m.Topic,
+		Partition: m.Partition,
+		Offset:    m.Offset,
+		Key:       m.Key,
+		Value:     m.Value,
+		Headers:   headers,
+	}, nil
+}
+
+// Commit commits the offset of the record synchronously.
+func (k *KafkaReader) Commit(ctx context.Context, r Record) error {
+	return k.r.CommitMessages(ctx, kafka.Message{
+		Topic:     r.Topic,
+		Partition: r.Partition,
+		Offset:    r.Offset,
+	})
+}
+
+func (k *KafkaReader) Close() error {
+	return k.r.Close()
+}
+
+// KafkaWriter writes records to Kafka.
+// Ignore this type for coverage since it mostly uses external dependencies.
+type KafkaWriter struct {
+	w *kafka.Writer
+}
+
+func NewKafkaWriter(brokers []string) *KafkaWriter {
+	return &KafkaWriter{
+		w: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			RequiredAcks: kafka.RequireAll,
+		},
+	}
+}
+
+// Write writes the record synchronously.
+func (k *KafkaWriter) Write(ctx context.Context, r Record) error {
+	headers := make([]kafka.Header, 0, len(r.Headers))
+	for key, value := range r.Headers {
+		headers = append(headers, kafka.Header{Key: key, Value: []byte(value)})
+	}
+	return k.w.WriteMessages(ctx, kafka.Message{
+		Topic:   r.Topic,
+		Key:     r.Key,
+		Value:   r.Value,
+		Headers: headers,
+	})
+}
+
+func (k *KafkaWriter) Close() error {
+	return k.w.Close()
+}
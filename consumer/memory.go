@@ -0,0 +1,151 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+type partition struct {
+	topic     string
+	partition int
+}
+
+// MemoryReader is an in-memory Reader used in tests and to run Haven without a broker.
+// Produced records are delivered in order and every topic has a single partition.
+type MemoryReader struct {
+	mu        sync.Mutex
+	records   []Record
+	next      int
+	offsets   map[partition]int64
+	committed map[partition]int64
+	ready     chan struct{}
+	closed    bool
+}
+
+func NewMemoryReader() *MemoryReader {
+	return &MemoryReader{
+		offsets:   make(map[partition]int64),
+		committed: make(map[partition]int64),
+		ready:     make(chan struct{}, 1),
+	}
+}
+
+// Produce appends a record to the topic and returns it with its offset.
+func (m *MemoryReader) Produce(topic string, value []byte, headers map[string]string) Record {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := partition{topic: topic}
+	r := Record{
+		Topic:   topic,
+		Offset:  m.offsets[p],
+		Value:   value,
+		Headers: headers,
+	}
+	m.offsets[p]++
+	m.records = append(m.records, r)
+	select {
+	case m.ready <- struct{}{}:
+	default:
+	}
+	return r
+}
+
+func (m *MemoryReader) Fetch(ctx context.Context) (Record, error) {
+	for {
+		m.mu.Lock()
+		if m.closed {
+			m.mu.Unlock()
+			return Record{}, errors.New("reader is closed")
+		}
+		if m.next < len(m.records) {
+			r := m.records[m.next]
+			m.next++
+			m.mu.Unlock()
+			return r, nil
+		}
+		m.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return Record{}, ctx.Err()
+		case <-m.ready:
+		}
+	}
+}
+
+func (m *MemoryReader) Commit(ctx context.Context, r Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := partition{topic: r.Topic, partition: r.Partition}
+	if r.Offset+1 > m.committed[p] {
+		m.committed[p] = r.Offset + 1
+	}
+	return nil
+}
+
+// Committed returns the offset of the next record to read from the topic, following the
+// Kafka convention of committing the offset after the last processed record.
+func (m *MemoryReader) Committed(topic string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.committed[partition{topic: topic}]
+}
+
+// Rewind restarts reading from the committed offsets, as a new consumer of the group would.
+func (m *MemoryReader) Rewind() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.next = len(m.records)
+	for i, r := range m.records {
+		if r.Offset >= m.committed[partition{topic: r.Topic, partition: r.Partition}] {
+			m.next = i
+			break
+		}
+	}
+}
+
+func (m *MemoryReader) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	return nil
+}
+
+// MemoryWriter is an in-memory Writer used in tests.
+type MemoryWriter struct {
+	mu      sync.Mutex
+	records []Record
+	err     error
+}
+
+func NewMemoryWriter() *MemoryWriter {
+	return &MemoryWriter{}
+}
+
+// SetErr makes the following writes fail with err, or succeed if it is nil.
+func (m *MemoryWriter) SetErr(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.err = err
+}
+
+func (m *MemoryWriter) Write(ctx context.Context, r Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.records = append(m.records, r)
+	return nil
+}
+
+// Records returns the written records in order.
+func (m *MemoryWriter) Records() []Record {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Record(nil), m.records...)
+}
+
+func (m *MemoryWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,547 @@
+// Package gitsync mirrors the schemas of the resources to a git working tree so they can be
+// reviewed, diffed and edited with the usual git tooling.
+//
+// Every new schema version is written to <resource>.schema.json and committed with the
+// version and reference payload in the message. Versions are queued and written in the
+// background by Run, retrying failures, so a slow or unreachable remote doesn't hold up the
+// requests adding them. Versions still queued when Haven stops are written by Reconcile when
+// Run starts again. Changes made to the files in the tree (for example merged pull requests)
+// are brought back with Import, which sets them as new versions.
+package gitsync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"movinglake.com/haven/handler"
+	"movinglake.com/haven/handler/jsonutils"
+	"movinglake.com/haven/telemetry"
+	"movinglake.com/haven/wrappers"
+)
+
+// Default identity of the commits.
+const (
+	DefaultAuthorName  = "Haven"
+	DefaultAuthorEmail = "haven@localhost"
+	DefaultBranch      = "main"
+)
+
+// Default delays between the attempts to write a version that failed.
+const (
+	DefaultBackoff    = 10 * time.Second
+	DefaultMaxBackoff = 10 * time.Minute
+)
+
+// Config configures a Syncer.
+type Config struct {
+	// Dir is the working tree the schemas are written to. It is created if it does not exist.
+	Dir string
+	// Remote is the URL commits are pushed to and imports pull from. Empty keeps the tree
+	// local.
+	Remote string
+	// Branch defaults to DefaultBranch.
+	Branch      string
+	AuthorName  string
+	AuthorEmail string
+	// Backoff is the delay before retrying a version that failed to be written, doubled for
+	// every further attempt up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// SourceReconcile is the source in the message of the commits made by Reconcile.
+const SourceReconcile = "reconcile"
+
+// Store reads and writes the schemas of the resources.
+type Store interface {
+	GetSchema(name string) (map[string]any, error)
+	SetSchema(name string, schema map[string]any) (*wrappers.Resource, error)
+	Resources() ([]wrappers.Resource, error)
+}
+
+// Status reports the versions waiting to be written to the working tree and the last failure.
+type Status struct {
+	handler.APIResponse
+	Pending int `json:"pending"`
+	// Attempts is the number of failed attempts to write the oldest pending version.
+	Attempts      uint       `json:"attempts"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorAt   *time.Time `json:"last_error_at,omitempty"`
+	LastSyncedAt  *time.Time `json:"last_synced_at,omitempty"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+}
+
+// errInvalidSchema fails the versions that can never be written.
+var errInvalidSchema = errors.New("invalid schema")
+
+// Syncer keeps a git working tree in sync with the schemas of the resources. It is safe for
+// concurrent use.
+type Syncer struct {
+	cfg   Config
+	store Store
+	// mu guards the working tree.
+	mu sync.Mutex
+
+	// queueMu guards the versions waiting to be written and the status.
+	queueMu sync.Mutex
+	pending []handler.VersionEvent
+	status  Status
+	wake    chan struct{}
+}
+
+// New returns a Syncer of the working tree in cfg.Dir. Init must be called before using it.
+func New(cfg Config, store Store) *Syncer {
+	if cfg.Branch == "" {
+		cfg.Branch = DefaultBranch
+	}
+	if cfg.AuthorName == "" {
+		cfg.AuthorName = DefaultAuthorName
+	}
+	if cfg.AuthorEmail == "" {
+		cfg.AuthorEmail = DefaultAuthorEmail
+	}
+	if cfg.Backoff == 0 {
+		cfg.Backoff = DefaultBackoff
+	}
+	if cfg.MaxBackoff == 0 {
+		cfg.MaxBackoff = DefaultMaxBackoff
+	}
+	return &Syncer{cfg: cfg, store: store, wake: make(chan struct{}, 1)}
+}
+
+// git runs a git command in the working tree and returns its output.
+func (s *Syncer) git(args ...string) (string, error) {
+	command := args[0]
+	args = append([]string{
+		"-c", "user.name=" + s.cfg.AuthorName,
+		"-c", "user.email=" + s.cfg.AuthorEmail,
+	}, args...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = s.cfg.Dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+// Init creates the working tree if needed and brings it up to date with the remote.
+func (s *Syncer) Init() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(s.cfg.Dir, 0o755); err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(s.cfg.Dir, ".git")); os.IsNotExist(err) {
+		if _, err := s.git("init", "--quiet"); err != nil {
+			return err
+		}
+		if _, err := s.git("symbolic-ref", "HEAD", "refs/heads/"+s.cfg.Branch); err != nil {
+			return err
+		}
+		if s.cfg.Remote != "" {
+			if _, err := s.git("remote", "add", "origin", s.cfg.Remote); err != nil {
+				return err
+			}
+		}
+	}
+	return s.pull()
+}
+
+// pull fast-forwards the working tree to the remote branch, if any.
+func (s *Syncer) pull() error {
+	if s.cfg.Remote == "" {
+		return nil
+	}
+	if _, err := s.git("fetch", "--quiet", "origin"); err != nil {
+		return err
+	}
+	remoteBranch := "refs/remotes/origin/" + s.cfg.Branch
+	if _, err := s.git("rev-parse", "--verify", "--quiet", remoteBranch); err != nil {
+		// Nothing has been pushed to the branch yet.
+		return nil
+	}
+	if _, err := s.git("merge", "--quiet", "--ff-only", remoteBranch); err == nil {
+		return nil
+	}
+	// The versions committed while the remote could not be pushed to are replayed on top of
+	// the changes pushed meanwhile.
+	if _, err := s.git("rebase", "--quiet", remoteBranch); err != nil {
+		s.git("rebase", "--abort")
+		return fmt.Errorf("working tree diverged from origin/%s: %v", s.cfg.Branch, err)
+	}
+	return nil
+}
+
+// commitMessage describes the new version in the commit.
+func commitMessage(ev handler.VersionEvent) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Set %s schema to version %d\n\n", ev.Resource, ev.Version)
+	fmt.Fprintf(&b, "Version: %d\n", ev.Version)
+	if ev.ReferencePayloadID != 0 {
+		fmt.Fprintf(&b, "Reference payload: %d\n", ev.ReferencePayloadID)
+	}
+	fmt.Fprintf(&b, "Source: %s\n", ev.Source)
+	return b.String()
+}
+
+// Write writes the schema of the version to the working tree and commits it, pushing the
+// commits not pushed yet if there is a remote. Versions that leave the file unchanged are not
+// committed.
+func (s *Syncer) Write(ev handler.VersionEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var schema any
+	if err := json.Unmarshal([]byte(ev.NewSchema), &schema); err != nil {
+		return fmt.Errorf("%w of %s: %v", errInvalidSchema, ev.Resource, err)
+	}
+	if err := s.pull(); err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal schema of %s: %v", ev.Resource, err)
+	}
+	file := jsonutils.SchemaFileName(ev.Resource)
+	if err := os.WriteFile(filepath.Join(s.cfg.Dir, file), append(content, '\n'), 0o644); err != nil {
+		return err
+	}
+	if _, err := s.git("add", "--", file); err != nil {
+		return err
+	}
+	if _, err := s.git("diff", "--cached", "--quiet"); err != nil {
+		if _, err := s.git("commit", "--quiet", "-m", commitMessage(ev)); err != nil {
+			return err
+		}
+	}
+	if s.cfg.Remote == "" {
+		return nil
+	}
+	// Commits of earlier attempts whose push failed are pushed even if this one made none.
+	_, err = s.git("push", "--quiet", "origin", "HEAD:refs/heads/"+s.cfg.Branch)
+	return err
+}
+
+// VersionAdded is a handler version hook that queues the version to be written to the working
+// tree by Run.
+func (s *Syncer) VersionAdded(ev handler.VersionEvent) {
+	// The working tree mirrors the default namespace, where Import sets the schemas.
+	if ev.Namespace != wrappers.DefaultNamespace {
+		return
+	}
+	s.queueMu.Lock()
+	s.pending = append(s.pending, ev)
+	s.status.Pending = len(s.pending)
+	telemetry.GitSyncPending.Set(float64(len(s.pending)))
+	s.queueMu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Status returns the status of the versions queued by VersionAdded.
+func (s *Syncer) Status() Status {
+	s.queueMu.Lock()
+	defer s.queueMu.Unlock()
+	return s.status
+}
+
+// backoff returns the delay before the next attempt after the given number of failed ones.
+func (s *Syncer) backoff(attempts uint) time.Duration {
+	d := s.cfg.Backoff
+	for i := uint(1); i < attempts && d < s.cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > s.cfg.MaxBackoff {
+		return s.cfg.MaxBackoff
+	}
+	return d
+}
+
+// failed records a failed attempt in the status and returns the delay before the next one.
+// queueMu must be held.
+func (s *Syncer) failed(now time.Time, message string) time.Duration {
+	telemetry.GitSyncErrors.Inc()
+	s.status.Attempts++
+	s.status.LastError = message
+	s.status.LastErrorAt = &now
+	delay := s.backoff(s.status.Attempts)
+	next := now.Add(delay)
+	s.status.NextAttemptAt = &next
+	return delay
+}
+
+// Flush writes the queued versions in order. It stops at the first failure, which is retried
+// by the next Flush, and returns the number of versions written. Versions whose schema is not
+// JSON are dropped.
+func (s *Syncer) Flush() (int, error) {
+	written := 0
+	for {
+		s.queueMu.Lock()
+		if len(s.pending) == 0 {
+			s.queueMu.Unlock()
+			return written, nil
+		}
+		ev := s.pending[0]
+		s.queueMu.Unlock()
+
+		err := s.Write(ev)
+		now := time.Now()
+		s.queueMu.Lock()
+		if err != nil && !errors.Is(err, errInvalidSchema) {
+			delay := s.failed(now, fmt.Sprintf("failed to sync schema of %s version %d: %v", ev.Resource, ev.Version, err))
+			s.queueMu.Unlock()
+			log.Printf("failed to sync schema of %s version %d to git, retrying in %v: %v", ev.Resource, ev.Version, delay, err)
+			return written, err
+		}
+		if err != nil {
+			log.Printf("dropping schema of %s version %d: %v", ev.Resource, ev.Version, err)
+		} else {
+			written++
+			s.status.LastSyncedAt = &now
+		}
+		s.pending = s.pending[1:]
+		s.status.Pending = len(s.pending)
+		s.status.Attempts = 0
+		s.status.NextAttemptAt = nil
+		telemetry.GitSyncPending.Set(float64(len(s.pending)))
+		s.queueMu.Unlock()
+	}
+}
+
+// committedVersion returns the version in the last commit of Write to the schema file of the
+// resource, zero if there is none.
+func (s *Syncer) committedVersion(name string) (uint, error) {
+	if _, err := s.git("rev-parse", "--verify", "--quiet", "HEAD"); err != nil {
+		// Nothing has been committed yet.
+		return 0, nil
+	}
+	out, err := s.git("log", "--format=%s", "--", jsonutils.SchemaFileName(name))
+	if err != nil {
+		return 0, err
+	}
+	prefix := "Set " + name + " schema to version "
+	for _, subject := range strings.Split(out, "\n") {
+		if !strings.HasPrefix(subject, prefix) {
+			continue
+		}
+		if v, err := strconv.ParseUint(strings.TrimPrefix(subject, prefix), 10, 0); err == nil {
+			return uint(v), nil
+		}
+	}
+	return 0, nil
+}
+
+// staleResources pulls the working tree and returns the resources whose current version is
+// newer than the one last committed to the tree and whose file has another schema.
+func (s *Syncer) staleResources() ([]wrappers.Resource, error) {
+	resources, err := s.store.Resources()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.pull(); err != nil {
+		return nil, err
+	}
+	var stale []wrappers.Resource
+	for _, r := range resources {
+		committed, err := s.committedVersion(r.Name)
+		if err != nil {
+			return nil, err
+		}
+		if committed >= r.Version {
+			continue
+		}
+		var current, file any
+		json.Unmarshal([]byte(r.Schema), &current)
+		content, err := os.ReadFile(filepath.Join(s.cfg.Dir, jsonutils.SchemaFileName(r.Name)))
+		if err == nil && json.Unmarshal(content, &file) == nil && reflect.DeepEqual(current, file) {
+			continue
+		}
+		stale = append(stale, r)
+	}
+	return stale, nil
+}
+
+// Reconcile writes the current schema of the resources whose latest version is missing from
+// the working tree, such as the versions still queued when Haven stopped, one commit per
+// resource. Files edited in the tree since their last version are left for Import. It returns
+// the names of the resources written.
+func (s *Syncer) Reconcile() ([]string, error) {
+	stale, err := s.staleResources()
+	var written []string
+	for _, r := range stale {
+		err = s.Write(handler.VersionEvent{
+			Namespace:  r.Namespace,
+			Resource:   r.Name,
+			ResourceID: r.ID,
+			Version:    r.Version,
+			NewSchema:  r.Schema,
+			Source:     SourceReconcile,
+		})
+		if errors.Is(err, errInvalidSchema) {
+			log.Printf("skipping schema of %s version %d: %v", r.Name, r.Version, err)
+			err = nil
+			continue
+		}
+		if err != nil {
+			break
+		}
+		written = append(written, r.Name)
+	}
+	now := time.Now()
+	s.queueMu.Lock()
+	defer s.queueMu.Unlock()
+	if err != nil {
+		delay := s.failed(now, fmt.Sprintf("failed to reconcile schemas: %v", err))
+		log.Printf("failed to reconcile schemas with git, retrying in %v: %v", delay, err)
+		return written, err
+	}
+	if len(written) > 0 {
+		s.status.LastSyncedAt = &now
+	}
+	s.status.Attempts = 0
+	s.status.NextAttemptAt = nil
+	return written, nil
+}
+
+// Run reconciles the working tree, then writes the versions queued by VersionAdded until the
+// context is done. Failures are retried with exponential backoff, and the versions queued
+// meanwhile wait for the retry to keep the commits in order.
+func (s *Syncer) Run(ctx context.Context) {
+	reconciled := false
+	for {
+		var err error
+		if !reconciled {
+			_, err = s.Reconcile()
+			reconciled = err == nil
+		}
+		if reconciled {
+			_, err = s.Flush()
+		}
+		var retry <-chan time.Time
+		if err != nil {
+			retry = time.After(s.backoff(s.Status().Attempts))
+		}
+		for wait := true; wait; {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.wake:
+				wait = retry != nil
+			case <-retry:
+				wait = false
+			}
+		}
+	}
+}
+
+// readSchemas pulls the working tree and returns the schema files in it by resource name.
+func (s *Syncer) readSchemas() (map[string]map[string]any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.pull(); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(s.cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	schemas := make(map[string]map[string]any)
+	for _, e := range entries {
+		name, ok := jsonutils.ResourceFromSchemaFile(e.Name())
+		if !ok || e.IsDir() {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(s.cfg.Dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var schema map[string]any
+		if err := json.Unmarshal(content, &schema); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", e.Name(), err)
+		}
+		schemas[name] = schema
+	}
+	return schemas, nil
+}
+
+// Import sets the schemas of the working tree that differ from the stored ones as new
+// versions, creating missing resources. It returns the names of the updated resources.
+// Resources whose file was removed are left untouched.
+func (s *Syncer) Import() ([]string, error) {
+	schemas, err := s.readSchemas()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(schemas))
+	for name := range schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var updated []string
+	for _, name := range names {
+		current, err := s.store.GetSchema(name)
+		if err != nil {
+			return updated, err
+		}
+		if current != nil && reflect.DeepEqual(current, schemas[name]) {
+			continue
+		}
+		// The new version is written back to the tree by the version hook, if registered.
+		if _, err := s.store.SetSchema(name, schemas[name]); err != nil {
+			return updated, fmt.Errorf("failed to set schema of %s: %v", name, err)
+		}
+		updated = append(updated, name)
+	}
+	return updated, nil
+}
+
+type ImportResponse struct {
+	handler.APIResponse
+	Updated []string `json:"updated"`
+}
+
+// RegisterRoutes adds the sync endpoints to the router, behind the middleware if any.
+func (s *Syncer) RegisterRoutes(e *gin.Engine, middleware ...gin.HandlerFunc) {
+	middleware = middleware[:len(middleware):len(middleware)]
+	e.POST("/api/v1/sync/import", append(middleware, s.importHandler)...)
+	e.GET("/api/v1/sync/status", append(middleware, s.statusHandler)...)
+}
+
+// statusHandler returns the versions waiting to be written and the last failure.
+func (s *Syncer) statusHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, s.Status())
+}
+
+// importHandler imports the schemas of the working tree.
+func (s *Syncer) importHandler(c *gin.Context) {
+	var response ImportResponse
+	updated, err := s.Import()
+	response.Updated = updated
+	if err != nil {
+		response.Error = fmt.Sprintf("failed to import schemas: %v", err)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
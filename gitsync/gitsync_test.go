@@ -0,0 +1,291 @@
+package gitsync
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"movinglake.com/haven/handler"
+	"movinglake.com/haven/wrappers"
+)
+
+// run runs git in dir, failing the test on errors.
+func run(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	args = append([]string{"-c", "user.name=Test", "-c", "user.email=test@localhost"}, args...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v: %s", args, err, out)
+	}
+	return string(out)
+}
+
+// newSyncer returns a syncer pushing to a new bare repository, registered as version hook of
+// a handler over a test DB.
+func newSyncer(t *testing.T) (*Syncer, *handler.HavenAPIHandler, *wrappers.TestDB, string) {
+	t.Helper()
+	dir := t.TempDir()
+	remote := filepath.Join(dir, "remote.git")
+	run(t, dir, "init", "--quiet", "--bare", remote)
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	h := handler.NewHavenAPIHandler(db, nil)
+	s := New(Config{Dir: filepath.Join(dir, "tree"), Remote: remote}, h)
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	h.OnVersion(s.VersionAdded)
+	return s, h, db, remote
+}
+
+// flush writes the queued versions, failing the test on errors.
+func flush(t *testing.T, s *Syncer) {
+	t.Helper()
+	if _, err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSyncVersions(t *testing.T) {
+	s, h, _, remote := newSyncer(t)
+	if err := h.AddPayload("/api/v1/users", map[string]any{"name": "Juan"}); err != nil {
+		t.Fatal(err)
+	}
+	// Payloads that leave the schema unchanged add no commits.
+	if err := h.AddPayload("/api/v1/users", map[string]any{"name": "Ana"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.SetSchema("pets", map[string]any{"type": "object"}); err != nil {
+		t.Fatal(err)
+	}
+	// Versions are written in the background.
+	assert.Equal(t, 2, s.Status().Pending)
+	flush(t, s)
+	assert.Equal(t, 0, s.Status().Pending)
+	assert.NotNil(t, s.Status().LastSyncedAt)
+
+	clone := filepath.Join(t.TempDir(), "clone")
+	run(t, filepath.Dir(clone), "clone", "--quiet", "--branch", DefaultBranch, remote, clone)
+	log := run(t, clone, "log", "--format=%B---")
+	commits := strings.Split(strings.TrimSuffix(strings.TrimSpace(log), "---"), "---")
+	assert.Equal(t, 2, len(commits))
+	assert.Equal(t, "Set pets schema to version 1\n\nVersion: 1\nSource: set_schema", strings.TrimSpace(commits[0]))
+	assert.Equal(t, "Set /api/v1/users schema to version 1\n\nVersion: 1\nReference payload: 1\nSource: payload", strings.TrimSpace(commits[1]))
+
+	content, err := os.ReadFile(filepath.Join(clone, "pets.schema.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "{\n  \"type\": \"object\"\n}\n", string(content))
+	content, err = os.ReadFile(filepath.Join(clone, "%2Fapi%2Fv1%2Fusers.schema.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]any
+	json.Unmarshal(content, &schema)
+	assert.Contains(t, schema["properties"], "name")
+}
+
+func TestImport(t *testing.T) {
+	s, h, db, remote := newSyncer(t)
+	if _, err := h.SetSchema("pets", map[string]any{"type": "object"}); err != nil {
+		t.Fatal(err)
+	}
+	flush(t, s)
+
+	// Edit the schemas in another clone and push them.
+	clone := filepath.Join(t.TempDir(), "clone")
+	run(t, filepath.Dir(clone), "clone", "--quiet", "--branch", DefaultBranch, remote, clone)
+	os.WriteFile(filepath.Join(clone, "pets.schema.json"), []byte(`{"type": "object", "required": ["name"]}`), 0o644)
+	os.WriteFile(filepath.Join(clone, "users.schema.json"), []byte(`{"type": "object"}`), 0o644)
+	os.WriteFile(filepath.Join(clone, "README.md"), []byte("Schemas"), 0o644)
+	run(t, clone, "add", ".")
+	run(t, clone, "commit", "--quiet", "-m", "Require pet names")
+	run(t, clone, "push", "--quiet", "origin", "HEAD")
+
+	router := gin.Default()
+	s.RegisterRoutes(router)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodPost, "/api/v1/sync/import", nil))
+	assert.Equal(t, http.StatusOK, response.Code)
+	var resp ImportResponse
+	json.Unmarshal(response.Body.Bytes(), &resp)
+	assert.Equal(t, []string{"pets", "users"}, resp.Updated)
+	assert.Equal(t, uint(2), db.Resource["pets"].Version)
+	assert.Equal(t, `{"required":["name"],"type":"object"}`, db.Resource["pets"].Schema)
+	assert.Equal(t, uint(1), db.Resource["users"].Version)
+
+	// The imported versions are written back reformatted.
+	flush(t, s)
+	run(t, clone, "pull", "--quiet")
+	log := run(t, clone, "log", "--format=%s")
+	assert.Equal(t, "Set users schema to version 1\nSet pets schema to version 2\nRequire pet names\nSet pets schema to version 1\n", log)
+
+	// Importing again changes nothing.
+	updated, err := s.Import()
+	assert.Nil(t, err)
+	assert.Empty(t, updated)
+
+	db.Errors = map[string]error{"GetResource": gorm.ErrInvalidDB}
+	os.WriteFile(filepath.Join(s.cfg.Dir, "users.schema.json"), []byte(`{}`), 0o644)
+	_, err = s.Import()
+	assert.NotNil(t, err)
+
+	os.WriteFile(filepath.Join(s.cfg.Dir, "users.schema.json"), []byte(`not json`), 0o644)
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodPost, "/api/v1/sync/import", nil))
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+}
+
+func TestSyncLocal(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "tree")
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	h := handler.NewHavenAPIHandler(db, nil)
+	s := New(Config{Dir: dir, Branch: "schemas"}, h)
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	// Init is idempotent.
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	h.OnVersion(s.VersionAdded)
+	if _, err := h.SetSchema("pets", map[string]any{"type": "object"}); err != nil {
+		t.Fatal(err)
+	}
+	flush(t, s)
+	assert.Equal(t, "schemas\n", run(t, dir, "rev-parse", "--abbrev-ref", "HEAD"))
+	assert.Equal(t, "Haven <haven@localhost>\n", run(t, dir, "log", "--format=%an <%ae>"))
+
+	err := s.Write(handler.VersionEvent{Resource: "pets", NewSchema: "not json"})
+	assert.NotNil(t, err)
+}
+
+func TestSyncRetries(t *testing.T) {
+	s, h, _, remote := newSyncer(t)
+	s.cfg.Backoff = time.Millisecond
+	s.cfg.MaxBackoff = time.Millisecond
+	if _, err := h.SetSchema("pets", map[string]any{"type": "object"}); err != nil {
+		t.Fatal(err)
+	}
+	flush(t, s)
+
+	// The remote rejects pushes, the versions wait and the failure is reported.
+	hook := filepath.Join(remote, "hooks", "pre-receive")
+	if err := os.WriteFile(hook, []byte("#!/bin/sh\nexit 1\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.SetSchema("users", map[string]any{"type": "object"}); err != nil {
+		t.Fatal(err)
+	}
+	written, err := s.Flush()
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, written)
+	router := gin.Default()
+	s.RegisterRoutes(router)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/api/v1/sync/status", nil))
+	var status Status
+	json.Unmarshal(response.Body.Bytes(), &status)
+	assert.Equal(t, 1, status.Pending)
+	assert.Equal(t, uint(1), status.Attempts)
+	assert.Contains(t, status.LastError, "users version 1")
+	assert.NotNil(t, status.NextAttemptAt)
+
+	// Meanwhile the remote gets another commit, the one of the failed attempt is rebased on it.
+	if err := os.Remove(hook); err != nil {
+		t.Fatal(err)
+	}
+	clone := filepath.Join(t.TempDir(), "clone")
+	run(t, filepath.Dir(clone), "clone", "--quiet", "--branch", DefaultBranch, remote, clone)
+	os.WriteFile(filepath.Join(clone, "README.md"), []byte("Schemas"), 0o644)
+	run(t, clone, "add", ".")
+	run(t, clone, "commit", "--quiet", "-m", "Add readme")
+	run(t, clone, "push", "--quiet", "origin", "HEAD")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	if _, err := h.SetSchema("orders", map[string]any{"type": "object"}); err != nil {
+		t.Fatal(err)
+	}
+	for start := time.Now(); s.Status().Pending > 0 && time.Since(start) < 5*time.Second; {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+	status = s.Status()
+	assert.Equal(t, 0, status.Pending)
+	assert.Equal(t, uint(0), status.Attempts)
+	run(t, clone, "pull", "--quiet")
+	log := run(t, clone, "log", "--format=%s")
+	assert.Equal(t, "Set orders schema to version 1\nSet users schema to version 1\nAdd readme\nSet pets schema to version 1\n", log)
+}
+
+func TestReconcile(t *testing.T) {
+	s, h, db, remote := newSyncer(t)
+	for _, name := range []string{"pets", "orders"} {
+		if _, err := h.SetSchema(name, map[string]any{"type": "object"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	flush(t, s)
+
+	// Orders are edited in the tree and not imported yet.
+	clone := filepath.Join(t.TempDir(), "clone")
+	run(t, filepath.Dir(clone), "clone", "--quiet", "--branch", DefaultBranch, remote, clone)
+	os.WriteFile(filepath.Join(clone, "orders.schema.json"), []byte(`{"type": "array"}`), 0o644)
+	run(t, clone, "commit", "--quiet", "-am", "Make orders a list")
+	run(t, clone, "push", "--quiet", "origin", "HEAD")
+
+	// Haven stops with versions still queued, a new syncer starts with an empty queue.
+	if _, err := h.SetSchema("pets", map[string]any{"type": "object", "required": []any{"name"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.AddPayload("users", map[string]any{"name": "Ann"}); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, s.Status().Pending)
+	restarted := New(s.cfg, h)
+	if err := restarted.Init(); err != nil {
+		t.Fatal(err)
+	}
+	written, err := restarted.Reconcile()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pets", "users"}, written)
+	run(t, clone, "pull", "--quiet")
+	log := run(t, clone, "log", "--format=%s")
+	assert.Equal(t, "Set users schema to version 1\nSet pets schema to version 2\nMake orders a list\nSet orders schema to version 1\nSet pets schema to version 1\n", log)
+	assert.Contains(t, run(t, clone, "log", "-1", "--format=%B"), "Source: reconcile")
+	content, _ := os.ReadFile(filepath.Join(clone, "orders.schema.json"))
+	assert.Equal(t, `{"type": "array"}`, string(content))
+
+	// The queue of the stopped syncer would add nothing.
+	flush(t, s)
+	written, err = restarted.Reconcile()
+	assert.NoError(t, err)
+	assert.Empty(t, written)
+	run(t, clone, "pull", "--quiet")
+	assert.Equal(t, log, run(t, clone, "log", "--format=%s"))
+
+	db.Errors = map[string]error{"GetAllResources": gorm.ErrInvalidDB}
+	_, err = restarted.Reconcile()
+	assert.NotNil(t, err)
+	status := restarted.Status()
+	assert.Equal(t, uint(1), status.Attempts)
+	assert.Contains(t, status.LastError, "failed to reconcile schemas")
+}
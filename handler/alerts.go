@@ -0,0 +1,348 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"movinglake.com/haven/handler/notifications"
+	"movinglake.com/haven/wrappers"
+)
+
+// Kinds of alert rules.
+const (
+	// AlertErrorRate fires when the fraction of failed validations exceeds the threshold.
+	AlertErrorRate = "error_rate"
+	// AlertErrorPath fires when the number of errors on a path exceeds the threshold.
+	AlertErrorPath = "error_path"
+)
+
+// States of alert rules.
+const (
+	AlertOK     = "ok"
+	AlertFiring = "firing"
+)
+
+// DefaultAlertInterval is how often RunAlerts evaluates the alert rules.
+const DefaultAlertInterval = time.Minute
+
+// maxAlertWindow is the longest window of alert rules, counters are read from minute buckets.
+const maxAlertWindow = 24 * time.Hour
+
+type AlertRule struct {
+	ID        uint    `json:"id"`
+	Resource  string  `json:"resource"`
+	Kind      string  `json:"kind"`
+	Threshold float64 `json:"threshold"`
+	// Window is a duration such as 10m.
+	Window         string     `json:"window"`
+	MinValidations uint       `json:"min_validations"`
+	ErrorType      string     `json:"error_type"`
+	Path           string     `json:"path"`
+	State          string     `json:"state"`
+	Value          float64    `json:"value"`
+	ChangedAt      *time.Time `json:"changed_at"`
+}
+
+type GetAlertRulesResponse struct {
+	APIResponse
+	Rules []AlertRule `json:"rules"`
+}
+
+// SetAlertRuleRequest creates an alert rule, or replaces the rule with the ID if set.
+type SetAlertRuleRequest struct {
+	ID             uint    `json:"id"`
+	Resource       string  `json:"resource"`
+	Kind           string  `json:"kind"`
+	Threshold      float64 `json:"threshold"`
+	Window         string  `json:"window"`
+	MinValidations uint    `json:"min_validations"`
+	ErrorType      string  `json:"error_type"`
+	Path           string  `json:"path"`
+}
+
+type SetAlertRuleResponse struct {
+	APIResponse
+	Rule AlertRule `json:"rule"`
+}
+
+type DeleteAlertRuleRequest struct {
+	ID uint `json:"id"`
+}
+
+type DeleteAlertRuleResponse struct {
+	APIResponse
+	Deleted int64 `json:"deleted"`
+}
+
+func newAlertRule(r wrappers.AlertRules) AlertRule {
+	return AlertRule{
+		ID:             r.ID,
+		Resource:       r.Resource.Name,
+		Kind:           r.Kind,
+		Threshold:      r.Threshold,
+		Window:         r.Window.String(),
+		MinValidations: r.MinValidations,
+		ErrorType:      r.ErrorType,
+		Path:           r.Path,
+		State:          r.State,
+		Value:          r.Value,
+		ChangedAt:      r.ChangedAt,
+	}
+}
+
+// describeAlert returns the condition of the rule, e.g. "error rate > 5% over 10m0s".
+func describeAlert(r wrappers.AlertRules) string {
+	if r.Kind == AlertErrorRate {
+		return fmt.Sprintf("error rate > %g%% over %v", r.Threshold*100, r.Window)
+	}
+	errType := "errors"
+	if r.ErrorType != "" {
+		errType = r.ErrorType + " errors"
+	}
+	return fmt.Sprintf("more than %g %s on %s over %v", r.Threshold, errType, r.Path, r.Window)
+}
+
+// evaluateAlert returns the value of the rule over its window and whether it fires: the error
+// rate or the number of matching errors.
+func (h *HavenAPIHandler) evaluateAlert(r wrappers.AlertRules, now time.Time) (float64, bool, error) {
+	since := now.UTC().Add(-r.Window).Truncate(time.Minute)
+	if r.Kind == AlertErrorRate {
+		counts, err := h.db.GetValidationCounts(uint(r.ResourceID), wrappers.GranularityMinute, since)
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to get validation counts: %w", err)
+		}
+		var total, failed uint
+		for _, c := range counts {
+			total += c.Total
+			failed += c.Failed
+		}
+		rate := errorRate(total, failed)
+		return rate, total > 0 && total >= r.MinValidations && rate > r.Threshold, nil
+	}
+	errCounts, err := h.db.GetValidationErrorCounts(uint(r.ResourceID), wrappers.GranularityMinute, since)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get validation error counts: %w", err)
+	}
+	var n uint
+	for _, c := range errCounts {
+		if c.Path == r.Path && (r.ErrorType == "" || c.ErrorType == r.ErrorType) {
+			n += c.Count
+		}
+	}
+	return float64(n), float64(n) > r.Threshold, nil
+}
+
+// alertNotification returns the notification of a rule changing state.
+func (h *HavenAPIHandler) alertNotification(r wrappers.AlertRules) notifications.Notification {
+	n := notifications.Notification{
+		Namespace: h.namespace,
+		Resource:  r.Resource.Name,
+		Event:     notifications.EventAlertResolved,
+		Text:      fmt.Sprintf("Alert `%s` of resource %s has resolved", describeAlert(r), h.resourceText(r.Resource.Name)),
+	}
+	if r.State == AlertFiring {
+		n.Event = notifications.EventAlertFiring
+		value := fmt.Sprintf("%g errors", r.Value)
+		if r.Kind == AlertErrorRate {
+			value = fmt.Sprintf("error rate %.1f%%", r.Value*100)
+		}
+		n.Text = fmt.Sprintf("Alert `%s` of resource %s is firing: %s", describeAlert(r), h.resourceText(r.Resource.Name), value)
+	}
+	n.URL = h.resourceURL(r.Resource.Name)
+	return n
+}
+
+// EvaluateAlerts evaluates every alert rule of every namespace at now and notifies the rules
+// that start or stop firing. Rules that keep their state don't notify again.
+func (h *HavenAPIHandler) EvaluateAlerts(now time.Time) error {
+	rules, err := h.global.GetAlertRules(0)
+	if err != nil {
+		return fmt.Errorf("failed to get alert rules: %w", err)
+	}
+	notified := false
+	for _, r := range rules {
+		value, fires, err := h.evaluateAlert(r, now)
+		if err != nil {
+			log.Printf("failed to evaluate alert rule %d: %v", r.ID, err)
+			continue
+		}
+		state := AlertOK
+		if fires {
+			state = AlertFiring
+		}
+		r.Value = value
+		changed := state != r.State
+		if changed {
+			r.State = state
+			r.ChangedAt = &now
+		}
+		err = h.db.Transaction(func(t *gorm.DB) error {
+			if err := h.db.Save(&r, t); err != nil {
+				return fmt.Errorf("failed to save alert rule: %w", err)
+			}
+			if !changed {
+				return nil
+			}
+			// Alerts go through the routes of the namespace of the resource.
+			scoped := h.InNamespace(r.Resource.Namespace)
+			return scoped.enqueueNotification(scoped.alertNotification(r), t)
+		})
+		if err != nil {
+			log.Printf("failed to update alert rule %d: %v", r.ID, err)
+			continue
+		}
+		notified = notified || changed
+	}
+	if notified {
+		h.wakeOutbox()
+	}
+	return nil
+}
+
+// RunAlerts evaluates the alert rules every interval until the context is done.
+func (h *HavenAPIHandler) RunAlerts(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := h.EvaluateAlerts(time.Now()); err != nil {
+			log.Printf("failed to evaluate alerts: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SetAlertRule creates or replaces an alert rule. Replaced rules keep their state, so they
+// notify when they resolve under the new condition.
+func (h *HavenAPIHandler) SetAlertRule(request SetAlertRuleRequest) (*wrappers.AlertRules, error) {
+	window, err := time.ParseDuration(request.Window)
+	if err != nil {
+		return nil, newAPIError(http.StatusBadRequest, "failed to parse window: %v", err)
+	}
+	if window < time.Minute || window > maxAlertWindow {
+		return nil, newAPIError(http.StatusBadRequest, "window must be between 1m and %v", maxAlertWindow)
+	}
+	switch request.Kind {
+	case AlertErrorRate:
+		if request.Threshold < 0 || request.Threshold >= 1 {
+			return nil, newAPIError(http.StatusBadRequest, "error rate threshold must be between 0 and 1")
+		}
+	case AlertErrorPath:
+		if request.Path == "" {
+			return nil, newAPIError(http.StatusBadRequest, "error_path rules need a path")
+		}
+		if request.Threshold < 0 {
+			return nil, newAPIError(http.StatusBadRequest, "threshold must not be negative")
+		}
+	default:
+		return nil, newAPIError(http.StatusBadRequest, "unknown alert kind %q", request.Kind)
+	}
+	res, err := h.db.GetResource(request.Resource, nil)
+	if err != nil {
+		return nil, newAPIError(http.StatusInternalServerError, "failed to get resource from db: %v", err)
+	}
+	if res == nil {
+		return nil, newAPIError(http.StatusNotFound, "resource not found: %s", request.Resource)
+	}
+	rule := &wrappers.AlertRules{State: AlertOK}
+	if request.ID != 0 {
+		existing, err := h.db.GetAlertRule(request.ID)
+		if err != nil {
+			return nil, newAPIError(http.StatusInternalServerError, "failed to get alert rule from db: %v", err)
+		}
+		if existing == nil {
+			return nil, newAPIError(http.StatusNotFound, "alert rule not found: %d", request.ID)
+		}
+		rule = existing
+	}
+	rule.Resource = *res
+	rule.ResourceID = int(res.ID)
+	rule.Kind = request.Kind
+	rule.Threshold = request.Threshold
+	rule.Window = window
+	rule.MinValidations = request.MinValidations
+	rule.ErrorType = request.ErrorType
+	rule.Path = request.Path
+	if err := h.db.Save(rule, nil); err != nil {
+		return nil, newAPIError(http.StatusInternalServerError, "failed to save alert rule: %v", err)
+	}
+	return rule, nil
+}
+
+// getAlertRules lists the alert rules of a resource with their state.
+func (h *HavenAPIHandler) getAlertRules(c *gin.Context) {
+	var response GetAlertRulesResponse
+	res, err := h.db.GetResource(c.Params.ByName("name"), nil)
+	if err != nil {
+		response.Error = fmt.Sprintf("failed to get resource from db: %v", err)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+	if res == nil {
+		response.Error = fmt.Sprintf("resource not found: %s", c.Params.ByName("name"))
+		c.JSON(http.StatusNotFound, response)
+		return
+	}
+	rules, err := h.db.GetAlertRules(res.ID)
+	if err != nil {
+		response.Error = fmt.Sprintf("failed to get alert rules from db: %v", err)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+	response.Rules = make([]AlertRule, len(rules))
+	for i, r := range rules {
+		response.Rules[i] = newAlertRule(r)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// setAlertRule creates or replaces an alert rule.
+func (h *HavenAPIHandler) setAlertRule(c *gin.Context) {
+	var request SetAlertRuleRequest
+	var response SetAlertRuleResponse
+	if err := c.ShouldBindBodyWithJSON(&request); err != nil {
+		response.Error = fmt.Sprintf("failed to parse json request: %v", err)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+	rule, err := h.SetAlertRule(request)
+	if err != nil {
+		response.Error = err.Error()
+		c.JSON(statusCode(err), response)
+		return
+	}
+	response.Rule = newAlertRule(*rule)
+	c.JSON(http.StatusOK, response)
+}
+
+// deleteAlertRule deletes an alert rule.
+func (h *HavenAPIHandler) deleteAlertRule(c *gin.Context) {
+	var request DeleteAlertRuleRequest
+	var response DeleteAlertRuleResponse
+	if err := c.ShouldBindBodyWithJSON(&request); err != nil {
+		response.Error = fmt.Sprintf("failed to parse json request: %v", err)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+	deleted, err := h.db.DeleteAlertRule(request.ID)
+	if err != nil {
+		response.Error = fmt.Sprintf("failed to delete alert rule: %v", err)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+	if deleted == 0 {
+		response.Error = fmt.Sprintf("alert rule not found: %d", request.ID)
+		c.JSON(http.StatusNotFound, response)
+		return
+	}
+	response.Deleted = deleted
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"movinglake.com/haven/handler/notifications"
+	"movinglake.com/haven/wrappers"
+)
+
+func getAlertRules(router *gin.Engine, resource string) GetAlertRulesResponse {
+	request := httptest.NewRequest(http.MethodGet, "/api/v1/get_alert_rules/"+resource, nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	var rules GetAlertRulesResponse
+	json.Unmarshal(response.Body.Bytes(), &rules)
+	return rules
+}
+
+func TestAlertRules(t *testing.T) {
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	handler := NewHavenAPIHandler(db, nil)
+	sender := &recordingSender{}
+	handler.notifier.Register(notifications.SenderSlack, sender)
+	router := gin.Default()
+	handler.RegisterRoutes(router)
+	postJSON(router, "/api/v1/set_schema", SetSchemaRequest{Resource: "users", Schema: map[string]any{"type": "object"}})
+	deliver(handler)
+	sender.messages = nil
+
+	for _, tc := range []struct {
+		request SetAlertRuleRequest
+		code    int
+	}{
+		{SetAlertRuleRequest{Resource: "users", Kind: "latency", Window: "10m"}, http.StatusBadRequest},
+		{SetAlertRuleRequest{Resource: "users", Kind: AlertErrorRate, Window: "10"}, http.StatusBadRequest},
+		{SetAlertRuleRequest{Resource: "users", Kind: AlertErrorRate, Window: "10s"}, http.StatusBadRequest},
+		{SetAlertRuleRequest{Resource: "users", Kind: AlertErrorRate, Window: "10m", Threshold: 5}, http.StatusBadRequest},
+		{SetAlertRuleRequest{Resource: "users", Kind: AlertErrorPath, Window: "10m"}, http.StatusBadRequest},
+		{SetAlertRuleRequest{Resource: "orders", Kind: AlertErrorRate, Window: "10m"}, http.StatusNotFound},
+		{SetAlertRuleRequest{ID: 42, Resource: "users", Kind: AlertErrorRate, Window: "10m"}, http.StatusNotFound},
+	} {
+		response := postJSON(router, "/api/v1/set_alert_rule", tc.request)
+		assert.Equal(t, tc.code, response.Code, "%+v: %s", tc.request, response.Body.String())
+	}
+
+	response := postJSON(router, "/api/v1/set_alert_rule", SetAlertRuleRequest{Resource: "users", Kind: AlertErrorRate, Threshold: 0.05, Window: "10m", MinValidations: 10})
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	response = postJSON(router, "/api/v1/set_alert_rule", SetAlertRuleRequest{Resource: "users", Kind: AlertErrorPath, Window: "10m", ErrorType: "required", Path: "(root)"})
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	rules := getAlertRules(router, "users").Rules
+	assert.Equal(t, 2, len(rules))
+	assert.Equal(t, "10m0s", rules[0].Window)
+	assert.Equal(t, AlertOK, rules[0].State)
+
+	now := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	res, _ := db.GetResource("users", nil)
+	db.ValidationCounts = []wrappers.ValidationCounts{
+		{ResourceID: int(res.ID), Granularity: wrappers.GranularityMinute, Bucket: now.Add(-5 * time.Minute), Total: 30, Failed: 1},
+		{ResourceID: int(res.ID), Granularity: wrappers.GranularityMinute, Bucket: now.Add(-time.Minute), Total: 10, Failed: 4},
+		// Out of the window.
+		{ResourceID: int(res.ID), Granularity: wrappers.GranularityMinute, Bucket: now.Add(-time.Hour), Total: 100, Failed: 100},
+	}
+	db.ValidationErrors = []wrappers.ValidationErrorCounts{
+		{ResourceID: int(res.ID), Granularity: wrappers.GranularityMinute, Bucket: now.Add(-time.Minute), ErrorType: "invalid_type", Path: "(root)", Count: 3},
+	}
+
+	assert.NoError(t, handler.EvaluateAlerts(now))
+	deliver(handler)
+	assert.Equal(t, []string{"Alert `error rate > 5% over 10m0s` of resource `users` is firing: error rate 12.5%"}, sender.messages)
+	rules = getAlertRules(router, "users").Rules
+	assert.Equal(t, AlertFiring, rules[0].State)
+	assert.Equal(t, 0.125, rules[0].Value)
+	assert.Equal(t, AlertOK, rules[1].State)
+
+	// Rules that keep firing don't notify again.
+	db.ValidationErrors = append(db.ValidationErrors, wrappers.ValidationErrorCounts{
+		ResourceID: int(res.ID), Granularity: wrappers.GranularityMinute, Bucket: now, ErrorType: "required", Path: "(root)", Count: 1,
+	})
+	assert.NoError(t, handler.EvaluateAlerts(now.Add(time.Minute)))
+	deliver(handler)
+	assert.Equal(t, []string{
+		"Alert `error rate > 5% over 10m0s` of resource `users` is firing: error rate 12.5%",
+		"Alert `more than 0 required errors on (root) over 10m0s` of resource `users` is firing: 1 errors",
+	}, sender.messages)
+
+	// Rules resolve once the failures leave the window.
+	sender.messages = nil
+	assert.NoError(t, handler.EvaluateAlerts(now.Add(time.Hour)))
+	deliver(handler)
+	assert.Equal(t, []string{
+		"Alert `error rate > 5% over 10m0s` of resource `users` has resolved",
+		"Alert `more than 0 required errors on (root) over 10m0s` of resource `users` has resolved",
+	}, sender.messages)
+	for _, r := range getAlertRules(router, "users").Rules {
+		assert.Equal(t, AlertOK, r.State)
+		assert.Equal(t, now.Add(time.Hour), *r.ChangedAt)
+	}
+
+	// Too few validations don't fire.
+	sender.messages = nil
+	db.ValidationCounts = []wrappers.ValidationCounts{
+		{ResourceID: int(res.ID), Granularity: wrappers.GranularityMinute, Bucket: now, Total: 5, Failed: 5},
+	}
+	db.ValidationErrors = nil
+	assert.NoError(t, handler.EvaluateAlerts(now))
+	deliver(handler)
+	assert.Empty(t, sender.messages)
+
+	response = postJSON(router, "/api/v1/delete_alert_rule", DeleteAlertRuleRequest{ID: rules[0].ID})
+	assert.Equal(t, http.StatusOK, response.Code)
+	response = postJSON(router, "/api/v1/delete_alert_rule", DeleteAlertRuleRequest{ID: rules[0].ID})
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	assert.Equal(t, 1, len(getAlertRules(router, "users").Rules))
+}
+
+func TestAlertRoutes(t *testing.T) {
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	handler := NewHavenAPIHandler(db, nil)
+	versions, alerts := &recordingSender{}, &recordingSender{}
+	handler.notifier.Register(notifications.SenderSlack, versions)
+	handler.notifier.Register(notifications.SenderWebhook, alerts)
+	router := gin.Default()
+	handler.RegisterRoutes(router)
+	postJSON(router, "/api/v1/set_notification_route", SetNotificationRouteRequest{Resource: "*", EventType: notifications.EventVersionAdded, Sender: notifications.SenderSlack})
+	postJSON(router, "/api/v1/set_notification_route", SetNotificationRouteRequest{Resource: "*", EventType: notifications.EventAlertFiring, Sender: notifications.SenderWebhook})
+	postJSON(router, "/api/v1/add_payload", AddPayloadRequest{Resource: "users", Payload: map[string]any{"name": "Ann"}})
+	postJSON(router, "/api/v1/set_alert_rule", SetAlertRuleRequest{Resource: "users", Kind: AlertErrorPath, Window: "5m", Path: "(root).name"})
+
+	now := time.Now()
+	res, _ := db.GetResource("users", nil)
+	db.ValidationErrors = []wrappers.ValidationErrorCounts{
+		{ResourceID: int(res.ID), Granularity: wrappers.GranularityMinute, Bucket: now.UTC().Truncate(time.Minute), ErrorType: "required", Path: "(root).name", Count: 2},
+	}
+	assert.NoError(t, handler.EvaluateAlerts(now))
+	deliver(handler)
+	assert.Equal(t, []string{"New version `1` of schema for resource `users` has been added"}, versions.messages)
+	assert.Equal(t, []string{"Alert `more than 0 errors on (root).name over 5m0s` of resource `users` is firing: 2 errors"}, alerts.messages)
+}
@@ -3,8 +3,8 @@ package handler
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
+	"sort"
 	"strconv"
 	"time"
 
@@ -13,6 +13,7 @@ import (
 	"gorm.io/gorm"
 	"movinglake.com/haven/handler/jsonutils"
 	"movinglake.com/haven/handler/notifications"
+	"movinglake.com/haven/telemetry"
 	"movinglake.com/haven/wrappers"
 )
 
@@ -20,22 +21,81 @@ import (
 
 // We need to hold DB connections.
 type HavenAPIHandler struct {
-	db      wrappers.DB
-	slacker notifications.Sender
-}
-
-// NotificationsConfig holds the configuration for notifications.
+	// db is restricted to the namespace of the handler, global is not. The handler returned by
+	// NewHavenAPIHandler works on the default namespace.
+	db              wrappers.DB
+	global          wrappers.DB
+	namespace       string
+	notifier        *notifications.Registry
+	baseURL         string
+	quarantineLimit uint
+	versionHooks    []func(VersionEvent)
+	// outboxWake signals RunOutbox that notifications were enqueued.
+	outboxWake chan struct{}
+	events     *eventBroker
+	auth       *apiKeyAuth
+}
+
+// NotificationsConfig holds the configuration for notifications. Every sender with its
+// settings filled is notified.
 type NotificationsConfig struct {
 	SlackToken     string
 	SlackChannelID string
+	// WebhookURL receives JSON posts signed with WebhookSecret.
+	WebhookURL    string
+	WebhookSecret string
+	// SMTPAddr is the host:port of the SMTP server emailing SMTPTo.
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+	SMTPTo       []string
+	// TeamsWebhookURL is a Microsoft Teams incoming webhook.
+	TeamsWebhookURL string
+	// PagerDutyRoutingKey is the integration key of a PagerDuty Events API v2 service.
+	PagerDutyRoutingKey string
+	// BaseURL is the external URL of Haven, used to link resource pages from notifications.
+	BaseURL string
+}
+
+// Registry returns the registry of the configured senders.
+func (nc *NotificationsConfig) Registry() *notifications.Registry {
+	r := notifications.NewRegistry()
+	senders := []struct {
+		name   string
+		sender notifications.Sender
+	}{
+		{notifications.SenderSlack, notifications.NewSlackSender(nc.SlackToken, nc.SlackChannelID)},
+		{notifications.SenderWebhook, notifications.NewWebhookSender(nc.WebhookURL, nc.WebhookSecret)},
+		{notifications.SenderEmail, notifications.NewEmailSender(nc.SMTPAddr, nc.SMTPUsername, nc.SMTPPassword, nc.SMTPFrom, nc.SMTPTo)},
+		{notifications.SenderTeams, notifications.NewTeamsSender(nc.TeamsWebhookURL)},
+		{notifications.SenderPagerDuty, notifications.NewPagerDutySender(nc.PagerDutyRoutingKey)},
+	}
+	for _, s := range senders {
+		if s.sender.IsActive() {
+			r.Register(s.name, s.sender)
+		}
+	}
+	return r
 }
 
 func NewHavenAPIHandler(db wrappers.DB, nc *NotificationsConfig) *HavenAPIHandler {
 	handler := &HavenAPIHandler{
-		db: db,
+		db:              db,
+		global:          db,
+		namespace:       wrappers.DefaultNamespace,
+		notifier:        notifications.NewRegistry(),
+		quarantineLimit: DefaultQuarantineLimit,
+		outboxWake:      make(chan struct{}, 1),
+		events:          newEventBroker(),
+		auth:            &apiKeyAuth{db: db},
+	}
+	if db != nil {
+		handler.db = db.WithNamespace(wrappers.DefaultNamespace)
 	}
 	if nc != nil {
-		handler.slacker = notifications.NewSlackSender(nc.SlackToken, nc.SlackChannelID)
+		handler.notifier = nc.Registry()
+		handler.baseURL = nc.BaseURL
 	}
 	return handler
 }
@@ -67,12 +127,17 @@ type AddPayloadResponse struct {
 type ValidatePayloadRequest struct {
 	Resource string      `json:"resource"`
 	Payload  interface{} `json:"payload"`
+	// RecordFailures stores invalid payloads in the quarantine table.
+	RecordFailures bool `json:"record_failures"`
+	// OutputFormat adds the errors in a JSON Schema output format ("basic" or "detailed").
+	OutputFormat string `json:"output_format"`
 }
 
 type ValidatePayloadResponse struct {
 	APIResponse
 	Valid            bool            `json:"valid"`
 	ValidationErrors []ErrorResponse `json:"validation_errors"`
+	Output           *OutputUnit     `json:"output,omitempty"`
 }
 
 type GetSchemaResponse struct {
@@ -136,138 +201,32 @@ func (h *HavenAPIHandler) addPayload(c *gin.Context) {
 		return
 	}
 
-	if request.Resource == "" {
-		response.Error = "resource name is required"
-		c.JSON(http.StatusBadRequest, response)
+	applied, err := h.applyPayload(request.Resource, request.Payload)
+	if err != nil {
+		response.Error = err.Error()
+		c.JSON(statusCode(err), response)
 		return
 	}
-
-	// Get the schema of the resource.
-	h.db.Transaction(func(t *gorm.DB) error {
-		r, err := h.db.SelectResourceForUpdate(request.Resource, t)
-		if err != nil {
-			response.Error = fmt.Sprintf("failed to get resource from db: %v", err)
-			c.JSON(http.StatusBadRequest, response)
-			return err
-		}
-
-		schema := make(map[string]interface{})
-		if r != nil && r.ID != 0 {
-			if err := json.Unmarshal([]byte(r.Schema), &schema); err != nil {
-				response.Error = fmt.Sprintf("failed to unmarshal schema: %v \"%v\"", err, r.Schema)
-				c.JSON(http.StatusInternalServerError, response)
-				return err
-			}
-		}
-
-		newSchema, err := jsonutils.ApplyPayload(schema, request.Payload, request.Resource)
-		if err != nil {
-			response.Error = fmt.Sprintf("failed to apply payload: %v", err)
-			c.JSON(http.StatusInternalServerError, response)
-			return err
-		}
-
-		if newSchema == nil {
-			// No changes to existing schema.
-			log.Printf("no changes to the schema for resource %v", request.Resource)
-			response.Success = true
-			response.Resource = ResourceResp{
-				ID:        r.ID,
-				Name:      r.Name,
-				Schema:    schema,
-				Version:   r.Version,
-				CreatedAt: r.CreatedAt,
-				UpdatedAt: r.UpdatedAt,
-			}
-			c.JSON(http.StatusOK, response)
-			return nil
-		}
-		log.Printf("changes found to the schema for resource %s", request.Resource)
-
-		// Save the new schema.
-		newSchemaBytes, err := json.Marshal(newSchema)
-		if err != nil {
-			response.Error = fmt.Sprintf("failed to marshal new schema: %v", err)
-			c.JSON(http.StatusInternalServerError, response)
-			return err
-		}
-		r.Version += 1
-		oldSchema := r.Schema
-		r.Schema = string(newSchemaBytes)
-		r.Name = request.Resource
-		if err := h.db.Save(r, t); err != nil {
-			response.Error = fmt.Sprintf("failed to save resource: %v", err)
-			c.JSON(http.StatusInternalServerError, response)
-			return err
-		}
-
-		// Save the reference payload.
-		payloadBytes, err := json.Marshal(request.Payload)
-		if err != nil {
-			response.Error = fmt.Sprintf("failed to marshal payload: %v", err)
-			c.JSON(http.StatusInternalServerError, response)
-			return err
-		}
-		refPayload := &wrappers.ReferencePayloads{
-			Resource: *r,
-			Payload:  string(payloadBytes),
-		}
-		if err := h.db.Save(refPayload, t); err != nil {
-			response.Error = fmt.Sprintf("failed to save reference payload: %v", err)
-			c.JSON(http.StatusInternalServerError, response)
-			return err
-		}
-
-		// Save the new version.
-		rv := &wrappers.ResourceVersions{
-			Resource:         *r,
-			ReferencePayload: refPayload,
-			OldSchema:        oldSchema,
-			NewSchema:        string(newSchemaBytes),
-			Version:          r.Version,
-		}
-
-		if err := h.db.Save(rv, t); err != nil {
-			response.Error = fmt.Sprintf("failed to save resource version: %v", err)
-			c.JSON(http.StatusInternalServerError, response)
-			return err
-		}
-		if h.slacker != nil && h.slacker.IsActive() {
-			log.Printf("sending slack message for new version of schema for resource %s", request.Resource)
-			err := h.slacker.SendMessage(
-				fmt.Sprintf("New version `%d` of schema for resource `%s` has been added",
-					r.Version,
-					request.Resource))
-			if err != nil {
-				log.Printf("failed to send slack message: %v", err)
-			}
-		} else {
-			log.Printf("slack not configured, skipping sending message for new version of schema for resource %s", request.Resource)
-		}
-		response.Success = true
-		var schemaMap map[string]any
-		if err := json.Unmarshal(newSchemaBytes, &schemaMap); err != nil {
-			response.Error = fmt.Sprintf("failed to unmarshal new schema: %v", err)
-			c.JSON(http.StatusInternalServerError, response)
-			return err
-		}
-		response.Resource = ResourceResp{
-			ID:        r.ID,
-			Name:      r.Name,
-			Schema:    schemaMap,
-			Version:   r.Version,
-			CreatedAt: r.CreatedAt,
-			UpdatedAt: r.UpdatedAt,
-		}
-		c.JSON(http.StatusOK, response)
-		return nil
-	})
+	response.Success = true
+	response.Resource = ResourceResp{
+		ID:        applied.resource.ID,
+		Name:      applied.resource.Name,
+		Schema:    applied.schema,
+		Version:   applied.resource.Version,
+		CreatedAt: applied.resource.CreatedAt,
+		UpdatedAt: applied.resource.UpdatedAt,
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 type ErrorResponse struct {
 	Type        string         `json:"type"`
 	Description string         `json:"description"`
 	Context     map[string]any `json:"context"`
+	// InstanceLocation is the RFC 6901 JSON Pointer to the invalid payload location.
+	InstanceLocation string `json:"instance_location"`
+	// KeywordLocation is the RFC 6901 JSON Pointer to the failing schema keyword.
+	KeywordLocation string `json:"keyword_location"`
 }
 
 func toPath(ctx *gojsonschema.JsonContext) string {
@@ -279,6 +238,27 @@ func toPath(ctx *gojsonschema.JsonContext) string {
 	return path
 }
 
+// ToErrorResponses converts the validation errors of result into their API representation.
+func ToErrorResponses(schema map[string]any, result *gojsonschema.Result) []ErrorResponse {
+	var errs []ErrorResponse
+	for _, e := range result.Errors() {
+		errs = append(errs, ErrorResponse{
+			Type:        e.Type(),
+			Description: e.Description(),
+			Context: map[string]any{
+				"field":    e.Details()["field"],
+				"property": e.Details()["property"],
+				"expected": e.Details()["expected"],
+				"given":    e.Details()["given"],
+				"path":     toPath(e.Context()),
+			},
+			InstanceLocation: jsonutils.InstancePointer(e.Context()),
+			KeywordLocation:  jsonutils.KeywordPointer(schema, e.Context(), e.Type()),
+		})
+	}
+	return errs
+}
+
 // validatePayload validates the payload against the schema.
 func (h *HavenAPIHandler) validatePayload(c *gin.Context) {
 	var request ValidatePayloadRequest
@@ -288,169 +268,122 @@ func (h *HavenAPIHandler) validatePayload(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, response)
 		return
 	}
-	// Get the schema of the resource.
-	res, err := h.db.GetResource(request.Resource, nil)
-	if err != nil {
-		response.Error = fmt.Sprintf("failed to get resource from db: %v", err)
+	if !validOutputFormat(request.OutputFormat) {
+		response.Error = fmt.Sprintf("unknown output format: %s", request.OutputFormat)
 		c.JSON(http.StatusBadRequest, response)
 		return
 	}
-
-	schema := make(map[string]any)
-	if err := json.Unmarshal([]byte(res.Schema), &schema); err != nil {
-		response.Error = fmt.Sprintf("failed to unmarshal schema: %v", err)
-		c.JSON(http.StatusInternalServerError, response)
-		return
-	}
-
-	result, err := jsonutils.ValidatePayload(schema, request.Payload)
+	_, errs, err := h.checkPayload(request.Resource, request.Payload, request.RecordFailures)
 	if err != nil {
-		response.Error = fmt.Sprintf("failed to validate payload: %v", err)
-		c.JSON(http.StatusInternalServerError, response)
-		return
-	}
-	if !result.Valid() {
-		var errs []ErrorResponse
-		for _, e := range result.Errors() {
-			errs = append(errs, ErrorResponse{
-				Type:        e.Type(),
-				Description: e.Description(),
-				Context: map[string]any{
-					"field":    e.Details()["field"],
-					"property": e.Details()["property"],
-					"expected": e.Details()["expected"],
-					"given":    e.Details()["given"],
-					"path":     toPath(e.Context()),
-				},
-			})
-		}
-		response.Valid = false
-		response.ValidationErrors = errs
-		c.JSON(http.StatusOK, response)
+		response.Error = err.Error()
+		c.JSON(statusCode(err), response)
 		return
 	}
-
-	response.Valid = true
+	response.Valid = len(errs) == 0
+	response.ValidationErrors = errs
+	response.Output, _ = buildOutput(request.OutputFormat, errs)
 	c.JSON(http.StatusOK, response)
 }
 
-// getSchema returns the schema of the resource.
+// getSchema returns the schema of the resource, as JSON Schema unless ?format= asks for avro or
+// proto.
 func (h *HavenAPIHandler) getSchema(c *gin.Context) {
+	if format := c.DefaultQuery("format", FormatJSONSchema); format != FormatJSONSchema {
+		h.convertedSchema(c, format)
+		return
+	}
 	var response GetSchemaResponse
-	res, err := h.db.GetResource(c.Params.ByName("name"), nil)
+	schema, err := h.GetSchema(c.Params.ByName("name"))
 	if err != nil {
-		response.Error = fmt.Sprintf("failed to get resource from db: %v", err)
-		c.JSON(http.StatusInternalServerError, response)
+		response.Error = err.Error()
+		c.JSON(statusCode(err), response)
 		return
 	}
-	if res == nil {
+	if schema == nil {
 		response.Error = fmt.Sprintf("resource not found: %s", c.Params.ByName("name"))
 		c.JSON(http.StatusNotFound, response)
 		return
 	}
-	response.Schema = make(map[string]any)
-	if err := json.Unmarshal([]byte(res.Schema), &response.Schema); err != nil {
-		response.Error = fmt.Sprintf("failed to unmarshal DB schema: %v", err)
-		c.JSON(http.StatusInternalServerError, response)
-		return
-	}
+	response.Schema = schema
 	c.JSON(http.StatusOK, response)
 }
 
-func (h *HavenAPIHandler) setSchemaNewResource(c *gin.Context, request SetSchemaRequest, response *SetSchemaResponse) {
-	m, err := json.Marshal(request.Schema)
+// storeSchema saves the schema as a new version of the resource, creating the resource if it
+// does not exist.
+func (h *HavenAPIHandler) storeSchema(name string, schema map[string]any, source string) (*wrappers.Resource, error) {
+	res, err := h.db.GetResource(name, nil)
 	if err != nil {
-		response.Error = fmt.Sprintf("failed to marshal schema: %v", err)
-		c.JSON(http.StatusInternalServerError, response)
-		return
+		return nil, newAPIError(http.StatusInternalServerError, "failed to get resource from db: %v", err)
+	}
+	m, err := json.Marshal(schema)
+	if err != nil {
+		return nil, newAPIError(http.StatusInternalServerError, "failed to marshal schema: %v", err)
 	}
-	// Create a new resource.
-	res := &wrappers.Resource{
-		Name:    request.Resource,
-		Schema:  string(m),
-		Version: 1,
+	var oldSchema string
+	if res == nil {
+		// Create a new resource with the schema.
+		res = &wrappers.Resource{Name: name, Version: 1}
+	} else {
+		oldSchema = res.Schema
+		res.Version += 1
+	}
+	res.Schema = string(m)
+	rv := &wrappers.ResourceVersions{
+		OldSchema: oldSchema,
+		NewSchema: res.Schema,
+		Version:   res.Version,
 	}
-	h.db.Transaction(func(t *gorm.DB) error {
+	err = h.db.Transaction(func(t *gorm.DB) error {
 		if err := h.db.Save(res, t); err != nil {
-			response.Error = fmt.Sprintf("failed to save resource: %v", err)
-			c.JSON(http.StatusInternalServerError, response)
-			return err
+			return newAPIError(http.StatusInternalServerError, "failed to save resource: %v", err)
 		}
 
 		// Save the new version.
-		rv := &wrappers.ResourceVersions{
-			Resource:  *res,
-			OldSchema: "",
-			NewSchema: res.Schema,
-			Version:   res.Version,
-		}
+		rv.Resource = *res
 		if err := h.db.Save(rv, t); err != nil {
-			response.Error = fmt.Sprintf("failed to save resource version: %v", err)
-			c.JSON(http.StatusInternalServerError, response)
-			return err
+			return newAPIError(http.StatusInternalServerError, "failed to save resource version: %v", err)
 		}
-
-		response.Resource = ResourceResp{
-			ID:        res.ID,
-			Name:      res.Name,
-			Schema:    request.Schema,
-			Version:   res.Version,
-			CreatedAt: res.CreatedAt,
-			UpdatedAt: res.UpdatedAt,
-		}
-		response.Success = true
-		c.JSON(http.StatusOK, response)
-		return nil
+		// Only the versions learned from payloads notify people, webhooks get every version.
+		return h.enqueueWebhooks(rv, t)
 	})
+	if err != nil {
+		return nil, err
+	}
+	h.versionAdded(newVersionEvent(rv, source))
+	h.wakeOutbox()
+	return res, nil
+}
+
+// SetSchema saves the schema as a new version of the resource, creating the resource if it
+// does not exist.
+func (h *HavenAPIHandler) SetSchema(name string, schema map[string]any) (*wrappers.Resource, error) {
+	return h.storeSchema(name, schema, SourceSetSchema)
 }
 
-func (h *HavenAPIHandler) setSchemaExistingResource(c *gin.Context, request SetSchemaRequest, response *SetSchemaResponse, existingResource *wrappers.Resource) {
-	schemaBytes, err := json.Marshal(request.Schema)
+// GetSchema returns the current schema of the resource, or nil if the resource does not exist.
+func (h *HavenAPIHandler) GetSchema(name string) (map[string]any, error) {
+	res, err := h.db.GetResource(name, nil)
 	if err != nil {
-		response.Error = fmt.Sprintf("failed to marshal schema: %v", err)
-		c.JSON(http.StatusInternalServerError, response)
-		return
+		return nil, newAPIError(http.StatusInternalServerError, "failed to get resource from db: %v", err)
 	}
-	oldSchema := existingResource.Schema
-	existingResource.Schema = string(schemaBytes)
-	existingResource.Version += 1
-	h.db.Transaction(func(t *gorm.DB) error {
-		if err := h.db.Save(existingResource, t); err != nil {
-			response.Error = fmt.Sprintf("failed to save resource: %v", err)
-			c.JSON(http.StatusInternalServerError, response)
-			return err
-		}
+	if res == nil {
+		return nil, nil
+	}
+	schema := make(map[string]any)
+	if err := json.Unmarshal([]byte(res.Schema), &schema); err != nil {
+		return nil, newAPIError(http.StatusInternalServerError, "failed to unmarshal DB schema: %v", err)
+	}
+	return schema, nil
+}
 
-		// Save the new version.
-		rv := &wrappers.ResourceVersions{
-			Resource:  *existingResource,
-			OldSchema: oldSchema,
-			NewSchema: existingResource.Schema,
-			Version:   existingResource.Version,
-		}
-		if err := h.db.Save(rv, t); err != nil {
-			response.Error = fmt.Sprintf("failed to save resource version: %v", err)
-			c.JSON(http.StatusInternalServerError, response)
-			return err
-		}
-		response.Success = true
-		var schema map[string]any
-		if err := json.Unmarshal(schemaBytes, &schema); err != nil {
-			response.Error = fmt.Sprintf("failed to unmarshal schema: %v", err)
-			c.JSON(http.StatusInternalServerError, response)
-			return err
-		}
-		response.Resource = ResourceResp{
-			ID:        existingResource.ID,
-			Name:      existingResource.Name,
-			Schema:    schema,
-			Version:   existingResource.Version,
-			CreatedAt: existingResource.CreatedAt,
-			UpdatedAt: existingResource.UpdatedAt,
-		}
-		c.JSON(http.StatusOK, response)
-		return nil
-	})
+// Resources returns the resources with their current schema and version, sorted by name.
+func (h *HavenAPIHandler) Resources() ([]wrappers.Resource, error) {
+	resources, err := h.db.GetAllResources()
+	if err != nil {
+		return nil, newAPIError(http.StatusInternalServerError, "failed to get resources from db: %v", err)
+	}
+	sort.Slice(resources, func(i, j int) bool { return resources[i].Name < resources[j].Name })
+	return resources, nil
 }
 
 // setSchema sets the schema of the resource.
@@ -462,18 +395,22 @@ func (h *HavenAPIHandler) setSchema(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, response)
 		return
 	}
-	dbRes, err := h.db.GetResource(request.Resource, nil)
+	res, err := h.SetSchema(request.Resource, request.Schema)
 	if err != nil {
-		response.Error = fmt.Sprintf("failed to get resource from db: %v", err)
-		c.JSON(http.StatusInternalServerError, response)
+		response.Error = err.Error()
+		c.JSON(statusCode(err), response)
 		return
 	}
-	if dbRes == nil {
-		// Create a new resource with the request's schema.
-		h.setSchemaNewResource(c, request, &response)
-		return
+	response.Resource = ResourceResp{
+		ID:        res.ID,
+		Name:      res.Name,
+		Schema:    request.Schema,
+		Version:   res.Version,
+		CreatedAt: res.CreatedAt,
+		UpdatedAt: res.UpdatedAt,
 	}
-	h.setSchemaExistingResource(c, request, &response, dbRes)
+	response.Success = true
+	c.JSON(http.StatusOK, response)
 }
 
 // getResource returns the full resource.
@@ -536,6 +473,29 @@ func (h *HavenAPIHandler) getResources(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// newResourceVersionsResponse decodes the schemas of a version. The old schema of the first
+// version is empty.
+func newResourceVersionsResponse(v wrappers.ResourceVersions) (ResourceVersionsResponse, error) {
+	r := ResourceVersionsResponse{
+		ID:        v.ID,
+		Version:   v.Version,
+		Resource:  uint(v.ResourceID),
+		OldSchema: make(map[string]any),
+	}
+	if v.OldSchema != "" {
+		if err := json.Unmarshal([]byte(v.OldSchema), &r.OldSchema); err != nil {
+			return r, fmt.Errorf("failed to unmarshal old schema: %v", err)
+		}
+	}
+	if err := json.Unmarshal([]byte(v.NewSchema), &r.NewSchema); err != nil {
+		return r, fmt.Errorf("failed to unmarshal new schema: %v", err)
+	}
+	if v.ReferencePayload != nil {
+		r.ReferencePayload = v.ReferencePayload.ID
+	}
+	return r, nil
+}
+
 func (h *HavenAPIHandler) getResourceVersion(c *gin.Context) {
 	var response GetResourceVersionResponse
 	idStr := c.Params.ByName("id")
@@ -556,28 +516,12 @@ func (h *HavenAPIHandler) getResourceVersion(c *gin.Context) {
 		c.JSON(http.StatusNotFound, response)
 		return
 	}
-	response.Version = ResourceVersionsResponse{
-		ID:        version.ID,
-		Version:   version.Version,
-		Resource:  uint(version.ResourceID),
-		OldSchema: make(map[string]any),
-		NewSchema: make(map[string]any),
-	}
-	if version.OldSchema != "" {
-		if err := json.Unmarshal([]byte(version.OldSchema), &response.Version.OldSchema); err != nil {
-			response.Error = fmt.Sprintf("failed to unmarshal old schema: %v", err)
-			c.JSON(http.StatusInternalServerError, response)
-			return
-		}
-	}
-	if err := json.Unmarshal([]byte(version.NewSchema), &response.Version.NewSchema); err != nil {
-		response.Error = fmt.Sprintf("failed to unmarshal new schema: %v", err)
+	response.Version, err = newResourceVersionsResponse(version)
+	if err != nil {
+		response.Error = err.Error()
 		c.JSON(http.StatusInternalServerError, response)
 		return
 	}
-	if version.ReferencePayload != nil {
-		response.Version.ReferencePayload = version.ReferencePayload.ID
-	}
 	c.JSON(http.StatusOK, response)
 }
 
@@ -603,30 +547,12 @@ func (h *HavenAPIHandler) getResourceVersions(c *gin.Context) {
 		return
 	}
 	for _, v := range versions {
-		var oldSchema map[string]any
-		if v.OldSchema == "" {
-			oldSchema = make(map[string]any)
-		} else if err := json.Unmarshal([]byte(v.OldSchema), &oldSchema); err != nil {
-			response.Error = fmt.Sprintf("failed to unmarshal old schema: %v", err)
-			c.JSON(http.StatusInternalServerError, response)
-			return
-		}
-		var newSchema map[string]any
-		if err := json.Unmarshal([]byte(v.NewSchema), &newSchema); err != nil {
-			response.Error = fmt.Sprintf("failed to unmarshal new schema: %v", err)
+		r, err := newResourceVersionsResponse(v)
+		if err != nil {
+			response.Error = err.Error()
 			c.JSON(http.StatusInternalServerError, response)
 			return
 		}
-		r := ResourceVersionsResponse{
-			ID:        v.ID,
-			Version:   v.Version,
-			Resource:  uint(v.ResourceID),
-			OldSchema: oldSchema,
-			NewSchema: newSchema,
-		}
-		if v.ReferencePayload != nil {
-			r.ReferencePayload = v.ReferencePayload.ID
-		}
 		response.Versions = append(response.Versions, r)
 	}
 	c.JSON(http.StatusOK, response)
@@ -658,20 +584,72 @@ func (h *HavenAPIHandler) getReferencePayload(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// namespaceRoute is an API route of a namespace. Once API keys are required, it requires a key
+// granted the scope.
+type namespaceRoute struct {
+	method string
+	path   string
+	scope  string
+	handle func(*HavenAPIHandler, *gin.Context)
+}
+
+var namespaceRoutes = []namespaceRoute{
+	{http.MethodPost, "/add_payload", ScopeIngest, (*HavenAPIHandler).addPayload},
+	{http.MethodPost, "/validate_payload", ScopeValidate, (*HavenAPIHandler).validatePayload},
+	{http.MethodGet, "/get_schema/:name", ScopeRead, (*HavenAPIHandler).getSchema},
+	{http.MethodPost, "/set_schema", ScopeAdmin, (*HavenAPIHandler).setSchema},
+	{http.MethodGet, "/get_resource/:name", ScopeRead, (*HavenAPIHandler).getResource},
+	{http.MethodGet, "/get_all_resources", ScopeRead, (*HavenAPIHandler).getResources},
+	{http.MethodGet, "/get_resource_version/:id", ScopeRead, (*HavenAPIHandler).getResourceVersion},
+	{http.MethodGet, "/get_resource_versions/:id", ScopeRead, (*HavenAPIHandler).getResourceVersions},
+	{http.MethodGet, "/get_reference_payload/:id", ScopeRead, (*HavenAPIHandler).getReferencePayload},
+	{http.MethodGet, "/get_quarantined_payloads/:name", ScopeRead, (*HavenAPIHandler).getQuarantinedPayloads},
+	{http.MethodPost, "/purge_quarantined_payloads", ScopeAdmin, (*HavenAPIHandler).purgeQuarantinedPayloads},
+	{http.MethodPost, "/set_quarantine_limit", ScopeAdmin, (*HavenAPIHandler).setQuarantineLimit},
+	{http.MethodGet, "/metrics/:name", ScopeRead, (*HavenAPIHandler).getMetrics},
+	{http.MethodPost, "/set_sampling", ScopeAdmin, (*HavenAPIHandler).setSampling},
+	{http.MethodPost, "/validate_stream/:name", ScopeValidate, (*HavenAPIHandler).validateStream},
+	{http.MethodGet, "/export", ScopeRead, (*HavenAPIHandler).exportBundle},
+	{http.MethodPost, "/import", ScopeAdmin, (*HavenAPIHandler).importBundle},
+	{http.MethodGet, "/codegen/:name", ScopeRead, (*HavenAPIHandler).codegen},
+	{http.MethodGet, "/openapi", ScopeRead, (*HavenAPIHandler).openAPI},
+	{http.MethodPost, "/import_schemas", ScopeAdmin, (*HavenAPIHandler).importSchemas},
+	{http.MethodGet, "/ddl/:name", ScopeRead, (*HavenAPIHandler).ddl},
+	{http.MethodGet, "/ddl_migration/:name", ScopeRead, (*HavenAPIHandler).ddlMigration},
+	{http.MethodGet, "/get_notification_routes", ScopeAdmin, (*HavenAPIHandler).getNotificationRoutes},
+	{http.MethodPost, "/set_notification_route", ScopeAdmin, (*HavenAPIHandler).setNotificationRoute},
+	{http.MethodPost, "/delete_notification_route", ScopeAdmin, (*HavenAPIHandler).deleteNotificationRoute},
+	{http.MethodGet, "/get_notification_deliveries", ScopeAdmin, (*HavenAPIHandler).getNotificationDeliveries},
+	{http.MethodPost, "/retry_notification", ScopeAdmin, (*HavenAPIHandler).retryNotification},
+	{http.MethodGet, "/get_alert_rules/:name", ScopeAdmin, (*HavenAPIHandler).getAlertRules},
+	{http.MethodPost, "/set_alert_rule", ScopeAdmin, (*HavenAPIHandler).setAlertRule},
+	{http.MethodPost, "/delete_alert_rule", ScopeAdmin, (*HavenAPIHandler).deleteAlertRule},
+	{http.MethodGet, "/get_webhooks", ScopeAdmin, (*HavenAPIHandler).getWebhooks},
+	{http.MethodPost, "/set_webhook", ScopeAdmin, (*HavenAPIHandler).setWebhook},
+	{http.MethodPost, "/delete_webhook", ScopeAdmin, (*HavenAPIHandler).deleteWebhook},
+	{http.MethodGet, "/get_webhook_deliveries/:id", ScopeAdmin, (*HavenAPIHandler).getWebhookDeliveries},
+	{http.MethodGet, "/events", ScopeRead, (*HavenAPIHandler).streamEvents},
+}
+
 func (h *HavenAPIHandler) RegisterRoutes(e *gin.Engine) error {
+	e.Use(telemetry.Middleware())
+	e.GET("/metrics", h.auth.requireUnbound(ScopeRead), telemetry.Handler())
 	e.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{
 			"message": "OK",
 		})
 	})
-	e.POST("/api/v1/add_payload", h.addPayload)
-	e.POST("/api/v1/validate_payload", h.validatePayload)
-	e.GET("/api/v1/get_schema/:name", h.getSchema)
-	e.POST("/api/v1/set_schema", h.setSchema)
-	e.GET("/api/v1/get_resource/:name", h.getResource)
-	e.GET("/api/v1/get_all_resources", h.getResources)
-	e.GET("/api/v1/get_resource_version/:id", h.getResourceVersion)
-	e.GET("/api/v1/get_resource_versions/:id", h.getResourceVersions)
-	e.GET("/api/v1/get_reference_payload/:id", h.getReferencePayload)
+	// Resource routes are served for the default namespace under /api/v1 and for any namespace
+	// under /api/v1/namespaces/:namespace.
+	for _, g := range []*gin.RouterGroup{e.Group("/api/v1"), e.Group("/api/v1/namespaces/:namespace")} {
+		g.Use(withNamespace)
+		for _, r := range namespaceRoutes {
+			g.Handle(r.method, r.path, h.auth.require(r.scope), h.scoped(r.handle))
+		}
+	}
+	e.GET("/api/v1/get_namespaces", h.auth.require(ScopeRead), h.getNamespaces)
+	e.GET("/api/v1/get_api_keys", h.auth.require(ScopeAdmin), h.getAPIKeys)
+	e.POST("/api/v1/create_api_key", h.auth.require(ScopeAdmin), h.createAPIKey)
+	e.POST("/api/v1/revoke_api_key", h.auth.require(ScopeAdmin), h.revokeAPIKey)
 	return nil
 }
@@ -119,6 +119,19 @@ func TestAddPayload(t *testing.T) {
 			},
 			wantCode: http.StatusInternalServerError,
 		},
+		{
+			name: "Schema can't be expanded",
+			dbResource: &wrappers.Resource{
+				Name:    "users",
+				Schema:  "{\"type\": 5}",
+				Version: 1,
+			},
+			request: &AddPayloadRequest{
+				Resource: "users",
+				Payload:  map[string]interface{}{"name": "John Doe", "age": 30},
+			},
+			wantCode: http.StatusInternalServerError,
+		},
 		{
 			name: "DB failed to find",
 			dbErrors: map[string]error{
@@ -214,7 +227,7 @@ func TestAddPayload(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			// Create a new HavenHandler with the fake DB
 			handler := NewHavenAPIHandler(db, nil)
-			handler.slacker = tc.slacker
+			handler.notifier.Register(notifications.SenderSlack, tc.slacker)
 
 			// Create a test router
 			router := gin.Default()
@@ -317,11 +330,110 @@ func TestValidatePayload(t *testing.T) {
 							"path":     "(root).",
 							"property": "narnia",
 						},
+						KeywordLocation: "/additionalProperties",
 					},
 				},
 			},
 			wantCode: http.StatusOK,
 		},
+		{
+			name: "invalid basic output",
+			dbResource: &wrappers.Resource{
+				Model:   gorm.Model{ID: 1},
+				Name:    "users",
+				Schema:  "{\"additionalProperties\":false,\"properties\":{\"age\":{\"type\":\"number\"},\"tags\":{\"type\":\"array\",\"items\":{\"type\":\"string\"}}},\"required\":[\"age\"],\"type\":\"object\"}",
+				Version: 1,
+			},
+			request: &ValidatePayloadRequest{
+				Resource:     "users",
+				Payload:      map[string]interface{}{"tags": []any{"a", 1}},
+				OutputFormat: "basic",
+			},
+			want: &ValidatePayloadResponse{
+				Valid: false,
+				ValidationErrors: []ErrorResponse{
+					{
+						Type:        "required",
+						Description: "age is required",
+						Context: map[string]any{
+							"expected": nil,
+							"field":    "(root)",
+							"given":    nil,
+							"path":     "(root).",
+							"property": "age",
+						},
+						KeywordLocation: "/required",
+					},
+					{
+						Type:        "invalid_type",
+						Description: "Invalid type. Expected: string, given: integer",
+						Context: map[string]any{
+							"expected": "string",
+							"field":    "tags.1",
+							"given":    "integer",
+							"path":     "(root).tags.1.",
+							"property": nil,
+						},
+						InstanceLocation: "/tags/1",
+						KeywordLocation:  "/properties/tags/items/type",
+					},
+				},
+				Output: &OutputUnit{
+					Valid: false,
+					Errors: []OutputUnit{
+						{KeywordLocation: "/required", Error: "age is required"},
+						{
+							KeywordLocation:  "/properties/tags/items/type",
+							InstanceLocation: "/tags/1",
+							Error:            "Invalid type. Expected: string, given: integer",
+						},
+					},
+				},
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name: "valid detailed output",
+			dbResource: &wrappers.Resource{
+				Model:   gorm.Model{ID: 1},
+				Name:    "users",
+				Schema:  "{\"type\":\"object\"}",
+				Version: 1,
+			},
+			request: &ValidatePayloadRequest{
+				Resource:     "users",
+				Payload:      map[string]interface{}{"name": "Juan"},
+				OutputFormat: "detailed",
+			},
+			want: &ValidatePayloadResponse{
+				Valid:  true,
+				Output: &OutputUnit{Valid: true},
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name: "unknown output format",
+			dbResource: &wrappers.Resource{
+				Model:   gorm.Model{ID: 1},
+				Name:    "users",
+				Schema:  "{\"type\":\"object\"}",
+				Version: 1,
+			},
+			request: &ValidatePayloadRequest{
+				Resource:     "users",
+				Payload:      map[string]interface{}{"name": "Juan"},
+				OutputFormat: "verbose",
+			},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "resource not found",
+			request: &ValidatePayloadRequest{
+				Resource: "users",
+				Payload:  map[string]interface{}{"name": "Juan"},
+			},
+			wantCode: http.StatusNotFound,
+		},
 	}
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
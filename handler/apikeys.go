@@ -0,0 +1,343 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"movinglake.com/haven/wrappers"
+)
+
+// Scopes granted to API keys. Admin keys are granted every scope.
+const (
+	ScopeIngest   = "ingest"
+	ScopeValidate = "validate"
+	ScopeRead     = "read"
+	ScopeAdmin    = "admin"
+)
+
+var apiKeyScopes = map[string]bool{ScopeIngest: true, ScopeValidate: true, ScopeRead: true, ScopeAdmin: true}
+
+const (
+	// APIKeyHeader holds the key of requests not sending it as "Authorization: Bearer <key>".
+	APIKeyHeader = "X-Haven-Key"
+	// APIKeyCookie holds the key of browsers, it is set by the login page.
+	APIKeyCookie = "haven_key"
+	// apiKeyPrefix starts every key, so they are easy to spot in configs and logs.
+	apiKeyPrefix = "hvn_"
+	// apiKeyContext is the gin context key of the key a request was authenticated with.
+	apiKeyContext = "api_key"
+	// apiKeyCookieAge is how long browsers keep the key after logging in.
+	apiKeyCookieAge = 30 * 24 * time.Hour
+)
+
+type APIKey struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+	// Namespace is the only namespace the key can access, empty for every namespace.
+	Namespace string `json:"namespace,omitempty"`
+	// Prefix is the start of the key, the key itself is only returned when created.
+	Prefix    string     `json:"prefix"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+type GetAPIKeysResponse struct {
+	APIResponse
+	Keys []APIKey `json:"keys"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// Namespace binds the key to a namespace. Keys bound to a namespace can only create keys
+	// bound to it.
+	Namespace string `json:"namespace"`
+}
+
+type CreateAPIKeyResponse struct {
+	APIResponse
+	APIKey APIKey `json:"api_key"`
+	// Key is the secret to authenticate with. It is not stored and cannot be retrieved again.
+	Key string `json:"key"`
+}
+
+type RevokeAPIKeyRequest struct {
+	ID uint `json:"id"`
+}
+
+type RevokeAPIKeyResponse struct {
+	APIResponse
+	APIKey APIKey `json:"api_key"`
+}
+
+func newAPIKey(k wrappers.APIKeys) APIKey {
+	return APIKey{
+		ID:        k.ID,
+		Name:      k.Name,
+		Namespace: k.Namespace,
+		Prefix:    k.Prefix,
+		Scopes:    strings.Split(k.Scopes, ","),
+		CreatedAt: k.CreatedAt,
+		RevokedAt: k.RevokedAt,
+	}
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// hasScope tells whether the key is granted the scope.
+func hasScope(key *wrappers.APIKeys, scope string) bool {
+	for _, s := range strings.Split(key.Scopes, ",") {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// requestAPIKey returns the key sent with the request, empty if there is none. The cookie is
+// only read on GET and HEAD requests, so other sites cannot make browsers change anything with
+// it.
+func requestAPIKey(c *gin.Context) string {
+	if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	if key := c.GetHeader(APIKeyHeader); key != "" {
+		return key
+	}
+	if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		return ""
+	}
+	key, _ := c.Cookie(APIKeyCookie)
+	return key
+}
+
+// apiKeyAuth checks the API keys of requests against the scopes of their routes. Every request
+// is let through until it is enabled.
+type apiKeyAuth struct {
+	db      wrappers.DB
+	enabled bool
+}
+
+// authorize returns the key if it exists, is not revoked, is granted the scope and can access
+// the namespace. An empty namespace is accessed by any key.
+func (a *apiKeyAuth) authorize(key, scope, namespace string) (*wrappers.APIKeys, error) {
+	if key == "" {
+		return nil, newAPIError(http.StatusUnauthorized, "missing api key")
+	}
+	row, err := a.db.GetAPIKeyByHash(hashAPIKey(key))
+	if err != nil {
+		return nil, newAPIError(http.StatusInternalServerError, "failed to get api key from db: %v", err)
+	}
+	if row == nil || row.RevokedAt != nil {
+		return nil, newAPIError(http.StatusUnauthorized, "invalid api key")
+	}
+	if !hasScope(row, scope) {
+		return nil, newAPIError(http.StatusForbidden, "api key %s is not granted the %s scope", row.Prefix, scope)
+	}
+	if namespace != "" && row.Namespace != "" && row.Namespace != namespace {
+		return nil, newAPIError(http.StatusForbidden, "api key %s is bound to namespace %s", row.Prefix, row.Namespace)
+	}
+	return row, nil
+}
+
+// require returns a middleware rejecting the API requests without a key granted the scope and
+// bound to the namespace of the request, if any.
+func (a *apiKeyAuth) require(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !a.enabled {
+			return
+		}
+		key, err := a.authorize(requestAPIKey(c), scope, c.GetString(namespaceContext))
+		if err != nil {
+			c.AbortWithStatusJSON(statusCode(err), APIResponse{Error: err.Error()})
+			return
+		}
+		c.Set(apiKeyContext, key)
+	}
+}
+
+// requireUnbound is require for routes spanning every namespace, which keys bound to a
+// namespace cannot access.
+func (a *apiKeyAuth) requireUnbound(scope string) gin.HandlerFunc {
+	require := a.require(scope)
+	return func(c *gin.Context) {
+		require(c)
+		key, ok := c.Get(apiKeyContext)
+		if c.IsAborted() || !ok {
+			return
+		}
+		if row := key.(*wrappers.APIKeys); row.Namespace != "" {
+			err := newAPIError(http.StatusForbidden, "api key %s is bound to namespace %s", row.Prefix, row.Namespace)
+			c.AbortWithStatusJSON(statusCode(err), APIResponse{Error: err.Error()})
+		}
+	}
+}
+
+// requirePage is require for HTML pages, which redirect to the login page instead.
+func (a *apiKeyAuth) requirePage(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !a.enabled {
+			return
+		}
+		key, err := a.authorize(requestAPIKey(c), scope, c.GetString(namespaceContext))
+		if err != nil {
+			if statusCode(err) == http.StatusInternalServerError {
+				c.AbortWithStatus(http.StatusInternalServerError)
+				return
+			}
+			c.Redirect(http.StatusSeeOther, "/login")
+			c.Abort()
+			return
+		}
+		c.Set(apiKeyContext, key)
+	}
+}
+
+// RequireAPIKeys makes the API routes, but /health, require an API key granted the scope of
+// the route. /metrics, which spans every namespace, requires a read key not bound to one.
+func (h *HavenAPIHandler) RequireAPIKeys() {
+	h.auth.enabled = true
+}
+
+// RequireScope returns a middleware requiring an API key granted the scope once API keys are
+// required, for routes registered outside the handler. Those work on the default namespace, so
+// keys bound to other namespaces are rejected.
+func (h *HavenAPIHandler) RequireScope(scope string) gin.HandlerFunc {
+	require := h.auth.require(scope)
+	return func(c *gin.Context) {
+		c.Set(namespaceContext, wrappers.DefaultNamespace)
+		require(c)
+	}
+}
+
+// CreateAPIKey creates a key granted the scopes and returns it together with its row. The key is
+// only stored hashed, so it cannot be returned again.
+func (h *HavenAPIHandler) CreateAPIKey(request CreateAPIKeyRequest) (string, *wrappers.APIKeys, error) {
+	if request.Name == "" {
+		return "", nil, newAPIError(http.StatusBadRequest, "api key name is required")
+	}
+	if len(request.Scopes) == 0 {
+		return "", nil, newAPIError(http.StatusBadRequest, "api key scopes are required")
+	}
+	for _, s := range request.Scopes {
+		if !apiKeyScopes[s] {
+			return "", nil, newAPIError(http.StatusBadRequest, "unknown api key scope %q", s)
+		}
+	}
+	if request.Namespace != "" && !ValidNamespace(request.Namespace) {
+		return "", nil, newAPIError(http.StatusBadRequest, "invalid namespace %q", request.Namespace)
+	}
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, newAPIError(http.StatusInternalServerError, "failed to generate api key: %v", err)
+	}
+	key := apiKeyPrefix + hex.EncodeToString(b)
+	row := &wrappers.APIKeys{
+		Namespace: request.Namespace,
+		Name:      request.Name,
+		Prefix:    key[:len(apiKeyPrefix)+8],
+		Hash:      hashAPIKey(key),
+		Scopes:    strings.Join(request.Scopes, ","),
+	}
+	if err := h.db.Save(row, nil); err != nil {
+		return "", nil, newAPIError(http.StatusInternalServerError, "failed to save api key: %v", err)
+	}
+	return key, row, nil
+}
+
+// RevokeAPIKey revokes the key with the ID. Revoking a revoked key keeps its revocation time.
+// A namespace restricts the keys found to the ones bound to it.
+func (h *HavenAPIHandler) RevokeAPIKey(id uint, namespace string) (*wrappers.APIKeys, error) {
+	row, err := h.db.GetAPIKey(id)
+	if err != nil {
+		return nil, newAPIError(http.StatusInternalServerError, "failed to get api key from db: %v", err)
+	}
+	if row == nil || (namespace != "" && row.Namespace != namespace) {
+		return nil, newAPIError(http.StatusNotFound, "api key not found: %d", id)
+	}
+	if row.RevokedAt != nil {
+		return row, nil
+	}
+	now := time.Now()
+	row.RevokedAt = &now
+	if err := h.db.Save(row, nil); err != nil {
+		return nil, newAPIError(http.StatusInternalServerError, "failed to save api key: %v", err)
+	}
+	return row, nil
+}
+
+// getAPIKeys lists the API keys, revoked ones included. Keys bound to a namespace only list the
+// keys bound to it.
+func (h *HavenAPIHandler) getAPIKeys(c *gin.Context) {
+	var response GetAPIKeysResponse
+	keys, err := h.db.GetAPIKeys()
+	if err != nil {
+		response.Error = fmt.Sprintf("failed to get api keys from db: %v", err)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+	response.Keys = []APIKey{}
+	for _, k := range keys {
+		if bound := keyNamespace(c); bound == "" || bound == k.Namespace {
+			response.Keys = append(response.Keys, newAPIKey(k))
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// createAPIKey creates an API key and returns it, for the only time.
+func (h *HavenAPIHandler) createAPIKey(c *gin.Context) {
+	var request CreateAPIKeyRequest
+	var response CreateAPIKeyResponse
+	if err := c.ShouldBindBodyWithJSON(&request); err != nil {
+		response.Error = fmt.Sprintf("failed to parse json request: %v", err)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+	if bound := keyNamespace(c); bound != "" {
+		if request.Namespace != "" && request.Namespace != bound {
+			response.Error = fmt.Sprintf("api key is bound to namespace %s", bound)
+			c.JSON(http.StatusForbidden, response)
+			return
+		}
+		request.Namespace = bound
+	}
+	key, row, err := h.CreateAPIKey(request)
+	if err != nil {
+		response.Error = err.Error()
+		c.JSON(statusCode(err), response)
+		return
+	}
+	response.APIKey = newAPIKey(*row)
+	response.Key = key
+	c.JSON(http.StatusOK, response)
+}
+
+// revokeAPIKey revokes an API key. Revoked keys are kept to be listed.
+func (h *HavenAPIHandler) revokeAPIKey(c *gin.Context) {
+	var request RevokeAPIKeyRequest
+	var response RevokeAPIKeyResponse
+	if err := c.ShouldBindBodyWithJSON(&request); err != nil {
+		response.Error = fmt.Sprintf("failed to parse json request: %v", err)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+	row, err := h.RevokeAPIKey(request.ID, keyNamespace(c))
+	if err != nil {
+		response.Error = err.Error()
+		c.JSON(statusCode(err), response)
+		return
+	}
+	response.APIKey = newAPIKey(*row)
+	c.JSON(http.StatusOK, response)
+}
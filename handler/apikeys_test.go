@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"movinglake.com/haven/wrappers"
+)
+
+// keyRequest serves a request authenticated with the key, sent in the header if set.
+func keyRequest(router *gin.Engine, method, path, header, key string, body any) *httptest.ResponseRecorder {
+	var out []byte
+	if body != nil {
+		out, _ = json.Marshal(body)
+	}
+	request := httptest.NewRequest(method, path, bytes.NewBuffer(out))
+	switch header {
+	case "Authorization":
+		request.Header.Set(header, "Bearer "+key)
+	case "":
+	default:
+		request.Header.Set(header, key)
+	}
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	return response
+}
+
+func TestAPIKeys(t *testing.T) {
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	handler := NewHavenAPIHandler(db, nil)
+	router := gin.Default()
+	handler.RegisterRoutes(router)
+
+	// Keys are not required until enabled.
+	response := postJSON(router, "/api/v1/add_payload", AddPayloadRequest{Resource: "users", Payload: map[string]any{"name": "Ann"}})
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	for _, request := range []CreateAPIKeyRequest{
+		{Scopes: []string{ScopeRead}},
+		{Name: "ci"},
+		{Name: "ci", Scopes: []string{"write"}},
+	} {
+		response := postJSON(router, "/api/v1/create_api_key", request)
+		assert.Equal(t, http.StatusBadRequest, response.Code, request)
+	}
+	response = postJSON(router, "/api/v1/create_api_key", CreateAPIKeyRequest{Name: "admin", Scopes: []string{ScopeAdmin}})
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	var created CreateAPIKeyResponse
+	json.Unmarshal(response.Body.Bytes(), &created)
+	admin := created.Key
+	assert.True(t, strings.HasPrefix(admin, created.APIKey.Prefix))
+	assert.Equal(t, hashAPIKey(admin), db.APIKeys[created.APIKey.ID].Hash)
+	ingest, _, err := handler.CreateAPIKey(CreateAPIKeyRequest{Name: "producer", Scopes: []string{ScopeIngest, ScopeValidate}})
+	assert.NoError(t, err)
+
+	handler.RequireAPIKeys()
+	response = postJSON(router, "/api/v1/add_payload", AddPayloadRequest{Resource: "users", Payload: map[string]any{"name": "Ann"}})
+	assert.Equal(t, http.StatusUnauthorized, response.Code)
+	response = keyRequest(router, http.MethodGet, "/api/v1/get_schema/users", "Authorization", "hvn_unknown", nil)
+	assert.Equal(t, http.StatusUnauthorized, response.Code)
+	response = keyRequest(router, http.MethodGet, "/api/v1/get_schema/users", "Authorization", ingest, nil)
+	assert.Equal(t, http.StatusForbidden, response.Code)
+	assert.Contains(t, response.Body.String(), "read scope")
+	response = keyRequest(router, http.MethodPost, "/api/v1/add_payload", APIKeyHeader, ingest, AddPayloadRequest{Resource: "users", Payload: map[string]any{"name": "Ann", "age": 30}})
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	response = keyRequest(router, http.MethodPost, "/api/v1/set_schema", APIKeyHeader, ingest, SetSchemaRequest{Resource: "users", Schema: map[string]any{}})
+	assert.Equal(t, http.StatusForbidden, response.Code)
+	response = keyRequest(router, http.MethodGet, "/api/v1/get_schema/users", "Authorization", admin, nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+	response = keyRequest(router, http.MethodGet, "/health", "", "", nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	response = keyRequest(router, http.MethodPost, "/api/v1/revoke_api_key", "Authorization", admin, RevokeAPIKeyRequest{ID: 2})
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	var revoked RevokeAPIKeyResponse
+	json.Unmarshal(response.Body.Bytes(), &revoked)
+	assert.NotNil(t, revoked.APIKey.RevokedAt)
+	response = keyRequest(router, http.MethodPost, "/api/v1/add_payload", APIKeyHeader, ingest, AddPayloadRequest{Resource: "users", Payload: map[string]any{"name": "Ann"}})
+	assert.Equal(t, http.StatusUnauthorized, response.Code)
+	response = keyRequest(router, http.MethodPost, "/api/v1/revoke_api_key", "Authorization", admin, RevokeAPIKeyRequest{ID: 42})
+	assert.Equal(t, http.StatusNotFound, response.Code)
+
+	response = keyRequest(router, http.MethodGet, "/api/v1/get_api_keys", "Authorization", admin, nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+	var keys GetAPIKeysResponse
+	json.Unmarshal(response.Body.Bytes(), &keys)
+	assert.Equal(t, 2, len(keys.Keys))
+	assert.Equal(t, []string{ScopeIngest, ScopeValidate}, keys.Keys[1].Scopes)
+	assert.NotContains(t, response.Body.String(), admin)
+
+	// Metrics span every namespace, keys bound to one can't read them.
+	bound, _, err := handler.CreateAPIKey(CreateAPIKeyRequest{Name: "team", Scopes: []string{ScopeRead}, Namespace: "team"})
+	assert.NoError(t, err)
+	response = keyRequest(router, http.MethodGet, "/metrics", "", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, response.Code)
+	response = keyRequest(router, http.MethodGet, "/metrics", "Authorization", bound, nil)
+	assert.Equal(t, http.StatusForbidden, response.Code)
+	assert.Contains(t, response.Body.String(), "bound to namespace team")
+	response = keyRequest(router, http.MethodGet, "/metrics", "Authorization", admin, nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Contains(t, response.Body.String(), "haven_http_requests_total")
+}
+
+func TestAPIKeyPages(t *testing.T) {
+	db := wrappers.NewTestDB()
+	api := NewHavenAPIHandler(db, nil)
+	reader, _, err := api.CreateAPIKey(CreateAPIKeyRequest{Name: "browser", Scopes: []string{ScopeRead}})
+	assert.NoError(t, err)
+	writer, _, err := api.CreateAPIKey(CreateAPIKeyRequest{Name: "producer", Scopes: []string{ScopeIngest}})
+	assert.NoError(t, err)
+	handler := NewHavenHTMLHandler(db)
+	handler.RequireAPIKeys()
+	router := gin.Default()
+	handler.RegisterRoutes(router, "../templates/*", "../web_resources")
+
+	response := keyRequest(router, http.MethodGet, "/index", "", "", nil)
+	assert.Equal(t, http.StatusSeeOther, response.Code)
+	assert.Equal(t, "/login", response.Header().Get("Location"))
+	response = keyRequest(router, http.MethodGet, "/login", "", "", nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	login := func(key string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(url.Values{"key": {key}}.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+		return response
+	}
+	response = login(writer)
+	assert.Equal(t, http.StatusForbidden, response.Code)
+	assert.Contains(t, response.Body.String(), "read scope")
+	response = login(reader)
+	assert.Equal(t, http.StatusSeeOther, response.Code)
+	cookies := response.Result().Cookies()
+	assert.Equal(t, 1, len(cookies))
+	assert.Equal(t, APIKeyCookie, cookies[0].Name)
+	assert.True(t, cookies[0].HttpOnly)
+
+	assert.Equal(t, http.SameSiteStrictMode, cookies[0].SameSite)
+
+	request := httptest.NewRequest(http.MethodGet, "/index", nil)
+	request.AddCookie(cookies[0])
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	// The cookie is not accepted on requests changing anything.
+	api.RequireAPIKeys()
+	api.RegisterRoutes(router)
+	admin, _, err := api.CreateAPIKey(CreateAPIKeyRequest{Name: "ops", Scopes: []string{ScopeAdmin}})
+	assert.NoError(t, err)
+	request = httptest.NewRequest(http.MethodGet, "/api/v1/get_all_resources", nil)
+	request.AddCookie(&http.Cookie{Name: APIKeyCookie, Value: admin})
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusOK, response.Code)
+	request = httptest.NewRequest(http.MethodPost, "/api/v1/set_schema", strings.NewReader(`{"resource": "users", "schema": {}}`))
+	request.Header.Set("Content-Type", "text/plain")
+	request.AddCookie(&http.Cookie{Name: APIKeyCookie, Value: admin})
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusUnauthorized, response.Code)
+}
@@ -0,0 +1,355 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"movinglake.com/haven/handler/jsonutils"
+	"movinglake.com/haven/wrappers"
+)
+
+// BundleFormatVersion is the version of the bundle format written by exports. Imports accept
+// bundles up to this version.
+const BundleFormatVersion = 1
+
+// Import modes.
+const (
+	// ImportModeMerge creates the resources missing from the DB and reports the ones whose
+	// schema differs as conflicts, leaving them untouched.
+	ImportModeMerge = "merge"
+	// ImportModeReplace creates the missing resources and sets the schema of the conflicting
+	// ones as a new version.
+	ImportModeReplace = "replace"
+	// ImportModeDryRun reports what a merge would do without changing the DB.
+	ImportModeDryRun = "dry-run"
+)
+
+// Import actions reported per resource.
+const (
+	ImportActionCreated   = "created"
+	ImportActionUnchanged = "unchanged"
+	ImportActionReplaced  = "replaced"
+	ImportActionConflict  = "conflict"
+)
+
+// Bundle is a portable dump of the resources and their schema history.
+type Bundle struct {
+	FormatVersion int              `json:"format_version"`
+	ExportedAt    time.Time        `json:"exported_at"`
+	Resources     []BundleResource `json:"resources"`
+}
+
+type BundleResource struct {
+	Name            string          `json:"name"`
+	Schema          map[string]any  `json:"schema"`
+	Version         uint            `json:"version"`
+	QuarantineLimit uint            `json:"quarantine_limit,omitempty"`
+	SampleRate      float64         `json:"sample_rate,omitempty"`
+	SampleKeyPath   string          `json:"sample_key_path,omitempty"`
+	Versions        []BundleVersion `json:"versions"`
+}
+
+type BundleVersion struct {
+	Version   uint           `json:"version"`
+	OldSchema map[string]any `json:"old_schema,omitempty"`
+	NewSchema map[string]any `json:"new_schema"`
+	CreatedAt time.Time      `json:"created_at"`
+	// ReferencePayload is only exported when requested.
+	ReferencePayload any `json:"reference_payload,omitempty"`
+}
+
+// ImportResult reports what an import did with a resource of the bundle.
+type ImportResult struct {
+	Resource string `json:"resource"`
+	Action   string `json:"action"`
+	// Changes goes from the schema in the DB to the schema in the bundle for conflicting and
+	// replaced resources.
+	Changes []jsonutils.SchemaChange `json:"changes,omitempty"`
+}
+
+type ImportBundleResponse struct {
+	APIResponse
+	Mode      string         `json:"mode"`
+	Results   []ImportResult `json:"results"`
+	Conflicts int            `json:"conflicts"`
+}
+
+type ExportBundleResponse struct {
+	APIResponse
+	Bundle
+}
+
+func unmarshalSchema(raw string) (map[string]any, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	schema := make(map[string]any)
+	if err := json.Unmarshal([]byte(raw), &schema); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// ExportBundle dumps all the resources and their versions, with the reference payloads of the
+// versions if withPayloads is set.
+func (h *HavenAPIHandler) ExportBundle(withPayloads bool) (*Bundle, error) {
+	resources, err := h.db.GetAllResources()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get resources from db: %v", err)
+	}
+	sort.Slice(resources, func(i, j int) bool { return resources[i].Name < resources[j].Name })
+	bundle := &Bundle{
+		FormatVersion: BundleFormatVersion,
+		ExportedAt:    time.Now().UTC(),
+		Resources:     []BundleResource{},
+	}
+	for _, r := range resources {
+		schema, err := unmarshalSchema(r.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal schema of %s: %v", r.Name, err)
+		}
+		br := BundleResource{
+			Name:            r.Name,
+			Schema:          schema,
+			Version:         r.Version,
+			QuarantineLimit: r.QuarantineLimit,
+			SampleRate:      r.SampleRate,
+			SampleKeyPath:   r.SampleKeyPath,
+			Versions:        []BundleVersion{},
+		}
+		versions, err := h.db.GetResourceVersions(r.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get versions of %s: %v", r.Name, err)
+		}
+		sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+		for _, v := range versions {
+			bv := BundleVersion{Version: v.Version, CreatedAt: v.CreatedAt}
+			if bv.OldSchema, err = unmarshalSchema(v.OldSchema); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal old schema of %s version %d: %v", r.Name, v.Version, err)
+			}
+			if bv.NewSchema, err = unmarshalSchema(v.NewSchema); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal new schema of %s version %d: %v", r.Name, v.Version, err)
+			}
+			if withPayloads && v.ReferencePayloadID != nil {
+				p, err := h.db.GetReferencePayload(uint(*v.ReferencePayloadID))
+				if err != nil {
+					return nil, fmt.Errorf("failed to get reference payload of %s version %d: %v", r.Name, v.Version, err)
+				}
+				if p != nil && p.ID != 0 {
+					if err := json.Unmarshal([]byte(p.Payload), &bv.ReferencePayload); err != nil {
+						return nil, fmt.Errorf("failed to unmarshal reference payload of %s version %d: %v", r.Name, v.Version, err)
+					}
+				}
+			}
+			br.Versions = append(br.Versions, bv)
+		}
+		bundle.Resources = append(bundle.Resources, br)
+	}
+	return bundle, nil
+}
+
+func marshalSchema(schema map[string]any) (string, error) {
+	if schema == nil {
+		return "", nil
+	}
+	b, err := json.Marshal(schema)
+	return string(b), err
+}
+
+// createBundleResource saves a resource of the bundle together with its history. It returns
+// the events of the saved versions.
+func (h *HavenAPIHandler) createBundleResource(br BundleResource, t *gorm.DB) ([]VersionEvent, error) {
+	schema, err := marshalSchema(br.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal schema of %s: %v", br.Name, err)
+	}
+	res := &wrappers.Resource{
+		Name:            br.Name,
+		Schema:          schema,
+		Version:         br.Version,
+		QuarantineLimit: br.QuarantineLimit,
+		SampleRate:      br.SampleRate,
+		SampleKeyPath:   br.SampleKeyPath,
+	}
+	if err := h.db.Save(res, t); err != nil {
+		return nil, fmt.Errorf("failed to save resource %s: %v", br.Name, err)
+	}
+	var events []VersionEvent
+	for _, bv := range br.Versions {
+		rv := &wrappers.ResourceVersions{
+			Resource: *res,
+			Version:  bv.Version,
+		}
+		if rv.OldSchema, err = marshalSchema(bv.OldSchema); err != nil {
+			return nil, fmt.Errorf("failed to marshal old schema of %s version %d: %v", br.Name, bv.Version, err)
+		}
+		if rv.NewSchema, err = marshalSchema(bv.NewSchema); err != nil {
+			return nil, fmt.Errorf("failed to marshal new schema of %s version %d: %v", br.Name, bv.Version, err)
+		}
+		if bv.ReferencePayload != nil {
+			payload, err := json.Marshal(bv.ReferencePayload)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal reference payload of %s version %d: %v", br.Name, bv.Version, err)
+			}
+			rv.ReferencePayload = &wrappers.ReferencePayloads{Resource: *res, Payload: string(payload)}
+			if err := h.db.Save(rv.ReferencePayload, t); err != nil {
+				return nil, fmt.Errorf("failed to save reference payload of %s version %d: %v", br.Name, bv.Version, err)
+			}
+		}
+		if err := h.db.Save(rv, t); err != nil {
+			return nil, fmt.Errorf("failed to save version %d of %s: %v", bv.Version, br.Name, err)
+		}
+		if err := h.enqueueWebhooks(rv, t); err != nil {
+			return nil, err
+		}
+		events = append(events, newVersionEvent(rv, SourceImport))
+	}
+	return events, nil
+}
+
+// replaceSchema sets the schema of the bundle resource as a new version of the existing one.
+func (h *HavenAPIHandler) replaceSchema(existing *wrappers.Resource, br BundleResource, t *gorm.DB) (*VersionEvent, error) {
+	schema, err := marshalSchema(br.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal schema of %s: %v", br.Name, err)
+	}
+	oldSchema := existing.Schema
+	existing.Schema = schema
+	existing.Version += 1
+	if err := h.db.Save(existing, t); err != nil {
+		return nil, fmt.Errorf("failed to save resource %s: %v", br.Name, err)
+	}
+	rv := &wrappers.ResourceVersions{
+		Resource:  *existing,
+		OldSchema: oldSchema,
+		NewSchema: existing.Schema,
+		Version:   existing.Version,
+	}
+	if err := h.db.Save(rv, t); err != nil {
+		return nil, fmt.Errorf("failed to save version %d of %s: %v", existing.Version, br.Name, err)
+	}
+	if err := h.enqueueWebhooks(rv, t); err != nil {
+		return nil, err
+	}
+	ev := newVersionEvent(rv, SourceImport)
+	return &ev, nil
+}
+
+// ImportBundle loads the resources of the bundle into the DB following the import mode. All
+// the changes are made in a single transaction.
+func (h *HavenAPIHandler) ImportBundle(bundle *Bundle, mode string) ([]ImportResult, error) {
+	if mode != ImportModeMerge && mode != ImportModeReplace && mode != ImportModeDryRun {
+		return nil, newAPIError(http.StatusBadRequest, "unknown import mode: %s", mode)
+	}
+	if bundle.FormatVersion < 1 || bundle.FormatVersion > BundleFormatVersion {
+		return nil, newAPIError(http.StatusBadRequest, "unsupported bundle format version %d", bundle.FormatVersion)
+	}
+	var results []ImportResult
+	var events []VersionEvent
+	err := h.db.Transaction(func(t *gorm.DB) error {
+		seen := make(map[string]bool)
+		for _, br := range bundle.Resources {
+			if br.Name == "" {
+				return newAPIError(http.StatusBadRequest, "bundle has a resource without name")
+			}
+			if seen[br.Name] {
+				return newAPIError(http.StatusBadRequest, "bundle has resource %s more than once", br.Name)
+			}
+			seen[br.Name] = true
+			existing, err := h.db.SelectResourceForUpdate(br.Name, t)
+			if err != nil {
+				return newAPIError(http.StatusInternalServerError, "failed to get resource %s from db: %v", br.Name, err)
+			}
+			result := ImportResult{Resource: br.Name}
+			if existing == nil || existing.ID == 0 {
+				result.Action = ImportActionCreated
+				if mode != ImportModeDryRun {
+					evs, err := h.createBundleResource(br, t)
+					if err != nil {
+						return newAPIError(http.StatusInternalServerError, "%v", err)
+					}
+					events = append(events, evs...)
+				}
+				results = append(results, result)
+				continue
+			}
+			schema, err := unmarshalSchema(existing.Schema)
+			if err != nil {
+				return newAPIError(http.StatusInternalServerError, "failed to unmarshal schema of %s: %v", br.Name, err)
+			}
+			if reflect.DeepEqual(schema, br.Schema) {
+				result.Action = ImportActionUnchanged
+				results = append(results, result)
+				continue
+			}
+			result.Changes = jsonutils.DiffSchemas(schema, br.Schema)
+			result.Action = ImportActionConflict
+			if mode == ImportModeReplace {
+				result.Action = ImportActionReplaced
+				ev, err := h.replaceSchema(existing, br, t)
+				if err != nil {
+					return newAPIError(http.StatusInternalServerError, "%v", err)
+				}
+				events = append(events, *ev)
+			}
+			results = append(results, result)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, ev := range events {
+		h.versionAdded(ev)
+	}
+	if len(events) > 0 {
+		h.wakeOutbox()
+	}
+	return results, nil
+}
+
+// exportBundle returns the bundle of all the resources. Reference payloads are included with
+// ?reference_payloads=true.
+func (h *HavenAPIHandler) exportBundle(c *gin.Context) {
+	var response ExportBundleResponse
+	bundle, err := h.ExportBundle(c.Query("reference_payloads") == "true")
+	if err != nil {
+		response.Error = err.Error()
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+	response.Bundle = *bundle
+	c.JSON(http.StatusOK, response)
+}
+
+// importBundle loads the bundle in the request body. The import mode is set with ?mode=,
+// defaulting to merge.
+func (h *HavenAPIHandler) importBundle(c *gin.Context) {
+	var bundle Bundle
+	var response ImportBundleResponse
+	response.Mode = c.DefaultQuery("mode", ImportModeMerge)
+	if err := c.ShouldBindBodyWithJSON(&bundle); err != nil {
+		response.Error = fmt.Sprintf("failed to parse bundle: %v", err)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+	results, err := h.ImportBundle(&bundle, response.Mode)
+	if err != nil {
+		response.Error = err.Error()
+		c.JSON(statusCode(err), response)
+		return
+	}
+	response.Results = results
+	for _, r := range results {
+		if r.Action == ImportActionConflict {
+			response.Conflicts++
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,228 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"movinglake.com/haven/handler/jsonutils"
+	"movinglake.com/haven/wrappers"
+)
+
+func newBundleRouter() (*wrappers.TestDB, *gin.Engine) {
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	handler := NewHavenAPIHandler(db, nil)
+	router := gin.Default()
+	gin.SetMode(gin.TestMode)
+	handler.RegisterRoutes(router)
+	return db, router
+}
+
+func exportBundle(t *testing.T, router *gin.Engine, path string) ExportBundleResponse {
+	t.Helper()
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, path, nil))
+	assert.Equal(t, http.StatusOK, response.Code)
+	var resp ExportBundleResponse
+	if err := json.Unmarshal(response.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestExportImportBundle(t *testing.T) {
+	_, source := newBundleRouter()
+	postJSON(source, "/api/v1/add_payload", AddPayloadRequest{Resource: "users", Payload: map[string]any{"name": "Juan"}})
+	postJSON(source, "/api/v1/add_payload", AddPayloadRequest{Resource: "users", Payload: map[string]any{"name": "Ana", "age": 30}})
+	postJSON(source, "/api/v1/set_schema", SetSchemaRequest{Resource: "pets", Schema: map[string]any{"type": "object"}})
+	postJSON(source, "/api/v1/set_sampling", SetSamplingRequest{Resource: "pets", Rate: 0.5})
+
+	exported := exportBundle(t, source, "/api/v1/export")
+	assert.Equal(t, BundleFormatVersion, exported.FormatVersion)
+	assert.Equal(t, 2, len(exported.Resources))
+	pets, users := exported.Resources[0], exported.Resources[1]
+	assert.Equal(t, "pets", pets.Name)
+	assert.Equal(t, 0.5, pets.SampleRate)
+	assert.Equal(t, uint(2), users.Version)
+	assert.Equal(t, 2, len(users.Versions))
+	assert.Nil(t, users.Versions[0].OldSchema)
+	assert.Nil(t, users.Versions[0].ReferencePayload)
+
+	withPayloads := exportBundle(t, source, "/api/v1/export?reference_payloads=true")
+	users = withPayloads.Resources[1]
+	assert.Equal(t, map[string]any{"name": "Ana", "age": float64(30)}, users.Versions[1].ReferencePayload)
+	assert.Nil(t, withPayloads.Resources[0].Versions[0].ReferencePayload)
+
+	// Importing into an empty DB reproduces the same bundle.
+	target, router := newBundleRouter()
+	response := postJSON(router, "/api/v1/import", withPayloads.Bundle)
+	assert.Equal(t, http.StatusOK, response.Code)
+	var resp ImportBundleResponse
+	json.Unmarshal(response.Body.Bytes(), &resp)
+	assert.Equal(t, ImportModeMerge, resp.Mode)
+	assert.Equal(t, []ImportResult{
+		{Resource: "pets", Action: ImportActionCreated},
+		{Resource: "users", Action: ImportActionCreated},
+	}, resp.Results)
+	assert.Equal(t, 2, len(target.ReferencePayloads))
+	ignore := cmpopts.IgnoreFields(Bundle{}, "ExportedAt")
+	ignoreVersions := cmpopts.IgnoreFields(BundleVersion{}, "CreatedAt")
+	reexported := exportBundle(t, router, "/api/v1/export?reference_payloads=true")
+	if diff := cmp.Diff(withPayloads.Bundle, reexported.Bundle, ignore, ignoreVersions); diff != "" {
+		t.Errorf("re-exported bundle got a diff: %s", diff)
+	}
+
+	// Importing again changes nothing.
+	response = postJSON(router, "/api/v1/import", withPayloads.Bundle)
+	json.Unmarshal(response.Body.Bytes(), &resp)
+	assert.Equal(t, ImportActionUnchanged, resp.Results[0].Action)
+	assert.Equal(t, ImportActionUnchanged, resp.Results[1].Action)
+}
+
+func TestImportBundleModes(t *testing.T) {
+	bundle := Bundle{
+		FormatVersion: BundleFormatVersion,
+		Resources: []BundleResource{
+			{
+				Name:     "users",
+				Schema:   map[string]any{"type": "object", "required": []any{"name"}},
+				Version:  1,
+				Versions: []BundleVersion{{Version: 1, NewSchema: map[string]any{"type": "object", "required": []any{"name"}}}},
+			},
+			{
+				Name:     "pets",
+				Schema:   map[string]any{"type": "object"},
+				Version:  1,
+				Versions: []BundleVersion{{Version: 1, NewSchema: map[string]any{"type": "object"}}},
+			},
+		},
+	}
+	wantChanges := []jsonutils.SchemaChange{{Path: "/required", Kind: jsonutils.ChangeAdded, New: []any{"name"}}}
+
+	cases := []struct {
+		mode          string
+		wantResults   []ImportResult
+		wantConflicts int
+		wantVersion   uint
+		wantPets      bool
+	}{
+		{
+			mode: ImportModeDryRun,
+			wantResults: []ImportResult{
+				{Resource: "users", Action: ImportActionConflict, Changes: wantChanges},
+				{Resource: "pets", Action: ImportActionCreated},
+			},
+			wantConflicts: 1,
+			wantVersion:   1,
+		},
+		{
+			mode: ImportModeMerge,
+			wantResults: []ImportResult{
+				{Resource: "users", Action: ImportActionConflict, Changes: wantChanges},
+				{Resource: "pets", Action: ImportActionCreated},
+			},
+			wantConflicts: 1,
+			wantVersion:   1,
+			wantPets:      true,
+		},
+		{
+			mode: ImportModeReplace,
+			wantResults: []ImportResult{
+				{Resource: "users", Action: ImportActionReplaced, Changes: wantChanges},
+				{Resource: "pets", Action: ImportActionCreated},
+			},
+			wantVersion: 2,
+			wantPets:    true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.mode, func(t *testing.T) {
+			db, router := newBundleRouter()
+			postJSON(router, "/api/v1/set_schema", SetSchemaRequest{Resource: "users", Schema: map[string]any{"type": "object"}})
+
+			response := postJSON(router, "/api/v1/import?mode="+tc.mode, bundle)
+			assert.Equal(t, http.StatusOK, response.Code)
+			var resp ImportBundleResponse
+			json.Unmarshal(response.Body.Bytes(), &resp)
+			assert.Equal(t, tc.mode, resp.Mode)
+			if diff := cmp.Diff(tc.wantResults, resp.Results); diff != "" {
+				t.Errorf("import got a diff: %s", diff)
+			}
+			assert.Equal(t, tc.wantConflicts, resp.Conflicts)
+			assert.Equal(t, tc.wantVersion, db.Resource["users"].Version)
+			_, ok := db.Resource["pets"]
+			assert.Equal(t, tc.wantPets, ok)
+		})
+	}
+}
+
+func TestImportBundleErrors(t *testing.T) {
+	valid := Bundle{
+		FormatVersion: BundleFormatVersion,
+		Resources:     []BundleResource{{Name: "users", Schema: map[string]any{"type": "object"}, Version: 1}},
+	}
+	cases := []struct {
+		name     string
+		path     string
+		body     any
+		dbErrors map[string]error
+		wantCode int
+	}{
+		{name: "bad json", path: "/api/v1/import", body: "not a bundle", wantCode: http.StatusBadRequest},
+		{name: "unknown mode", path: "/api/v1/import?mode=overwrite", body: valid, wantCode: http.StatusBadRequest},
+		{name: "future format", path: "/api/v1/import", body: Bundle{FormatVersion: BundleFormatVersion + 1}, wantCode: http.StatusBadRequest},
+		{name: "no format", path: "/api/v1/import", body: Bundle{}, wantCode: http.StatusBadRequest},
+		{
+			name:     "resource without name",
+			path:     "/api/v1/import",
+			body:     Bundle{FormatVersion: BundleFormatVersion, Resources: []BundleResource{{}}},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "duplicated resource",
+			path:     "/api/v1/import",
+			body:     Bundle{FormatVersion: BundleFormatVersion, Resources: []BundleResource{{Name: "a"}, {Name: "a"}}},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "select fails",
+			path:     "/api/v1/import",
+			body:     valid,
+			dbErrors: map[string]error{"SelectResourceForUpdate": gorm.ErrInvalidDB},
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "save fails",
+			path:     "/api/v1/import",
+			body:     valid,
+			dbErrors: map[string]error{"Save": gorm.ErrInvalidDB},
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, router := newBundleRouter()
+			db.Errors = tc.dbErrors
+			response := postJSON(router, tc.path, tc.body)
+			assert.Equal(t, tc.wantCode, response.Code)
+		})
+	}
+
+	db, router := newBundleRouter()
+	db.Save(&wrappers.Resource{Name: "users", Schema: "not json", Version: 1}, nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/api/v1/export", nil))
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+	assert.Equal(t, http.StatusInternalServerError, postJSON(router, "/api/v1/import", valid).Code)
+
+	db.Errors = map[string]error{"GetAllResources": gorm.ErrInvalidDB}
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/api/v1/export", nil))
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+}
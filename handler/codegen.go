@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"movinglake.com/haven/handler/schemaconv"
+	"movinglake.com/haven/wrappers"
+)
+
+// Languages of the generated code.
+const (
+	LangGo         = "go"
+	LangTypeScript = "typescript"
+)
+
+// DefaultGoPackage is the package of the generated Go code.
+const DefaultGoPackage = "models"
+
+// GenerateCode returns the types of the schemas in the language. pkg is the package of Go
+// code.
+func GenerateCode(lang, pkg string, schemas []schemaconv.Schema) ([]byte, error) {
+	switch lang {
+	case LangGo:
+		if !token.IsIdentifier(pkg) {
+			return nil, newAPIError(http.StatusBadRequest, "invalid go package name: %q", pkg)
+		}
+		code, err := schemaconv.Go(pkg, schemas)
+		if err != nil {
+			return nil, newAPIError(http.StatusUnprocessableEntity, "%v", err)
+		}
+		return code, nil
+	case LangTypeScript:
+		code, err := schemaconv.TypeScript(schemas)
+		if err != nil {
+			return nil, newAPIError(http.StatusUnprocessableEntity, "%v", err)
+		}
+		return code, nil
+	}
+	return nil, newAPIError(http.StatusBadRequest, "unknown language: %s", lang)
+}
+
+// ResourceSchema returns the current schema of the resource for conversion.
+func (h *HavenAPIHandler) ResourceSchema(name string) (*schemaconv.Schema, error) {
+	schema, _, err := h.resourceSchema(name)
+	return schema, err
+}
+
+// resourceSchema is ResourceSchema also returning the resource.
+func (h *HavenAPIHandler) resourceSchema(name string) (*schemaconv.Schema, *wrappers.Resource, error) {
+	res, err := h.db.GetResource(name, nil)
+	if err != nil {
+		return nil, nil, newAPIError(http.StatusInternalServerError, "failed to get resource from db: %v", err)
+	}
+	if res == nil {
+		return nil, nil, newAPIError(http.StatusNotFound, "resource not found: %s", name)
+	}
+	schema := make(map[string]any)
+	if err := json.Unmarshal([]byte(res.Schema), &schema); err != nil {
+		return nil, nil, newAPIError(http.StatusInternalServerError, "failed to unmarshal DB schema: %v", err)
+	}
+	return &schemaconv.Schema{Resource: res.Name, Version: res.Version, Schema: schema}, res, nil
+}
+
+// codegen returns the types of the resource in the ?lang= language (go or typescript) as
+// plain text. Go code is in the ?package= package, models by default.
+func (h *HavenAPIHandler) codegen(c *gin.Context) {
+	var response APIResponse
+	schema, err := h.ResourceSchema(c.Params.ByName("name"))
+	if err != nil {
+		response.Error = err.Error()
+		c.JSON(statusCode(err), response)
+		return
+	}
+	code, err := GenerateCode(c.DefaultQuery("lang", LangGo), c.DefaultQuery("package", DefaultGoPackage), []schemaconv.Schema{*schema})
+	if err != nil {
+		response.Error = fmt.Sprintf("failed to generate code: %v", err)
+		c.JSON(statusCode(err), response)
+		return
+	}
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", code)
+}
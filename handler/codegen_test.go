@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"movinglake.com/haven/wrappers"
+)
+
+func TestCodegen(t *testing.T) {
+	db, router := newBundleRouter()
+	postJSON(router, "/api/v1/add_payload", AddPayloadRequest{Resource: "users", Payload: map[string]any{"name": "Juan", "age": 35}})
+	postJSON(router, "/api/v1/add_payload", AddPayloadRequest{Resource: "users", Payload: map[string]any{"name": nil}})
+	db.Save(&wrappers.Resource{Name: "broken", Schema: `{"type": "date"}`, Version: 1}, nil)
+
+	cases := []struct {
+		name         string
+		path         string
+		dbErrors     map[string]error
+		wantCode     int
+		wantContains []string
+	}{
+		{
+			name:     "go",
+			path:     "/api/v1/codegen/users",
+			wantCode: http.StatusOK,
+			wantContains: []string{
+				"//   users version 2\n",
+				"package models\n",
+				"type Users struct {\n\tAge  *float64 `json:\"age,omitempty\"`\n\tName *string  `json:\"name\"`\n}",
+			},
+		},
+		{
+			name:         "go package",
+			path:         "/api/v1/codegen/users?lang=go&package=api",
+			wantCode:     http.StatusOK,
+			wantContains: []string{"package api\n"},
+		},
+		{
+			name:         "typescript",
+			path:         "/api/v1/codegen/users?lang=typescript",
+			wantCode:     http.StatusOK,
+			wantContains: []string{"export interface Users {\n  age?: number;\n  name: string | null;\n}\n"},
+		},
+		{name: "bad package", path: "/api/v1/codegen/users?package=" + url.QueryEscape("my models"), wantCode: http.StatusBadRequest},
+		{name: "unknown language", path: "/api/v1/codegen/users?lang=rust", wantCode: http.StatusBadRequest},
+		{name: "not found", path: "/api/v1/codegen/pets", wantCode: http.StatusNotFound},
+		{name: "unsupported schema", path: "/api/v1/codegen/broken", wantCode: http.StatusUnprocessableEntity, wantContains: []string{`unknown type \"date\"`}},
+		{name: "db fails", path: "/api/v1/codegen/users", dbErrors: map[string]error{"GetResource": gorm.ErrInvalidDB}, wantCode: http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db.Errors = tc.dbErrors
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			assert.Equal(t, tc.wantCode, response.Code)
+			for _, s := range tc.wantContains {
+				assert.Contains(t, response.Body.String(), s)
+			}
+		})
+	}
+}
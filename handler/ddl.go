@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"movinglake.com/haven/handler/schemaconv"
+)
+
+// ResourceVersionSchema returns the schema of a version of the resource for conversion.
+func (h *HavenAPIHandler) ResourceVersionSchema(name string, version uint) (*schemaconv.Schema, error) {
+	res, err := h.db.GetResource(name, nil)
+	if err != nil {
+		return nil, newAPIError(http.StatusInternalServerError, "failed to get resource from db: %v", err)
+	}
+	if res == nil {
+		return nil, newAPIError(http.StatusNotFound, "resource not found: %s", name)
+	}
+	dbSchema := res.Schema
+	if res.Version != version {
+		versions, err := h.db.GetResourceVersions(res.ID)
+		if err != nil {
+			return nil, newAPIError(http.StatusInternalServerError, "failed to get resource versions from db: %v", err)
+		}
+		dbSchema = ""
+		for _, v := range versions {
+			if v.Version == version {
+				dbSchema = v.NewSchema
+			}
+		}
+		if dbSchema == "" {
+			return nil, newAPIError(http.StatusNotFound, "version %d of resource %s not found", version, name)
+		}
+	}
+	schema := make(map[string]any)
+	if err := json.Unmarshal([]byte(dbSchema), &schema); err != nil {
+		return nil, newAPIError(http.StatusInternalServerError, "failed to unmarshal DB schema: %v", err)
+	}
+	return &schemaconv.Schema{Resource: res.Name, Version: version, Schema: schema}, nil
+}
+
+// ddlOptions reads the ?dialect=, ?nested=, ?table= and ?drop= DDL options.
+func ddlOptions(c *gin.Context) (schemaconv.DDLOptions, error) {
+	opts := schemaconv.DDLOptions{
+		Dialect:     c.DefaultQuery("dialect", schemaconv.DialectPostgres),
+		Nested:      c.DefaultQuery("nested", schemaconv.NestedFlatten),
+		Table:       c.Query("table"),
+		DropColumns: c.Query("drop") == "true",
+	}
+	if err := opts.Validate(); err != nil {
+		return opts, newAPIError(http.StatusBadRequest, "%v", err)
+	}
+	return opts, nil
+}
+
+// versionQuery reads a version number from the query, def if missing.
+func versionQuery(c *gin.Context, key string, def uint) (uint, error) {
+	v, ok := c.GetQuery(key)
+	if !ok {
+		return def, nil
+	}
+	version, err := strconv.ParseUint(v, 10, 32)
+	if err != nil {
+		return 0, newAPIError(http.StatusBadRequest, "failed to parse %s: %v", key, err)
+	}
+	return uint(version), nil
+}
+
+// CreateTable returns the CREATE TABLE statement of a version of the resource, the current
+// one if version is 0.
+func (h *HavenAPIHandler) CreateTable(name string, version uint, opts schemaconv.DDLOptions) ([]byte, error) {
+	var schema *schemaconv.Schema
+	var err error
+	if version == 0 {
+		schema, err = h.ResourceSchema(name)
+	} else {
+		schema, err = h.ResourceVersionSchema(name, version)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ddl, err := schemaconv.CreateTable(*schema, opts)
+	if err != nil {
+		return nil, newAPIError(http.StatusUnprocessableEntity, "%v", err)
+	}
+	return ddl, nil
+}
+
+// AlterTable returns the ALTER TABLE statements migrating the table of the resource between
+// two versions.
+func (h *HavenAPIHandler) AlterTable(name string, from, to uint, opts schemaconv.DDLOptions) ([]byte, error) {
+	fromSchema, err := h.ResourceVersionSchema(name, from)
+	if err != nil {
+		return nil, err
+	}
+	toSchema, err := h.ResourceVersionSchema(name, to)
+	if err != nil {
+		return nil, err
+	}
+	ddl, err := schemaconv.AlterTable(*fromSchema, *toSchema, opts)
+	if err != nil {
+		return nil, newAPIError(http.StatusUnprocessableEntity, "%v", err)
+	}
+	return ddl, nil
+}
+
+// ddl returns the CREATE TABLE statement of the resource as plain text. ?version= picks a
+// version other than the current one.
+func (h *HavenAPIHandler) ddl(c *gin.Context) {
+	var response APIResponse
+	opts, err := ddlOptions(c)
+	if err != nil {
+		response.Error = err.Error()
+		c.JSON(statusCode(err), response)
+		return
+	}
+	version, err := versionQuery(c, "version", 0)
+	if err != nil {
+		response.Error = err.Error()
+		c.JSON(statusCode(err), response)
+		return
+	}
+	ddl, err := h.CreateTable(c.Params.ByName("name"), version, opts)
+	if err != nil {
+		response.Error = fmt.Sprintf("failed to generate DDL: %v", err)
+		c.JSON(statusCode(err), response)
+		return
+	}
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", ddl)
+}
+
+// ddlMigration returns the ALTER TABLE statements migrating the table of the resource from the
+// ?from= version to the ?to= version as plain text. to defaults to the current version and
+// from to the version before it.
+func (h *HavenAPIHandler) ddlMigration(c *gin.Context) {
+	var response APIResponse
+	name := c.Params.ByName("name")
+	opts, err := ddlOptions(c)
+	if err != nil {
+		response.Error = err.Error()
+		c.JSON(statusCode(err), response)
+		return
+	}
+	current, err := h.ResourceSchema(name)
+	if err != nil {
+		response.Error = err.Error()
+		c.JSON(statusCode(err), response)
+		return
+	}
+	to, err := versionQuery(c, "to", current.Version)
+	if err != nil {
+		response.Error = err.Error()
+		c.JSON(statusCode(err), response)
+		return
+	}
+	from, err := versionQuery(c, "from", to-1)
+	if err != nil {
+		response.Error = err.Error()
+		c.JSON(statusCode(err), response)
+		return
+	}
+	ddl, err := h.AlterTable(name, from, to, opts)
+	if err != nil {
+		response.Error = fmt.Sprintf("failed to generate DDL: %v", err)
+		c.JSON(statusCode(err), response)
+		return
+	}
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", ddl)
+}
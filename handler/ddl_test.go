@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestDDL(t *testing.T) {
+	db, router := newBundleRouter()
+	postJSON(router, "/api/v1/set_schema", SetSchemaRequest{Resource: "users", Schema: map[string]any{
+		"type":       "object",
+		"required":   []any{"name"},
+		"properties": map[string]any{"name": map[string]any{"type": "string"}, "address": map[string]any{"type": "object", "properties": map[string]any{"city": map[string]any{"type": "string"}}}},
+	}})
+	postJSON(router, "/api/v1/set_schema", SetSchemaRequest{Resource: "users", Schema: map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"name": map[string]any{"type": "string"}, "age": map[string]any{"type": "integer"}},
+	}})
+	postJSON(router, "/api/v1/set_schema", SetSchemaRequest{Resource: "any", Schema: map[string]any{"type": "object"}})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, path, nil))
+		return response
+	}
+
+	response := get("/api/v1/ddl/users")
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	assert.Equal(t, "text/plain; charset=utf-8", response.Header().Get("Content-Type"))
+	assert.Contains(t, response.Body.String(), "--   users version 2\n\nCREATE TABLE \"users\" (\n  \"age\" BIGINT,\n  \"name\" TEXT\n);\n")
+
+	response = get("/api/v1/ddl/users?version=1&dialect=bigquery&nested=json&table=raw.users")
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	assert.Contains(t, response.Body.String(), "CREATE TABLE `raw`.`users` (\n  `address` JSON,\n  `name` STRING NOT NULL\n);\n")
+
+	response = get("/api/v1/ddl_migration/users")
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	assert.Contains(t, response.Body.String(), "--   users version 1\n--   users version 2\n\n"+
+		"ALTER TABLE \"users\" ADD COLUMN \"age\" BIGINT;\n"+
+		"ALTER TABLE \"users\" ALTER COLUMN \"name\" DROP NOT NULL;\n"+
+		"-- ALTER TABLE \"users\" DROP COLUMN \"address_city\";\n")
+
+	response = get("/api/v1/ddl_migration/users?from=2&to=1&drop=true")
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	assert.Contains(t, response.Body.String(), "ALTER TABLE \"users\" ADD COLUMN \"address_city\" TEXT;\n"+
+		"ALTER TABLE \"users\" DROP COLUMN \"age\";\n")
+
+	cases := []struct {
+		name     string
+		path     string
+		dbErrors map[string]error
+		wantCode int
+	}{
+		{name: "bad dialect", path: "/api/v1/ddl/any?dialect=mysql", wantCode: http.StatusBadRequest},
+		{name: "bad nested", path: "/api/v1/ddl_migration/any?nested=xml", wantCode: http.StatusBadRequest},
+		{name: "bad version", path: "/api/v1/ddl/any?version=x", wantCode: http.StatusBadRequest},
+		{name: "bad from", path: "/api/v1/ddl_migration/any?from=x", wantCode: http.StatusBadRequest},
+		{name: "bad to", path: "/api/v1/ddl_migration/any?to=x", wantCode: http.StatusBadRequest},
+		{name: "resource not found", path: "/api/v1/ddl/nope", wantCode: http.StatusNotFound},
+		{name: "migration resource not found", path: "/api/v1/ddl_migration/nope", wantCode: http.StatusNotFound},
+		{name: "version not found", path: "/api/v1/ddl/any?version=5", wantCode: http.StatusNotFound},
+		{name: "from not found", path: "/api/v1/ddl_migration/any", wantCode: http.StatusNotFound},
+		{name: "can't represent", path: "/api/v1/ddl/any", wantCode: http.StatusUnprocessableEntity},
+		{name: "db fails", path: "/api/v1/ddl/any", dbErrors: map[string]error{"GetResource": gorm.ErrInvalidDB}, wantCode: http.StatusInternalServerError},
+		{name: "versions db fails", path: "/api/v1/ddl_migration/any?from=1&to=2", dbErrors: map[string]error{"GetResourceVersions": gorm.ErrInvalidDB}, wantCode: http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db.Errors = tc.dbErrors
+			response := get(tc.path)
+			assert.Equal(t, tc.wantCode, response.Code, response.Body.String())
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"movinglake.com/haven/handler/jsonutils"
+	"movinglake.com/haven/handler/notifications"
+	"movinglake.com/haven/wrappers"
+)
+
+// DefaultDigestInterval is how often RunDigests looks for digests whose window has ended.
+const DefaultDigestInterval = time.Minute
+
+// errDigestTaken rolls back a digest whose notifications were digested by another replica.
+var errDigestTaken = errors.New("digest sent by another replica")
+
+// digestKey is what notifications are batched by: one digest per resource and destination.
+type digestKey struct {
+	namespace string
+	resource  string
+	sender    string
+	channel   string
+}
+
+// typeName formats the value of a "type" keyword, e.g. null|string.
+func typeName(v any) string {
+	if types, ok := v.([]any); ok {
+		names := make([]string, len(types))
+		for i, t := range types {
+			names[i] = fmt.Sprint(t)
+		}
+		return strings.Join(names, "|")
+	}
+	return fmt.Sprint(v)
+}
+
+// schemaFieldChanges returns the fields added and the types changed from oldSchema to
+// newSchema, one line per change.
+func schemaFieldChanges(oldSchema, newSchema map[string]any) (added []string, retyped []string) {
+	for _, c := range jsonutils.DiffSchemas(oldSchema, newSchema) {
+		switch {
+		case c.Kind == jsonutils.ChangeAdded && strings.HasSuffix(c.Path, "/properties"):
+			// A whole properties object is new, all of its fields are.
+			parent, ok := jsonutils.FieldPath(strings.TrimSuffix(c.Path, "/properties"))
+			props, isMap := c.New.(map[string]any)
+			if !ok || !isMap {
+				continue
+			}
+			var names []string
+			for name := range props {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				if parent != "" {
+					name = parent + "." + name
+				}
+				added = append(added, "+ "+name)
+			}
+		case c.Kind == jsonutils.ChangeAdded:
+			i := strings.LastIndex(c.Path, "/")
+			if field, ok := jsonutils.FieldPath(c.Path); ok && strings.HasSuffix(c.Path[:i], "/properties") {
+				added = append(added, "+ "+field)
+			}
+		case c.Kind == jsonutils.ChangeChanged && strings.HasSuffix(c.Path, "/type"):
+			field, ok := jsonutils.FieldPath(strings.TrimSuffix(c.Path, "/type"))
+			if !ok {
+				continue
+			}
+			if field == "" {
+				field = "(root)"
+			}
+			retyped = append(retyped, fmt.Sprintf("~ %s: %s -> %s", field, typeName(c.Old), typeName(c.New)))
+		}
+	}
+	return added, retyped
+}
+
+// digestChanges returns the fields added and the types changed by the versions first to last
+// of the resource.
+func (h *HavenAPIHandler) digestChanges(resource string, first, last uint) ([]string, []string, error) {
+	res, err := h.db.GetResource(resource, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get resource from db: %w", err)
+	}
+	if res == nil {
+		return nil, nil, fmt.Errorf("resource not found: %s", resource)
+	}
+	versions, err := h.db.GetResourceVersions(res.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get versions from db: %w", err)
+	}
+	var oldSchema, newSchema string
+	found := 0
+	for _, v := range versions {
+		if v.Version == first {
+			oldSchema = v.OldSchema
+			found++
+		}
+		if v.Version == last {
+			newSchema = v.NewSchema
+			found++
+		}
+	}
+	if found != 2 {
+		return nil, nil, fmt.Errorf("versions %d to %d of resource %s not found", first, last, resource)
+	}
+	oldMap := map[string]any{}
+	if oldSchema != "" {
+		if err := json.Unmarshal([]byte(oldSchema), &oldMap); err != nil {
+			return nil, nil, fmt.Errorf("failed to unmarshal schema of version %d: %w", first, err)
+		}
+	}
+	var newMap map[string]any
+	if err := json.Unmarshal([]byte(newSchema), &newMap); err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal schema of version %d: %w", last, err)
+	}
+	added, retyped := schemaFieldChanges(oldMap, newMap)
+	return added, retyped, nil
+}
+
+// digestNotification summarizes the batched version notifications of a resource: the versions
+// added and the fields added and types changed across them.
+func (h *HavenAPIHandler) digestNotification(resource string, batch []wrappers.NotificationOutbox) notifications.Notification {
+	n := notifications.Notification{
+		Namespace: h.namespace,
+		Resource:  resource,
+		Event:     notifications.EventDigest,
+		Severity:  notifications.SeverityCompatible,
+		URL:       h.resourceURL(resource),
+	}
+	var versions []uint
+	for _, row := range batch {
+		var v notifications.Notification
+		if err := json.Unmarshal([]byte(row.Notification), &v); err != nil {
+			log.Printf("failed to unmarshal notification %d of digest: %v", row.ID, err)
+			continue
+		}
+		versions = append(versions, v.Version)
+		if v.Severity == notifications.SeverityBreaking {
+			n.Severity = notifications.SeverityBreaking
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i] < versions[j]
+	})
+	list := make([]string, len(versions))
+	for i, v := range versions {
+		list[i] = fmt.Sprint(v)
+	}
+	n.Text = fmt.Sprintf("Digest of resource %s: new versions %s", h.resourceText(resource), strings.Join(list, ", "))
+	if len(versions) == 0 {
+		return n
+	}
+	added, retyped, err := h.digestChanges(resource, versions[0], versions[len(versions)-1])
+	if err != nil {
+		log.Printf("failed to get changes of digest: %v", err)
+		return n
+	}
+	n.Text += fmt.Sprintf("; fields added: %d; type changes: %d", len(added), len(retyped))
+	n.Changes = append(added, retyped...)
+	if len(n.Changes) > maxNotificationChanges {
+		n.Changes, n.MoreChanges = n.Changes[:maxNotificationChanges], len(n.Changes)-maxNotificationChanges
+	}
+	return n
+}
+
+// SendDigests puts a digest in the outbox for every resource and destination of every namespace
+// whose digest window has ended at now, and returns how many it sent.
+func (h *HavenAPIHandler) SendDigests(now time.Time) (int, error) {
+	rows, err := h.global.GetOutboxNotifications(wrappers.OutboxFilter{Status: wrappers.DeliveryDigest})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get digest notifications: %w", err)
+	}
+	batches := make(map[digestKey][]wrappers.NotificationOutbox)
+	var keys []digestKey
+	// Rows are newest first, batches are oldest first.
+	for i := len(rows) - 1; i >= 0; i-- {
+		key := digestKey{namespace: rows[i].Namespace, resource: rows[i].Resource, sender: rows[i].Sender, channel: rows[i].Channel}
+		if _, ok := batches[key]; !ok {
+			keys = append(keys, key)
+		}
+		batches[key] = append(batches[key], rows[i])
+	}
+	sent := 0
+	for _, key := range keys {
+		batch := batches[key]
+		// The window opens with the oldest notification of the batch.
+		if batch[0].NextAttemptAt.After(now) {
+			continue
+		}
+		scoped := h.InNamespace(key.namespace)
+		n := scoped.digestNotification(key.resource, batch)
+		b, err := json.Marshal(n)
+		if err != nil {
+			return sent, fmt.Errorf("failed to marshal digest: %w", err)
+		}
+		ids := make([]uint, len(batch))
+		for i := range batch {
+			ids[i] = batch[i].ID
+		}
+		err = scoped.db.Transaction(func(t *gorm.DB) error {
+			// Marking the batch only if it is still waiting for its digest keeps other
+			// replicas from sending it too.
+			marked, err := scoped.db.MarkDigested(ids, t)
+			if err != nil {
+				return fmt.Errorf("failed to mark notifications digested: %w", err)
+			}
+			if marked != int64(len(ids)) {
+				return errDigestTaken
+			}
+			return scoped.saveOutbox(key.resource, n.Event, string(b), notificationTarget{sender: key.sender, channel: key.channel}, t)
+		})
+		if errors.Is(err, errDigestTaken) {
+			continue
+		}
+		if err != nil {
+			return sent, fmt.Errorf("failed to save digest of resource %s: %w", key.resource, err)
+		}
+		sent++
+	}
+	if sent > 0 {
+		h.wakeOutbox()
+	}
+	return sent, nil
+}
+
+// RunDigests sends the digests whose window has ended every interval until the context is
+// done.
+func (h *HavenAPIHandler) RunDigests(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := h.SendDigests(time.Now()); err != nil {
+			log.Printf("failed to send digests: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"movinglake.com/haven/handler/notifications"
+	"movinglake.com/haven/wrappers"
+)
+
+func TestSchemaFieldChanges(t *testing.T) {
+	oldSchema := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"name": map[string]any{"type": "string"},
+			"tags": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		},
+	}
+	newSchema := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"name": map[string]any{"type": []any{"null", "string"}},
+			"tags": map[string]any{"type": "array", "items": map[string]any{"type": "number"}},
+			"age":  map[string]any{"type": "number"},
+			"address": map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"zip": map[string]any{"type": "string"}, "city": map[string]any{"type": "string"}},
+			},
+		},
+	}
+	added, retyped := schemaFieldChanges(oldSchema, newSchema)
+	assert.Equal(t, []string{"+ address", "+ age"}, added)
+	assert.Equal(t, []string{"~ name: string -> null|string", "~ tags[]: string -> number"}, retyped)
+
+	added, _ = schemaFieldChanges(map[string]any{}, newSchema)
+	assert.Equal(t, []string{"+ address", "+ age", "+ name", "+ tags"}, added)
+}
+
+func TestDigests(t *testing.T) {
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	handler := NewHavenAPIHandler(db, &NotificationsConfig{BaseURL: "https://haven.example.com"})
+	sender := &fakeNotificationSender{}
+	handler.notifier.Register(notifications.SenderSlack, sender)
+	router := gin.Default()
+	handler.RegisterRoutes(router)
+
+	for _, digest := range []string{"1", "30s"} {
+		response := postJSON(router, "/api/v1/set_notification_route", SetNotificationRouteRequest{Resource: "users", Sender: notifications.SenderSlack, Digest: digest})
+		assert.Equal(t, http.StatusBadRequest, response.Code, digest)
+	}
+	response := postJSON(router, "/api/v1/set_notification_route", SetNotificationRouteRequest{Resource: "users", Sender: notifications.SenderSlack, Digest: "1h"})
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	postJSON(router, "/api/v1/set_notification_route", SetNotificationRouteRequest{Resource: "orders", Sender: notifications.SenderSlack})
+
+	for _, payload := range []map[string]any{
+		{"name": "Ann"},
+		{"name": "Ann", "age": "30"},
+		{"name": "Ann", "age": 30, "email": "ann@example.com"},
+	} {
+		response := postJSON(router, "/api/v1/add_payload", AddPayloadRequest{Resource: "users", Payload: payload})
+		assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	}
+	postJSON(router, "/api/v1/add_payload", AddPayloadRequest{Resource: "orders", Payload: map[string]any{"id": 1}})
+
+	// Resources without a digest are sent right away, the others wait for their window.
+	now := time.Now()
+	deliver(handler)
+	assert.Equal(t, 1, len(sender.notifications))
+	assert.Equal(t, "orders", sender.notifications[0].Resource)
+	sent, err := handler.SendDigests(now)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, sent)
+	assert.Equal(t, 3, len(getDeliveries(router, "?status=digest").Deliveries))
+
+	sent, err = handler.SendDigests(now.Add(time.Hour + time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	deliver(handler)
+	assert.Equal(t, 2, len(sender.notifications))
+	digest := sender.notifications[1]
+	assert.Equal(t, notifications.EventDigest, digest.Event)
+	assert.Equal(t, notifications.SeverityCompatible, digest.Severity)
+	assert.Equal(t, "Digest of resource `users`: new versions 1, 2, 3; fields added: 3; type changes: 0", digest.Text)
+	assert.Equal(t, []string{"+ age", "+ email", "+ name"}, digest.Changes)
+	assert.Equal(t, "https://haven.example.com/resource/users", digest.URL)
+	assert.Equal(t, 3, len(getDeliveries(router, "?status=digested").Deliveries))
+
+	// The next digest starts a new window.
+	postJSON(router, "/api/v1/add_payload", AddPayloadRequest{Resource: "users", Payload: map[string]any{"name": 5}})
+	sent, _ = handler.SendDigests(now.Add(30 * time.Minute))
+	assert.Equal(t, 0, sent)
+	sent, _ = handler.SendDigests(now.Add(2 * time.Hour))
+	assert.Equal(t, 1, sent)
+	deliver(handler)
+	assert.Equal(t, "Digest of resource `users`: new versions 4; fields added: 0; type changes: 1", sender.notifications[2].Text)
+	assert.Equal(t, []string{"~ name: string -> number|string"}, sender.notifications[2].Changes)
+
+	// Batches another replica has digested in the meantime are skipped.
+	postJSON(router, "/api/v1/add_payload", AddPayloadRequest{Resource: "users", Payload: map[string]any{"zip": "08001"}})
+	waiting := getDeliveries(router, "?status=digest").Deliveries
+	assert.Equal(t, 1, len(waiting))
+	db.MarkDigested([]uint{waiting[0].ID}, nil)
+	sent, err = handler.SendDigests(now.Add(4 * time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, sent)
+	assert.Empty(t, getDeliveries(router, "?status=pending").Deliveries)
+}
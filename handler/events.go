@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"time"
+
+	"movinglake.com/haven/telemetry"
+	"movinglake.com/haven/wrappers"
+)
+
+// Sources of new schema versions.
+const (
+	SourcePayload   = "payload"
+	SourceSetSchema = "set_schema"
+	SourceImport    = "import"
+)
+
+// VersionEvent describes a new version of the schema of a resource.
+type VersionEvent struct {
+	Namespace  string
+	Resource   string
+	ResourceID uint
+	Version    uint
+	OldSchema  string
+	NewSchema  string
+	// ReferencePayloadID is the ID of the payload that triggered the version, zero if there is
+	// none.
+	ReferencePayloadID uint
+	// Source is what created the version: payload, set_schema or import.
+	Source    string
+	CreatedAt time.Time
+}
+
+func newVersionEvent(rv *wrappers.ResourceVersions, source string) VersionEvent {
+	ev := VersionEvent{
+		Namespace:  rv.Resource.Namespace,
+		Resource:   rv.Resource.Name,
+		ResourceID: rv.Resource.ID,
+		Version:    rv.Version,
+		OldSchema:  rv.OldSchema,
+		NewSchema:  rv.NewSchema,
+		Source:     source,
+		CreatedAt:  rv.CreatedAt,
+	}
+	if rv.ReferencePayload != nil {
+		ev.ReferencePayloadID = rv.ReferencePayload.ID
+	}
+	return ev
+}
+
+// OnVersion registers a function called with every new schema version once it is committed to
+// the DB. Hooks run synchronously in registration order and must not be registered while the
+// handler is serving requests.
+func (h *HavenAPIHandler) OnVersion(hook func(VersionEvent)) {
+	h.versionHooks = append(h.versionHooks, hook)
+}
+
+// versionAdded records the new version in the metrics, calls the version hooks and streams
+// it.
+func (h *HavenAPIHandler) versionAdded(ev VersionEvent) {
+	telemetry.SchemaVersions.WithLabelValues(ev.Namespace, ev.Resource, ev.Source).Inc()
+	for _, hook := range h.versionHooks {
+		hook(ev)
+	}
+	h.events.publish(StreamEvent{
+		Event:     StreamVersionAdded,
+		Namespace: ev.Namespace,
+		Resource:  ev.Resource,
+		Version:   ev.Version,
+		At:        ev.CreatedAt,
+	})
+}
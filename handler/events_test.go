@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"movinglake.com/haven/wrappers"
+)
+
+func TestOnVersion(t *testing.T) {
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	handler := NewHavenAPIHandler(db, nil)
+	var events []VersionEvent
+	handler.OnVersion(func(ev VersionEvent) { events = append(events, ev) })
+	router := gin.Default()
+	handler.RegisterRoutes(router)
+
+	postJSON(router, "/api/v1/add_payload", AddPayloadRequest{Resource: "users", Payload: map[string]any{"name": "Juan"}})
+	// Payloads that do not change the schema add no version.
+	postJSON(router, "/api/v1/add_payload", AddPayloadRequest{Resource: "users", Payload: map[string]any{"name": "Ana"}})
+	postJSON(router, "/api/v1/set_schema", SetSchemaRequest{Resource: "users", Schema: map[string]any{"type": "object"}})
+	postJSON(router, "/api/v1/import?mode=replace", Bundle{
+		FormatVersion: BundleFormatVersion,
+		Resources: []BundleResource{
+			{Name: "users", Schema: map[string]any{"type": "array"}},
+			{
+				Name:    "pets",
+				Schema:  map[string]any{"type": "object"},
+				Version: 1,
+				Versions: []BundleVersion{
+					{Version: 1, NewSchema: map[string]any{"type": "object"}, ReferencePayload: map[string]any{}},
+				},
+			},
+		},
+	})
+	db.Errors = map[string]error{"Save": gorm.ErrInvalidDB}
+	postJSON(router, "/api/v1/set_schema", SetSchemaRequest{Resource: "users", Schema: map[string]any{}})
+
+	assert.Equal(t, 4, len(events))
+	first := events[0]
+	assert.Equal(t, "users", first.Resource)
+	assert.Equal(t, uint(1), first.Version)
+	assert.Equal(t, SourcePayload, first.Source)
+	assert.Equal(t, "", first.OldSchema)
+	assert.Equal(t, uint(1), first.ReferencePayloadID)
+	assert.False(t, first.CreatedAt.IsZero())
+
+	assert.Equal(t, SourceSetSchema, events[1].Source)
+	assert.Equal(t, uint(2), events[1].Version)
+	assert.Equal(t, first.NewSchema, events[1].OldSchema)
+	assert.Equal(t, `{"type":"object"}`, events[1].NewSchema)
+	assert.Equal(t, uint(0), events[1].ReferencePayloadID)
+
+	assert.Equal(t, SourceImport, events[2].Source)
+	assert.Equal(t, uint(3), events[2].Version)
+	assert.Equal(t, "pets", events[3].Resource)
+	assert.Equal(t, uint(2), events[3].ReferencePayloadID)
+}
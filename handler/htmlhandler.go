@@ -4,51 +4,126 @@ import (
 	"log"
 	"net/http"
 	"path/filepath"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"movinglake.com/haven/wrappers"
 )
 
 type HavenHTMLHandler struct {
-	db wrappers.DB
+	db   wrappers.DB
+	auth *apiKeyAuth
 }
 
 func NewHavenHTMLHandler(db wrappers.DB) *HavenHTMLHandler {
 	return &HavenHTMLHandler{
-		db: db,
+		db:   db,
+		auth: &apiKeyAuth{db: db},
 	}
 }
 
+// RequireAPIKeys makes the pages require an API key granted the read scope. Browsers send it in
+// the cookie set by the login page.
+func (h *HavenHTMLHandler) RequireAPIKeys() {
+	h.auth.enabled = true
+}
+
+// namespaceLink is a namespace listed on the index page.
+type namespaceLink struct {
+	Name string
+	Path string
+}
+
 func (h *HavenHTMLHandler) home(c *gin.Context) {
-	resources, err := h.db.GetAllResources()
+	namespace := c.GetString(namespaceContext)
+	resources, err := h.db.WithNamespace(namespace).GetAllResources()
 	if err != nil {
 		log.Printf("Error getting resources: %v", err)
 	}
 	var formattedResources []string
+	var metrics []ValidationSummary
+	since := time.Now().Add(-24 * time.Hour)
 	for _, r := range resources {
 		formattedResources = append(formattedResources, r.Name)
+		summary, err := summarizeValidations(h.db, r, since)
+		if err != nil {
+			log.Printf("Error getting validation metrics for %s: %v", r.Name, err)
+			continue
+		}
+		metrics = append(metrics, summary)
+	}
+	namespaces, err := h.db.GetNamespaces()
+	if err != nil {
+		log.Printf("Error getting namespaces: %v", err)
+	}
+	var links []namespaceLink
+	for _, ns := range namespaces {
+		if bound := keyNamespace(c); bound == "" || bound == ns {
+			links = append(links, namespaceLink{Name: ns, Path: pagePath(ns) + "/"})
+		}
 	}
 	c.HTML(http.StatusOK, "index.html", gin.H{
-		"title":     "Haven",
-		"resources": formattedResources,
-		"config":    "",
-		"logs":      "",
-		"metrics":   "",
+		"title":      "Haven",
+		"resources":  formattedResources,
+		"config":     "",
+		"logs":       "",
+		"metrics":    metrics,
+		"namespace":  namespace,
+		"namespaces": links,
+		"base":       pagePath(namespace),
+		"api":        apiPath(namespace),
 	})
 }
 
+// login stores the API key of the form in a cookie, which the pages and the API calls made by
+// them are authenticated with.
+func (h *HavenHTMLHandler) login(c *gin.Context) {
+	key := c.PostForm("key")
+	row, err := h.auth.authorize(key, ScopeRead, "")
+	if err != nil {
+		c.HTML(statusCode(err), "login.html", gin.H{
+			"title": "Haven",
+			"error": err.Error(),
+		})
+		return
+	}
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(APIKeyCookie, key, int(apiKeyCookieAge.Seconds()), "/", "", c.Request.TLS != nil, true)
+	// Keys bound to a namespace land on its index page.
+	namespace := row.Namespace
+	if namespace == "" {
+		namespace = wrappers.DefaultNamespace
+	}
+	c.Redirect(http.StatusSeeOther, pagePath(namespace)+"/")
+}
+
 func (h *HavenHTMLHandler) RegisterRoutes(r *gin.Engine, templateRegex string, staticDir string) {
 	r.LoadHTMLGlob(templateRegex)
-	r.GET("/", h.home)
-	r.GET("/index", h.home)
-	r.GET("/index.html", h.home)
-	r.GET("/resource/:name", func(c *gin.Context) {
-		name := c.Param("name")
-		c.HTML(http.StatusOK, "resource.html", gin.H{
-			"title":         "Haven",
-			"resource_name": name,
+	read := h.auth.requirePage(ScopeRead)
+	// The pages of the default namespace are at the root, the ones of the others under
+	// /namespaces/<namespace>.
+	for _, g := range []*gin.RouterGroup{r.Group(""), r.Group("/namespaces/:namespace")} {
+		g.Use(withNamespace)
+		g.GET("/", read, h.home)
+		g.GET("/index", read, h.home)
+		g.GET("/index.html", read, h.home)
+		g.GET("/resource/:name", read, func(c *gin.Context) {
+			namespace := c.GetString(namespaceContext)
+			c.HTML(http.StatusOK, "resource.html", gin.H{
+				"title":         "Haven",
+				"resource_name": c.Param("name"),
+				"namespace":     namespace,
+				"base":          pagePath(namespace),
+				"api":           apiPath(namespace),
+			})
+		})
+	}
+	r.GET("/login", func(c *gin.Context) {
+		c.HTML(http.StatusOK, "login.html", gin.H{
+			"title": "Haven",
 		})
 	})
+	r.POST("/login", h.login)
 	r.GET("/js/:name", func(c *gin.Context) {
 		name := c.Param("name")
 		c.File(filepath.Join(staticDir, "js", name))
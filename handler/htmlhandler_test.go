@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -43,6 +44,14 @@ func TestRegisterRoutes(t *testing.T) {
 	router.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusOK, w.Code)
 
+	db.IncrementValidationCounts(wrappers.ValidationIncrement{ResourceID: 1, Version: 1, At: time.Now(), Received: 1, Total: 1}, nil)
+	db.IncrementValidationCounts(wrappers.ValidationIncrement{ResourceID: 1, Version: 1, At: time.Now(), Received: 1, Total: 1, Failed: 1}, nil)
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/index", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "50.00%")
+
 	w = httptest.NewRecorder()
 	req, _ = http.NewRequest("GET", "/js/jsonTree.js", nil)
 	router.ServeHTTP(w, req)
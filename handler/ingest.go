@@ -0,0 +1,211 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"gorm.io/gorm"
+	"movinglake.com/haven/handler/jsonutils"
+	"movinglake.com/haven/telemetry"
+	"movinglake.com/haven/wrappers"
+)
+
+// apiError is an error together with the HTTP status code it maps to.
+type apiError struct {
+	code int
+	err  error
+	// permanent marks server errors that retrying the same request will not fix.
+	permanent bool
+}
+
+func (e *apiError) Error() string {
+	return e.err.Error()
+}
+
+func (e *apiError) Unwrap() error {
+	return e.err
+}
+
+// Temporary reports whether retrying the same request may succeed.
+func (e *apiError) Temporary() bool {
+	return !e.permanent && e.code >= http.StatusInternalServerError
+}
+
+func newAPIError(code int, format string, args ...any) error {
+	return &apiError{code: code, err: fmt.Errorf(format, args...)}
+}
+
+// newPermanentError is newAPIError for server errors the same request always fails with, like
+// a stored schema that cannot be parsed.
+func newPermanentError(code int, format string, args ...any) error {
+	return &apiError{code: code, err: fmt.Errorf(format, args...), permanent: true}
+}
+
+// statusCode returns the HTTP status code of err, defaulting to 500.
+func statusCode(err error) int {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr.code
+	}
+	return http.StatusInternalServerError
+}
+
+// appliedPayload is the outcome of applying a payload to the schema of a resource.
+type appliedPayload struct {
+	resource   *wrappers.Resource
+	schema     map[string]any
+	newVersion bool
+}
+
+// applyPayload expands the schema of the resource so the payload is valid against it. New
+// schemas are saved as a new version with the payload as reference payload. The resource is
+// created if it does not exist.
+func (h *HavenAPIHandler) applyPayload(name string, payload any) (*appliedPayload, error) {
+	if name == "" {
+		return nil, newAPIError(http.StatusBadRequest, "resource name is required")
+	}
+	var applied appliedPayload
+	var rv *wrappers.ResourceVersions
+	err := h.db.Transaction(func(t *gorm.DB) error {
+		r, err := h.db.SelectResourceForUpdate(name, t)
+		if err != nil {
+			return newAPIError(http.StatusInternalServerError, "failed to get resource from db: %v", err)
+		}
+
+		schema := make(map[string]interface{})
+		if r != nil && r.ID != 0 {
+			if err := json.Unmarshal([]byte(r.Schema), &schema); err != nil {
+				return newPermanentError(http.StatusInternalServerError, "failed to unmarshal schema: %v \"%v\"", err, r.Schema)
+			}
+		}
+
+		newSchema, err := jsonutils.ApplyPayload(schema, payload, name)
+		if err != nil {
+			telemetry.ExpansionFailures.WithLabelValues(h.namespace, name).Inc()
+			return newPermanentError(http.StatusInternalServerError, "failed to apply payload: %v", err)
+		}
+
+		if newSchema == nil {
+			// No changes to existing schema.
+			log.Printf("no changes to the schema for resource %v", name)
+			applied.resource = r
+			applied.schema = schema
+			return nil
+		}
+		log.Printf("changes found to the schema for resource %s", name)
+
+		// Save the new schema.
+		newSchemaBytes, err := json.Marshal(newSchema)
+		if err != nil {
+			return newAPIError(http.StatusInternalServerError, "failed to marshal new schema: %v", err)
+		}
+		r.Version += 1
+		oldSchema := r.Schema
+		r.Schema = string(newSchemaBytes)
+		r.Name = name
+		if err := h.db.Save(r, t); err != nil {
+			return newAPIError(http.StatusInternalServerError, "failed to save resource: %v", err)
+		}
+
+		// Save the reference payload.
+		payloadBytes, err := json.Marshal(payload)
+		if err != nil {
+			return newAPIError(http.StatusInternalServerError, "failed to marshal payload: %v", err)
+		}
+		refPayload := &wrappers.ReferencePayloads{
+			Resource: *r,
+			Payload:  string(payloadBytes),
+		}
+		if err := h.db.Save(refPayload, t); err != nil {
+			return newAPIError(http.StatusInternalServerError, "failed to save reference payload: %v", err)
+		}
+
+		// Save the new version.
+		rv = &wrappers.ResourceVersions{
+			Resource:         *r,
+			ReferencePayload: refPayload,
+			OldSchema:        oldSchema,
+			NewSchema:        string(newSchemaBytes),
+			Version:          r.Version,
+		}
+
+		if err := h.db.Save(rv, t); err != nil {
+			return newAPIError(http.StatusInternalServerError, "failed to save resource version: %v", err)
+		}
+		n := h.versionNotification(newVersionEvent(rv, SourcePayload), refPayload.Payload)
+		if err := h.enqueueNotification(n, t); err != nil {
+			return err
+		}
+		if err := h.enqueueWebhooks(rv, t); err != nil {
+			return err
+		}
+		var schemaMap map[string]any
+		if err := json.Unmarshal(newSchemaBytes, &schemaMap); err != nil {
+			return newAPIError(http.StatusInternalServerError, "failed to unmarshal new schema: %v", err)
+		}
+		applied.resource = r
+		applied.schema = schemaMap
+		applied.newVersion = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if applied.newVersion {
+		h.versionAdded(newVersionEvent(rv, SourcePayload))
+		h.wakeOutbox()
+	}
+	return &applied, nil
+}
+
+// checkPayload validates the payload against the schema of the resource and records the
+// result in the validation metrics. Invalid payloads are quarantined if recordFailures is set.
+func (h *HavenAPIHandler) checkPayload(name string, payload any, recordFailures bool) (*wrappers.Resource, []ErrorResponse, error) {
+	res, err := h.db.GetResource(name, nil)
+	if err != nil {
+		return nil, nil, newAPIError(http.StatusInternalServerError, "failed to get resource from db: %v", err)
+	}
+	if res == nil {
+		return nil, nil, newAPIError(http.StatusNotFound, "resource not found: %s", name)
+	}
+
+	schema := make(map[string]any)
+	if err := json.Unmarshal([]byte(res.Schema), &schema); err != nil {
+		return nil, nil, newPermanentError(http.StatusInternalServerError, "failed to unmarshal schema: %v", err)
+	}
+
+	result, err := jsonutils.ValidatePayload(schema, payload)
+	if err != nil {
+		return nil, nil, newPermanentError(http.StatusInternalServerError, "failed to validate payload: %v", err)
+	}
+	if result.Valid() {
+		h.recordValidation(res, nil)
+		return res, nil, nil
+	}
+	errs := ToErrorResponses(schema, result)
+	h.recordValidation(res, errs)
+	if recordFailures {
+		if err := h.quarantinePayload(res, payload, errs); err != nil {
+			return nil, nil, newAPIError(http.StatusInternalServerError, "failed to record invalid payload: %v", err)
+		}
+	}
+	return res, errs, nil
+}
+
+// AddPayload applies the payload to the schema of the resource. It returns once the changes
+// are committed to the DB.
+func (h *HavenAPIHandler) AddPayload(resource string, payload any) error {
+	_, err := h.applyPayload(resource, payload)
+	return err
+}
+
+// ValidatePayload validates the payload against the schema of the resource. Invalid payloads
+// are recorded in the metrics (and the quarantine if recordFailures is set) but are not an
+// error.
+func (h *HavenAPIHandler) ValidatePayload(resource string, payload any, recordFailures bool) error {
+	_, _, err := h.checkPayload(resource, payload, recordFailures)
+	return err
+}
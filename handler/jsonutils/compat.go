@@ -0,0 +1,188 @@
+package jsonutils
+
+import (
+	"reflect"
+	"strings"
+)
+
+// annotations are the keywords that don't change which payloads a schema accepts.
+var annotations = map[string]bool{
+	"$id":         true,
+	"$schema":     true,
+	"$comment":    true,
+	"title":       true,
+	"description": true,
+	"examples":    true,
+	"default":     true,
+	"deprecated":  true,
+	"readOnly":    true,
+	"writeOnly":   true,
+}
+
+// pointerTokens splits an RFC 6901 JSON Pointer into its unescaped reference tokens.
+func pointerTokens(pointer string) []string {
+	if pointer == "" {
+		return nil
+	}
+	tokens := strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens
+}
+
+// typeSet returns the types of a "type" keyword value.
+func typeSet(v any) map[any]bool {
+	set := make(map[any]bool)
+	switch t := v.(type) {
+	case []any:
+		for _, typ := range t {
+			set[typ] = true
+		}
+	default:
+		set[t] = true
+	}
+	return set
+}
+
+// containsAll reports whether every element of sub is in list, compared as JSON values.
+func containsAll(list, sub []any) bool {
+	for _, s := range sub {
+		found := false
+		for _, l := range list {
+			if reflect.DeepEqual(l, s) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// widensToAnyOf reports whether the new schema is an anyOf union one of whose variants is the
+// old schema, the way ExpandSchema widens array items.
+func widensToAnyOf(oldV, newV any) bool {
+	m, ok := newV.(map[string]any)
+	if !ok {
+		return false
+	}
+	variants, _ := m["anyOf"].([]any)
+	for _, v := range variants {
+		if reflect.DeepEqual(v, oldV) || reflect.DeepEqual(v, map[string]any{"type": oldV}) {
+			return true
+		}
+	}
+	return false
+}
+
+// looserVariant reports whether a variant of a union added to the old schema only has
+// keywords of the old schema, so every payload the old schema accepted matches it.
+func looserVariant(oldSchema map[string]any, variants any) bool {
+	list, _ := variants.([]any)
+	for _, v := range list {
+		m, ok := v.(map[string]any)
+		if !ok {
+			continue
+		}
+		looser := true
+		for k, value := range m {
+			if !reflect.DeepEqual(oldSchema[k], value) {
+				looser = false
+				break
+			}
+		}
+		if looser {
+			return true
+		}
+	}
+	return false
+}
+
+// valueAtPointer returns the value of the schema at the tokens, nil if there is none.
+func valueAtPointer(schema map[string]any, tokens []string) any {
+	var v any = schema
+	for _, t := range tokens {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[t]
+	}
+	return v
+}
+
+// isBreaking reports whether a change may reject payloads the old schema accepted or drop
+// properties consumers rely on. Changes that aren't known to be safe are breaking.
+func isBreaking(oldSchema map[string]any, c SchemaChange) bool {
+	tokens := pointerTokens(c.Path)
+	if len(tokens) == 0 {
+		return true
+	}
+	keyword := tokens[len(tokens)-1]
+	inProperties := len(tokens) > 1 && tokens[len(tokens)-2] == "properties"
+	if annotations[keyword] && !inProperties {
+		return false
+	}
+	switch c.Kind {
+	case ChangeRemoved:
+		// Removing a constraint accepts more payloads, removing a property drops it.
+		return inProperties
+	case ChangeAdded:
+		switch {
+		case inProperties:
+			// New properties are only breaking if required, which changes "required".
+			return false
+		case keyword == "required":
+			list, _ := c.New.([]any)
+			return len(list) > 0
+		case keyword == "additionalProperties":
+			return c.New != true
+		case keyword == "anyOf" || keyword == "oneOf":
+			parent, _ := valueAtPointer(oldSchema, tokens[:len(tokens)-1]).(map[string]any)
+			return !looserVariant(parent, c.New)
+		}
+		return true
+	}
+	if inProperties {
+		// A property schema replaced by a boolean schema.
+		return true
+	}
+	switch keyword {
+	case "required":
+		oldList, _ := c.Old.([]any)
+		newList, _ := c.New.([]any)
+		return !containsAll(oldList, newList)
+	case "type":
+		oldTypes, newTypes := typeSet(c.Old), typeSet(c.New)
+		for typ := range oldTypes {
+			if !newTypes[typ] && !(typ == "integer" && newTypes["number"]) {
+				return true
+			}
+		}
+		return false
+	case "additionalProperties":
+		return c.New != true
+	case "anyOf", "oneOf", "enum":
+		oldList, _ := c.Old.([]any)
+		newList, _ := c.New.([]any)
+		return !containsAll(newList, oldList)
+	}
+	return !widensToAnyOf(c.Old, c.New)
+}
+
+// BreakingChanges returns the changes from oldSchema to newSchema, as returned by DiffSchemas,
+// that may break producers or consumers of the resource: new required properties, narrower
+// types, removed properties and new constraints. Widening changes, such as the ones made by
+// ExpandSchema, and annotations are compatible.
+func BreakingChanges(oldSchema, newSchema map[string]any) []SchemaChange {
+	var breaking []SchemaChange
+	for _, c := range DiffSchemas(oldSchema, newSchema) {
+		if isBreaking(oldSchema, c) {
+			breaking = append(breaking, c)
+		}
+	}
+	return breaking
+}
@@ -0,0 +1,115 @@
+package jsonutils
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// roundTrip returns the schema as stored in the DB.
+func roundTrip(t *testing.T, schema map[string]any) map[string]any {
+	t.Helper()
+	b, err := json.Marshal(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]any
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestBreakingChanges(t *testing.T) {
+	oldSchema := map[string]any{
+		"title":                "users",
+		"type":                 "object",
+		"additionalProperties": false,
+		"required":             []any{"name"},
+		"properties": map[string]any{
+			"name":  map[string]any{"type": "string"},
+			"age":   map[string]any{"type": []any{"integer", "string"}},
+			"tags":  map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			"email": map[string]any{"type": "string"},
+			"role":  map[string]any{"enum": []any{"admin", "user"}},
+		},
+	}
+	compatible := map[string]any{
+		"title":                "Users",
+		"description":          "Users of the app.",
+		"type":                 "object",
+		"additionalProperties": true,
+		"required":             []any{},
+		"properties": map[string]any{
+			"name":     map[string]any{"type": []any{"null", "string"}},
+			"age":      map[string]any{"type": []any{"number", "string"}},
+			"tags":     map[string]any{"type": "array", "items": map[string]any{"anyOf": []any{map[string]any{"type": "string"}, map[string]any{"type": "number"}}}},
+			"email":    map[string]any{"type": "string", "description": "Contact."},
+			"role":     map[string]any{"enum": []any{"admin", "user", "guest"}},
+			"nickname": map[string]any{"type": "string"},
+		},
+	}
+	if got := BreakingChanges(oldSchema, compatible); len(got) != 0 {
+		t.Errorf("BreakingChanges() of compatible changes = %v", got)
+	}
+
+	breaking := map[string]any{
+		"title":    "users",
+		"type":     "object",
+		"required": []any{"name", "nickname"},
+		"properties": map[string]any{
+			"name":     map[string]any{"type": "string", "minLength": 1.0},
+			"age":      map[string]any{"type": "integer"},
+			"tags":     map[string]any{"type": "array", "items": map[string]any{"type": "number"}},
+			"role":     map[string]any{"enum": []any{"admin"}},
+			"nickname": map[string]any{"type": "string"},
+		},
+	}
+	want := []SchemaChange{
+		{Path: "/properties/age/type", Kind: ChangeChanged, Old: []any{"integer", "string"}, New: "integer"},
+		{Path: "/properties/email", Kind: ChangeRemoved, Old: map[string]any{"type": "string"}},
+		{Path: "/properties/name/minLength", Kind: ChangeAdded, New: 1.0},
+		{Path: "/properties/role/enum", Kind: ChangeChanged, Old: []any{"admin", "user"}, New: []any{"admin"}},
+		{Path: "/properties/tags/items/type", Kind: ChangeChanged, Old: "string", New: "number"},
+		{Path: "/required", Kind: ChangeChanged, Old: []any{"name"}, New: []any{"name", "nickname"}},
+	}
+	if diff := cmp.Diff(want, BreakingChanges(oldSchema, breaking)); diff != "" {
+		t.Errorf("BreakingChanges() got a diff: %s", diff)
+	}
+
+	// Closing the schema to additional properties is breaking, opening it is not.
+	open := map[string]any{"type": "object"}
+	closed := map[string]any{"type": "object", "additionalProperties": false}
+	if got := BreakingChanges(open, closed); len(got) != 1 {
+		t.Errorf("BreakingChanges() of closing the schema = %v", got)
+	}
+	if got := BreakingChanges(closed, open); len(got) != 0 {
+		t.Errorf("BreakingChanges() of opening the schema = %v", got)
+	}
+}
+
+func TestBreakingChangesOfExpandedSchemas(t *testing.T) {
+	// Schemas learned from payloads only widen.
+	payloads := []any{
+		map[string]any{"name": "Ann", "age": 30},
+		map[string]any{"name": nil, "age": "thirty"},
+		map[string]any{"age": 31.5, "address": map[string]any{"city": "Lima"}},
+	}
+	schema := CreateSchema(payloads[0], "users")
+	for _, p := range payloads[1:] {
+		oldSchema := roundTrip(t, schema)
+		newSchema, err := ApplyPayload(roundTrip(t, schema), p, "users")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if newSchema == nil {
+			continue
+		}
+		newSchema = roundTrip(t, newSchema)
+		if got := BreakingChanges(oldSchema, newSchema); len(got) != 0 {
+			t.Errorf("BreakingChanges() of %v = %v", p, got)
+		}
+		schema = newSchema
+	}
+}
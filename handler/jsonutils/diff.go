@@ -0,0 +1,102 @@
+package jsonutils
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Kinds of schema changes.
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+// SchemaChange is a difference between two schemas at the location Path, an RFC 6901 JSON
+// Pointer into the schemas. Old is nil for added locations and New is nil for removed ones.
+type SchemaChange struct {
+	Path string `json:"path"`
+	Kind string `json:"kind"`
+	Old  any    `json:"old,omitempty"`
+	New  any    `json:"new,omitempty"`
+}
+
+// String formats the change as a line of a diff, e.g. `+ /properties/age: {"type":"number"}`.
+func (c SchemaChange) String() string {
+	switch c.Kind {
+	case ChangeAdded:
+		return fmt.Sprintf("+ %s: %s", c.Path, compactJSON(c.New))
+	case ChangeRemoved:
+		return fmt.Sprintf("- %s: %s", c.Path, compactJSON(c.Old))
+	}
+	return fmt.Sprintf("~ %s: %s -> %s", c.Path, compactJSON(c.Old), compactJSON(c.New))
+}
+
+func compactJSON(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// DiffSchemas returns the changes from oldSchema to newSchema sorted by path. Objects are
+// compared key by key, any other value (including arrays such as "required") is compared as a
+// whole.
+func DiffSchemas(oldSchema, newSchema map[string]any) []SchemaChange {
+	var changes []SchemaChange
+	diffObjects(nil, oldSchema, newSchema, &changes)
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+func diffObjects(tokens []string, oldObj, newObj map[string]any, changes *[]SchemaChange) {
+	for k, oldV := range oldObj {
+		path := append(append([]string{}, tokens...), k)
+		newV, ok := newObj[k]
+		if !ok {
+			*changes = append(*changes, SchemaChange{Path: toPointer(path), Kind: ChangeRemoved, Old: oldV})
+			continue
+		}
+		oldM, oldIsObj := oldV.(map[string]any)
+		newM, newIsObj := newV.(map[string]any)
+		if oldIsObj && newIsObj {
+			diffObjects(path, oldM, newM, changes)
+			continue
+		}
+		if !reflect.DeepEqual(oldV, newV) {
+			*changes = append(*changes, SchemaChange{Path: toPointer(path), Kind: ChangeChanged, Old: oldV, New: newV})
+		}
+	}
+	for k, newV := range newObj {
+		if _, ok := oldObj[k]; !ok {
+			path := append(append([]string{}, tokens...), k)
+			*changes = append(*changes, SchemaChange{Path: toPointer(path), Kind: ChangeAdded, New: newV})
+		}
+	}
+}
+
+// FieldPath returns the payload field a schema pointer is about, e.g. "address.city" for
+// /properties/address/properties/city and "tags[]" for /properties/tags/items. It returns
+// false for pointers that don't only go through properties and items.
+func FieldPath(pointer string) (string, bool) {
+	var fields []string
+	tokens := pointerTokens(pointer)
+	for i := 0; i < len(tokens); i++ {
+		switch {
+		case tokens[i] == "properties" && i+1 < len(tokens):
+			fields = append(fields, tokens[i+1])
+			i++
+		case tokens[i] == "items" && len(fields) > 0:
+			fields[len(fields)-1] += "[]"
+		default:
+			return "", false
+		}
+	}
+	return strings.Join(fields, "."), true
+}
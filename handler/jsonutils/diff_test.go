@@ -0,0 +1,72 @@
+package jsonutils
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiffSchemas(t *testing.T) {
+	oldSchema := map[string]any{
+		"type":     "object",
+		"required": []any{"name"},
+		"properties": map[string]any{
+			"name": map[string]any{"type": "string"},
+			"a/b":  map[string]any{"type": "number"},
+		},
+	}
+	newSchema := map[string]any{
+		"type":     "object",
+		"required": []any{"age", "name"},
+		"properties": map[string]any{
+			"name": map[string]any{"type": []any{"null", "string"}},
+			"age":  map[string]any{"type": "number"},
+		},
+	}
+	want := []SchemaChange{
+		{Path: "/properties/age", Kind: ChangeAdded, New: map[string]any{"type": "number"}},
+		{Path: "/properties/a~1b", Kind: ChangeRemoved, Old: map[string]any{"type": "number"}},
+		{Path: "/properties/name/type", Kind: ChangeChanged, Old: "string", New: []any{"null", "string"}},
+		{Path: "/required", Kind: ChangeChanged, Old: []any{"name"}, New: []any{"age", "name"}},
+	}
+	got := DiffSchemas(oldSchema, newSchema)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("DiffSchemas() got a diff: %s", diff)
+	}
+	if len(DiffSchemas(oldSchema, oldSchema)) != 0 {
+		t.Errorf("DiffSchemas() of equal schemas is not empty")
+	}
+
+	lines := []string{
+		`+ /properties/age: {"type":"number"}`,
+		`- /properties/a~1b: {"type":"number"}`,
+		`~ /properties/name/type: "string" -> ["null","string"]`,
+		`~ /required: ["name"] -> ["age","name"]`,
+	}
+	for i, c := range got {
+		if c.String() != lines[i] {
+			t.Errorf("String() = %q, want %q", c.String(), lines[i])
+		}
+	}
+}
+
+func TestFieldPath(t *testing.T) {
+	for pointer, want := range map[string]string{
+		"":                                     "",
+		"/properties/name":                     "name",
+		"/properties/address/properties/city":  "address.city",
+		"/properties/tags/items":               "tags[]",
+		"/properties/a~1b/items/properties/id": "a/b[].id",
+		"/properties/properties":               "properties",
+	} {
+		got, ok := FieldPath(pointer)
+		if !ok || got != want {
+			t.Errorf("FieldPath(%q) = %q, %v, want %q", pointer, got, ok, want)
+		}
+	}
+	for _, pointer := range []string{"/type", "/properties", "/items", "/properties/name/anyOf/0"} {
+		if _, ok := FieldPath(pointer); ok {
+			t.Errorf("FieldPath(%q) is a field", pointer)
+		}
+	}
+}
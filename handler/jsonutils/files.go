@@ -0,0 +1,29 @@
+package jsonutils
+
+import (
+	"net/url"
+	"strings"
+)
+
+// SchemaFileExt is the extension of exported schema files.
+const SchemaFileExt = ".schema.json"
+
+// SchemaFileName returns the name of the file holding the exported schema of the resource.
+// Resource names are path escaped so that names such as "/api/v1/payments" map to a single
+// file.
+func SchemaFileName(resource string) string {
+	return url.PathEscape(resource) + SchemaFileExt
+}
+
+// ResourceFromSchemaFile returns the resource name of an exported schema file name, or false
+// if the name is not one of a schema file.
+func ResourceFromSchemaFile(name string) (string, bool) {
+	if !strings.HasSuffix(name, SchemaFileExt) {
+		return "", false
+	}
+	resource, err := url.PathUnescape(strings.TrimSuffix(name, SchemaFileExt))
+	if err != nil || resource == "" {
+		return "", false
+	}
+	return resource, true
+}
@@ -0,0 +1,21 @@
+package jsonutils
+
+import "testing"
+
+func TestSchemaFileName(t *testing.T) {
+	for _, resource := range []string{"users", "/api/v1/payments", "a b%c"} {
+		name := SchemaFileName(resource)
+		got, ok := ResourceFromSchemaFile(name)
+		if !ok || got != resource {
+			t.Errorf("ResourceFromSchemaFile(%q) = %q, %v, want %q", name, got, ok, resource)
+		}
+	}
+	if got := SchemaFileName("/api/v1/payments"); got != "%2Fapi%2Fv1%2Fpayments.schema.json" {
+		t.Errorf("SchemaFileName() = %q", got)
+	}
+	for _, name := range []string{"users.json", ".schema.json", "%zz.schema.json"} {
+		if _, ok := ResourceFromSchemaFile(name); ok {
+			t.Errorf("ResourceFromSchemaFile(%q) is a schema file", name)
+		}
+	}
+}
@@ -267,8 +267,8 @@ func ApplyPayload(oldSchema map[string]any, payload any, resourceName string) (m
 	return oldSchema, nil
 }
 
-// ValidatePayload validates the payload against the schema.
-func ValidatePayload(schema map[string]any, payload any) (*gojsonschema.Result, error) {
+// CompileSchema parses the schema once so that it can validate many payloads.
+func CompileSchema(schema map[string]any) (*gojsonschema.Schema, error) {
 	if len(schema) == 0 {
 		return nil, fmt.Errorf("schema is empty")
 	}
@@ -276,5 +276,14 @@ func ValidatePayload(schema map[string]any, payload any) (*gojsonschema.Result,
 	if err != nil {
 		return nil, fmt.Errorf("failed to create the schema: %w", err)
 	}
+	return goSchema, nil
+}
+
+// ValidatePayload validates the payload against the schema.
+func ValidatePayload(schema map[string]any, payload any) (*gojsonschema.Result, error) {
+	goSchema, err := CompileSchema(schema)
+	if err != nil {
+		return nil, err
+	}
 	return goSchema.Validate(gojsonschema.NewGoLoader(payload))
 }
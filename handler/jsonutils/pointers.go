@@ -0,0 +1,134 @@
+package jsonutils
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/andres-movl/gojsonschema"
+)
+
+// errorKeywords maps the validation error types to the JSON schema keyword that produces them.
+var errorKeywords = map[string]string{
+	"false":                           "",
+	"required":                        "required",
+	"invalid_type":                    "type",
+	"number_any_of":                   "anyOf",
+	"number_one_of":                   "oneOf",
+	"number_all_of":                   "allOf",
+	"number_not":                      "not",
+	"missing_dependency":              "dependencies",
+	"internal":                        "",
+	"const":                           "const",
+	"enum":                            "enum",
+	"array_no_additional_items":       "additionalItems",
+	"array_min_items":                 "minItems",
+	"array_max_items":                 "maxItems",
+	"unique":                          "uniqueItems",
+	"contains":                        "contains",
+	"array_min_properties":            "minProperties",
+	"array_max_properties":            "maxProperties",
+	"additional_property_not_allowed": "additionalProperties",
+	"invalid_property_pattern":        "patternProperties",
+	"invalid_property_name":           "propertyNames",
+	"string_gte":                      "minLength",
+	"string_lte":                      "maxLength",
+	"pattern":                         "pattern",
+	"format":                          "format",
+	"multiple_of":                     "multipleOf",
+	"number_gte":                      "minimum",
+	"number_gt":                       "exclusiveMinimum",
+	"number_lte":                      "maximum",
+	"number_lt":                       "exclusiveMaximum",
+	"condition_then":                  "then",
+	"condition_else":                  "else",
+}
+
+// escapePointerToken escapes a reference token as described in RFC 6901.
+func escapePointerToken(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+// contextTokens returns the path of the context from the root, without the "(root)" element.
+func contextTokens(ctx *gojsonschema.JsonContext) []string {
+	var tokens []string
+	for ; ctx != nil && ctx.Head() != "(root)"; ctx = ctx.Tail() {
+		tokens = append([]string{ctx.Head()}, tokens...)
+	}
+	return tokens
+}
+
+// toPointer joins reference tokens into an RFC 6901 JSON Pointer.
+func toPointer(tokens []string) string {
+	var b strings.Builder
+	for _, t := range tokens {
+		b.WriteString("/")
+		b.WriteString(escapePointerToken(t))
+	}
+	return b.String()
+}
+
+// InstancePointer returns the RFC 6901 JSON Pointer to the payload location of a validation
+// error context. The root of the payload is the empty pointer.
+func InstancePointer(ctx *gojsonschema.JsonContext) string {
+	return toPointer(contextTokens(ctx))
+}
+
+// KeywordPointer returns the RFC 6901 JSON Pointer to the schema keyword that produced a
+// validation error of type errType at the payload location ctx. The schema is followed
+// through "properties", "items" and "additionalProperties" for as long as it describes the
+// payload location.
+func KeywordPointer(schema map[string]any, ctx *gojsonschema.JsonContext, errType string) string {
+	var tokens []string
+	curr := schema
+	for _, t := range contextTokens(ctx) {
+		if props, ok := curr["properties"].(map[string]any); ok {
+			if sub, ok := props[t].(map[string]any); ok {
+				tokens = append(tokens, "properties", t)
+				curr = sub
+				continue
+			}
+		}
+		if _, err := strconv.Atoi(t); err == nil {
+			if sub, ok := curr["items"].(map[string]any); ok {
+				tokens = append(tokens, "items")
+				curr = sub
+				continue
+			}
+		}
+		if sub, ok := curr["additionalProperties"].(map[string]any); ok {
+			tokens = append(tokens, "additionalProperties")
+			curr = sub
+			continue
+		}
+		break
+	}
+	if keyword := errorKeywords[errType]; keyword != "" {
+		tokens = append(tokens, keyword)
+	}
+	return toPointer(tokens)
+}
+
+// ValueAtPath returns the value at the dot separated path of the payload. Numeric path
+// elements index arrays.
+func ValueAtPath(payload any, path string) (any, bool) {
+	curr := payload
+	for _, p := range strings.Split(path, ".") {
+		switch v := curr.(type) {
+		case map[string]any:
+			next, ok := v[p]
+			if !ok {
+				return nil, false
+			}
+			curr = next
+		case []any:
+			i, err := strconv.Atoi(p)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			curr = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return curr, true
+}
@@ -0,0 +1,94 @@
+package jsonutils
+
+import (
+	"testing"
+
+	"github.com/andres-movl/gojsonschema"
+)
+
+func jsonContext(path ...string) *gojsonschema.JsonContext {
+	ctx := gojsonschema.NewJsonContext("(root)", nil)
+	for _, p := range path {
+		ctx = gojsonschema.NewJsonContext(p, ctx)
+	}
+	return ctx
+}
+
+func TestInstancePointer(t *testing.T) {
+	cases := []struct {
+		ctx  *gojsonschema.JsonContext
+		want string
+	}{
+		{jsonContext(), ""},
+		{jsonContext("items", "0", "name"), "/items/0/name"},
+		{jsonContext("a/b", "m~n"), "/a~1b/m~0n"},
+	}
+	for _, tc := range cases {
+		if got := InstancePointer(tc.ctx); got != tc.want {
+			t.Errorf("InstancePointer(%s) = %q, want %q", tc.ctx.String(), got, tc.want)
+		}
+	}
+}
+
+func TestKeywordPointer(t *testing.T) {
+	schema := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"items": map[string]any{
+				"type": "array",
+				"items": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"name": map[string]any{"type": "string"},
+					},
+				},
+			},
+			"meta": map[string]any{
+				"type":                 "object",
+				"additionalProperties": map[string]any{"type": "string"},
+			},
+		},
+	}
+	cases := []struct {
+		ctx     *gojsonschema.JsonContext
+		errType string
+		want    string
+	}{
+		{jsonContext(), "additional_property_not_allowed", "/additionalProperties"},
+		{jsonContext(), "required", "/required"},
+		{jsonContext("items", "0", "name"), "invalid_type", "/properties/items/items/properties/name/type"},
+		{jsonContext("meta", "key"), "invalid_type", "/properties/meta/additionalProperties/type"},
+		{jsonContext("unknown", "field"), "invalid_type", "/type"},
+		{jsonContext(), "false", ""},
+	}
+	for _, tc := range cases {
+		if got := KeywordPointer(schema, tc.ctx, tc.errType); got != tc.want {
+			t.Errorf("KeywordPointer(%s, %s) = %q, want %q", tc.ctx.String(), tc.errType, got, tc.want)
+		}
+	}
+}
+
+func TestValueAtPath(t *testing.T) {
+	payload := map[string]any{
+		"user":  map[string]any{"id": "u1"},
+		"items": []any{map[string]any{"sku": "a"}},
+	}
+	cases := []struct {
+		path   string
+		want   any
+		wantOk bool
+	}{
+		{"user.id", "u1", true},
+		{"items.0.sku", "a", true},
+		{"items.1.sku", nil, false},
+		{"items.x", nil, false},
+		{"user.id.more", nil, false},
+		{"missing", nil, false},
+	}
+	for _, tc := range cases {
+		got, ok := ValueAtPath(payload, tc.path)
+		if ok != tc.wantOk || got != tc.want {
+			t.Errorf("ValueAtPath(%q) = %v, %v, want %v, %v", tc.path, got, ok, tc.want, tc.wantOk)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"movinglake.com/haven/telemetry"
+	"movinglake.com/haven/wrappers"
+)
+
+// defaultMetricsWindow is how far back the metrics endpoint looks for each granularity
+// when no start time is given.
+var defaultMetricsWindow = map[string]time.Duration{
+	wrappers.GranularityMinute: time.Hour,
+	wrappers.GranularityHour:   24 * time.Hour,
+}
+
+type ValidationBucketResp struct {
+	Bucket   time.Time `json:"bucket"`
+	Version  uint      `json:"version"`
+	Received uint      `json:"received"`
+	Total    uint      `json:"total"`
+	Failed   uint      `json:"failed"`
+	// ErrorRate is the fraction of validated payloads that failed.
+	ErrorRate float64 `json:"error_rate"`
+	// EstimatedFailed extrapolates the error rate to all the received payloads.
+	EstimatedFailed float64 `json:"estimated_failed"`
+}
+
+type ValidationErrorBucketResp struct {
+	Bucket  time.Time `json:"bucket"`
+	Version uint      `json:"version"`
+	Type    string    `json:"type"`
+	Path    string    `json:"path"`
+	Count   uint      `json:"count"`
+}
+
+type GetMetricsResponse struct {
+	APIResponse
+	Resource    string                      `json:"resource"`
+	Granularity string                      `json:"granularity"`
+	Since       time.Time                   `json:"since"`
+	Buckets     []ValidationBucketResp      `json:"buckets"`
+	Errors      []ValidationErrorBucketResp `json:"errors"`
+}
+
+// ValidationSummary aggregates the validations of a resource over a period of time.
+type ValidationSummary struct {
+	Name      string
+	Total     uint
+	Failed    uint
+	ErrorRate float64
+}
+
+// ErrorPercent formats the error rate as a percentage.
+func (s ValidationSummary) ErrorPercent() string {
+	return fmt.Sprintf("%.2f%%", s.ErrorRate*100)
+}
+
+func errorRate(total, failed uint) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(failed) / float64(total)
+}
+
+// addValidation adds the result of a validation to inc.
+func addValidation(inc *wrappers.ValidationIncrement, errs []ErrorResponse) {
+	inc.Received++
+	inc.Total++
+	if len(errs) > 0 {
+		inc.Failed++
+	}
+	for _, e := range errs {
+		inc.Errors = append(inc.Errors, wrappers.ValidationErrorKey{
+			Type: e.Type,
+			Path: fmt.Sprint(e.Context["path"]),
+		})
+	}
+}
+
+// recordValidation adds a validation result to the validation metrics of the resource.
+func (h *HavenAPIHandler) recordValidation(res *wrappers.Resource, errs []ErrorResponse) {
+	inc := wrappers.ValidationIncrement{
+		ResourceID: res.ID,
+		Version:    res.Version,
+		At:         time.Now(),
+	}
+	addValidation(&inc, errs)
+	h.recordValidations(res, inc)
+}
+
+// recordValidations adds validation results to the validation metrics of the resource and
+// streams the failures. Failing to record metrics does not fail the validation.
+func (h *HavenAPIHandler) recordValidations(res *wrappers.Resource, inc wrappers.ValidationIncrement) {
+	telemetry.Validations.WithLabelValues(h.namespace, res.Name, "valid").Add(float64(inc.Total - inc.Failed))
+	telemetry.Validations.WithLabelValues(h.namespace, res.Name, "invalid").Add(float64(inc.Failed))
+	h.publishValidations(res, inc)
+	if err := h.db.IncrementValidationCounts(inc, nil); err != nil {
+		log.Printf("failed to record validation metrics for resource %s: %v", res.Name, err)
+	}
+}
+
+// summarizeValidations adds up the hourly validation counters of a resource since the given time.
+func summarizeValidations(db wrappers.DB, res wrappers.Resource, since time.Time) (ValidationSummary, error) {
+	summary := ValidationSummary{Name: res.Name}
+	counts, err := db.GetValidationCounts(res.ID, wrappers.GranularityHour, since)
+	if err != nil {
+		return summary, err
+	}
+	for _, c := range counts {
+		summary.Total += c.Total
+		summary.Failed += c.Failed
+	}
+	summary.ErrorRate = errorRate(summary.Total, summary.Failed)
+	return summary, nil
+}
+
+// getMetrics returns the validation counters of a resource bucketed by time.
+func (h *HavenAPIHandler) getMetrics(c *gin.Context) {
+	var response GetMetricsResponse
+	response.Resource = c.Params.ByName("name")
+	response.Granularity = c.DefaultQuery("granularity", wrappers.GranularityHour)
+	window, ok := defaultMetricsWindow[response.Granularity]
+	if !ok {
+		response.Error = fmt.Sprintf("unknown granularity: %s", response.Granularity)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+	response.Since = time.Now().UTC().Add(-window).Truncate(wrappers.Granularities[response.Granularity])
+	if v := c.Query("since"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			response.Error = fmt.Sprintf("failed to parse since: %v", err)
+			c.JSON(http.StatusBadRequest, response)
+			return
+		}
+		response.Since = since
+	}
+	res, err := h.db.GetResource(response.Resource, nil)
+	if err != nil {
+		response.Error = fmt.Sprintf("failed to get resource from db: %v", err)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+	if res == nil {
+		response.Error = fmt.Sprintf("resource not found: %s", response.Resource)
+		c.JSON(http.StatusNotFound, response)
+		return
+	}
+	counts, err := h.db.GetValidationCounts(res.ID, response.Granularity, response.Since)
+	if err != nil {
+		response.Error = fmt.Sprintf("failed to get validation counts from db: %v", err)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+	errCounts, err := h.db.GetValidationErrorCounts(res.ID, response.Granularity, response.Since)
+	if err != nil {
+		response.Error = fmt.Sprintf("failed to get validation error counts from db: %v", err)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+	response.Buckets = []ValidationBucketResp{}
+	for _, vc := range counts {
+		rate := errorRate(vc.Total, vc.Failed)
+		response.Buckets = append(response.Buckets, ValidationBucketResp{
+			Bucket:          vc.Bucket,
+			Version:         vc.Version,
+			Received:        vc.Received,
+			Total:           vc.Total,
+			Failed:          vc.Failed,
+			ErrorRate:       rate,
+			EstimatedFailed: rate * float64(vc.Received),
+		})
+	}
+	response.Errors = []ValidationErrorBucketResp{}
+	for _, ec := range errCounts {
+		response.Errors = append(response.Errors, ValidationErrorBucketResp{
+			Bucket:  ec.Bucket,
+			Version: ec.Version,
+			Type:    ec.ErrorType,
+			Path:    ec.Path,
+			Count:   ec.Count,
+		})
+	}
+	c.JSON(http.StatusOK, response)
+}
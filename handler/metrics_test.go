@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"movinglake.com/haven/handler/notifications"
+	"movinglake.com/haven/wrappers"
+)
+
+func TestGetMetrics(t *testing.T) {
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	handler := NewHavenAPIHandler(db, nil)
+	router := gin.Default()
+	gin.SetMode(gin.TestMode)
+	handler.RegisterRoutes(router)
+
+	db.Save(&wrappers.Resource{
+		Model:   gorm.Model{ID: 1},
+		Name:    "users",
+		Schema:  usersSchema,
+		Version: 1,
+	}, nil)
+
+	for _, p := range []map[string]any{
+		{"name": "Juan", "age": 35},
+		{"name": "Ana", "age": 30},
+		{"name": "Juan"},
+		{"age": 1},
+	} {
+		postJSON(router, "/api/v1/validate_payload", ValidatePayloadRequest{Resource: "users", Payload: p})
+	}
+
+	cases := []struct {
+		name        string
+		path        string
+		dbErrors    map[string]error
+		wantCode    int
+		wantTotal   uint
+		wantFailed  uint
+		wantErrors  int
+		granularity string
+	}{
+		{
+			name:        "hourly",
+			path:        "/api/v1/metrics/users",
+			wantCode:    http.StatusOK,
+			wantTotal:   4,
+			wantFailed:  2,
+			wantErrors:  1,
+			granularity: "hour",
+		},
+		{
+			name:        "per minute",
+			path:        "/api/v1/metrics/users?granularity=minute",
+			wantCode:    http.StatusOK,
+			wantTotal:   4,
+			wantFailed:  2,
+			wantErrors:  1,
+			granularity: "minute",
+		},
+		{
+			name:     "unknown granularity",
+			path:     "/api/v1/metrics/users?granularity=fortnight",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "bad since",
+			path:     "/api/v1/metrics/users?since=yesterday",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:        "since in the future",
+			path:        "/api/v1/metrics/users?since=2999-01-01T00:00:00Z",
+			wantCode:    http.StatusOK,
+			granularity: "hour",
+		},
+		{
+			name:     "unknown resource",
+			path:     "/api/v1/metrics/pets",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "DB fails on counts",
+			path:     "/api/v1/metrics/users",
+			dbErrors: map[string]error{"GetValidationCounts": gorm.ErrInvalidDB},
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "DB fails on error counts",
+			path:     "/api/v1/metrics/users",
+			dbErrors: map[string]error{"GetValidationErrorCounts": gorm.ErrInvalidDB},
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db.Errors = tc.dbErrors
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			assert.Equal(t, tc.wantCode, response.Code)
+			if tc.wantCode != http.StatusOK {
+				return
+			}
+			var resp GetMetricsResponse
+			json.Unmarshal(response.Body.Bytes(), &resp)
+			assert.Equal(t, tc.granularity, resp.Granularity)
+			var total, failed uint
+			for _, b := range resp.Buckets {
+				total += b.Total
+				failed += b.Failed
+			}
+			assert.Equal(t, tc.wantTotal, total)
+			assert.Equal(t, tc.wantFailed, failed)
+			// Both failures are a missing required property at the root.
+			assert.Equal(t, tc.wantErrors, len(resp.Errors))
+			for _, e := range resp.Errors {
+				assert.Equal(t, "required", e.Type)
+				assert.Equal(t, uint(2), e.Count)
+			}
+		})
+	}
+}
+
+func TestRecordValidationDBError(t *testing.T) {
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	handler := NewHavenAPIHandler(db, nil)
+	router := gin.Default()
+	gin.SetMode(gin.TestMode)
+	handler.RegisterRoutes(router)
+	db.Save(&wrappers.Resource{
+		Model:   gorm.Model{ID: 1},
+		Name:    "users",
+		Schema:  usersSchema,
+		Version: 1,
+	}, nil)
+
+	// Metrics failures must not fail validations.
+	db.Errors = map[string]error{"IncrementValidationCounts": gorm.ErrInvalidDB}
+	response := postJSON(router, "/api/v1/validate_payload", ValidatePayloadRequest{
+		Resource: "users",
+		Payload:  map[string]any{"name": "Juan", "age": 35},
+	})
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, 0, len(db.ValidationCounts))
+}
+
+func TestPrometheusMetrics(t *testing.T) {
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	handler := NewHavenAPIHandler(db, nil)
+	handler.notifier.Register(notifications.SenderSlack, &fakeSlackSender{err: gorm.ErrInvalidData})
+	router := gin.Default()
+	gin.SetMode(gin.TestMode)
+	handler.RegisterRoutes(router)
+
+	postJSON(router, "/api/v1/add_payload", AddPayloadRequest{
+		Resource: "prom",
+		Payload:  map[string]any{"name": "Juan", "age": 35},
+	})
+	postJSON(router, "/api/v1/validate_payload", ValidatePayloadRequest{
+		Resource: "prom",
+		Payload:  map[string]any{"name": "Juan"},
+	})
+	postJSON(router, "/api/v1/set_schema", SetSchemaRequest{
+		Resource: "prom",
+		Schema:   map[string]any{"type": "object"},
+	})
+	postJSON(router, "/api/v1/namespaces/team/add_payload", AddPayloadRequest{
+		Resource: "prom",
+		Payload:  map[string]any{"name": "Ann"},
+	})
+	handler.DeliverNotifications(DefaultOutboxConfig, time.Now())
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, response.Code)
+	body := response.Body.String()
+	for _, want := range []string{
+		`haven_validations_total{namespace="default",resource="prom",result="invalid"} 1`,
+		`haven_schema_versions_total{namespace="default",resource="prom",source="payload"} 1`,
+		`haven_schema_versions_total{namespace="default",resource="prom",source="set_schema"} 1`,
+		`haven_schema_versions_total{namespace="team",resource="prom",source="payload"} 1`,
+		`haven_notification_errors_total{sender="slack"}`,
+		`haven_http_requests_total{code="200",method="POST",route="/api/v1/add_payload"}`,
+	} {
+		assert.Contains(t, body, want)
+	}
+}
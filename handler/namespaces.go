@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"movinglake.com/haven/wrappers"
+)
+
+// namespaceContext is the gin context key of the namespace of a request.
+const namespaceContext = "namespace"
+
+var namespaceName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+type GetNamespacesResponse struct {
+	APIResponse
+	Namespaces []string `json:"namespaces"`
+}
+
+// ValidNamespace tells whether the namespace name is lowercase letters, digits, dashes and
+// underscores.
+func ValidNamespace(namespace string) bool {
+	return namespaceName.MatchString(namespace)
+}
+
+// withNamespace puts the namespace of the route, or the default one, in the context.
+func withNamespace(c *gin.Context) {
+	namespace := c.Param("namespace")
+	if namespace == "" {
+		namespace = wrappers.DefaultNamespace
+	}
+	if !ValidNamespace(namespace) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, APIResponse{Error: fmt.Sprintf("invalid namespace %q", namespace)})
+		return
+	}
+	c.Set(namespaceContext, namespace)
+}
+
+// pagePath is the path the pages of the namespace are under, and apiPath the one of its API
+// routes.
+func pagePath(namespace string) string {
+	if namespace == wrappers.DefaultNamespace {
+		return ""
+	}
+	return "/namespaces/" + namespace
+}
+
+func apiPath(namespace string) string {
+	return "/api/v1" + pagePath(namespace)
+}
+
+// InNamespace returns the handler working on the resources and settings of the namespace.
+func (h *HavenAPIHandler) InNamespace(namespace string) *HavenAPIHandler {
+	scoped := *h
+	scoped.namespace = namespace
+	if h.global != nil {
+		scoped.db = h.global.WithNamespace(namespace)
+	}
+	return &scoped
+}
+
+// scoped serves the route with the handler of the namespace of the request.
+func (h *HavenAPIHandler) scoped(f func(*HavenAPIHandler, *gin.Context)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		f(h.InNamespace(c.GetString(namespaceContext)), c)
+	}
+}
+
+// resourceText formats the resource for notification texts, with its namespace outside the
+// default one.
+func (h *HavenAPIHandler) resourceText(resource string) string {
+	if h.namespace == wrappers.DefaultNamespace {
+		return fmt.Sprintf("`%s`", resource)
+	}
+	return fmt.Sprintf("`%s` in namespace `%s`", resource, h.namespace)
+}
+
+// keyNamespace returns the namespace the API key of the request is bound to, empty if it can
+// access every namespace or API keys are not required.
+func keyNamespace(c *gin.Context) string {
+	if key, ok := c.Get(apiKeyContext); ok {
+		return key.(*wrappers.APIKeys).Namespace
+	}
+	return ""
+}
+
+// getNamespaces lists the namespaces with resources that the API key of the request can
+// access.
+func (h *HavenAPIHandler) getNamespaces(c *gin.Context) {
+	var response GetNamespacesResponse
+	namespaces, err := h.global.GetNamespaces()
+	if err != nil {
+		response.Error = fmt.Sprintf("failed to get namespaces from db: %v", err)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+	response.Namespaces = []string{}
+	for _, ns := range namespaces {
+		if bound := keyNamespace(c); bound == "" || bound == ns {
+			response.Namespaces = append(response.Namespaces, ns)
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
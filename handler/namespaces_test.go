@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"movinglake.com/haven/wrappers"
+)
+
+func TestNamespaces(t *testing.T) {
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	handler := NewHavenAPIHandler(db, nil)
+	router := gin.Default()
+	gin.SetMode(gin.TestMode)
+	handler.RegisterRoutes(router)
+
+	// The same resource name is a different resource in every namespace.
+	response := postJSON(router, "/api/v1/add_payload", AddPayloadRequest{Resource: "users", Payload: map[string]any{"name": "Ann"}})
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	response = postJSON(router, "/api/v1/namespaces/team-a/add_payload", AddPayloadRequest{Resource: "users", Payload: map[string]any{"id": 1}})
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	response = postJSON(router, "/api/v1/namespaces/team-a/add_payload", AddPayloadRequest{Resource: "orders", Payload: map[string]any{"id": 1}})
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+
+	get := func(path string) *httptest.ResponseRecorder {
+		return keyRequest(router, http.MethodGet, path, "", "", nil)
+	}
+	var resource GetResourceResponse
+	response = get("/api/v1/namespaces/team-a/get_resource/users")
+	assert.Equal(t, http.StatusOK, response.Code)
+	json.Unmarshal(response.Body.Bytes(), &resource)
+	assert.Contains(t, resource.Resource.Schema["properties"], "id")
+	teamUsers := resource.Resource.ID
+	response = get("/api/v1/get_resource/users")
+	json.Unmarshal(response.Body.Bytes(), &resource)
+	assert.Contains(t, resource.Resource.Schema["properties"], "name")
+	assert.NotEqual(t, teamUsers, resource.Resource.ID)
+	assert.Equal(t, http.StatusNotFound, get("/api/v1/get_resource/orders").Code)
+	assert.Equal(t, http.StatusNotFound, get("/api/v1/namespaces/team-b/get_resource/users").Code)
+
+	var resources GetAllResourcesResponse
+	json.Unmarshal(get("/api/v1/namespaces/team-a/get_all_resources").Body.Bytes(), &resources)
+	assert.Equal(t, 2, len(resources.Resources))
+	json.Unmarshal(get("/api/v1/get_all_resources").Body.Bytes(), &resources)
+	assert.Equal(t, 1, len(resources.Resources))
+
+	// Versions are only found in the namespace of their resource.
+	var versions GetResourceVersionsResponse
+	json.Unmarshal(get(fmt.Sprintf("/api/v1/namespaces/team-a/get_resource_versions/%d", teamUsers)).Body.Bytes(), &versions)
+	assert.Equal(t, 1, len(versions.Versions))
+	json.Unmarshal(get(fmt.Sprintf("/api/v1/get_resource_versions/%d", teamUsers)).Body.Bytes(), &versions)
+	assert.Equal(t, 0, len(versions.Versions))
+
+	// Webhooks are only posted the events of their namespace.
+	response = postJSON(router, "/api/v1/namespaces/team-a/set_webhook", SetWebhookRequest{URL: "http://example.com/hook"})
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	var webhooks GetWebhooksResponse
+	json.Unmarshal(get("/api/v1/get_webhooks").Body.Bytes(), &webhooks)
+	assert.Equal(t, 0, len(webhooks.Webhooks))
+	json.Unmarshal(get("/api/v1/namespaces/team-a/get_webhooks").Body.Bytes(), &webhooks)
+	assert.Equal(t, 1, len(webhooks.Webhooks))
+	postJSON(router, "/api/v1/add_payload", AddPayloadRequest{Resource: "users", Payload: map[string]any{"name": "Ann", "age": 30}})
+	assert.Equal(t, 0, len(db.WebhookDeliveries))
+	postJSON(router, "/api/v1/namespaces/team-a/add_payload", AddPayloadRequest{Resource: "users", Payload: map[string]any{"id": 1, "age": 30}})
+	assert.Equal(t, 1, len(db.WebhookDeliveries))
+
+	var namespaces GetNamespacesResponse
+	json.Unmarshal(get("/api/v1/get_namespaces").Body.Bytes(), &namespaces)
+	assert.Equal(t, []string{wrappers.DefaultNamespace, "team-a"}, namespaces.Namespaces)
+
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/namespaces/Team%20A/get_all_resources").Code)
+}
+
+func TestNamespaceAPIKeys(t *testing.T) {
+	db := wrappers.NewTestDB()
+	handler := NewHavenAPIHandler(db, nil)
+	router := gin.Default()
+	handler.RegisterRoutes(router)
+	postJSON(router, "/api/v1/add_payload", AddPayloadRequest{Resource: "users", Payload: map[string]any{"name": "Ann"}})
+	postJSON(router, "/api/v1/namespaces/team-a/add_payload", AddPayloadRequest{Resource: "users", Payload: map[string]any{"id": 1}})
+
+	_, _, err := handler.CreateAPIKey(CreateAPIKeyRequest{Name: "bad", Scopes: []string{ScopeRead}, Namespace: "Team A"})
+	assert.Error(t, err)
+	team, _, err := handler.CreateAPIKey(CreateAPIKeyRequest{Name: "team-a", Scopes: []string{ScopeAdmin}, Namespace: "team-a"})
+	assert.NoError(t, err)
+	handler.RequireAPIKeys()
+
+	response := keyRequest(router, http.MethodGet, "/api/v1/namespaces/team-a/get_resource/users", APIKeyHeader, team, nil)
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	response = keyRequest(router, http.MethodGet, "/api/v1/get_resource/users", APIKeyHeader, team, nil)
+	assert.Equal(t, http.StatusForbidden, response.Code)
+	assert.Contains(t, response.Body.String(), "bound to namespace team-a")
+
+	var namespaces GetNamespacesResponse
+	response = keyRequest(router, http.MethodGet, "/api/v1/get_namespaces", APIKeyHeader, team, nil)
+	json.Unmarshal(response.Body.Bytes(), &namespaces)
+	assert.Equal(t, []string{"team-a"}, namespaces.Namespaces)
+
+	// Keys bound to a namespace only create keys bound to it.
+	response = keyRequest(router, http.MethodPost, "/api/v1/create_api_key", APIKeyHeader, team, CreateAPIKeyRequest{Name: "other", Scopes: []string{ScopeRead}, Namespace: "team-b"})
+	assert.Equal(t, http.StatusForbidden, response.Code)
+	response = keyRequest(router, http.MethodPost, "/api/v1/create_api_key", APIKeyHeader, team, CreateAPIKeyRequest{Name: "reader", Scopes: []string{ScopeRead}})
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	var created CreateAPIKeyResponse
+	json.Unmarshal(response.Body.Bytes(), &created)
+	assert.Equal(t, "team-a", created.APIKey.Namespace)
+
+	// Routes registered outside the handler, like the git sync ones, are in the default namespace.
+	router.POST("/api/v1/sync/import", handler.RequireScope(ScopeAdmin), func(c *gin.Context) {
+		c.JSON(http.StatusOK, APIResponse{})
+	})
+	response = keyRequest(router, http.MethodPost, "/api/v1/sync/import", APIKeyHeader, team, nil)
+	assert.Equal(t, http.StatusForbidden, response.Code)
+	assert.Contains(t, response.Body.String(), "bound to namespace team-a")
+	admin, _, err := handler.CreateAPIKey(CreateAPIKeyRequest{Name: "ops", Scopes: []string{ScopeAdmin}})
+	assert.NoError(t, err)
+	response = keyRequest(router, http.MethodPost, "/api/v1/sync/import", APIKeyHeader, admin, nil)
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+}
+
+func TestNamespacePages(t *testing.T) {
+	db := wrappers.NewTestDB()
+	api := NewHavenAPIHandler(db, nil)
+	apiRouter := gin.Default()
+	api.RegisterRoutes(apiRouter)
+	postJSON(apiRouter, "/api/v1/namespaces/team-a/add_payload", AddPayloadRequest{Resource: "orders", Payload: map[string]any{"id": 1}})
+	handler := NewHavenHTMLHandler(db)
+	router := gin.Default()
+	handler.RegisterRoutes(router, "../templates/*", "../web_resources")
+
+	response := keyRequest(router, http.MethodGet, "/namespaces/team-a/", "", "", nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Contains(t, response.Body.String(), `href="/namespaces/team-a/resource/orders"`)
+	response = keyRequest(router, http.MethodGet, "/", "", "", nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.NotContains(t, response.Body.String(), "resource/orders")
+	assert.Contains(t, response.Body.String(), `href="/namespaces/team-a/"`)
+	response = keyRequest(router, http.MethodGet, "/namespaces/team-a/resource/orders", "", "", nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Contains(t, response.Body.String(), `\/api\/v1\/namespaces\/team-a/get_resource/`)
+}
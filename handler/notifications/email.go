@@ -0,0 +1,72 @@
+package notifications
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// DefaultEmailSubject is the subject of the emails sent by EmailSender.
+const DefaultEmailSubject = "Haven notification"
+
+// EmailSender sends messages by email through an SMTP server.
+type EmailSender struct {
+	// Addr is the host:port of the SMTP server.
+	Addr string
+	// Username and Password authenticate with PLAIN auth if set, which net/smtp only allows
+	// over TLS or to localhost.
+	Username string
+	Password string
+	From     string
+	To       []string
+	Subject  string
+}
+
+func NewEmailSender(addr, username, password, from string, to []string) *EmailSender {
+	return &EmailSender{Addr: addr, Username: username, Password: password, From: from, To: to, Subject: DefaultEmailSubject}
+}
+
+func (s *EmailSender) IsActive() bool {
+	return s.Addr != "" && s.From != "" && len(s.To) > 0
+}
+
+func (s *EmailSender) SendMessage(message string) error {
+	return s.send(s.To, message)
+}
+
+// SendMessageTo sends a message to comma separated recipients instead of the configured ones.
+func (s *EmailSender) SendMessageTo(recipients, message string) error {
+	var to []string
+	for _, r := range strings.Split(recipients, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			to = append(to, r)
+		}
+	}
+	if len(to) == 0 {
+		return fmt.Errorf("no recipients in %q", recipients)
+	}
+	return s.send(to, message)
+}
+
+func (s *EmailSender) send(to []string, message string) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return fmt.Errorf("invalid SMTP address %q: %v", s.Addr, err)
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", s.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", s.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(message, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return smtp.SendMail(s.Addr, auth, s.From, to, b.Bytes())
+}
@@ -0,0 +1,126 @@
+package notifications
+
+import (
+	"bufio"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// smtpMessage is an email received by the SMTP stand-in.
+type smtpMessage struct {
+	from string
+	to   []string
+	auth string
+	data string
+}
+
+// newSMTPServer starts a minimal SMTP stand-in on localhost and returns its address and the
+// channel of the received messages.
+func newSMTPServer(t *testing.T) (string, <-chan smtpMessage) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	messages := make(chan smtpMessage, 1)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, messages)
+		}
+	}()
+	return l.Addr().String(), messages
+}
+
+func serveSMTP(conn net.Conn, messages chan<- smtpMessage) {
+	defer conn.Close()
+	c := textproto.NewConn(conn)
+	c.PrintfLine("220 localhost ESMTP")
+	var msg smtpMessage
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(cmd) {
+		case "EHLO", "HELO":
+			c.PrintfLine("250-localhost\r\n250 AUTH PLAIN")
+		case "AUTH":
+			msg.auth = arg
+			c.PrintfLine("235 authenticated")
+		case "MAIL":
+			msg.from = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			c.PrintfLine("250 ok")
+		case "RCPT":
+			msg.to = append(msg.to, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			c.PrintfLine("250 ok")
+		case "DATA":
+			c.PrintfLine("354 go ahead")
+			data, err := bufio.NewReader(c.DotReader()).ReadString(0)
+			if err != nil && data == "" {
+				return
+			}
+			msg.data = data
+			c.PrintfLine("250 queued")
+			messages <- msg
+		case "QUIT":
+			c.PrintfLine("221 bye")
+			return
+		default:
+			c.PrintfLine("250 ok")
+		}
+	}
+}
+
+func TestEmailSender(t *testing.T) {
+	if NewEmailSender("localhost:25", "", "", "", nil).IsActive() {
+		t.Errorf("expected sender without recipients to be inactive")
+	}
+	addr, messages := newSMTPServer(t)
+	s := NewEmailSender(addr, "haven", "password", "haven@example.com", []string{"a@example.com", "b@example.com"})
+	if !s.IsActive() {
+		t.Fatalf("expected sender to be active")
+	}
+	if err := s.SendMessage("New version\nof users"); err != nil {
+		t.Fatal(err)
+	}
+	msg := <-messages
+	if msg.from != "haven@example.com" || strings.Join(msg.to, ",") != "a@example.com,b@example.com" {
+		t.Errorf("unexpected envelope %v", msg)
+	}
+	if !strings.HasPrefix(msg.auth, "PLAIN ") {
+		t.Errorf("expected PLAIN auth, got %q", msg.auth)
+	}
+	for _, want := range []string{
+		"From: haven@example.com\n",
+		"To: a@example.com, b@example.com\n",
+		"Subject: " + DefaultEmailSubject + "\n",
+		"\nNew version\nof users\n",
+	} {
+		if !strings.Contains(msg.data, want) {
+			t.Errorf("expected message to contain %q, got %q", want, msg.data)
+		}
+	}
+
+	if err := s.SendMessageTo(" c@example.com, d@example.com", "routed"); err != nil {
+		t.Fatal(err)
+	}
+	msg = <-messages
+	if strings.Join(msg.to, ",") != "c@example.com,d@example.com" || !strings.Contains(msg.data, "To: c@example.com, d@example.com\n") {
+		t.Errorf("expected the message to go to the routed recipients, got %v", msg)
+	}
+	if err := s.SendMessageTo(" , ", "x"); err == nil {
+		t.Errorf("expected an error without recipients")
+	}
+
+	s.Addr = "nohost"
+	if err := s.SendMessage("x"); err == nil {
+		t.Errorf("expected an invalid address error")
+	}
+}
@@ -0,0 +1,44 @@
+package notifications
+
+// Event types of notifications.
+const (
+	EventVersionAdded  = "version_added"
+	EventAlertFiring   = "alert_firing"
+	EventAlertResolved = "alert_resolved"
+	// EventDigest summarizes the new versions of a resource batched by a digest route.
+	EventDigest = "digest"
+)
+
+// Severities of notifications.
+const (
+	SeverityBreaking   = "breaking"
+	SeverityCompatible = "compatible"
+)
+
+// Notification is a message about a resource with details that senders may format, e.g. as
+// Slack blocks. Senders that only send text send Text.
+type Notification struct {
+	Namespace string
+	Resource  string
+	Event     string
+	Severity  string
+	// Version is the schema version of version notifications.
+	Version uint
+	// Text is the message as plain text.
+	Text string
+	// Changes summarizes what changed, one change per line.
+	Changes []string
+	// MoreChanges counts the changes left out of Changes.
+	MoreChanges int
+	// Payload is a snippet of the payload that triggered the notification.
+	Payload string
+	// URL links to the page of the resource.
+	URL string
+}
+
+// NotificationSender is a Sender that formats the details of notifications. An empty channel
+// sends to the configured destination.
+type NotificationSender interface {
+	Sender
+	SendNotification(channel string, n Notification) error
+}
@@ -0,0 +1,141 @@
+package notifications
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Names of the senders configured by Haven.
+const (
+	SenderSlack     = "slack"
+	SenderWebhook   = "webhook"
+	SenderEmail     = "email"
+	SenderTeams     = "teams"
+	SenderPagerDuty = "pagerduty"
+)
+
+// SendErrors are the errors of the senders that failed to send a message, by sender name.
+type SendErrors map[string]error
+
+func (e SendErrors) Error() string {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = fmt.Sprintf("%s: %v", name, e[name])
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ChannelSender is a Sender that can send messages to another destination than the configured
+// one, e.g. another Slack channel.
+type ChannelSender interface {
+	Sender
+	SendMessageTo(channel, message string) error
+}
+
+type namedSender struct {
+	name   string
+	sender Sender
+}
+
+// Registry sends messages to several senders at once. It is a Sender itself.
+type Registry struct {
+	senders []namedSender
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds a sender under a name. Nil senders are ignored.
+func (r *Registry) Register(name string, s Sender) {
+	if s == nil {
+		return
+	}
+	r.senders = append(r.senders, namedSender{name: name, sender: s})
+}
+
+// Names returns the names of the active senders, in registration order.
+func (r *Registry) Names() []string {
+	var names []string
+	for _, s := range r.senders {
+		if s.sender.IsActive() {
+			names = append(names, s.name)
+		}
+	}
+	return names
+}
+
+// sender returns the active sender registered under the name, nil if there is none.
+func (r *Registry) sender(name string) Sender {
+	for _, s := range r.senders {
+		if s.name == name && s.sender.IsActive() {
+			return s.sender
+		}
+	}
+	return nil
+}
+
+// SupportsChannels reports whether the active sender registered under the name can send to
+// other channels.
+func (r *Registry) SupportsChannels(name string) bool {
+	_, ok := r.sender(name).(ChannelSender)
+	return ok
+}
+
+// IsActive reports whether any sender is active.
+func (r *Registry) IsActive() bool {
+	return len(r.Names()) > 0
+}
+
+// SendMessage sends the message to every active sender. Failures don't stop the other senders
+// and are returned as SendErrors.
+func (r *Registry) SendMessage(message string) error {
+	return r.Send(Notification{Text: message})
+}
+
+// Send sends the notification to every active sender, see SendMessage.
+func (r *Registry) Send(n Notification) error {
+	errs := SendErrors{}
+	for _, s := range r.senders {
+		if !s.sender.IsActive() {
+			continue
+		}
+		if err := deliver(s.sender, "", n); err != nil {
+			errs[s.name] = err
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// SendTo sends the notification through the active sender registered under the name, to
+// channel if it is set.
+func (r *Registry) SendTo(name, channel string, n Notification) error {
+	s := r.sender(name)
+	if s == nil {
+		return fmt.Errorf("sender %s is not configured", name)
+	}
+	if _, ok := s.(ChannelSender); channel != "" && !ok {
+		return fmt.Errorf("sender %s does not support channels", name)
+	}
+	return deliver(s, channel, n)
+}
+
+// deliver sends the notification with the most detailed method the sender supports.
+func deliver(s Sender, channel string, n Notification) error {
+	if ns, ok := s.(NotificationSender); ok {
+		return ns.SendNotification(channel, n)
+	}
+	if channel != "" {
+		return s.(ChannelSender).SendMessageTo(channel, n.Text)
+	}
+	return s.SendMessage(n.Text)
+}
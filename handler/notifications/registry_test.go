@@ -0,0 +1,95 @@
+package notifications
+
+import (
+	"errors"
+	"testing"
+)
+
+type fakeSender struct {
+	active   bool
+	err      error
+	messages []string
+}
+
+func (f *fakeSender) SendMessage(message string) error {
+	f.messages = append(f.messages, message)
+	return f.err
+}
+
+func (f *fakeSender) IsActive() bool {
+	return f.active
+}
+
+type fakeChannelSender struct {
+	fakeSender
+	channels []string
+}
+
+func (f *fakeChannelSender) SendMessageTo(channel, message string) error {
+	f.channels = append(f.channels, channel)
+	return f.SendMessage(message)
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	if r.IsActive() {
+		t.Errorf("expected empty registry to be inactive")
+	}
+	if err := r.SendMessage("nobody listens"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+
+	ok := &fakeSender{active: true}
+	failing := &fakeSender{active: true, err: errors.New("boom")}
+	inactive := &fakeSender{}
+	r.Register("ok", ok)
+	r.Register("failing", failing)
+	r.Register("inactive", inactive)
+	r.Register("nil", nil)
+	if !r.IsActive() {
+		t.Errorf("expected registry to be active")
+	}
+	if got := r.Names(); len(got) != 2 || got[0] != "ok" || got[1] != "failing" {
+		t.Errorf("Names() = %v, want [ok failing]", got)
+	}
+
+	err := r.SendMessage("hello")
+	var errs SendErrors
+	if !errors.As(err, &errs) || len(errs) != 1 || errs["failing"] == nil {
+		t.Fatalf("expected the failing sender error, got %v", err)
+	}
+	if err.Error() != "failing: boom" {
+		t.Errorf("Error() = %q", err.Error())
+	}
+	if len(ok.messages) != 1 || len(failing.messages) != 1 || len(inactive.messages) != 0 {
+		t.Errorf("expected the active senders to get the message, got %v %v %v", ok.messages, failing.messages, inactive.messages)
+	}
+}
+
+func TestRegistrySendTo(t *testing.T) {
+	r := NewRegistry()
+	plain := &fakeSender{active: true}
+	channels := &fakeChannelSender{fakeSender: fakeSender{active: true}}
+	r.Register("plain", plain)
+	r.Register("channels", channels)
+	r.Register("inactive", &fakeChannelSender{})
+
+	if r.SupportsChannels("plain") || !r.SupportsChannels("channels") || r.SupportsChannels("inactive") {
+		t.Errorf("unexpected channel support")
+	}
+	if err := r.SendTo("plain", "", Notification{Text: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SendTo("channels", "C1", Notification{Text: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(plain.messages) != 1 || len(channels.channels) != 1 || channels.channels[0] != "C1" {
+		t.Errorf("unexpected deliveries %v %v", plain.messages, channels.channels)
+	}
+	if err := r.SendTo("plain", "C1", Notification{Text: "hello"}); err == nil {
+		t.Errorf("expected an error for a sender without channels")
+	}
+	if err := r.SendTo("inactive", "", Notification{Text: "hello"}); err == nil {
+		t.Errorf("expected an error for an inactive sender")
+	}
+}
@@ -1,9 +1,18 @@
 package notifications
 
 import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/slack-go/slack"
 )
 
+// DefaultThreadWindow is how long the Slack notifications about a resource keep going to the
+// thread of the first one.
+const DefaultThreadWindow = 10 * time.Minute
+
 type Sender interface {
 	SendMessage(message string) error
 	IsActive() bool
@@ -11,19 +20,42 @@ type Sender interface {
 
 type SlackSender struct {
 	ChannelID string
-	cli       SlackCli
+	// ThreadWindow is how long after a notification about a resource the next ones are posted
+	// as replies in its thread, so versions landing quickly don't flood the channel. Zero
+	// disables threads.
+	ThreadWindow time.Duration
+	cli          SlackCli
+
+	mu      sync.Mutex
+	threads map[slackThreadKey]slackThread
+	now     func() time.Time
 }
 
 type SlackCli interface {
 	PostMessage(channelID string, options ...slack.MsgOption) (string, string, error)
 }
 
+type slackThreadKey struct {
+	channel  string
+	resource string
+}
+
+// slackThread is the thread of the notifications about a resource in a channel.
+type slackThread struct {
+	ts string
+	// last is when the last notification was posted to the thread.
+	last time.Time
+}
+
 func NewSlackSender(token, channelID string) *SlackSender {
 	// Create a new Slack client
 	api := slack.New(token)
 	return &SlackSender{
-		ChannelID: channelID,
-		cli:       api,
+		ChannelID:    channelID,
+		ThreadWindow: DefaultThreadWindow,
+		cli:          api,
+		threads:      make(map[slackThreadKey]slackThread),
+		now:          time.Now,
 	}
 }
 
@@ -34,16 +66,100 @@ func (s *SlackSender) IsActive() bool {
 // SendMessageToSlack sends a message to a Slack channel.
 // Ignore this function for coverage since it mostly uses external dependencies.
 func (s *SlackSender) SendMessage(message string) error {
+	return s.SendMessageTo(s.ChannelID, message)
+}
+
+// SendMessageTo sends a message to another Slack channel than the configured one.
+func (s *SlackSender) SendMessageTo(channelID, message string) error {
 	// Set the message options
 	options := []slack.MsgOption{
 		slack.MsgOptionText(message, false),
 	}
 
 	// Send the message
-	_, _, err := s.cli.PostMessage(s.ChannelID, options...)
+	_, _, err := s.cli.PostMessage(channelID, options...)
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// SendNotification posts the notification as Block Kit blocks, in the thread of the previous
+// notification about the resource if it was posted within ThreadWindow.
+func (s *SlackSender) SendNotification(channelID string, n Notification) error {
+	if channelID == "" {
+		channelID = s.ChannelID
+	}
+	options := []slack.MsgOption{
+		slack.MsgOptionText(n.Text, false),
+		slack.MsgOptionBlocks(slackBlocks(n)...),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if s.now != nil {
+		now = s.now()
+	}
+	if s.threads == nil {
+		s.threads = make(map[slackThreadKey]slackThread)
+	}
+	for k, t := range s.threads {
+		if now.Sub(t.last) > s.ThreadWindow {
+			delete(s.threads, k)
+		}
+	}
+	key := slackThreadKey{channel: channelID, resource: n.Resource}
+	thread, threaded := s.threads[key]
+	threaded = threaded && s.ThreadWindow > 0
+	if threaded {
+		options = append(options, slack.MsgOptionTS(thread.ts))
+	}
+	_, ts, err := s.cli.PostMessage(channelID, options...)
+	if err != nil {
+		return err
+	}
+	if !threaded {
+		thread.ts = ts
+	}
+	thread.last = now
+	if s.ThreadWindow > 0 && n.Resource != "" {
+		s.threads[key] = thread
+	}
+	return nil
+}
+
+// slackEscape escapes the characters Slack reserves for links and mentions.
+func slackEscape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+func mrkdwn(text string) *slack.TextBlockObject {
+	return slack.NewTextBlockObject(slack.MarkdownType, text, false, false)
+}
+
+// slackBlocks formats the notification as a section with the text, the summary of the changes,
+// the payload snippet and a link to the resource page.
+func slackBlocks(n Notification) []slack.Block {
+	text := slackEscape(n.Text)
+	if n.Severity == SeverityBreaking {
+		text = ":warning: *Breaking change.* " + text
+	}
+	blocks := []slack.Block{slack.NewSectionBlock(mrkdwn(text), nil, nil)}
+	if len(n.Changes) > 0 {
+		changes := "*Changes*\n```" + slackEscape(strings.Join(n.Changes, "\n")) + "```"
+		if n.MoreChanges > 0 {
+			changes += fmt.Sprintf("\n…and %d more.", n.MoreChanges)
+		}
+		blocks = append(blocks, slack.NewSectionBlock(mrkdwn(changes), nil, nil))
+	}
+	if n.Payload != "" {
+		blocks = append(blocks, slack.NewSectionBlock(mrkdwn("*Reference payload*\n```"+slackEscape(n.Payload)+"```"), nil, nil))
+	}
+	if n.URL != "" {
+		link := fmt.Sprintf("<%s|View %s in Haven>", n.URL, slackEscape(n.Resource))
+		blocks = append(blocks, slack.NewContextBlock("", mrkdwn(link)))
+	}
+	return blocks
+}
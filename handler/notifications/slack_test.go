@@ -1,18 +1,28 @@
 package notifications
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/slack-go/slack"
 )
 
 type fakeSlackCli struct {
-	err error
+	err      error
+	channels []string
+	posts    []url.Values
 }
 
 func (f *fakeSlackCli) PostMessage(channelID string, options ...slack.MsgOption) (string, string, error) {
-	return "", "", f.err
+	f.channels = append(f.channels, channelID)
+	_, values, _ := slack.UnsafeApplyMsgOptions("token", channelID, "", options...)
+	f.posts = append(f.posts, values)
+	return channelID, fmt.Sprintf("1700000000.%06d", len(f.posts)), f.err
 }
 
 func TestIsActive(t *testing.T) {
@@ -40,3 +50,92 @@ func TestPostMessage(t *testing.T) {
 		t.Errorf("expected error, got %v", err)
 	}
 }
+
+func TestSendMessageTo(t *testing.T) {
+	s := NewSlackSender("token", "channel")
+	cli := &fakeSlackCli{}
+	s.cli = cli
+	if err := s.SendMessage("default"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SendMessageTo("C123", "routed"); err != nil {
+		t.Fatal(err)
+	}
+	if len(cli.channels) != 2 || cli.channels[0] != "channel" || cli.channels[1] != "C123" {
+		t.Errorf("expected messages to channel and C123, got %v", cli.channels)
+	}
+}
+
+func TestSendNotification(t *testing.T) {
+	s := NewSlackSender("token", "channel")
+	cli := &fakeSlackCli{}
+	s.cli = cli
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	n := Notification{
+		Resource:    "orders",
+		Severity:    SeverityBreaking,
+		Text:        "New version `2` of schema for resource `orders` has been added",
+		Changes:     []string{`~ /properties/id/type: "integer" -> "string"`},
+		MoreChanges: 3,
+		Payload:     `{"id":"a<b"}`,
+		URL:         "https://haven.example.com/resource/orders",
+	}
+	if err := s.SendNotification("", n); err != nil {
+		t.Fatal(err)
+	}
+	post := cli.posts[0]
+	if post.Get("text") != n.Text || post.Get("thread_ts") != "" || cli.channels[0] != "channel" {
+		t.Errorf("unexpected first post %v", post)
+	}
+	var blocks []struct {
+		Text     struct{ Text string }
+		Elements []struct{ Text string }
+	}
+	if err := json.Unmarshal([]byte(post.Get("blocks")), &blocks); err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 4 {
+		t.Fatalf("expected text, changes, payload and link blocks, got %s", post.Get("blocks"))
+	}
+	want := []string{
+		":warning: *Breaking change.* " + n.Text,
+		"*Changes*\n```~ /properties/id/type: \"integer\" -&gt; \"string\"```\n…and 3 more.",
+		"*Reference payload*\n```{\"id\":\"a&lt;b\"}```",
+	}
+	for i, w := range want {
+		if blocks[i].Text.Text != w {
+			t.Errorf("block %d = %q, want %q", i, blocks[i].Text.Text, w)
+		}
+	}
+	if len(blocks[3].Elements) != 1 || blocks[3].Elements[0].Text != "<https://haven.example.com/resource/orders|View orders in Haven>" {
+		t.Errorf("unexpected link block %+v", blocks[3])
+	}
+
+	// Notifications within the window go to the thread of the first one, other resources and
+	// channels get their own.
+	now = now.Add(5 * time.Minute)
+	s.SendNotification("", n)
+	s.SendNotification("", Notification{Resource: "users", Text: "users"})
+	s.SendNotification("C2", n)
+	now = now.Add(9 * time.Minute)
+	s.SendNotification("", n)
+	now = now.Add(11 * time.Minute)
+	s.SendNotification("", n)
+	var threads []string
+	for _, p := range cli.posts {
+		threads = append(threads, p.Get("thread_ts"))
+	}
+	wantThreads := []string{"", "1700000000.000001", "", "", "1700000000.000001", ""}
+	if strings.Join(threads, ",") != strings.Join(wantThreads, ",") {
+		t.Errorf("thread_ts = %v, want %v", threads, wantThreads)
+	}
+
+	s.ThreadWindow = 0
+	s.SendNotification("", n)
+	s.SendNotification("", n)
+	if got := cli.posts[len(cli.posts)-1].Get("thread_ts"); got != "" {
+		t.Errorf("expected no threads with a zero window, got %s", got)
+	}
+}
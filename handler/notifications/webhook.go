@@ -0,0 +1,155 @@
+package notifications
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// SignatureHeader carries the HMAC-SHA256 signature of the bodies posted by WebhookSender,
+// as "sha256=<hex>".
+const SignatureHeader = "X-Haven-Signature"
+
+// DefaultPagerDutyURL is the PagerDuty Events API v2 endpoint.
+const DefaultPagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+
+// maxPagerDutySummary is the longest summary accepted by the PagerDuty Events API.
+const maxPagerDutySummary = 1024
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Sign returns the value of the SignatureHeader of a body signed with secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// postJSON posts v as JSON, signing the body if secret is set. Responses other than 2xx are
+// errors.
+func postJSON(client *http.Client, url, secret string, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal body: %v", err)
+	}
+	_, err = post(client, url, secret, body, nil)
+	return err
+}
+
+// PostSigned posts a JSON body with the extra headers, signing it if secret is set. It returns
+// the status of the response, zero if there was none. Responses other than 2xx are errors.
+func PostSigned(url, secret string, body []byte, header http.Header) (int, error) {
+	return post(httpClient, url, secret, body, header)
+}
+
+func post(client *http.Client, url, secret string, body []byte, header http.Header) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set(SignatureHeader, Sign(secret, body))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return resp.StatusCode, fmt.Errorf("%s responded %s: %s", url, resp.Status, bytes.TrimSpace(msg))
+	}
+	return resp.StatusCode, nil
+}
+
+// WebhookMessage is the body posted by WebhookSender.
+type WebhookMessage struct {
+	Text   string    `json:"text"`
+	SentAt time.Time `json:"sent_at"`
+}
+
+// WebhookSender posts messages as JSON to a URL, signed with HMAC-SHA256 if a secret is set.
+type WebhookSender struct {
+	URL    string
+	Secret string
+	client *http.Client
+}
+
+func NewWebhookSender(url, secret string) *WebhookSender {
+	return &WebhookSender{URL: url, Secret: secret, client: httpClient}
+}
+
+func (s *WebhookSender) IsActive() bool {
+	return s.URL != ""
+}
+
+func (s *WebhookSender) SendMessage(message string) error {
+	return postJSON(s.client, s.URL, s.Secret, WebhookMessage{Text: message, SentAt: time.Now().UTC()})
+}
+
+// TeamsSender posts messages to a Microsoft Teams incoming webhook.
+type TeamsSender struct {
+	WebhookURL string
+	client     *http.Client
+}
+
+func NewTeamsSender(webhookURL string) *TeamsSender {
+	return &TeamsSender{WebhookURL: webhookURL, client: httpClient}
+}
+
+func (s *TeamsSender) IsActive() bool {
+	return s.WebhookURL != ""
+}
+
+func (s *TeamsSender) SendMessage(message string) error {
+	return postJSON(s.client, s.WebhookURL, "", map[string]any{
+		"@type":    "MessageCard",
+		"@context": "https://schema.org/extensions",
+		"summary":  "Haven notification",
+		"text":     message,
+	})
+}
+
+// PagerDutySender triggers PagerDuty incidents through the Events API v2.
+type PagerDutySender struct {
+	RoutingKey string
+	// URL of the Events API, DefaultPagerDutyURL unless testing.
+	URL string
+	// Severity of the events: critical, error, warning or info.
+	Severity string
+	client   *http.Client
+}
+
+func NewPagerDutySender(routingKey string) *PagerDutySender {
+	return &PagerDutySender{RoutingKey: routingKey, URL: DefaultPagerDutyURL, Severity: "warning", client: httpClient}
+}
+
+func (s *PagerDutySender) IsActive() bool {
+	return s.RoutingKey != ""
+}
+
+func (s *PagerDutySender) SendMessage(message string) error {
+	summary := message
+	if len(summary) > maxPagerDutySummary {
+		summary = summary[:maxPagerDutySummary]
+	}
+	return postJSON(s.client, s.URL, "", map[string]any{
+		"routing_key":  s.RoutingKey,
+		"event_action": "trigger",
+		"payload": map[string]any{
+			"summary":  summary,
+			"source":   "haven",
+			"severity": s.Severity,
+		},
+	})
+}
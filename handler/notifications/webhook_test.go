@@ -0,0 +1,124 @@
+package notifications
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// request is a request received by the stand-in server.
+type request struct {
+	header http.Header
+	body   []byte
+}
+
+// newServer starts an HTTP stand-in responding with status and recording the requests.
+func newServer(t *testing.T, status int) (*httptest.Server, *[]request) {
+	var requests []request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, request{header: r.Header, body: body})
+		w.WriteHeader(status)
+		w.Write([]byte("response body"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func decode(t *testing.T, body []byte) map[string]any {
+	t.Helper()
+	var m map[string]any
+	if err := json.Unmarshal(body, &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestWebhookSender(t *testing.T) {
+	if NewWebhookSender("", "").IsActive() {
+		t.Errorf("expected sender without URL to be inactive")
+	}
+	srv, requests := newServer(t, http.StatusNoContent)
+	s := NewWebhookSender(srv.URL, "secret")
+	if err := s.SendMessage("new version"); err != nil {
+		t.Fatal(err)
+	}
+	got := (*requests)[0]
+	if got.header.Get("Content-Type") != "application/json" {
+		t.Errorf("Content-Type = %q", got.header.Get("Content-Type"))
+	}
+	if want := Sign("secret", got.body); got.header.Get(SignatureHeader) != want {
+		t.Errorf("signature = %q, want %q", got.header.Get(SignatureHeader), want)
+	}
+	if !strings.HasPrefix(got.header.Get(SignatureHeader), "sha256=") {
+		t.Errorf("signature = %q, want a sha256= prefix", got.header.Get(SignatureHeader))
+	}
+	if body := decode(t, got.body); body["text"] != "new version" || body["sent_at"] == nil {
+		t.Errorf("unexpected body %v", body)
+	}
+
+	// Unsigned without a secret.
+	s.Secret = ""
+	if err := s.SendMessage("new version"); err != nil {
+		t.Fatal(err)
+	}
+	if sig := (*requests)[1].header.Get(SignatureHeader); sig != "" {
+		t.Errorf("expected no signature, got %q", sig)
+	}
+
+	failing, _ := newServer(t, http.StatusInternalServerError)
+	err := NewWebhookSender(failing.URL, "").SendMessage("new version")
+	if err == nil || !strings.Contains(err.Error(), "500 Internal Server Error: response body") {
+		t.Errorf("expected a status error, got %v", err)
+	}
+	if err := NewWebhookSender("http://127.0.0.1:1", "").SendMessage("x"); err == nil {
+		t.Errorf("expected a connection error")
+	}
+}
+
+func TestSign(t *testing.T) {
+	want := "sha256=d49963aea532c415fd26bd91c1bf13691d8411b6b579b7d82efb35116ebd38a2"
+	if got := Sign("secret", []byte(`{"text":"hi"}`)); got != want {
+		t.Errorf("Sign() = %q, want %q", got, want)
+	}
+}
+
+func TestTeamsSender(t *testing.T) {
+	if NewTeamsSender("").IsActive() {
+		t.Errorf("expected sender without URL to be inactive")
+	}
+	srv, requests := newServer(t, http.StatusOK)
+	if err := NewTeamsSender(srv.URL).SendMessage("new version"); err != nil {
+		t.Fatal(err)
+	}
+	body := decode(t, (*requests)[0].body)
+	if body["@type"] != "MessageCard" || body["text"] != "new version" {
+		t.Errorf("unexpected body %v", body)
+	}
+}
+
+func TestPagerDutySender(t *testing.T) {
+	if NewPagerDutySender("").IsActive() {
+		t.Errorf("expected sender without routing key to be inactive")
+	}
+	srv, requests := newServer(t, http.StatusAccepted)
+	s := NewPagerDutySender("key")
+	if s.URL != DefaultPagerDutyURL {
+		t.Errorf("URL = %q", s.URL)
+	}
+	s.URL = srv.URL
+	if err := s.SendMessage(strings.Repeat("x", 2000)); err != nil {
+		t.Fatal(err)
+	}
+	body := decode(t, (*requests)[0].body)
+	payload := body["payload"].(map[string]any)
+	if body["routing_key"] != "key" || body["event_action"] != "trigger" || payload["severity"] != "warning" || payload["source"] != "haven" {
+		t.Errorf("unexpected body %v", body)
+	}
+	if len(payload["summary"].(string)) != maxPagerDutySummary {
+		t.Errorf("expected the summary to be truncated to %d, got %d", maxPagerDutySummary, len(payload["summary"].(string)))
+	}
+}
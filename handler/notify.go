@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"movinglake.com/haven/handler/jsonutils"
+	"movinglake.com/haven/handler/notifications"
+	"movinglake.com/haven/telemetry"
+	"movinglake.com/haven/wrappers"
+)
+
+// maxNotificationChanges and maxNotificationPayload limit the details of version
+// notifications.
+const (
+	maxNotificationChanges = 10
+	maxNotificationPayload = 500
+)
+
+var (
+	eventTypes = map[string]bool{
+		notifications.EventVersionAdded:  true,
+		notifications.EventAlertFiring:   true,
+		notifications.EventAlertResolved: true,
+	}
+	severities = map[string]bool{notifications.SeverityBreaking: true, notifications.SeverityCompatible: true}
+)
+
+// versionSeverity returns whether the changes of a new version are breaking, see
+// jsonutils.BreakingChanges. The first version of a resource is compatible.
+func versionSeverity(ev VersionEvent) string {
+	if ev.OldSchema == "" {
+		return notifications.SeverityCompatible
+	}
+	var oldSchema, newSchema map[string]any
+	if json.Unmarshal([]byte(ev.OldSchema), &oldSchema) != nil || json.Unmarshal([]byte(ev.NewSchema), &newSchema) != nil {
+		return notifications.SeverityBreaking
+	}
+	if len(jsonutils.BreakingChanges(oldSchema, newSchema)) > 0 {
+		return notifications.SeverityBreaking
+	}
+	return notifications.SeverityCompatible
+}
+
+// versionChanges returns the diff lines of a new version, at most maxNotificationChanges, and
+// the number of lines left out.
+func versionChanges(ev VersionEvent) ([]string, int) {
+	if ev.OldSchema == "" {
+		return nil, 0
+	}
+	var oldSchema, newSchema map[string]any
+	if json.Unmarshal([]byte(ev.OldSchema), &oldSchema) != nil || json.Unmarshal([]byte(ev.NewSchema), &newSchema) != nil {
+		return nil, 0
+	}
+	var lines []string
+	for _, c := range jsonutils.DiffSchemas(oldSchema, newSchema) {
+		lines = append(lines, c.String())
+	}
+	if len(lines) > maxNotificationChanges {
+		return lines[:maxNotificationChanges], len(lines) - maxNotificationChanges
+	}
+	return lines, 0
+}
+
+// truncate cuts s to at most n bytes without splitting runes, marking the cut with an ellipsis.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "…"
+}
+
+// versionNotification returns the notification of a new version, with the changes, a snippet
+// of the reference payload and a link to the resource page as details.
+func (h *HavenAPIHandler) versionNotification(ev VersionEvent, payload string) notifications.Notification {
+	n := notifications.Notification{
+		Namespace: h.namespace,
+		Resource:  ev.Resource,
+		Event:     notifications.EventVersionAdded,
+		Severity:  versionSeverity(ev),
+		Version:   ev.Version,
+		Text:      fmt.Sprintf("New version `%d` of schema for resource %s has been added", ev.Version, h.resourceText(ev.Resource)),
+		Payload:   truncate(payload, maxNotificationPayload),
+	}
+	n.Changes, n.MoreChanges = versionChanges(ev)
+	n.URL = h.resourceURL(ev.Resource)
+	return n
+}
+
+// resourceURL returns the link to the page of the resource, or "" without a base URL.
+func (h *HavenAPIHandler) resourceURL(resource string) string {
+	if h.baseURL == "" {
+		return ""
+	}
+	return strings.TrimSuffix(h.baseURL, "/") + pagePath(h.namespace) + "/resource/" + resource
+}
+
+// resourcePattern compiles the resource pattern of a route. Globs are anchored and their *
+// matches any characters, including slashes.
+func resourcePattern(pattern string, isRegex bool) (*regexp.Regexp, error) {
+	if isRegex {
+		return regexp.Compile(pattern)
+	}
+	glob := regexp.QuoteMeta(pattern)
+	glob = strings.ReplaceAll(glob, `\*`, ".*")
+	glob = strings.ReplaceAll(glob, `\?`, ".")
+	return regexp.Compile("^" + glob + "$")
+}
+
+// routeMatches reports whether the notification goes through the route.
+func routeMatches(r wrappers.NotificationRoutes, n notifications.Notification) bool {
+	if r.EventType != "" && r.EventType != n.Event {
+		return false
+	}
+	if r.Severity != "" && r.Severity != n.Severity {
+		return false
+	}
+	if r.Resource == "" {
+		return true
+	}
+	re, err := resourcePattern(r.Resource, r.Regex)
+	if err != nil {
+		log.Printf("invalid resource pattern %q of notification route %d: %v", r.Resource, r.ID, err)
+		return false
+	}
+	return re.MatchString(n.Resource)
+}
+
+// notificationTarget is a sender and channel a notification is delivered to.
+type notificationTarget struct {
+	sender  string
+	channel string
+	// digest is the window the notification is batched over, zero to send it right away.
+	digest time.Duration
+}
+
+// notificationTargets returns where the notification goes: the notification routes it
+// matches, or every configured sender if there are no routes.
+func (h *HavenAPIHandler) notificationTargets(n notifications.Notification) []notificationTarget {
+	routes, err := h.db.GetNotificationRoutes()
+	if err != nil {
+		log.Printf("failed to get notification routes, sending to all senders: %v", err)
+		routes = nil
+	}
+	var targets []notificationTarget
+	if len(routes) == 0 {
+		for _, name := range h.notifier.Names() {
+			targets = append(targets, notificationTarget{sender: name})
+		}
+		return targets
+	}
+	seen := make(map[notificationTarget]bool)
+	for _, r := range routes {
+		target := notificationTarget{sender: r.Sender, channel: r.Channel}
+		if seen[target] || !routeMatches(r, n) {
+			continue
+		}
+		seen[target] = true
+		// Only new versions are batched, alerts are sent right away.
+		if n.Event == notifications.EventVersionAdded {
+			target.digest = r.Digest
+		}
+		targets = append(targets, target)
+	}
+	if len(targets) == 0 {
+		telemetry.UnroutedNotifications.WithLabelValues(n.Event).Inc()
+		log.Printf("no notification route matches %s of resource %s, dropping it", n.Event, n.Resource)
+	}
+	return targets
+}
+
+// enqueueNotification writes the notification to the outbox of every target in the
+// transaction, to be delivered by the outbox worker once it commits.
+func (h *HavenAPIHandler) enqueueNotification(n notifications.Notification, tx *gorm.DB) error {
+	if !h.notifier.IsActive() {
+		log.Printf("notifications not configured, skipping sending message for resource %s", n.Resource)
+		return nil
+	}
+	b, err := json.Marshal(n)
+	if err != nil {
+		return newAPIError(http.StatusInternalServerError, "failed to marshal notification: %v", err)
+	}
+	for _, t := range h.notificationTargets(n) {
+		if err := h.saveOutbox(n.Resource, n.Event, string(b), t, tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveOutbox writes a JSON encoded notification to the outbox of the target. Targets with a
+// digest keep it until the digest window ends.
+func (h *HavenAPIHandler) saveOutbox(resource, event, notification string, t notificationTarget, tx *gorm.DB) error {
+	row := &wrappers.NotificationOutbox{
+		Resource:      resource,
+		Event:         event,
+		Sender:        t.sender,
+		Channel:       t.channel,
+		Notification:  notification,
+		Status:        wrappers.DeliveryPending,
+		NextAttemptAt: time.Now(),
+	}
+	if t.digest > 0 {
+		row.Status = wrappers.DeliveryDigest
+		row.NextAttemptAt = row.NextAttemptAt.Add(t.digest)
+	}
+	if err := h.db.Save(row, tx); err != nil {
+		return newAPIError(http.StatusInternalServerError, "failed to save notification: %v", err)
+	}
+	return nil
+}
+
+func notificationFailed(sender string, err error) {
+	telemetry.NotificationErrors.WithLabelValues(sender).Inc()
+	log.Printf("failed to send %s notification: %v", sender, err)
+}
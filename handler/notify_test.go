@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"movinglake.com/haven/handler/notifications"
+	"movinglake.com/haven/wrappers"
+)
+
+func TestNotificationsConfig(t *testing.T) {
+	assert.Empty(t, (&NotificationsConfig{}).Registry().Names())
+	nc := &NotificationsConfig{
+		SlackToken:          "token",
+		SlackChannelID:      "channel",
+		WebhookURL:          "http://localhost/hook",
+		SMTPAddr:            "localhost:25",
+		SMTPFrom:            "haven@example.com",
+		SMTPTo:              []string{"team@example.com"},
+		TeamsWebhookURL:     "http://localhost/teams",
+		PagerDutyRoutingKey: "key",
+	}
+	want := []string{
+		notifications.SenderSlack,
+		notifications.SenderWebhook,
+		notifications.SenderEmail,
+		notifications.SenderTeams,
+		notifications.SenderPagerDuty,
+	}
+	assert.Equal(t, want, nc.Registry().Names())
+}
+
+func TestNotifyNewVersion(t *testing.T) {
+	var bodies []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		assert.Equal(t, notifications.Sign("secret", b), r.Header.Get(notifications.SignatureHeader))
+		var body map[string]any
+		json.Unmarshal(b, &body)
+		bodies = append(bodies, body)
+	}))
+	defer srv.Close()
+
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	handler := NewHavenAPIHandler(db, &NotificationsConfig{WebhookURL: srv.URL, WebhookSecret: "secret"})
+	failing := &fakeSlackSender{err: http.ErrHandlerTimeout}
+	handler.notifier.Register(notifications.SenderSlack, failing)
+	router := gin.Default()
+	handler.RegisterRoutes(router)
+
+	// A failing sender doesn't stop the others nor the request.
+	response := postJSON(router, "/api/v1/add_payload", AddPayloadRequest{Resource: "users", Payload: map[string]any{"name": "Ann"}})
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Empty(t, bodies, "notifications are delivered by the outbox")
+	delivered, err := handler.DeliverNotifications(DefaultOutboxConfig, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, delivered)
+	assert.Equal(t, 1, len(bodies))
+	assert.Equal(t, "New version `1` of schema for resource `users` has been added", bodies[0]["text"])
+}
+
+type fakeNotificationSender struct {
+	notifications []notifications.Notification
+}
+
+func (f *fakeNotificationSender) SendMessage(message string) error {
+	return f.SendNotification("", notifications.Notification{Text: message})
+}
+
+func (f *fakeNotificationSender) SendNotification(channel string, n notifications.Notification) error {
+	f.notifications = append(f.notifications, n)
+	return nil
+}
+
+func (f *fakeNotificationSender) IsActive() bool {
+	return true
+}
+
+func TestNotifyVersionDetails(t *testing.T) {
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	handler := NewHavenAPIHandler(db, &NotificationsConfig{BaseURL: "https://haven.example.com/"})
+	sender := &fakeNotificationSender{}
+	handler.notifier.Register(notifications.SenderSlack, sender)
+	router := gin.Default()
+	handler.RegisterRoutes(router)
+
+	postJSON(router, "/api/v1/add_payload", AddPayloadRequest{Resource: "users", Payload: map[string]any{"name": "Ann"}})
+	long := strings.Repeat("é", maxNotificationPayload)
+	response := postJSON(router, "/api/v1/add_payload", AddPayloadRequest{Resource: "users", Payload: map[string]any{"name": "Ann", "bio": long}})
+	assert.Equal(t, http.StatusOK, response.Code)
+	handler.DeliverNotifications(DefaultOutboxConfig, time.Now())
+
+	assert.Equal(t, 2, len(sender.notifications))
+	first, second := sender.notifications[0], sender.notifications[1]
+	assert.Empty(t, first.Changes)
+	assert.Equal(t, `{"name":"Ann"}`, first.Payload)
+	assert.Equal(t, "https://haven.example.com/resource/users", first.URL)
+	assert.Equal(t, notifications.EventVersionAdded, second.Event)
+	assert.Equal(t, notifications.SeverityCompatible, second.Severity)
+	assert.Equal(t, []string{`+ /properties/bio: {"type":"string"}`}, second.Changes)
+	assert.True(t, strings.HasSuffix(second.Payload, "…"))
+	assert.True(t, utf8.ValidString(second.Payload))
+	assert.LessOrEqual(t, len(second.Payload), maxNotificationPayload+len("…"))
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"movinglake.com/haven/handler/schemaconv"
+)
+
+// Defaults of the OpenAPI document info.
+const (
+	DefaultOpenAPITitle   = "Haven schemas"
+	DefaultOpenAPIVersion = "1.0.0"
+)
+
+// OpenAPI returns an OpenAPI document with the schemas of the resources, or of all of them if
+// names is empty.
+func (h *HavenAPIHandler) OpenAPI(names []string, opts schemaconv.OpenAPIOptions) (*schemaconv.OpenAPIDocument, error) {
+	var schemas []schemaconv.Schema
+	if len(names) > 0 {
+		for _, name := range names {
+			schema, err := h.ResourceSchema(name)
+			if err != nil {
+				return nil, err
+			}
+			schemas = append(schemas, *schema)
+		}
+		return schemaconv.OpenAPI(schemas, opts), nil
+	}
+	resources, err := h.db.GetAllResources()
+	if err != nil {
+		return nil, newAPIError(http.StatusInternalServerError, "failed to get resources from db: %v", err)
+	}
+	sort.Slice(resources, func(i, j int) bool { return resources[i].Name < resources[j].Name })
+	for _, r := range resources {
+		schema, err := unmarshalSchema(r.Schema)
+		if err != nil {
+			return nil, newAPIError(http.StatusInternalServerError, "failed to unmarshal schema of %s: %v", r.Name, err)
+		}
+		schemas = append(schemas, schemaconv.Schema{Resource: r.Name, Version: r.Version, Schema: schema})
+	}
+	return schemaconv.OpenAPI(schemas, opts), nil
+}
+
+// openAPI returns an OpenAPI 3.1 document with the resources as component schemas. It
+// includes every resource unless some are picked with ?resource=, and adds paths for the
+// resources named after URL paths with ?paths=true. The info is set with ?title= and
+// ?version=.
+func (h *HavenAPIHandler) openAPI(c *gin.Context) {
+	opts := schemaconv.OpenAPIOptions{
+		Title:   c.DefaultQuery("title", DefaultOpenAPITitle),
+		Version: c.DefaultQuery("version", DefaultOpenAPIVersion),
+		Paths:   c.Query("paths") == "true",
+	}
+	doc, err := h.OpenAPI(c.QueryArray("resource"), opts)
+	if err != nil {
+		c.JSON(statusCode(err), APIResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, doc)
+}
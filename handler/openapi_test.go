@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"movinglake.com/haven/handler/schemaconv"
+	"movinglake.com/haven/wrappers"
+)
+
+func TestOpenAPI(t *testing.T) {
+	db, router := newBundleRouter()
+	postJSON(router, "/api/v1/add_payload", AddPayloadRequest{Resource: "/api/v1/payments", Payload: map[string]any{"amount": 10}})
+	postJSON(router, "/api/v1/set_schema", SetSchemaRequest{Resource: "pets", Schema: map[string]any{"type": "object"}})
+
+	get := func(path string) (int, schemaconv.OpenAPIDocument) {
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, path, nil))
+		var doc schemaconv.OpenAPIDocument
+		json.Unmarshal(response.Body.Bytes(), &doc)
+		return response.Code, doc
+	}
+
+	code, doc := get("/api/v1/openapi")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, schemaconv.OpenAPIVersion, doc.OpenAPI)
+	assert.Equal(t, schemaconv.OpenAPIInfo{Title: DefaultOpenAPITitle, Version: DefaultOpenAPIVersion}, doc.Info)
+	assert.Equal(t, 2, len(doc.Components.Schemas))
+	payments := doc.Components.Schemas["ApiV1Payments"]
+	assert.Equal(t, "/api/v1/payments", payments[schemaconv.ExtensionResource])
+	assert.Contains(t, payments["properties"], "amount")
+	assert.NotContains(t, payments, "$id")
+	assert.Nil(t, doc.Paths)
+
+	code, doc = get("/api/v1/openapi?paths=true&resource=/api/v1/payments&resource=pets&title=Payments&version=2")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, schemaconv.OpenAPIInfo{Title: "Payments", Version: "2"}, doc.Info)
+	assert.Equal(t, 2, len(doc.Components.Schemas))
+	assert.Equal(t, 1, len(doc.Paths))
+	assert.Contains(t, doc.Paths["/api/v1/payments"], "get")
+
+	code, _ = get("/api/v1/openapi?resource=missing")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	db.Errors = map[string]error{"GetAllResources": gorm.ErrInvalidDB}
+	code, _ = get("/api/v1/openapi")
+	assert.Equal(t, http.StatusInternalServerError, code)
+
+	db.Errors = nil
+	db.Save(&wrappers.Resource{Name: "broken", Schema: "not json", Version: 1}, nil)
+	code, _ = get("/api/v1/openapi")
+	assert.Equal(t, http.StatusInternalServerError, code)
+}
@@ -0,0 +1,261 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"movinglake.com/haven/handler/notifications"
+	"movinglake.com/haven/telemetry"
+	"movinglake.com/haven/wrappers"
+)
+
+// OutboxConfig configures the delivery of the notification outbox.
+type OutboxConfig struct {
+	// Interval is how often due notifications are looked for. New notifications are delivered
+	// right after their transaction commits.
+	Interval time.Duration
+	// Backoff is the delay before the first retry of a failed delivery, doubled for every
+	// further attempt up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// MaxAttempts is the number of failed deliveries after which notifications are
+	// dead-lettered.
+	MaxAttempts uint
+	// BatchSize is the maximum number of notifications delivered per round.
+	BatchSize int
+	// Lease is how long the notifications claimed by a round are skipped by other replicas.
+	// Deliveries not saved by then, e.g. because the replica died, are attempted again.
+	Lease time.Duration
+}
+
+var DefaultOutboxConfig = OutboxConfig{
+	Interval:    10 * time.Second,
+	Backoff:     30 * time.Second,
+	MaxBackoff:  time.Hour,
+	MaxAttempts: 8,
+	BatchSize:   100,
+	Lease:       5 * time.Minute,
+}
+
+// backoff returns the delay before the next attempt after the given number of failed ones.
+func (c OutboxConfig) backoff(attempts uint) time.Duration {
+	d := c.Backoff
+	for i := uint(1); i < attempts && d < c.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > c.MaxBackoff {
+		return c.MaxBackoff
+	}
+	return d
+}
+
+type NotificationDelivery struct {
+	ID            uint       `json:"id"`
+	Resource      string     `json:"resource"`
+	Event         string     `json:"event"`
+	Sender        string     `json:"sender"`
+	Channel       string     `json:"channel"`
+	Text          string     `json:"text"`
+	Status        string     `json:"status"`
+	Attempts      uint       `json:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	LastError     string     `json:"last_error"`
+	DeliveredAt   *time.Time `json:"delivered_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+type GetNotificationDeliveriesResponse struct {
+	APIResponse
+	Deliveries []NotificationDelivery `json:"deliveries"`
+}
+
+type RetryNotificationRequest struct {
+	ID uint `json:"id"`
+}
+
+type RetryNotificationResponse struct {
+	APIResponse
+	Delivery NotificationDelivery `json:"delivery"`
+}
+
+func newNotificationDelivery(row wrappers.NotificationOutbox) NotificationDelivery {
+	d := NotificationDelivery{
+		ID:            row.ID,
+		Resource:      row.Resource,
+		Event:         row.Event,
+		Sender:        row.Sender,
+		Channel:       row.Channel,
+		Status:        row.Status,
+		Attempts:      row.Attempts,
+		NextAttemptAt: row.NextAttemptAt,
+		LastError:     row.LastError,
+		DeliveredAt:   row.DeliveredAt,
+		CreatedAt:     row.CreatedAt,
+	}
+	var n notifications.Notification
+	if err := json.Unmarshal([]byte(row.Notification), &n); err == nil {
+		d.Text = n.Text
+	}
+	return d
+}
+
+// wakeOutbox makes RunOutbox deliver the notifications enqueued by a committed transaction
+// without waiting for the next interval.
+func (h *HavenAPIHandler) wakeOutbox() {
+	select {
+	case h.outboxWake <- struct{}{}:
+	default:
+	}
+}
+
+// deliverNotification sends a notification of the outbox and records the result, scheduling
+// a retry or dead-lettering it if it failed.
+func (h *HavenAPIHandler) deliverNotification(cfg OutboxConfig, row *wrappers.NotificationOutbox, now time.Time) error {
+	var n notifications.Notification
+	err := json.Unmarshal([]byte(row.Notification), &n)
+	if err != nil {
+		err = fmt.Errorf("failed to unmarshal notification: %v", err)
+		row.Attempts = cfg.MaxAttempts - 1
+	} else {
+		err = h.notifier.SendTo(row.Sender, row.Channel, n)
+	}
+	row.Attempts++
+	switch {
+	case err == nil:
+		row.Status = wrappers.DeliveryDelivered
+		row.DeliveredAt = &now
+		row.LastError = ""
+	case row.Attempts >= cfg.MaxAttempts:
+		notificationFailed(row.Sender, err)
+		telemetry.NotificationDeadLetters.WithLabelValues(row.Sender).Inc()
+		log.Printf("giving up on notification %d after %d attempts", row.ID, row.Attempts)
+		row.Status = wrappers.DeliveryDead
+		row.LastError = err.Error()
+	default:
+		notificationFailed(row.Sender, err)
+		row.NextAttemptAt = now.Add(cfg.backoff(row.Attempts))
+		row.LastError = err.Error()
+	}
+	return h.db.Save(row, nil)
+}
+
+// DeliverNotifications delivers the notifications of the outbox due at now and returns how
+// many were attempted.
+func (h *HavenAPIHandler) DeliverNotifications(cfg OutboxConfig, now time.Time) (int, error) {
+	rows, err := h.db.ClaimDueNotifications(now, cfg.Lease, cfg.BatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim due notifications: %w", err)
+	}
+	for i := range rows {
+		if err := h.deliverNotification(cfg, &rows[i], now); err != nil {
+			return i, fmt.Errorf("failed to save notification %d: %w", rows[i].ID, err)
+		}
+	}
+	return len(rows), nil
+}
+
+// RunOutbox delivers the notifications of the outbox and the webhook deliveries until the
+// context is done. Errors are logged and retried on the next round.
+func (h *HavenAPIHandler) RunOutbox(ctx context.Context, cfg OutboxConfig) {
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := h.DeliverNotifications(cfg, time.Now())
+			if err != nil {
+				log.Printf("failed to deliver notifications: %v", err)
+			}
+			w, werr := h.DeliverWebhooks(cfg, time.Now())
+			if werr != nil {
+				log.Printf("failed to deliver webhooks: %v", werr)
+			}
+			// Full batches may have more due deliveries behind them.
+			if (err != nil || n < cfg.BatchSize) && (werr != nil || w < cfg.BatchSize) {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-h.outboxWake:
+		}
+	}
+}
+
+// getNotificationDeliveries lists the notifications of the outbox, newest first. It can be
+// filtered by ?resource= and ?status= and paginated with ?limit= and ?offset=.
+func (h *HavenAPIHandler) getNotificationDeliveries(c *gin.Context) {
+	var response GetNotificationDeliveriesResponse
+	filter := wrappers.OutboxFilter{Resource: c.Query("resource"), Status: c.Query("status")}
+	var err error
+	if v := c.Query("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil {
+			response.Error = fmt.Sprintf("failed to parse limit: %v", err)
+			c.JSON(http.StatusBadRequest, response)
+			return
+		}
+	}
+	if v := c.Query("offset"); v != "" {
+		if filter.Offset, err = strconv.Atoi(v); err != nil {
+			response.Error = fmt.Sprintf("failed to parse offset: %v", err)
+			c.JSON(http.StatusBadRequest, response)
+			return
+		}
+	}
+	rows, err := h.db.GetOutboxNotifications(filter)
+	if err != nil {
+		response.Error = fmt.Sprintf("failed to get notifications from db: %v", err)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+	response.Deliveries = []NotificationDelivery{}
+	for _, row := range rows {
+		response.Deliveries = append(response.Deliveries, newNotificationDelivery(row))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// retryNotification queues a dead-lettered notification for delivery again.
+func (h *HavenAPIHandler) retryNotification(c *gin.Context) {
+	var request RetryNotificationRequest
+	var response RetryNotificationResponse
+	if err := c.ShouldBindBodyWithJSON(&request); err != nil {
+		response.Error = fmt.Sprintf("failed to parse json request: %v", err)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+	row, err := h.db.GetOutboxNotification(request.ID)
+	if err != nil {
+		response.Error = fmt.Sprintf("failed to get notification from db: %v", err)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+	if row == nil {
+		response.Error = fmt.Sprintf("notification not found: %d", request.ID)
+		c.JSON(http.StatusNotFound, response)
+		return
+	}
+	if row.Status != wrappers.DeliveryDead {
+		response.Error = fmt.Sprintf("notification %d is %s, only dead notifications can be retried", row.ID, row.Status)
+		c.JSON(http.StatusConflict, response)
+		return
+	}
+	row.Status = wrappers.DeliveryPending
+	row.Attempts = 0
+	row.NextAttemptAt = time.Now()
+	if err := h.db.Save(row, nil); err != nil {
+		response.Error = fmt.Sprintf("failed to save notification: %v", err)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+	h.wakeOutbox()
+	response.Delivery = newNotificationDelivery(*row)
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"movinglake.com/haven/handler/notifications"
+	"movinglake.com/haven/wrappers"
+)
+
+type chanSender chan string
+
+func (s chanSender) SendMessage(message string) error {
+	s <- message
+	return nil
+}
+
+func (s chanSender) IsActive() bool {
+	return true
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	cfg := OutboxConfig{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	for attempts, want := range map[uint]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 40: 5 * time.Second} {
+		assert.Equal(t, want, cfg.backoff(attempts), "attempts %d", attempts)
+	}
+}
+
+func getDeliveries(router *gin.Engine, query string) GetNotificationDeliveriesResponse {
+	request := httptest.NewRequest(http.MethodGet, "/api/v1/get_notification_deliveries"+query, nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	var deliveries GetNotificationDeliveriesResponse
+	json.Unmarshal(response.Body.Bytes(), &deliveries)
+	return deliveries
+}
+
+func TestOutboxRetries(t *testing.T) {
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	handler := NewHavenAPIHandler(db, nil)
+	slack := &fakeSlackSender{err: errors.New("slack is down")}
+	handler.notifier.Register(notifications.SenderSlack, slack)
+	router := gin.Default()
+	handler.RegisterRoutes(router)
+	cfg := OutboxConfig{Backoff: time.Minute, MaxBackoff: time.Hour, MaxAttempts: 3, BatchSize: 10}
+
+	response := postJSON(router, "/api/v1/add_payload", AddPayloadRequest{Resource: "users", Payload: map[string]any{"name": "Ann"}})
+	assert.Equal(t, http.StatusOK, response.Code)
+	deliveries := getDeliveries(router, "?resource=users")
+	assert.Equal(t, 1, len(deliveries.Deliveries))
+	assert.Equal(t, wrappers.DeliveryPending, deliveries.Deliveries[0].Status)
+	assert.Equal(t, "New version `1` of schema for resource `users` has been added", deliveries.Deliveries[0].Text)
+
+	// Failed deliveries are retried with exponential backoff, then dead-lettered.
+	now := time.Now()
+	for _, step := range []struct {
+		after     time.Duration
+		attempted int
+	}{
+		{0, 1},
+		{30 * time.Second, 0},
+		{time.Minute, 1},
+		{2*time.Minute + 59*time.Second, 0},
+		{3 * time.Minute, 1},
+		{time.Hour, 0},
+	} {
+		attempted, err := handler.DeliverNotifications(cfg, now.Add(step.after))
+		assert.NoError(t, err)
+		assert.Equal(t, step.attempted, attempted, "after %v", step.after)
+	}
+	deliveries = getDeliveries(router, "?status=dead")
+	assert.Equal(t, 1, len(deliveries.Deliveries))
+	dead := deliveries.Deliveries[0]
+	assert.Equal(t, uint(3), dead.Attempts)
+	assert.Equal(t, "slack is down", dead.LastError)
+	assert.Nil(t, dead.DeliveredAt)
+
+	// Dead notifications can be retried once the sender is back.
+	response = postJSON(router, "/api/v1/retry_notification", RetryNotificationRequest{ID: dead.ID})
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	slack.err = nil
+	attempted, err := handler.DeliverNotifications(cfg, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, attempted)
+	deliveries = getDeliveries(router, "")
+	assert.Equal(t, wrappers.DeliveryDelivered, deliveries.Deliveries[0].Status)
+	assert.NotNil(t, deliveries.Deliveries[0].DeliveredAt)
+	assert.Empty(t, deliveries.Deliveries[0].LastError)
+
+	response = postJSON(router, "/api/v1/retry_notification", RetryNotificationRequest{ID: dead.ID})
+	assert.Equal(t, http.StatusConflict, response.Code)
+	response = postJSON(router, "/api/v1/retry_notification", RetryNotificationRequest{ID: 42})
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	assert.Empty(t, getDeliveries(router, "?resource=orders").Deliveries)
+
+	// Notifications that can't be decoded are dead-lettered right away.
+	db.Save(&wrappers.NotificationOutbox{Sender: notifications.SenderSlack, Notification: "{", Status: wrappers.DeliveryPending}, nil)
+	handler.DeliverNotifications(cfg, time.Now())
+	assert.Equal(t, 1, len(getDeliveries(router, "?status=dead").Deliveries))
+}
+
+func TestOutboxLease(t *testing.T) {
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	handler := NewHavenAPIHandler(db, nil)
+	messages := make(chanSender, 1)
+	handler.notifier.Register(notifications.SenderSlack, messages)
+	router := gin.Default()
+	handler.RegisterRoutes(router)
+	cfg := OutboxConfig{Backoff: time.Minute, MaxBackoff: time.Hour, MaxAttempts: 3, BatchSize: 10, Lease: 5 * time.Minute}
+
+	// Notifications claimed by a replica are skipped by the others until its lease expires.
+	postJSON(router, "/api/v1/add_payload", AddPayloadRequest{Resource: "users", Payload: map[string]any{"name": "Ann"}})
+	now := time.Now()
+	claimed, err := db.ClaimDueNotifications(now, cfg.Lease, cfg.BatchSize)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(claimed))
+	attempted, err := handler.DeliverNotifications(cfg, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, attempted)
+	attempted, err = handler.DeliverNotifications(cfg, now.Add(cfg.Lease))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, attempted)
+	assert.Equal(t, "New version `1` of schema for resource `users` has been added", <-messages)
+
+	db.Errors = map[string]error{"ClaimDueNotifications": errors.New("db is down")}
+	_, err = handler.DeliverNotifications(cfg, now)
+	assert.ErrorContains(t, err, "failed to claim due notifications")
+}
+
+func TestRunOutbox(t *testing.T) {
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	handler := NewHavenAPIHandler(db, nil)
+	messages := make(chanSender, 1)
+	handler.notifier.Register(notifications.SenderSlack, messages)
+	router := gin.Default()
+	handler.RegisterRoutes(router)
+
+	// Committed transactions wake the worker up, without blocking when it is busy.
+	postJSON(router, "/api/v1/add_payload", AddPayloadRequest{Resource: "users", Payload: map[string]any{"name": "Ann"}})
+	postJSON(router, "/api/v1/add_payload", AddPayloadRequest{Resource: "users", Payload: map[string]any{"name": "Ann", "age": 30}})
+	assert.Equal(t, 1, len(handler.outboxWake))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		handler.RunOutbox(ctx, OutboxConfig{Interval: time.Hour, MaxAttempts: 1, BatchSize: 1})
+		close(done)
+	}()
+	for _, version := range []string{"1", "2"} {
+		select {
+		case msg := <-messages:
+			assert.Equal(t, "New version `"+version+"` of schema for resource `users` has been added", msg)
+		case <-time.After(5 * time.Second):
+			t.Fatal("notification not delivered")
+		}
+	}
+	cancel()
+	<-done
+	for _, row := range db.Outbox {
+		assert.Equal(t, wrappers.DeliveryDelivered, row.Status)
+	}
+}
@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Output formats of the JSON Schema specification supported by validatePayload.
+const (
+	OutputFormatBasic    = "basic"
+	OutputFormatDetailed = "detailed"
+)
+
+// OutputUnit is an output unit as described in the "Output Formatting" section of the
+// JSON Schema specification.
+type OutputUnit struct {
+	Valid            bool         `json:"valid"`
+	KeywordLocation  string       `json:"keywordLocation"`
+	InstanceLocation string       `json:"instanceLocation"`
+	Error            string       `json:"error,omitempty"`
+	Errors           []OutputUnit `json:"errors,omitempty"`
+}
+
+func validOutputFormat(format string) bool {
+	return format == "" || format == OutputFormatBasic || format == OutputFormatDetailed
+}
+
+func errorUnit(e ErrorResponse) OutputUnit {
+	return OutputUnit{
+		Valid:            false,
+		KeywordLocation:  e.KeywordLocation,
+		InstanceLocation: e.InstanceLocation,
+		Error:            e.Description,
+	}
+}
+
+// basicOutput lists every validation error in a flat list.
+func basicOutput(errs []ErrorResponse) *OutputUnit {
+	out := &OutputUnit{Valid: len(errs) == 0}
+	for _, e := range errs {
+		out.Errors = append(out.Errors, errorUnit(e))
+	}
+	return out
+}
+
+// outputNode groups the errors produced under a schema location.
+type outputNode struct {
+	keywordLocation  string
+	instanceLocation string
+	errors           []OutputUnit
+	children         map[string]*outputNode
+}
+
+func (n *outputNode) child(keywordLocation, instanceLocation string) *outputNode {
+	c, ok := n.children[keywordLocation]
+	if !ok {
+		c = &outputNode{
+			keywordLocation:  keywordLocation,
+			instanceLocation: instanceLocation,
+			children:         map[string]*outputNode{},
+		}
+		n.children[keywordLocation] = c
+	}
+	return c
+}
+
+// unit converts the node into an output unit, collapsing nodes with a single error.
+func (n *outputNode) unit() OutputUnit {
+	u := OutputUnit{
+		Valid:            false,
+		KeywordLocation:  n.keywordLocation,
+		InstanceLocation: n.instanceLocation,
+		Errors:           n.errors,
+	}
+	keys := make([]string, 0, len(n.children))
+	for k := range n.children {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		u.Errors = append(u.Errors, n.children[k].unit())
+	}
+	if len(u.Errors) == 1 {
+		return u.Errors[0]
+	}
+	return u
+}
+
+// subschemaLocation is the location of a subschema together with the number of payload
+// levels it is nested in.
+type subschemaLocation struct {
+	keywordLocation string
+	depth           int
+}
+
+// subschemaLocations splits the keyword location of an error into the locations of the
+// subschemas that lead to it. E.g. /properties/a/items/type yields /properties/a and
+// /properties/a/items.
+func subschemaLocations(keywordLocation string) []subschemaLocation {
+	tokens := strings.Split(strings.TrimPrefix(keywordLocation, "/"), "/")
+	var locations []subschemaLocation
+	depth := 0
+	for i := 0; i < len(tokens)-1; i++ {
+		switch tokens[i] {
+		case "properties":
+			i++
+		case "items", "additionalProperties":
+		default:
+			return locations
+		}
+		if i >= len(tokens)-1 {
+			break
+		}
+		depth++
+		locations = append(locations, subschemaLocation{
+			keywordLocation: "/" + strings.Join(tokens[:i+1], "/"),
+			depth:           depth,
+		})
+	}
+	return locations
+}
+
+// detailedOutput nests the validation errors following the structure of the schema.
+func detailedOutput(errs []ErrorResponse) *OutputUnit {
+	if len(errs) == 0 {
+		return &OutputUnit{Valid: true}
+	}
+	root := &outputNode{children: map[string]*outputNode{}}
+	for _, e := range errs {
+		node := root
+		instance := strings.Split(e.InstanceLocation, "/")
+		for _, loc := range subschemaLocations(e.KeywordLocation) {
+			depth := loc.depth
+			if depth >= len(instance) {
+				depth = len(instance) - 1
+			}
+			node = node.child(loc.keywordLocation, strings.Join(instance[:depth+1], "/"))
+		}
+		node.errors = append(node.errors, errorUnit(e))
+	}
+	u := root.unit()
+	if u.KeywordLocation != "" || u.Error != "" {
+		// A single subschema collapsed into the root, keep the root as the container.
+		return &OutputUnit{Valid: false, Errors: []OutputUnit{u}}
+	}
+	return &u
+}
+
+// buildOutput formats the validation errors with the requested output format.
+func buildOutput(format string, errs []ErrorResponse) (*OutputUnit, error) {
+	switch format {
+	case "":
+		return nil, nil
+	case OutputFormatBasic:
+		return basicOutput(errs), nil
+	case OutputFormatDetailed:
+		return detailedOutput(errs), nil
+	}
+	return nil, fmt.Errorf("unknown output format: %s", format)
+}
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDetailedOutput(t *testing.T) {
+	errs := []ErrorResponse{
+		{Description: "age is required", KeywordLocation: "/required"},
+		{Description: "bad street", InstanceLocation: "/address/street", KeywordLocation: "/properties/address/properties/street/type"},
+		{Description: "bad zip", InstanceLocation: "/address/zip", KeywordLocation: "/properties/address/properties/zip/type"},
+		{Description: "bad tag", InstanceLocation: "/tags/3", KeywordLocation: "/properties/tags/items/type"},
+	}
+	want := &OutputUnit{
+		Valid: false,
+		Errors: []OutputUnit{
+			{KeywordLocation: "/required", Error: "age is required"},
+			{
+				KeywordLocation:  "/properties/address",
+				InstanceLocation: "/address",
+				Errors: []OutputUnit{
+					{KeywordLocation: "/properties/address/properties/street/type", InstanceLocation: "/address/street", Error: "bad street"},
+					{KeywordLocation: "/properties/address/properties/zip/type", InstanceLocation: "/address/zip", Error: "bad zip"},
+				},
+			},
+			{KeywordLocation: "/properties/tags/items/type", InstanceLocation: "/tags/3", Error: "bad tag"},
+		},
+	}
+	if diff := cmp.Diff(want, detailedOutput(errs)); diff != "" {
+		t.Errorf("detailedOutput() got a diff: %s", diff)
+	}
+
+	// A single nested error is still wrapped by the root unit.
+	want = &OutputUnit{
+		Valid: false,
+		Errors: []OutputUnit{
+			{KeywordLocation: "/properties/tags/items/type", InstanceLocation: "/tags/3", Error: "bad tag"},
+		},
+	}
+	if diff := cmp.Diff(want, detailedOutput(errs[3:])); diff != "" {
+		t.Errorf("detailedOutput() got a diff: %s", diff)
+	}
+}
+
+func TestBuildOutput(t *testing.T) {
+	out, err := buildOutput("", nil)
+	if out != nil || err != nil {
+		t.Errorf("expected no output, got %v %v", out, err)
+	}
+	out, err = buildOutput("basic", nil)
+	if err != nil || !out.Valid {
+		t.Errorf("expected a valid output, got %v %v", out, err)
+	}
+	if _, err := buildOutput("verbose", nil); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,237 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"movinglake.com/haven/wrappers"
+)
+
+// DefaultQuarantineLimit is the number of quarantined payloads kept per resource when
+// the resource does not define its own limit.
+const DefaultQuarantineLimit = 1000
+
+type QuarantinedPayloadResp struct {
+	ID        uint            `json:"id"`
+	Resource  uint            `json:"resource_id"`
+	Version   uint            `json:"version"`
+	Payload   interface{}     `json:"payload"`
+	Errors    []ErrorResponse `json:"errors"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type GetQuarantinedPayloadsResponse struct {
+	APIResponse
+	Payloads []QuarantinedPayloadResp `json:"payloads"`
+}
+
+type PurgeQuarantinedPayloadsRequest struct {
+	Resource string `json:"resource"`
+	// Before only purges payloads quarantined before this time. Zero purges all of them.
+	Before time.Time `json:"before"`
+}
+
+type PurgeQuarantinedPayloadsResponse struct {
+	APIResponse
+	Deleted int64 `json:"deleted"`
+}
+
+type SetQuarantineLimitRequest struct {
+	Resource string `json:"resource"`
+	Limit    uint   `json:"limit"`
+}
+
+type SetQuarantineLimitResponse struct {
+	APIResponse
+	Success bool `json:"success"`
+}
+
+// quarantinePayload stores an invalid payload and trims the quarantine of the resource
+// to its retention limit.
+func (h *HavenAPIHandler) quarantinePayload(res *wrappers.Resource, payload any, errs []ErrorResponse) error {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	errBytes, err := json.Marshal(errs)
+	if err != nil {
+		return fmt.Errorf("failed to marshal validation errors: %w", err)
+	}
+	limit := h.quarantineLimit
+	if res.QuarantineLimit != 0 {
+		limit = res.QuarantineLimit
+	}
+	return h.db.Transaction(func(t *gorm.DB) error {
+		qp := &wrappers.QuarantinedPayloads{
+			ResourceID: int(res.ID),
+			Version:    res.Version,
+			Payload:    string(payloadBytes),
+			Errors:     string(errBytes),
+		}
+		if err := h.db.Save(qp, t); err != nil {
+			return fmt.Errorf("failed to save quarantined payload: %w", err)
+		}
+		if err := h.db.TrimQuarantinedPayloads(res.ID, limit, t); err != nil {
+			return fmt.Errorf("failed to trim quarantined payloads: %w", err)
+		}
+		return nil
+	})
+}
+
+// parseQuarantineFilter builds a quarantine filter from the query string.
+func parseQuarantineFilter(c *gin.Context, resourceID uint) (wrappers.QuarantineFilter, error) {
+	filter := wrappers.QuarantineFilter{
+		ResourceID: resourceID,
+		ErrorType:  c.Query("error_type"),
+		Path:       c.Query("path"),
+		Contains:   c.Query("contains"),
+		Limit:      100,
+	}
+	var err error
+	if v := c.Query("since"); v != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, fmt.Errorf("failed to parse since: %w", err)
+		}
+	}
+	if v := c.Query("until"); v != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, fmt.Errorf("failed to parse until: %w", err)
+		}
+	}
+	if v := c.Query("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil {
+			return filter, fmt.Errorf("failed to parse limit: %w", err)
+		}
+	}
+	if v := c.Query("offset"); v != "" {
+		if filter.Offset, err = strconv.Atoi(v); err != nil {
+			return filter, fmt.Errorf("failed to parse offset: %w", err)
+		}
+	}
+	return filter, nil
+}
+
+// getQuarantinedPayloads lists the quarantined payloads of a resource, newest first.
+// It can be filtered by error type, error path, payload substring and time range.
+func (h *HavenAPIHandler) getQuarantinedPayloads(c *gin.Context) {
+	var response GetQuarantinedPayloadsResponse
+	res, err := h.db.GetResource(c.Params.ByName("name"), nil)
+	if err != nil {
+		response.Error = fmt.Sprintf("failed to get resource from db: %v", err)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+	if res == nil {
+		response.Error = fmt.Sprintf("resource not found: %s", c.Params.ByName("name"))
+		c.JSON(http.StatusNotFound, response)
+		return
+	}
+	filter, err := parseQuarantineFilter(c, res.ID)
+	if err != nil {
+		response.Error = err.Error()
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+	payloads, err := h.db.GetQuarantinedPayloads(filter)
+	if err != nil {
+		response.Error = fmt.Sprintf("failed to get quarantined payloads from db: %v", err)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+	response.Payloads = []QuarantinedPayloadResp{}
+	for _, qp := range payloads {
+		r := QuarantinedPayloadResp{
+			ID:        qp.ID,
+			Resource:  uint(qp.ResourceID),
+			Version:   qp.Version,
+			CreatedAt: qp.CreatedAt,
+		}
+		if err := json.Unmarshal([]byte(qp.Payload), &r.Payload); err != nil {
+			response.Error = fmt.Sprintf("failed to unmarshal quarantined payload: %v", err)
+			c.JSON(http.StatusInternalServerError, response)
+			return
+		}
+		if err := json.Unmarshal([]byte(qp.Errors), &r.Errors); err != nil {
+			response.Error = fmt.Sprintf("failed to unmarshal validation errors: %v", err)
+			c.JSON(http.StatusInternalServerError, response)
+			return
+		}
+		response.Payloads = append(response.Payloads, r)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// purgeQuarantinedPayloads deletes the quarantined payloads of a resource.
+func (h *HavenAPIHandler) purgeQuarantinedPayloads(c *gin.Context) {
+	var request PurgeQuarantinedPayloadsRequest
+	var response PurgeQuarantinedPayloadsResponse
+	if err := c.ShouldBindBodyWithJSON(&request); err != nil {
+		response.Error = fmt.Sprintf("failed to parse json request: %v", err)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+	res, err := h.db.GetResource(request.Resource, nil)
+	if err != nil {
+		response.Error = fmt.Sprintf("failed to get resource from db: %v", err)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+	if res == nil {
+		response.Error = fmt.Sprintf("resource not found: %s", request.Resource)
+		c.JSON(http.StatusNotFound, response)
+		return
+	}
+	deleted, err := h.db.PurgeQuarantinedPayloads(res.ID, request.Before)
+	if err != nil {
+		response.Error = fmt.Sprintf("failed to purge quarantined payloads: %v", err)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+	response.Deleted = deleted
+	c.JSON(http.StatusOK, response)
+}
+
+// setQuarantineLimit sets how many quarantined payloads are kept for a resource.
+func (h *HavenAPIHandler) setQuarantineLimit(c *gin.Context) {
+	var request SetQuarantineLimitRequest
+	var response SetQuarantineLimitResponse
+	if err := c.ShouldBindBodyWithJSON(&request); err != nil {
+		response.Error = fmt.Sprintf("failed to parse json request: %v", err)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+	res, err := h.db.GetResource(request.Resource, nil)
+	if err != nil {
+		response.Error = fmt.Sprintf("failed to get resource from db: %v", err)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+	if res == nil {
+		response.Error = fmt.Sprintf("resource not found: %s", request.Resource)
+		c.JSON(http.StatusNotFound, response)
+		return
+	}
+	res.QuarantineLimit = request.Limit
+	keep := request.Limit
+	if keep == 0 {
+		keep = h.quarantineLimit
+	}
+	err = h.db.Transaction(func(t *gorm.DB) error {
+		if err := h.db.Save(res, t); err != nil {
+			return err
+		}
+		return h.db.TrimQuarantinedPayloads(res.ID, keep, t)
+	})
+	if err != nil {
+		response.Error = fmt.Sprintf("failed to save quarantine limit: %v", err)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+	response.Success = true
+	c.JSON(http.StatusOK, response)
+}
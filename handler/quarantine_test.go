@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"movinglake.com/haven/wrappers"
+)
+
+const usersSchema = "{\"$id\":\"https://movinglake.com/haven.schema.json\",\"$schema\":\"https://json-schema.org/draft/2020-12/schema\",\"additionalProperties\":false,\"properties\":{\"age\":{\"type\":\"number\"},\"name\":{\"type\":\"string\"}},\"required\":[\"age\",\"name\"],\"title\":\"users\",\"type\":\"object\"}"
+
+func postJSON(router *gin.Engine, path string, body any) *httptest.ResponseRecorder {
+	out, _ := json.Marshal(body)
+	request := httptest.NewRequest(http.MethodPost, path, bytes.NewBuffer(out))
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	return response
+}
+
+func TestQuarantine(t *testing.T) {
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	handler := NewHavenAPIHandler(db, nil)
+	router := gin.Default()
+	gin.SetMode(gin.TestMode)
+	handler.RegisterRoutes(router)
+
+	db.Save(&wrappers.Resource{
+		Model:   gorm.Model{ID: 1},
+		Name:    "users",
+		Schema:  usersSchema,
+		Version: 1,
+	}, nil)
+
+	// Valid payloads and failures without the flag are not recorded.
+	postJSON(router, "/api/v1/validate_payload", ValidatePayloadRequest{
+		Resource:       "users",
+		Payload:        map[string]any{"name": "Juan", "age": 35},
+		RecordFailures: true,
+	})
+	postJSON(router, "/api/v1/validate_payload", ValidatePayloadRequest{
+		Resource: "users",
+		Payload:  map[string]any{"narnia": "ok", "name": "Juan", "age": 35},
+	})
+	assert.Equal(t, 0, len(db.Quarantine))
+
+	for _, p := range []map[string]any{
+		{"narnia": "ok", "name": "Juan", "age": 35},
+		{"name": "Juan"},
+		{"name": "Ana", "age": "old"},
+	} {
+		response := postJSON(router, "/api/v1/validate_payload", ValidatePayloadRequest{
+			Resource:       "users",
+			Payload:        p,
+			RecordFailures: true,
+		})
+		assert.Equal(t, http.StatusOK, response.Code)
+	}
+	assert.Equal(t, 3, len(db.Quarantine))
+
+	// List everything, newest first.
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/api/v1/get_quarantined_payloads/users", nil))
+	assert.Equal(t, http.StatusOK, response.Code)
+	var resp GetQuarantinedPayloadsResponse
+	json.Unmarshal(response.Body.Bytes(), &resp)
+	assert.Equal(t, 3, len(resp.Payloads))
+	assert.Equal(t, uint(3), resp.Payloads[0].ID)
+	assert.Equal(t, uint(1), resp.Payloads[0].Version)
+	assert.Equal(t, "invalid_type", resp.Payloads[0].Errors[0].Type)
+	assert.Contains(t, response.Body.String(), `"instance_location":"/age"`)
+	assert.Equal(t, "/properties/age/type", resp.Payloads[0].Errors[0].KeywordLocation)
+
+	// Search by error type.
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/api/v1/get_quarantined_payloads/users?error_type=required", nil))
+	resp = GetQuarantinedPayloadsResponse{}
+	json.Unmarshal(response.Body.Bytes(), &resp)
+	assert.Equal(t, 1, len(resp.Payloads))
+	assert.Equal(t, map[string]any{"name": "Juan"}, resp.Payloads[0].Payload)
+
+	// Bad filters and unknown resources.
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/api/v1/get_quarantined_payloads/users?since=yesterday", nil))
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/api/v1/get_quarantined_payloads/pets", nil))
+	assert.Equal(t, http.StatusNotFound, response.Code)
+
+	// Lowering the limit trims the oldest payloads.
+	response = postJSON(router, "/api/v1/set_quarantine_limit", SetQuarantineLimitRequest{Resource: "users", Limit: 2})
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, 2, len(db.Quarantine))
+	_, ok := db.Quarantine[1]
+	assert.False(t, ok)
+	assert.Equal(t, uint(2), db.Resource["users"].QuarantineLimit)
+
+	// New failures respect the limit.
+	postJSON(router, "/api/v1/validate_payload", ValidatePayloadRequest{
+		Resource:       "users",
+		Payload:        map[string]any{},
+		RecordFailures: true,
+	})
+	assert.Equal(t, 2, len(db.Quarantine))
+
+	response = postJSON(router, "/api/v1/purge_quarantined_payloads", PurgeQuarantinedPayloadsRequest{Resource: "users"})
+	assert.Equal(t, http.StatusOK, response.Code)
+	var purgeResp PurgeQuarantinedPayloadsResponse
+	json.Unmarshal(response.Body.Bytes(), &purgeResp)
+	assert.Equal(t, int64(2), purgeResp.Deleted)
+	assert.Equal(t, 0, len(db.Quarantine))
+
+	response = postJSON(router, "/api/v1/purge_quarantined_payloads", PurgeQuarantinedPayloadsRequest{Resource: "pets"})
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	response = postJSON(router, "/api/v1/set_quarantine_limit", SetQuarantineLimitRequest{Resource: "pets"})
+	assert.Equal(t, http.StatusNotFound, response.Code)
+}
+
+func TestQuarantineDBErrors(t *testing.T) {
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	handler := NewHavenAPIHandler(db, nil)
+	router := gin.Default()
+	gin.SetMode(gin.TestMode)
+	handler.RegisterRoutes(router)
+
+	db.Save(&wrappers.Resource{
+		Model:   gorm.Model{ID: 1},
+		Name:    "users",
+		Schema:  usersSchema,
+		Version: 1,
+	}, nil)
+
+	db.Errors = map[string]error{"TrimQuarantinedPayloads": gorm.ErrInvalidDB}
+	response := postJSON(router, "/api/v1/validate_payload", ValidatePayloadRequest{
+		Resource:       "users",
+		Payload:        map[string]any{},
+		RecordFailures: true,
+	})
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+	response = postJSON(router, "/api/v1/set_quarantine_limit", SetQuarantineLimitRequest{Resource: "users", Limit: 1})
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+
+	db.Errors = map[string]error{
+		"GetQuarantinedPayloads":   gorm.ErrInvalidDB,
+		"PurgeQuarantinedPayloads": gorm.ErrInvalidDB,
+	}
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/api/v1/get_quarantined_payloads/users", nil))
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+	response = postJSON(router, "/api/v1/purge_quarantined_payloads", PurgeQuarantinedPayloadsRequest{Resource: "users"})
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+}
@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"movinglake.com/haven/wrappers"
+)
+
+type NotificationRoute struct {
+	ID uint `json:"id"`
+	// Resource is a glob matching resource names, or a regular expression if Regex is set.
+	// Empty matches all resources.
+	Resource string `json:"resource"`
+	Regex    bool   `json:"regex"`
+	// EventType and Severity restrict the route, empty matches any.
+	EventType string `json:"event_type"`
+	Severity  string `json:"severity"`
+	Sender    string `json:"sender"`
+	// Channel overrides the destination of the sender, e.g. a Slack channel ID or comma
+	// separated email recipients.
+	Channel string `json:"channel"`
+	// Digest is the window new versions are batched over, e.g. 1h. Empty sends them right
+	// away.
+	Digest    string    `json:"digest"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type GetNotificationRoutesResponse struct {
+	APIResponse
+	Routes []NotificationRoute `json:"routes"`
+}
+
+// SetNotificationRouteRequest creates a route, or replaces the route with the ID if set.
+type SetNotificationRouteRequest struct {
+	ID        uint   `json:"id"`
+	Resource  string `json:"resource"`
+	Regex     bool   `json:"regex"`
+	EventType string `json:"event_type"`
+	Severity  string `json:"severity"`
+	Sender    string `json:"sender"`
+	Channel   string `json:"channel"`
+	Digest    string `json:"digest"`
+}
+
+type SetNotificationRouteResponse struct {
+	APIResponse
+	Route NotificationRoute `json:"route"`
+}
+
+type DeleteNotificationRouteRequest struct {
+	ID uint `json:"id"`
+}
+
+type DeleteNotificationRouteResponse struct {
+	APIResponse
+	Deleted int64 `json:"deleted"`
+}
+
+func newNotificationRoute(r wrappers.NotificationRoutes) NotificationRoute {
+	route := NotificationRoute{
+		ID:        r.ID,
+		Resource:  r.Resource,
+		Regex:     r.Regex,
+		EventType: r.EventType,
+		Severity:  r.Severity,
+		Sender:    r.Sender,
+		Channel:   r.Channel,
+		CreatedAt: r.CreatedAt,
+		UpdatedAt: r.UpdatedAt,
+	}
+	if r.Digest > 0 {
+		route.Digest = r.Digest.String()
+	}
+	return route
+}
+
+// routeDigest parses the digest window of a route, zero if there is none.
+func routeDigest(digest string) (time.Duration, error) {
+	if digest == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(digest)
+	if err != nil {
+		return 0, newAPIError(http.StatusBadRequest, "failed to parse digest: %v", err)
+	}
+	if d < time.Minute {
+		return 0, newAPIError(http.StatusBadRequest, "digest must be at least 1m")
+	}
+	return d, nil
+}
+
+// validateRoute checks the pattern, event type, severity and digest of a route and that its
+// sender is configured.
+func (h *HavenAPIHandler) validateRoute(r SetNotificationRouteRequest) error {
+	if _, err := resourcePattern(r.Resource, r.Regex); err != nil {
+		return newAPIError(http.StatusBadRequest, "invalid resource pattern %q: %v", r.Resource, err)
+	}
+	if r.EventType != "" && !eventTypes[r.EventType] {
+		return newAPIError(http.StatusBadRequest, "unknown event type %q", r.EventType)
+	}
+	if r.Severity != "" && !severities[r.Severity] {
+		return newAPIError(http.StatusBadRequest, "unknown severity %q", r.Severity)
+	}
+	if _, err := routeDigest(r.Digest); err != nil {
+		return err
+	}
+	configured := false
+	for _, name := range h.notifier.Names() {
+		configured = configured || name == r.Sender
+	}
+	if !configured {
+		return newAPIError(http.StatusBadRequest, "sender %q is not configured, configured senders: %v", r.Sender, h.notifier.Names())
+	}
+	if r.Channel != "" && !h.notifier.SupportsChannels(r.Sender) {
+		return newAPIError(http.StatusBadRequest, "sender %s does not support channels", r.Sender)
+	}
+	return nil
+}
+
+// SetNotificationRoute creates or replaces a notification route.
+func (h *HavenAPIHandler) SetNotificationRoute(request SetNotificationRouteRequest) (*wrappers.NotificationRoutes, error) {
+	if err := h.validateRoute(request); err != nil {
+		return nil, err
+	}
+	route := &wrappers.NotificationRoutes{}
+	if request.ID != 0 {
+		existing, err := h.db.GetNotificationRoute(request.ID)
+		if err != nil {
+			return nil, newAPIError(http.StatusInternalServerError, "failed to get notification route from db: %v", err)
+		}
+		if existing == nil {
+			return nil, newAPIError(http.StatusNotFound, "notification route not found: %d", request.ID)
+		}
+		route = existing
+	}
+	route.Resource = request.Resource
+	route.Regex = request.Regex
+	route.EventType = request.EventType
+	route.Severity = request.Severity
+	route.Sender = request.Sender
+	route.Channel = request.Channel
+	route.Digest, _ = routeDigest(request.Digest)
+	if err := h.db.Save(route, nil); err != nil {
+		return nil, newAPIError(http.StatusInternalServerError, "failed to save notification route: %v", err)
+	}
+	return route, nil
+}
+
+// getNotificationRoutes lists the notification routes.
+func (h *HavenAPIHandler) getNotificationRoutes(c *gin.Context) {
+	var response GetNotificationRoutesResponse
+	routes, err := h.db.GetNotificationRoutes()
+	if err != nil {
+		response.Error = fmt.Sprintf("failed to get notification routes from db: %v", err)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+	response.Routes = make([]NotificationRoute, len(routes))
+	for i, r := range routes {
+		response.Routes[i] = newNotificationRoute(r)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// setNotificationRoute creates or replaces a notification route.
+func (h *HavenAPIHandler) setNotificationRoute(c *gin.Context) {
+	var request SetNotificationRouteRequest
+	var response SetNotificationRouteResponse
+	if err := c.ShouldBindBodyWithJSON(&request); err != nil {
+		response.Error = fmt.Sprintf("failed to parse json request: %v", err)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+	route, err := h.SetNotificationRoute(request)
+	if err != nil {
+		response.Error = err.Error()
+		c.JSON(statusCode(err), response)
+		return
+	}
+	response.Route = newNotificationRoute(*route)
+	c.JSON(http.StatusOK, response)
+}
+
+// deleteNotificationRoute deletes a notification route.
+func (h *HavenAPIHandler) deleteNotificationRoute(c *gin.Context) {
+	var request DeleteNotificationRouteRequest
+	var response DeleteNotificationRouteResponse
+	if err := c.ShouldBindBodyWithJSON(&request); err != nil {
+		response.Error = fmt.Sprintf("failed to parse json request: %v", err)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+	deleted, err := h.db.DeleteNotificationRoute(request.ID)
+	if err != nil {
+		response.Error = fmt.Sprintf("failed to delete notification route: %v", err)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+	if deleted == 0 {
+		response.Error = fmt.Sprintf("notification route not found: %d", request.ID)
+		c.JSON(http.StatusNotFound, response)
+		return
+	}
+	response.Deleted = deleted
+	c.JSON(http.StatusOK, response)
+}
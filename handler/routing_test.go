@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"movinglake.com/haven/handler/notifications"
+	"movinglake.com/haven/telemetry"
+	"movinglake.com/haven/wrappers"
+)
+
+type recordingSender struct {
+	messages []string
+	channels []string
+}
+
+func (s *recordingSender) SendMessage(message string) error {
+	return s.SendMessageTo("", message)
+}
+
+func (s *recordingSender) SendMessageTo(channel, message string) error {
+	s.channels = append(s.channels, channel)
+	s.messages = append(s.messages, message)
+	return nil
+}
+
+func (s *recordingSender) IsActive() bool {
+	return true
+}
+
+// deliver delivers the notifications of the outbox.
+func deliver(handler *HavenAPIHandler) {
+	handler.DeliverNotifications(DefaultOutboxConfig, time.Now())
+}
+
+func TestRouteMatches(t *testing.T) {
+	n := notifications.Notification{Resource: "shop.com/api/v1/orders", Event: notifications.EventVersionAdded, Severity: notifications.SeverityBreaking}
+	cases := []struct {
+		route wrappers.NotificationRoutes
+		want  bool
+	}{
+		{wrappers.NotificationRoutes{}, true},
+		{wrappers.NotificationRoutes{Resource: "shop.com/*"}, true},
+		{wrappers.NotificationRoutes{Resource: "shop.com/api/v?/orders"}, true},
+		{wrappers.NotificationRoutes{Resource: "shop.com"}, false},
+		{wrappers.NotificationRoutes{Resource: "orders$", Regex: true}, true},
+		{wrappers.NotificationRoutes{Resource: "^orders", Regex: true}, false},
+		{wrappers.NotificationRoutes{Resource: "(", Regex: true}, false},
+		{wrappers.NotificationRoutes{EventType: notifications.EventVersionAdded, Severity: notifications.SeverityBreaking}, true},
+		{wrappers.NotificationRoutes{Severity: notifications.SeverityCompatible}, false},
+		{wrappers.NotificationRoutes{EventType: "other"}, false},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.want, routeMatches(tc.route, n), "%+v", tc.route)
+	}
+}
+
+func TestVersionSeverity(t *testing.T) {
+	oldSchema := `{"type":"object","properties":{"id":{"type":"integer"}},"required":["id"]}`
+	assert.Equal(t, notifications.SeverityCompatible, versionSeverity(VersionEvent{NewSchema: oldSchema}))
+	assert.Equal(t, notifications.SeverityCompatible, versionSeverity(VersionEvent{
+		OldSchema: oldSchema,
+		NewSchema: `{"type":"object","properties":{"id":{"type":["integer","string"]}},"required":["id"]}`,
+	}))
+	assert.Equal(t, notifications.SeverityBreaking, versionSeverity(VersionEvent{
+		OldSchema: oldSchema,
+		NewSchema: `{"type":"object","properties":{"id":{"type":"integer"},"total":{"type":"number"}},"required":["id","total"]}`,
+	}))
+}
+
+func TestNotificationRoutes(t *testing.T) {
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	handler := NewHavenAPIHandler(db, nil)
+	slack := &recordingSender{}
+	webhook := &fakeSlackSender{}
+	handler.notifier.Register(notifications.SenderSlack, slack)
+	handler.notifier.Register(notifications.SenderWebhook, webhook)
+	router := gin.Default()
+	handler.RegisterRoutes(router)
+
+	for _, tc := range []struct {
+		request  SetNotificationRouteRequest
+		wantCode int
+	}{
+		{SetNotificationRouteRequest{Resource: "(", Regex: true, Sender: notifications.SenderSlack}, http.StatusBadRequest},
+		{SetNotificationRouteRequest{EventType: "deleted", Sender: notifications.SenderSlack}, http.StatusBadRequest},
+		{SetNotificationRouteRequest{Severity: "minor", Sender: notifications.SenderSlack}, http.StatusBadRequest},
+		{SetNotificationRouteRequest{Sender: notifications.SenderEmail}, http.StatusBadRequest},
+		{SetNotificationRouteRequest{Sender: notifications.SenderWebhook, Channel: "C1"}, http.StatusBadRequest},
+		{SetNotificationRouteRequest{ID: 42, Sender: notifications.SenderSlack}, http.StatusNotFound},
+	} {
+		response := postJSON(router, "/api/v1/set_notification_route", tc.request)
+		assert.Equal(t, tc.wantCode, response.Code, "%+v: %s", tc.request, response.Body)
+	}
+
+	// Breaking changes of orders go to the orders channel, anything about users to the webhook.
+	response := postJSON(router, "/api/v1/set_notification_route", SetNotificationRouteRequest{
+		Resource: "orders*", Severity: notifications.SeverityCompatible, Sender: notifications.SenderSlack, Channel: "C-orders",
+	})
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	var set SetNotificationRouteResponse
+	assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &set))
+	response = postJSON(router, "/api/v1/set_notification_route", SetNotificationRouteRequest{
+		ID: set.Route.ID, Resource: set.Route.Resource, Severity: notifications.SeverityBreaking, Sender: set.Route.Sender, Channel: set.Route.Channel,
+	})
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	response = postJSON(router, "/api/v1/set_notification_route", SetNotificationRouteRequest{
+		Resource: "users", Sender: notifications.SenderWebhook,
+	})
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+
+	request := httptest.NewRequest(http.MethodGet, "/api/v1/get_notification_routes", nil)
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	var routes GetNotificationRoutesResponse
+	assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &routes))
+	assert.Equal(t, 2, len(routes.Routes))
+	assert.Equal(t, notifications.SeverityBreaking, routes.Routes[0].Severity)
+	assert.Equal(t, "C-orders", routes.Routes[0].Channel)
+
+	// The first version of orders is compatible and matches no route, so it is dropped.
+	unrouted := testutil.ToFloat64(telemetry.UnroutedNotifications.WithLabelValues(notifications.EventVersionAdded))
+	response = postJSON(router, "/api/v1/add_payload", AddPayloadRequest{Resource: "orders", Payload: map[string]any{"id": 1}})
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	deliver(handler)
+	assert.Empty(t, slack.messages)
+	assert.Equal(t, unrouted+1, testutil.ToFloat64(telemetry.UnroutedNotifications.WithLabelValues(notifications.EventVersionAdded)))
+
+	// Breaking changes of orders go to the orders channel.
+	targets := handler.notificationTargets(notifications.Notification{Resource: "orders", Event: notifications.EventVersionAdded, Severity: notifications.SeverityBreaking})
+	assert.Equal(t, []notificationTarget{{sender: notifications.SenderSlack, channel: "C-orders"}}, targets)
+
+	response = postJSON(router, "/api/v1/add_payload", AddPayloadRequest{Resource: "users", Payload: map[string]any{"name": "Ann"}})
+	assert.Equal(t, http.StatusOK, response.Code)
+	deliver(handler)
+	assert.Empty(t, slack.messages)
+
+	response = postJSON(router, "/api/v1/delete_notification_route", DeleteNotificationRouteRequest{ID: set.Route.ID})
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	response = postJSON(router, "/api/v1/delete_notification_route", DeleteNotificationRouteRequest{ID: set.Route.ID})
+	assert.Equal(t, http.StatusNotFound, response.Code)
+
+	// Without routes every sender gets notified, also when the routes can't be read.
+	delete(db.Routes, 2)
+	db.Errors["GetNotificationRoutes"] = errors.New("db down")
+	response = postJSON(router, "/api/v1/add_payload", AddPayloadRequest{Resource: "users", Payload: map[string]any{"name": "Ann", "age": 30}})
+	assert.Equal(t, http.StatusOK, response.Code)
+	deliver(handler)
+	assert.Equal(t, 1, len(slack.messages))
+	assert.Equal(t, "", slack.channels[0])
+
+	// Schemas set through the API don't notify.
+	response = postJSON(router, "/api/v1/set_schema", SetSchemaRequest{Resource: "pets", Schema: map[string]any{"type": "object"}})
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	deliver(handler)
+	assert.Equal(t, 1, len(slack.messages))
+}
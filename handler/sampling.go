@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/andres-movl/gojsonschema"
+	"github.com/gin-gonic/gin"
+	"movinglake.com/haven/handler/jsonutils"
+	"movinglake.com/haven/wrappers"
+)
+
+// maxStreamFailures caps the number of failures returned by validateStream.
+const maxStreamFailures = 100
+
+type SetSamplingRequest struct {
+	Resource string `json:"resource"`
+	// Rate is the fraction of streamed payloads to validate, in (0, 1]. Zero validates all of them.
+	Rate float64 `json:"rate"`
+	// KeyPath is the dot separated path of the field hashed to sample payloads, e.g. "user.id".
+	KeyPath string `json:"key_path"`
+}
+
+type SetSamplingResponse struct {
+	APIResponse
+	Success bool `json:"success"`
+}
+
+type StreamFailure struct {
+	// Index is the position of the payload in the stream, starting at 0.
+	Index            uint            `json:"index"`
+	ValidationErrors []ErrorResponse `json:"validation_errors"`
+}
+
+type ValidateStreamResponse struct {
+	APIResponse
+	Received   uint    `json:"received"`
+	Sampled    uint    `json:"sampled"`
+	Invalid    uint    `json:"invalid"`
+	SampleRate float64 `json:"sample_rate"`
+	// ErrorRate is the fraction of sampled payloads that failed validation.
+	ErrorRate float64 `json:"error_rate"`
+	// EstimatedInvalid extrapolates the error rate to all the received payloads.
+	EstimatedInvalid float64         `json:"estimated_invalid"`
+	Failures         []StreamFailure `json:"failures"`
+}
+
+// isSampled decides whether a payload gets validated. The decision hashes the value at
+// keyPath (or the whole payload if there is no such value) so that the same payload or key
+// is always sampled the same way.
+func isSampled(payload any, keyPath string, rate float64) bool {
+	if rate <= 0 || rate >= 1 {
+		return true
+	}
+	key := payload
+	if keyPath != "" {
+		if v, ok := jsonutils.ValueAtPath(payload, keyPath); ok {
+			key = v
+		}
+	}
+	b, err := json.Marshal(key)
+	if err != nil {
+		return true
+	}
+	h := fnv.New64a()
+	h.Write(b)
+	return float64(h.Sum64())/math.MaxUint64 < rate
+}
+
+// setSampling sets the sample rate and key path used when streaming payloads of a resource.
+func (h *HavenAPIHandler) setSampling(c *gin.Context) {
+	var request SetSamplingRequest
+	var response SetSamplingResponse
+	if err := c.ShouldBindBodyWithJSON(&request); err != nil {
+		response.Error = fmt.Sprintf("failed to parse json request: %v", err)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+	if request.Rate < 0 || request.Rate > 1 {
+		response.Error = fmt.Sprintf("sample rate must be between 0 and 1, got %v", request.Rate)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+	res, err := h.db.GetResource(request.Resource, nil)
+	if err != nil {
+		response.Error = fmt.Sprintf("failed to get resource from db: %v", err)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+	if res == nil {
+		response.Error = fmt.Sprintf("resource not found: %s", request.Resource)
+		c.JSON(http.StatusNotFound, response)
+		return
+	}
+	res.SampleRate = request.Rate
+	res.SampleKeyPath = request.KeyPath
+	if err := h.db.Save(res, nil); err != nil {
+		response.Error = fmt.Sprintf("failed to save resource: %v", err)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+	response.Success = true
+	c.JSON(http.StatusOK, response)
+}
+
+// validateStream validates a stream of newline delimited JSON payloads. Only the sample of
+// payloads selected by the resource's sample rate gets validated, but every payload is counted.
+func (h *HavenAPIHandler) validateStream(c *gin.Context) {
+	var response ValidateStreamResponse
+	recordFailures := c.Query("record_failures") == "true"
+	res, err := h.db.GetResource(c.Params.ByName("name"), nil)
+	if err != nil {
+		response.Error = fmt.Sprintf("failed to get resource from db: %v", err)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+	if res == nil {
+		response.Error = fmt.Sprintf("resource not found: %s", c.Params.ByName("name"))
+		c.JSON(http.StatusNotFound, response)
+		return
+	}
+	schema := make(map[string]any)
+	if err := json.Unmarshal([]byte(res.Schema), &schema); err != nil {
+		response.Error = fmt.Sprintf("failed to unmarshal schema: %v", err)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+	goSchema, err := jsonutils.CompileSchema(schema)
+	if err != nil {
+		response.Error = fmt.Sprintf("failed to compile schema: %v", err)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	response.SampleRate = res.SampleRate
+	if response.SampleRate == 0 {
+		response.SampleRate = 1
+	}
+	inc := wrappers.ValidationIncrement{
+		ResourceID: res.ID,
+		Version:    res.Version,
+		At:         time.Now(),
+	}
+	// Count whatever was processed even if the stream breaks midway.
+	defer func() {
+		h.recordValidations(res, inc)
+	}()
+	response.Failures = []StreamFailure{}
+	dec := json.NewDecoder(c.Request.Body)
+	for {
+		var payload any
+		if err := dec.Decode(&payload); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			response.Error = fmt.Sprintf("failed to parse payload %d: %v", response.Received, err)
+			c.JSON(http.StatusBadRequest, response)
+			return
+		}
+		response.Received++
+		if !isSampled(payload, res.SampleKeyPath, res.SampleRate) {
+			inc.Received++
+			continue
+		}
+		result, err := goSchema.Validate(gojsonschema.NewGoLoader(payload))
+		if err != nil {
+			response.Error = fmt.Sprintf("failed to validate payload %d: %v", response.Received-1, err)
+			c.JSON(http.StatusInternalServerError, response)
+			return
+		}
+		response.Sampled++
+		var errs []ErrorResponse
+		if !result.Valid() {
+			errs = ToErrorResponses(schema, result)
+			response.Invalid++
+			if len(response.Failures) < maxStreamFailures {
+				response.Failures = append(response.Failures, StreamFailure{
+					Index:            response.Received - 1,
+					ValidationErrors: errs,
+				})
+			}
+			if recordFailures {
+				if err := h.quarantinePayload(res, payload, errs); err != nil {
+					response.Error = fmt.Sprintf("failed to record invalid payload: %v", err)
+					c.JSON(http.StatusInternalServerError, response)
+					return
+				}
+			}
+		}
+		addValidation(&inc, errs)
+	}
+	response.ErrorRate = errorRate(response.Sampled, response.Invalid)
+	response.EstimatedInvalid = response.ErrorRate * float64(response.Received)
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"movinglake.com/haven/wrappers"
+)
+
+func TestIsSampled(t *testing.T) {
+	assert.True(t, isSampled(map[string]any{}, "", 0))
+	assert.True(t, isSampled(map[string]any{}, "", 1))
+
+	// The decision only depends on the key.
+	a := map[string]any{"id": 7, "name": "a"}
+	b := map[string]any{"id": 7, "name": "b"}
+	for _, rate := range []float64{0.1, 0.5, 0.9} {
+		assert.Equal(t, isSampled(a, "id", rate), isSampled(b, "id", rate))
+	}
+
+	// The sampled fraction approaches the rate.
+	sampled := 0
+	for i := 0; i < 10000; i++ {
+		if isSampled(map[string]any{"id": i}, "id", 0.25) {
+			sampled++
+		}
+	}
+	assert.InDelta(t, 2500, sampled, 250)
+}
+
+func TestValidateStream(t *testing.T) {
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	handler := NewHavenAPIHandler(db, nil)
+	router := gin.Default()
+	gin.SetMode(gin.TestMode)
+	handler.RegisterRoutes(router)
+
+	db.Save(&wrappers.Resource{
+		Model:   gorm.Model{ID: 1},
+		Name:    "users",
+		Schema:  usersSchema,
+		Version: 1,
+	}, nil)
+
+	var stream strings.Builder
+	for i := 0; i < 1000; i++ {
+		p := map[string]any{"name": fmt.Sprintf("user%d", i), "age": i}
+		if i%4 == 0 {
+			delete(p, "age")
+		}
+		out, _ := json.Marshal(p)
+		stream.Write(out)
+		stream.WriteString("\n")
+	}
+
+	streamRequest := func(path string) (*httptest.ResponseRecorder, ValidateStreamResponse) {
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(stream.String())))
+		var resp ValidateStreamResponse
+		json.Unmarshal(response.Body.Bytes(), &resp)
+		return response, resp
+	}
+
+	// Without sampling everything is validated.
+	response, resp := streamRequest("/api/v1/validate_stream/users")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, uint(1000), resp.Received)
+	assert.Equal(t, uint(1000), resp.Sampled)
+	assert.Equal(t, uint(250), resp.Invalid)
+	assert.Equal(t, 0.25, resp.ErrorRate)
+	assert.Equal(t, maxStreamFailures, len(resp.Failures))
+	assert.Equal(t, uint(0), resp.Failures[0].Index)
+	assert.Equal(t, uint(4), resp.Failures[1].Index)
+
+	response = postJSON(router, "/api/v1/set_sampling", SetSamplingRequest{Resource: "users", Rate: 0.2, KeyPath: "name"})
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, 0.2, db.Resource["users"].SampleRate)
+
+	response, resp = streamRequest("/api/v1/validate_stream/users?record_failures=true")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, uint(1000), resp.Received)
+	assert.InDelta(t, 200, resp.Sampled, 50)
+	assert.InDelta(t, 0.25, resp.ErrorRate, 0.1)
+	assert.InDelta(t, 250, resp.EstimatedInvalid, 100)
+	assert.Equal(t, int(resp.Invalid), len(db.Quarantine))
+
+	// Sampling is deterministic.
+	_, again := streamRequest("/api/v1/validate_stream/users")
+	assert.Equal(t, resp.Sampled, again.Sampled)
+	assert.Equal(t, resp.Invalid, again.Invalid)
+
+	// Totals include the payloads skipped by sampling.
+	var received, total uint
+	for _, c := range db.ValidationCounts {
+		if c.Granularity == wrappers.GranularityHour {
+			received += c.Received
+			total += c.Total
+		}
+	}
+	assert.Equal(t, uint(3000), received)
+	assert.Equal(t, 1000+2*resp.Sampled, total)
+
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodPost, "/api/v1/validate_stream/users", bytes.NewBufferString("{\"name\": \"a\"}\n{bad")))
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodPost, "/api/v1/validate_stream/pets", bytes.NewBufferString("{}")))
+	assert.Equal(t, http.StatusNotFound, response.Code)
+
+	response = postJSON(router, "/api/v1/set_sampling", SetSamplingRequest{Resource: "users", Rate: 2})
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	response = postJSON(router, "/api/v1/set_sampling", SetSamplingRequest{Resource: "pets", Rate: 0.5})
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	db.Errors = map[string]error{"Save": gorm.ErrInvalidDB}
+	response = postJSON(router, "/api/v1/set_sampling", SetSamplingRequest{Resource: "users", Rate: 0.5})
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+}
@@ -0,0 +1,142 @@
+package schemaconv
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// avroName matches the names of Avro records and fields.
+var avroName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+type avroGenerator struct {
+	names names
+}
+
+// avroJSONDoc documents the fields holding values Avro can not type.
+const avroJSONDoc = "JSON encoded, Avro can not type the values."
+
+// typeOf returns the Avro type of the node at path and whether it, or its items, are values
+// Avro can not type encoded as JSON strings. name is the name of the record if the node is an
+// object with properties.
+func (g *avroGenerator) typeOf(n *Node, name, path string) (any, bool, error) {
+	if n.Any() {
+		return "string", true, nil
+	}
+	var union []any
+	encoded := false
+	// add adds a branch to the union, unions can not have two branches of the same type.
+	add := func(typ any) {
+		for _, t := range union {
+			if s, ok := t.(string); ok && s == typ {
+				return
+			}
+		}
+		union = append(union, typ)
+	}
+	if n.Nullable {
+		// null goes first so it can be the default of optional fields.
+		add("null")
+	}
+	for _, typ := range n.Types {
+		switch typ {
+		case TypeString:
+			add("string")
+		case TypeNumber:
+			add("double")
+		case TypeInteger:
+			add("long")
+		case TypeBoolean:
+			add("boolean")
+		case TypeArray:
+			items := any("string")
+			itemsEncoded := true
+			if n.Items != nil {
+				var err error
+				items, itemsEncoded, err = g.typeOf(n.Items, name+"Item", path+"/items")
+				if err != nil {
+					return nil, false, err
+				}
+			}
+			encoded = encoded || itemsEncoded
+			add(map[string]any{"type": "array", "items": items})
+		case TypeObject:
+			if len(n.Properties) == 0 {
+				encoded = true
+				add("string")
+				continue
+			}
+			record, err := g.record(n, name, path)
+			if err != nil {
+				return nil, false, err
+			}
+			add(record)
+		}
+	}
+	if len(union) == 1 {
+		return union[0], encoded, nil
+	}
+	return union, encoded, nil
+}
+
+// record returns the Avro record of an object node.
+func (g *avroGenerator) record(n *Node, name, path string) (map[string]any, error) {
+	if !avroName.MatchString(name) {
+		return nil, errorf(path, "%q is not a valid Avro record name", name)
+	}
+	fields := make([]any, 0, len(n.Properties))
+	for _, p := range n.Properties {
+		propPath := path + "/properties/" + escapePointer(p.Name)
+		if !avroName.MatchString(p.Name) {
+			return nil, errorf(propPath, "%q is not a valid Avro field name", p.Name)
+		}
+		typ, encoded, err := g.typeOf(p.Node, name+Identifier(p.Name), propPath)
+		if err != nil {
+			return nil, err
+		}
+		field := map[string]any{"name": p.Name, "type": typ}
+		if encoded {
+			field["doc"] = avroJSONDoc
+		}
+		if !p.Required {
+			// Avro has no optional fields, missing values are null by default.
+			if flatten(typ)[0] != "null" {
+				field["type"] = append([]any{"null"}, flatten(typ)...)
+			}
+			field["default"] = nil
+		}
+		fields = append(fields, field)
+	}
+	return map[string]any{"type": "record", "name": g.names.unique(name), "fields": fields}, nil
+}
+
+// flatten returns the branches of an Avro type, unions can not be nested.
+func flatten(typ any) []any {
+	if union, ok := typ.([]any); ok {
+		return union
+	}
+	return []any{typ}
+}
+
+// Avro returns the Avro schema of a resource. Objects become records named after the
+// resource and the path of the property, nullable values and unions of several types become
+// Avro unions, and optional properties become nullable fields defaulting to null. Values Avro
+// can not type, such as objects without properties and array items of any type, become JSON
+// encoded strings documented as such. Names Avro does not allow are reported as an *Error.
+func Avro(s Schema) (any, error) {
+	n, err := Parse(s.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse schema of %s: %w", s.Resource, err)
+	}
+	g := &avroGenerator{names: names{}}
+	typ, _, err := g.typeOf(n, Identifier(s.Resource), "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert schema of %s: %w", s.Resource, err)
+	}
+	if record, ok := typ.(map[string]any); ok && record["type"] == "record" {
+		record["doc"] = fmt.Sprintf("Schema of resource %s.", s.Resource)
+		if s.Version > 0 {
+			record["doc"] = fmt.Sprintf("Schema of resource %s version %d.", s.Resource, s.Version)
+		}
+	}
+	return typ, nil
+}
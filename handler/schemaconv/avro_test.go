@@ -0,0 +1,131 @@
+package schemaconv
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAvro(t *testing.T) {
+	got, err := Avro(Schema{Resource: "/api/v1/users", Version: 3, Schema: unmarshal(t, usersSchema)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := unmarshal(t, `{
+		"type": "record",
+		"name": "ApiV1Users",
+		"doc": "Schema of resource /api/v1/users version 3.",
+		"fields": [
+			{"name": "address", "type": {
+				"type": "record",
+				"name": "ApiV1UsersAddress",
+				"fields": [
+					{"name": "city", "type": "string"},
+					{"name": "zip", "type": ["null", "string"], "default": null}
+				]
+			}},
+			{"name": "age", "type": ["double", "string"]},
+			{"name": "created_at", "type": ["null", "string"], "default": null},
+			{"name": "mixed", "type": {"type": "array", "items": ["double", "string"]}},
+			{"name": "name", "type": ["null", "string"]},
+			{"name": "score", "type": ["null", "double"], "default": null},
+			{"name": "tags", "type": {"type": "array", "items": "string"}}
+		]
+	}`)
+	// Round trip through JSON to compare with the expected document.
+	b, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, unmarshal(t, string(b))); diff != "" {
+		t.Errorf("Avro() got a diff: %s", diff)
+	}
+
+	// Optional unions get null added once, and other schemas need no record.
+	got, err = Avro(Schema{Resource: "ids", Schema: unmarshal(t, `{"type": "array", "items": {"properties": {"id": {"type": ["null", "integer", "string"]}}}}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want2 := map[string]any{"type": "array", "items": map[string]any{
+		"type":   "record",
+		"name":   "IdsItem",
+		"fields": []any{map[string]any{"name": "id", "type": []any{"null", "long", "string"}, "default": nil}},
+	}}
+	if diff := cmp.Diff(want2, got); diff != "" {
+		t.Errorf("Avro() got a diff: %s", diff)
+	}
+}
+
+func TestAvroUntyped(t *testing.T) {
+	got, err := Avro(Schema{Resource: "events", Schema: unmarshal(t, `{
+		"type": "object",
+		"required": ["data", "tags", "value"],
+		"properties": {
+			"data": {"type": "object"},
+			"meta": {"type": ["object", "string"]},
+			"tags": {"type": "array"},
+			"value": {}
+		}
+	}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := unmarshal(t, `{
+		"type": "record",
+		"name": "Events",
+		"doc": "Schema of resource events.",
+		"fields": [
+			{"name": "data", "type": "string", "doc": "JSON encoded, Avro can not type the values."},
+			{"name": "meta", "type": ["null", "string"], "doc": "JSON encoded, Avro can not type the values.", "default": null},
+			{"name": "tags", "type": {"type": "array", "items": "string"}, "doc": "JSON encoded, Avro can not type the values."},
+			{"name": "value", "type": "string", "doc": "JSON encoded, Avro can not type the values."}
+		]
+	}`)
+	b, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, unmarshal(t, string(b))); diff != "" {
+		t.Errorf("Avro() got a diff: %s", diff)
+	}
+
+	// Schemas learned from payloads have arrays that were always empty.
+	learned, err := os.ReadFile("../../testdata/multiple_payloads_schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = Avro(Schema{Resource: "payloads", Schema: unmarshal(t, string(learned))})
+	if err != nil {
+		t.Fatalf("Avro() of a learned schema got error %v", err)
+	}
+	b, _ = json.Marshal(got)
+	if !strings.Contains(string(b), `{"default":null,"doc":"JSON encoded, Avro can not type the values.","name":"customFields","type":["null",{"items":"string","type":"array"}]}`) {
+		t.Errorf("Avro() got %s, want customFields as an array of JSON encoded strings", b)
+	}
+	// Properties that were always null are not null twice.
+	if !strings.Contains(string(b), `{"default":null,"name":"deleted_at","type":"null"}`) {
+		t.Errorf("Avro() got %s, want deleted_at as null", b)
+	}
+}
+
+func TestAvroErrors(t *testing.T) {
+	cases := []struct {
+		schema string
+		want   string
+	}{
+		{schema: `{"properties": {"a-b": {"type": "string"}}}`, want: `/properties/a-b: "a-b" is not a valid Avro field name`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.want, func(t *testing.T) {
+			_, err := Avro(Schema{Resource: "a", Schema: unmarshal(t, tc.schema)})
+			var convErr *Error
+			if !errors.As(err, &convErr) || convErr.Error() != tc.want {
+				t.Errorf("Avro() got error %v, want %s", err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package schemaconv
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// SQL dialects of the generated DDL.
+const (
+	DialectPostgres = "postgres"
+	DialectBigQuery = "bigquery"
+)
+
+// Ways to store nested objects in tables.
+const (
+	// NestedFlatten stores the properties of nested objects in their own columns, named after
+	// the path of the property, e.g. address_city.
+	NestedFlatten = "flatten"
+	// NestedJSON stores nested objects in JSON columns.
+	NestedJSON = "json"
+)
+
+var sqlNameChars = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// DDLOptions configures the generated DDL.
+type DDLOptions struct {
+	// Dialect is DialectPostgres or DialectBigQuery, defaults to DialectPostgres.
+	Dialect string
+	// Nested is NestedFlatten or NestedJSON, defaults to NestedFlatten.
+	Nested string
+	// Table is the name of the table, possibly qualified by a schema or dataset. Defaults to
+	// the resource name, e.g. api_v1_users for /api/v1/users.
+	Table string
+	// DropColumns drops the columns of removed properties in migrations instead of leaving the
+	// statements commented out.
+	DropColumns bool
+}
+
+// Validate checks the dialect and nested mode.
+func (o DDLOptions) Validate() error {
+	switch o.Dialect {
+	case "", DialectPostgres, DialectBigQuery:
+	default:
+		return fmt.Errorf("unknown dialect %q", o.Dialect)
+	}
+	switch o.Nested {
+	case "", NestedFlatten, NestedJSON:
+	default:
+		return fmt.Errorf("unknown nested mode %q", o.Nested)
+	}
+	return nil
+}
+
+// Column is a table column.
+type Column struct {
+	Name string
+	// Type is the SQL type of the column.
+	Type    string
+	NotNull bool
+}
+
+// SQLName turns a resource or property name into an SQL identifier, e.g. "/api/v1/users" into
+// "api_v1_users".
+func SQLName(name string) string {
+	id := strings.Trim(sqlNameChars.ReplaceAllString(name, "_"), "_")
+	if id == "" || unicode.IsDigit(rune(id[0])) {
+		return "_" + id
+	}
+	return id
+}
+
+// bigQueryEscaper escapes the identifiers quoted with backticks, which take the escape
+// sequences of string literals.
+var bigQueryEscaper = strings.NewReplacer(`\`, `\\`, "`", "\\`")
+
+func (o DDLOptions) quote(id string) string {
+	if o.Dialect == DialectBigQuery {
+		return "`" + bigQueryEscaper.Replace(id) + "`"
+	}
+	return `"` + strings.ReplaceAll(id, `"`, `""`) + `"`
+}
+
+// table returns the quoted name of the table of the resource.
+func (o DDLOptions) table(resource string) string {
+	if o.Table == "" {
+		return o.quote(SQLName(resource))
+	}
+	parts := strings.Split(o.Table, ".")
+	for i, p := range parts {
+		parts[i] = o.quote(p)
+	}
+	return strings.Join(parts, ".")
+}
+
+// sqlType returns the type of a column holding values of the node, json for several types.
+func (o DDLOptions) sqlType(n *Node) string {
+	typ := ""
+	if len(n.Types) == 1 {
+		typ = n.Types[0]
+	}
+	bigQuery := o.Dialect == DialectBigQuery
+	switch {
+	case typ == TypeString && bigQuery:
+		return "STRING"
+	case typ == TypeString:
+		return "TEXT"
+	case typ == TypeInteger && bigQuery:
+		return "INT64"
+	case typ == TypeInteger:
+		return "BIGINT"
+	case typ == TypeNumber && bigQuery:
+		return "FLOAT64"
+	case typ == TypeNumber:
+		return "DOUBLE PRECISION"
+	case typ == TypeBoolean && bigQuery:
+		return "BOOL"
+	case typ == TypeBoolean:
+		return "BOOLEAN"
+	case bigQuery:
+		return "JSON"
+	}
+	return "JSONB"
+}
+
+// columns appends the columns of the properties of an object node. notNull is false if the
+// object itself may be missing or null.
+func (o DDLOptions) columns(cols []Column, n *Node, prefix string, notNull bool, ns names) []Column {
+	for _, p := range n.Properties {
+		name := prefix + SQLName(p.Name)
+		required := notNull && p.Required && !p.Node.Nullable
+		if o.Nested != NestedJSON && p.Node.Is(TypeObject) && len(p.Node.Properties) > 0 {
+			cols = o.columns(cols, p.Node, name+"_", required, ns)
+			continue
+		}
+		cols = append(cols, Column{Name: ns.unique(name), Type: o.sqlType(p.Node), NotNull: required})
+	}
+	return cols
+}
+
+// Columns returns the columns of the table of a resource. The properties of the resource
+// become columns, nested objects are flattened or stored as JSON according to the options and
+// arrays, unions of several types and values of any type are stored as JSON. Columns are NOT
+// NULL when the property is required and not nullable.
+func Columns(s Schema, opts DDLOptions) ([]Column, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	n, err := Parse(s.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse schema of %s: %w", s.Resource, err)
+	}
+	if !n.Is(TypeObject) || len(n.Properties) == 0 {
+		return nil, fmt.Errorf("failed to convert schema of %s: %w", s.Resource, errorf("", "only objects with properties can be stored in tables"))
+	}
+	return opts.columns(nil, n, "", !n.Nullable, names{}), nil
+}
+
+func (o DDLOptions) columnDefinition(c Column) string {
+	def := o.quote(c.Name) + " " + c.Type
+	if c.NotNull {
+		def += " NOT NULL"
+	}
+	return def
+}
+
+// CreateTable returns the CREATE TABLE statement of the table of a resource, see Columns.
+func CreateTable(s Schema, opts DDLOptions) ([]byte, error) {
+	cols, err := Columns(s, opts)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	generated(&b, "--", []Schema{s})
+	fmt.Fprintf(&b, "\nCREATE TABLE %s (\n", opts.table(s.Resource))
+	for i, c := range cols {
+		sep := ","
+		if i == len(cols)-1 {
+			sep = ""
+		}
+		fmt.Fprintf(&b, "  %s%s\n", opts.columnDefinition(c), sep)
+	}
+	b.WriteString(");\n")
+	return b.Bytes(), nil
+}
+
+// AlterTable returns the ALTER TABLE statements migrating the table of a resource from one
+// schema to another. Migrations only loosen constraints so they apply to tables with
+// rows: added columns are nullable and columns that become required keep allowing NULL.
+// Columns of removed properties are only dropped if opts.DropColumns is set.
+func AlterTable(from, to Schema, opts DDLOptions) ([]byte, error) {
+	oldCols, err := Columns(from, opts)
+	if err != nil {
+		return nil, err
+	}
+	newCols, err := Columns(to, opts)
+	if err != nil {
+		return nil, err
+	}
+	table := opts.table(to.Resource)
+	var b bytes.Buffer
+	generated(&b, "--", []Schema{from, to})
+	b.WriteString("\n")
+	existing := make(map[string]Column)
+	for _, c := range oldCols {
+		existing[c.Name] = c
+	}
+	changes := 0
+	for _, c := range newCols {
+		col := opts.quote(c.Name)
+		oc, ok := existing[c.Name]
+		delete(existing, c.Name)
+		if !ok {
+			c.NotNull = false
+			fmt.Fprintf(&b, "ALTER TABLE %s ADD COLUMN %s;\n", table, opts.columnDefinition(c))
+			changes++
+			continue
+		}
+		if oc.Type != c.Type {
+			switch {
+			case opts.Dialect != DialectBigQuery && c.Type == "JSONB":
+				fmt.Fprintf(&b, "ALTER TABLE %s ALTER COLUMN %s TYPE JSONB USING to_jsonb(%s);\n", table, col, col)
+			case opts.Dialect != DialectBigQuery:
+				fmt.Fprintf(&b, "ALTER TABLE %s ALTER COLUMN %s TYPE %s USING %s::%s;\n", table, col, c.Type, col, c.Type)
+			case oc.Type == "INT64" && c.Type == "FLOAT64":
+				fmt.Fprintf(&b, "ALTER TABLE %s ALTER COLUMN %s SET DATA TYPE %s;\n", table, col, c.Type)
+			default:
+				// BigQuery only widens numeric columns in place.
+				fmt.Fprintf(&b, "-- BigQuery can not change the type of %s from %s to %s, migrate the column manually.\n", col, oc.Type, c.Type)
+			}
+			changes++
+		}
+		if oc.NotNull && !c.NotNull {
+			fmt.Fprintf(&b, "ALTER TABLE %s ALTER COLUMN %s DROP NOT NULL;\n", table, col)
+			changes++
+		}
+	}
+	for _, c := range oldCols {
+		if _, ok := existing[c.Name]; !ok {
+			continue
+		}
+		comment := "-- "
+		if opts.DropColumns {
+			comment = ""
+		}
+		fmt.Fprintf(&b, "%sALTER TABLE %s DROP COLUMN %s;\n", comment, table, opts.quote(c.Name))
+		changes++
+	}
+	if changes == 0 {
+		b.WriteString("-- No changes.\n")
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,207 @@
+package schemaconv
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const usersV4Schema = `{
+	"type": "object",
+	"required": ["age", "email"],
+	"properties": {
+		"address": {"type": "object", "properties": {"city": {"type": "string"}}},
+		"age": {"type": "integer"},
+		"email": {"type": "string"},
+		"name": {"type": "string"},
+		"score": {"type": "string"}
+	}
+}`
+
+func TestCreateTable(t *testing.T) {
+	s := Schema{Resource: "/api/v1/users", Version: 3, Schema: unmarshal(t, usersSchema)}
+	cases := []struct {
+		name string
+		opts DDLOptions
+		want string
+	}{
+		{
+			name: "postgres flattened",
+			want: `CREATE TABLE "api_v1_users" (
+  "address_city" TEXT NOT NULL,
+  "address_zip" TEXT,
+  "age" JSONB NOT NULL,
+  "created_at" TEXT,
+  "mixed" JSONB NOT NULL,
+  "name" TEXT,
+  "score" DOUBLE PRECISION,
+  "tags" JSONB NOT NULL
+);
+`,
+		},
+		{
+			name: "bigquery json",
+			opts: DDLOptions{Dialect: DialectBigQuery, Nested: NestedJSON, Table: "dataset.users"},
+			want: "CREATE TABLE `dataset`.`users` (\n" +
+				"  `address` JSON NOT NULL,\n" +
+				"  `age` JSON NOT NULL,\n" +
+				"  `created_at` STRING,\n" +
+				"  `mixed` JSON NOT NULL,\n" +
+				"  `name` STRING,\n" +
+				"  `score` FLOAT64,\n" +
+				"  `tags` JSON NOT NULL\n" +
+				");\n",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := CreateTable(s, tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := "-- Code generated by haven from the schemas of the resources below. DO NOT EDIT.\n--   /api/v1/users version 3\n\n" + tc.want
+			if diff := cmp.Diff(want, string(got)); diff != "" {
+				t.Errorf("CreateTable() got a diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestColumns(t *testing.T) {
+	// Flattened names are unique and columns of optional objects are nullable.
+	s := Schema{Resource: "a", Schema: unmarshal(t, `{
+		"type": "object",
+		"required": ["a", "a_b", "1"],
+		"properties": {
+			"a": {"type": "object", "required": ["b"], "properties": {"b": {"type": "boolean"}}},
+			"a_b": {"type": "integer"},
+			"1": {"type": "string"},
+			"c": {"type": "object", "required": ["d"], "properties": {"d": {"type": "boolean"}}}
+		}
+	}`)}
+	got, err := Columns(s, DDLOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Column{
+		{Name: "_1", Type: "TEXT", NotNull: true},
+		{Name: "a_b", Type: "BOOLEAN", NotNull: true},
+		{Name: "a_b2", Type: "BIGINT", NotNull: true},
+		{Name: "c_d", Type: "BOOLEAN"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Columns() got a diff: %s", diff)
+	}
+
+	if _, err := Columns(s, DDLOptions{Dialect: "mysql"}); err == nil || !strings.Contains(err.Error(), `unknown dialect "mysql"`) {
+		t.Errorf("Columns() got error %v, want unknown dialect", err)
+	}
+	if _, err := Columns(s, DDLOptions{Nested: "xml"}); err == nil || !strings.Contains(err.Error(), `unknown nested mode "xml"`) {
+		t.Errorf("Columns() got error %v, want unknown nested mode", err)
+	}
+	_, err = Columns(Schema{Resource: "a", Schema: unmarshal(t, `{"type": "array"}`)}, DDLOptions{})
+	var convErr *Error
+	if !errors.As(err, &convErr) || convErr.Reason != "only objects with properties can be stored in tables" {
+		t.Errorf("Columns() got error %v, want a conversion error", err)
+	}
+}
+
+func TestAlterTable(t *testing.T) {
+	from := Schema{Resource: "/api/v1/users", Version: 3, Schema: unmarshal(t, usersSchema)}
+	to := Schema{Resource: "/api/v1/users", Version: 4, Schema: unmarshal(t, usersV4Schema)}
+	cases := []struct {
+		name     string
+		from, to Schema
+		opts     DDLOptions
+		want     string
+	}{
+		{
+			name: "postgres",
+			from: from,
+			to:   to,
+			want: `ALTER TABLE "api_v1_users" ALTER COLUMN "address_city" DROP NOT NULL;
+ALTER TABLE "api_v1_users" ALTER COLUMN "age" TYPE BIGINT USING "age"::BIGINT;
+ALTER TABLE "api_v1_users" ADD COLUMN "email" TEXT;
+ALTER TABLE "api_v1_users" ALTER COLUMN "score" TYPE TEXT USING "score"::TEXT;
+-- ALTER TABLE "api_v1_users" DROP COLUMN "address_zip";
+-- ALTER TABLE "api_v1_users" DROP COLUMN "created_at";
+-- ALTER TABLE "api_v1_users" DROP COLUMN "mixed";
+-- ALTER TABLE "api_v1_users" DROP COLUMN "tags";
+`,
+		},
+		{
+			name: "postgres to json",
+			from: to,
+			to:   Schema{Resource: "/api/v1/users", Version: 5, Schema: unmarshal(t, `{"type": "object", "properties": {"age": {"type": ["integer", "string"]}}}`)},
+			opts: DDLOptions{Table: "users"},
+			want: `ALTER TABLE "users" ALTER COLUMN "age" TYPE JSONB USING to_jsonb("age");
+ALTER TABLE "users" ALTER COLUMN "age" DROP NOT NULL;
+-- ALTER TABLE "users" DROP COLUMN "address_city";
+-- ALTER TABLE "users" DROP COLUMN "email";
+-- ALTER TABLE "users" DROP COLUMN "name";
+-- ALTER TABLE "users" DROP COLUMN "score";
+`,
+		},
+		{
+			name: "bigquery",
+			from: from,
+			to:   to,
+			opts: DDLOptions{Dialect: DialectBigQuery, DropColumns: true},
+			want: "ALTER TABLE `api_v1_users` ALTER COLUMN `address_city` DROP NOT NULL;\n" +
+				"-- BigQuery can not change the type of `age` from JSON to INT64, migrate the column manually.\n" +
+				"ALTER TABLE `api_v1_users` ADD COLUMN `email` STRING;\n" +
+				"-- BigQuery can not change the type of `score` from FLOAT64 to STRING, migrate the column manually.\n" +
+				"ALTER TABLE `api_v1_users` DROP COLUMN `address_zip`;\n" +
+				"ALTER TABLE `api_v1_users` DROP COLUMN `created_at`;\n" +
+				"ALTER TABLE `api_v1_users` DROP COLUMN `mixed`;\n" +
+				"ALTER TABLE `api_v1_users` DROP COLUMN `tags`;\n",
+		},
+		{
+			name: "bigquery widening",
+			from: Schema{Resource: "a", Schema: unmarshal(t, `{"properties": {"n": {"type": "integer"}}}`)},
+			to:   Schema{Resource: "a", Schema: unmarshal(t, `{"properties": {"n": {"type": "number"}}}`)},
+			opts: DDLOptions{Dialect: DialectBigQuery},
+			want: "ALTER TABLE `a` ALTER COLUMN `n` SET DATA TYPE FLOAT64;\n",
+		},
+		{
+			name: "no changes",
+			from: to,
+			to:   to,
+			want: "-- No changes.\n",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := AlterTable(tc.from, tc.to, tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, statements, _ := strings.Cut(string(got), "\n\n")
+			if diff := cmp.Diff(tc.want, statements); diff != "" {
+				t.Errorf("AlterTable() got a diff: %s", diff)
+			}
+		})
+	}
+
+	if _, err := AlterTable(Schema{Resource: "a", Schema: unmarshal(t, `{}`)}, to, DDLOptions{}); err == nil {
+		t.Errorf("AlterTable() from a schema without properties got no error")
+	}
+}
+
+func TestQuote(t *testing.T) {
+	cases := []struct {
+		opts DDLOptions
+		want string
+	}{
+		{opts: DDLOptions{Table: `data"set.users`}, want: `"data""set"."users"`},
+		{opts: DDLOptions{Dialect: DialectBigQuery, Table: "data`set.users"}, want: "`data\\`set`.`users`"},
+		{opts: DDLOptions{Dialect: DialectBigQuery, Table: `dataset.users\`}, want: "`dataset`.`users\\\\`"},
+	}
+	for _, tc := range cases {
+		if got := tc.opts.table("users"); got != tc.want {
+			t.Errorf("table(%q) = %s, want %s", tc.opts.Table, got, tc.want)
+		}
+	}
+}
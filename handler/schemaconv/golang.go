@@ -0,0 +1,177 @@
+package schemaconv
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Schema is the schema of a resource to convert.
+type Schema struct {
+	Resource string
+	Version  uint
+	Schema   map[string]any
+	// History are the schemas of the earlier versions of the resource, oldest first. Protobuf
+	// fields are numbered after them so numbers do not change between versions.
+	History []map[string]any
+}
+
+// generated writes the header shared by the generated sources.
+func generated(b *bytes.Buffer, comment string, schemas []Schema) {
+	fmt.Fprintf(b, "%s Code generated by haven from the schemas of the resources below. DO NOT EDIT.\n", comment)
+	for _, s := range schemas {
+		if s.Version == 0 {
+			fmt.Fprintf(b, "%s   %s\n", comment, commentText(s.Resource))
+			continue
+		}
+		fmt.Fprintf(b, "%s   %s version %d\n", comment, commentText(s.Resource), s.Version)
+	}
+}
+
+// commentText makes a name safe to write in a generated comment. Names with line breaks or
+// other unprintable characters, or that would end a block comment, are quoted.
+func commentText(name string) string {
+	if strings.Contains(name, "*/") || strings.IndexFunc(name, func(r rune) bool { return !unicode.IsPrint(r) }) >= 0 {
+		return strings.ReplaceAll(strconv.Quote(name), "*/", `*\/`)
+	}
+	return name
+}
+
+// goInitialisms are the initialisms Go writes in a single case, from the list of golint.
+var goInitialisms = map[string]bool{
+	"ACL": true, "API": true, "ASCII": true, "CPU": true, "CSS": true, "DNS": true, "EOF": true,
+	"GUID": true, "HTML": true, "HTTP": true, "HTTPS": true, "ID": true, "IP": true, "JSON": true,
+	"LHS": true, "QPS": true, "RAM": true, "RHS": true, "RPC": true, "SLA": true, "SMTP": true,
+	"SQL": true, "SSH": true, "TCP": true, "TLS": true, "TTL": true, "UDP": true, "UI": true,
+	"UID": true, "UUID": true, "URI": true, "URL": true, "UTF8": true, "VM": true, "XML": true,
+	"XMPP": true, "XSRF": true, "XSS": true,
+}
+
+// goIdentifier is Identifier with the words that are initialisms in upper case, e.g. "user_id"
+// becomes "UserID" and "/api/v1/payments" "APIV1Payments".
+func goIdentifier(name string) string {
+	var b strings.Builder
+	var word []rune
+	flush := func() {
+		if w := strings.ToUpper(string(word)); goInitialisms[w] {
+			b.WriteString(w)
+		} else {
+			b.WriteString(Identifier(string(word)))
+		}
+		word = word[:0]
+	}
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if len(word) > 0 {
+				flush()
+			}
+			continue
+		}
+		// A lower case letter followed by an upper case one starts a new camelCase word.
+		if len(word) > 0 && unicode.IsUpper(r) && unicode.IsLower(word[len(word)-1]) {
+			flush()
+		}
+		word = append(word, r)
+	}
+	if len(word) > 0 {
+		flush()
+	}
+	return Identifier(b.String())
+}
+
+// pendingType is an object type pending to be written.
+type pendingType struct {
+	name string
+	node *Node
+}
+
+type goGenerator struct {
+	names   names
+	pending []pendingType
+}
+
+// typeOf returns the Go type of the node, queueing the structs it needs. name is the name of
+// the struct if the node is an object with properties.
+func (g *goGenerator) typeOf(n *Node, name string) string {
+	if len(n.Types) != 1 {
+		return "any"
+	}
+	switch n.Types[0] {
+	case TypeString:
+		return "string"
+	case TypeNumber:
+		return "float64"
+	case TypeInteger:
+		return "int64"
+	case TypeBoolean:
+		return "bool"
+	case TypeArray:
+		if n.Items == nil {
+			return "[]any"
+		}
+		return "[]" + g.typeOf(n.Items, name+"Item")
+	}
+	if len(n.Properties) == 0 {
+		return "map[string]any"
+	}
+	name = g.names.unique(name)
+	g.pending = append(g.pending, pendingType{name: name, node: n})
+	return name
+}
+
+func (g *goGenerator) writeStruct(b *bytes.Buffer, s pendingType) {
+	fmt.Fprintf(b, "type %s struct {\n", s.name)
+	fields := names{}
+	for _, p := range s.node.Properties {
+		field := fields.unique(goIdentifier(p.Name))
+		typ := g.typeOf(p.Node, s.name+goIdentifier(p.Name))
+		// Pointers tell missing and null values apart from zero values. Slices, maps and
+		// interfaces are nil already.
+		nilable := typ == "any" || strings.HasPrefix(typ, "[]") || strings.HasPrefix(typ, "map[")
+		if (p.Node.Nullable || !p.Required) && !nilable {
+			typ = "*" + typ
+		}
+		tag := p.Name
+		if !p.Required {
+			tag += ",omitempty"
+		}
+		fmt.Fprintf(b, "\t%s %s `json:%s`\n", field, typ, strconv.Quote(tag))
+	}
+	b.WriteString("}\n\n")
+}
+
+// Go returns a Go source file of package pkg with a type for each schema. Objects become
+// structs with json tags, optional and nullable properties become pointers and unions of
+// several types become any.
+func Go(pkg string, schemas []Schema) ([]byte, error) {
+	var b bytes.Buffer
+	generated(&b, "//", schemas)
+	fmt.Fprintf(&b, "\npackage %s\n\n", pkg)
+	g := &goGenerator{names: names{}}
+	for _, s := range schemas {
+		n, err := Parse(s.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse schema of %s: %w", s.Resource, err)
+		}
+		name := g.names.unique(goIdentifier(s.Resource))
+		fmt.Fprintf(&b, "// %s is the schema of resource %s.\n", name, commentText(s.Resource))
+		if len(n.Properties) > 0 && n.Is(TypeObject) {
+			g.writeStruct(&b, pendingType{name: name, node: n})
+		} else {
+			fmt.Fprintf(&b, "type %s %s\n\n", name, g.typeOf(n, name))
+		}
+		for len(g.pending) > 0 {
+			s := g.pending[0]
+			g.pending = g.pending[1:]
+			g.writeStruct(&b, s)
+		}
+	}
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to format generated code: %v", err)
+	}
+	return src, nil
+}
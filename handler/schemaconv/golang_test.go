@@ -0,0 +1,133 @@
+package schemaconv
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGo(t *testing.T) {
+	schemas := []Schema{
+		{Resource: "/api/v1/users", Version: 3, Schema: unmarshal(t, usersSchema)},
+		{Resource: "api-v1-users", Version: 1, Schema: unmarshal(t, `{"type": "array", "items": {"properties": {"id": {"type": "integer"}}}}`)},
+		{Resource: "flags", Version: 1, Schema: unmarshal(t, `{"type": ["boolean", "null"]}`)},
+	}
+	want := "// Code generated by haven from the schemas of the resources below. DO NOT EDIT.\n" +
+		"//   /api/v1/users version 3\n" +
+		"//   api-v1-users version 1\n" +
+		"//   flags version 1\n" +
+		`
+package models
+
+// APIV1Users is the schema of resource /api/v1/users.
+type APIV1Users struct {
+	Address   APIV1UsersAddress ` + "`json:\"address\"`" + `
+	Age       any               ` + "`json:\"age\"`" + `
+	CreatedAt *string           ` + "`json:\"created_at,omitempty\"`" + `
+	Mixed     []any             ` + "`json:\"mixed\"`" + `
+	Name      *string           ` + "`json:\"name\"`" + `
+	Score     *float64          ` + "`json:\"score,omitempty\"`" + `
+	Tags      []string          ` + "`json:\"tags\"`" + `
+}
+
+type APIV1UsersAddress struct {
+	City string  ` + "`json:\"city\"`" + `
+	Zip  *string ` + "`json:\"zip,omitempty\"`" + `
+}
+
+// APIV1Users2 is the schema of resource api-v1-users.
+type APIV1Users2 []APIV1Users2Item
+
+type APIV1Users2Item struct {
+	ID *int64 ` + "`json:\"id,omitempty\"`" + `
+}
+
+// Flags is the schema of resource flags.
+type Flags bool
+`
+	got, err := Go("models", schemas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Go() got a diff: %s", diff)
+	}
+
+	// Field names are unique within a struct.
+	got, err = Go("models", []Schema{{Resource: "a", Schema: unmarshal(t, `{"type": "object", "properties": {"a_b": {}, "a-b": {}, "c": {"type": "object"}}}`)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "// Code generated by haven from the schemas of the resources below. DO NOT EDIT.\n" +
+		"//   a\n" +
+		`
+package models
+
+// A is the schema of resource a.
+type A struct {
+	AB  any            ` + "`json:\"a-b,omitempty\"`" + `
+	AB2 any            ` + "`json:\"a_b,omitempty\"`" + `
+	C   map[string]any ` + "`json:\"c,omitempty\"`" + `
+}
+`
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Go() got a diff: %s", diff)
+	}
+
+	// Names are escaped in comments.
+	got, err = Go("models", []Schema{{Resource: "a\nb", Schema: unmarshal(t, `{"type": "string"}`)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "// Code generated by haven from the schemas of the resources below. DO NOT EDIT.\n" +
+		"//   \"a\\nb\"\n" +
+		`
+package models
+
+// AB is the schema of resource "a\nb".
+type AB string
+`
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Go() got a diff: %s", diff)
+	}
+
+	if _, err := Go("models", []Schema{{Resource: "a", Schema: unmarshal(t, `{"type": "x"}`)}}); err == nil {
+		t.Errorf("Go() of an invalid schema got no error")
+	}
+	if _, err := Go("not a package", schemas); err == nil {
+		t.Errorf("Go() with an invalid package got no error")
+	}
+}
+
+func TestGoIdentifier(t *testing.T) {
+	cases := map[string]string{
+		"/api/v1/payments": "APIV1Payments",
+		"user_id":          "UserID",
+		"userId":           "UserID",
+		"userID":           "UserID",
+		"id":               "ID",
+		"image-url":        "ImageURL",
+		"identity":         "Identity",
+		"HTTPServer":       "HTTPServer",
+		"2fa":              "X2fa",
+		"$":                "X",
+	}
+	for name, want := range cases {
+		if got := goIdentifier(name); got != want {
+			t.Errorf("goIdentifier(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestCommentText(t *testing.T) {
+	cases := map[string]string{
+		"/api/v1/users": "/api/v1/users",
+		"a\nb":          `"a\nb"`,
+		"a*/b":          `"a*\/b"`,
+	}
+	for name, want := range cases {
+		if got := commentText(name); got != want {
+			t.Errorf("commentText(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package schemaconv
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+
+	"movinglake.com/haven/handler/jsonutils"
+)
+
+// DefaultTemplate names the resources imported from OpenAPI documents after the path of the
+// operation, following the convention of naming resources after URL paths.
+const DefaultTemplate = "{path}"
+
+// operationMethods are the HTTP methods of OpenAPI path items, in the order they are read.
+var operationMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// ImportedSchema is a schema read from an OpenAPI document or a JSON Schema file.
+type ImportedSchema struct {
+	Resource string
+	// Source is where the schema comes from, e.g. "GET /pets 200" or a file name.
+	Source string
+	Schema map[string]any
+}
+
+// OpenAPIImportOptions configures how the responses of an OpenAPI document map to resources.
+type OpenAPIImportOptions struct {
+	// Template names the resource of a response from its {path}, {method}, {status} and
+	// {operationId}. Defaults to DefaultTemplate. Templates without {method} only name the
+	// responses of GET operations.
+	Template string
+	// Mapping names the resources of specific responses, overriding the template. Keys are
+	// operation IDs, "METHOD /path" or "METHOD /path STATUS". An empty name skips the
+	// response.
+	Mapping map[string]string
+}
+
+// resourceName returns the name of the resource of a response and whether it is imported.
+func (o OpenAPIImportOptions) resourceName(p, method, status, operationID string) (string, bool) {
+	keys := []string{
+		fmt.Sprintf("%s %s %s", strings.ToUpper(method), p, status),
+		fmt.Sprintf("%s %s", strings.ToUpper(method), p),
+	}
+	if operationID != "" {
+		keys = append([]string{operationID}, keys...)
+	}
+	for _, k := range keys {
+		if name, ok := o.Mapping[k]; ok {
+			return name, name != ""
+		}
+	}
+	template := o.Template
+	if template == "" {
+		template = DefaultTemplate
+	}
+	if method != "get" && !strings.Contains(template, "{method}") {
+		// Other operations on the path would get the name of the GET one.
+		return "", false
+	}
+	return strings.NewReplacer(
+		"{path}", p,
+		"{method}", method,
+		"{status}", status,
+		"{operationId}", operationID,
+	).Replace(template), true
+}
+
+// jsonContent returns the JSON media type of the content of a response, if any.
+func jsonContent(content map[string]any) (map[string]any, bool) {
+	if m, ok := content["application/json"].(map[string]any); ok {
+		return m, true
+	}
+	types := make([]string, 0, len(content))
+	for t := range content {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	for _, t := range types {
+		if strings.HasSuffix(strings.SplitN(t, ";", 2)[0], "+json") {
+			m, ok := content[t].(map[string]any)
+			return m, ok
+		}
+	}
+	return nil, false
+}
+
+// nullableToType rewrites the OpenAPI 3.0 `nullable: true` keyword of the schema and its
+// subschemas as a null type.
+func nullableToType(schema map[string]any) {
+	if nullable, ok := schema["nullable"].(bool); ok {
+		delete(schema, "nullable")
+		switch t := schema["type"].(type) {
+		case string:
+			if nullable {
+				schema["type"] = []any{t, TypeNull}
+			}
+		case []any:
+			if nullable {
+				schema["type"] = append(t, TypeNull)
+			}
+		}
+	}
+	for _, keyword := range []string{"properties", "patternProperties"} {
+		if props, ok := schema[keyword].(map[string]any); ok {
+			for _, p := range props {
+				if s, ok := p.(map[string]any); ok {
+					nullableToType(s)
+				}
+			}
+		}
+	}
+	for _, keyword := range []string{"items", "additionalProperties", "not"} {
+		if s, ok := schema[keyword].(map[string]any); ok {
+			nullableToType(s)
+		}
+	}
+	for _, keyword := range []string{"anyOf", "oneOf", "allOf", "prefixItems"} {
+		if list, ok := schema[keyword].([]any); ok {
+			for _, v := range list {
+				if s, ok := v.(map[string]any); ok {
+					nullableToType(s)
+				}
+			}
+		}
+	}
+}
+
+// resourceSchema completes an imported schema the way Haven stores them.
+func resourceSchema(resource string, schema map[string]any) map[string]any {
+	schema["$schema"] = jsonSchemaDialect
+	if _, ok := schema["title"]; !ok {
+		schema["title"] = resource
+	}
+	return schema
+}
+
+// FromOpenAPI returns the schemas of the JSON responses of the successful (2xx) responses of
+// an OpenAPI 3 document, with their $refs resolved.
+func FromOpenAPI(doc map[string]any, opts OpenAPIImportOptions) ([]ImportedSchema, error) {
+	version, _ := doc["openapi"].(string)
+	if !strings.HasPrefix(version, "3.") {
+		return nil, fmt.Errorf("unsupported OpenAPI version %q, only 3.x documents are supported", version)
+	}
+	docs := Documents{"": doc}
+	paths, _ := doc["paths"].(map[string]any)
+	sortedPaths := make([]string, 0, len(paths))
+	for p := range paths {
+		sortedPaths = append(sortedPaths, p)
+	}
+	sort.Strings(sortedPaths)
+
+	var imported []ImportedSchema
+	sources := make(map[string]int)
+	for _, p := range sortedPaths {
+		item, ok := paths[p].(map[string]any)
+		if !ok {
+			continue
+		}
+		for _, method := range operationMethods {
+			op, ok := item[method].(map[string]any)
+			if !ok {
+				continue
+			}
+			operationID, _ := op["operationId"].(string)
+			responses, _ := op["responses"].(map[string]any)
+			statuses := make([]string, 0, len(responses))
+			for status := range responses {
+				if strings.HasPrefix(status, "2") {
+					statuses = append(statuses, status)
+				}
+			}
+			sort.Strings(statuses)
+			for _, status := range statuses {
+				source := fmt.Sprintf("%s %s %s", strings.ToUpper(method), p, status)
+				response, err := docs.Resolve("", responses[status])
+				if err != nil {
+					return nil, fmt.Errorf("%s: %v", source, err)
+				}
+				content, _ := response["content"].(map[string]any)
+				media, ok := jsonContent(content)
+				if !ok || media["schema"] == nil {
+					continue
+				}
+				name, ok := opts.resourceName(p, method, status, operationID)
+				if !ok {
+					continue
+				}
+				schema, ok := media["schema"].(map[string]any)
+				if !ok {
+					return nil, fmt.Errorf("%s: schema is not an object", source)
+				}
+				nullableToType(schema)
+				schema = resourceSchema(name, schema)
+				if i, ok := sources[name]; ok {
+					if reflect.DeepEqual(imported[i].Schema, schema) {
+						continue
+					}
+					return nil, fmt.Errorf("resource %s is mapped from both %s and %s with different schemas, map them to different names", name, imported[i].Source, source)
+				}
+				sources[name] = len(imported)
+				imported = append(imported, ImportedSchema{Resource: name, Source: source, Schema: schema})
+			}
+		}
+	}
+	return imported, nil
+}
+
+// ResourceFromFile returns the resource named by a JSON Schema file, e.g. "users" for
+// "schemas/users.schema.json" or "schemas/users.json".
+func ResourceFromFile(name string) string {
+	base := path.Base(name)
+	if resource, ok := jsonutils.ResourceFromSchemaFile(base); ok {
+		return resource
+	}
+	return strings.TrimSuffix(base, path.Ext(base))
+}
+
+// FromJSONSchemas returns the schemas of the resource documents with their $refs resolved
+// against all the documents. Resources are named after their document by ResourceFromFile.
+func FromJSONSchemas(docs Documents, resources []string) ([]ImportedSchema, error) {
+	var imported []ImportedSchema
+	seen := make(map[string]string)
+	for _, doc := range resources {
+		v, ok := docs[doc]
+		if !ok {
+			return nil, fmt.Errorf("document %q not found", doc)
+		}
+		name := ResourceFromFile(doc)
+		if other, ok := seen[name]; ok {
+			return nil, fmt.Errorf("resource %s is named by both %s and %s", name, other, doc)
+		}
+		seen[name] = doc
+		schema, err := docs.Resolve(doc, v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", doc, err)
+		}
+		delete(schema, "$id")
+		imported = append(imported, ImportedSchema{Resource: name, Source: doc, Schema: resourceSchema(name, schema)})
+	}
+	return imported, nil
+}
@@ -0,0 +1,192 @@
+package schemaconv
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const petstore = `{
+	"openapi": "3.0.3",
+	"info": {"title": "Petstore", "version": "1"},
+	"paths": {
+		"/pets": {
+			"get": {
+				"operationId": "listPets",
+				"responses": {
+					"200": {"content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Pet"}}}}},
+					"default": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}}
+				}
+			},
+			"post": {
+				"operationId": "createPet",
+				"responses": {
+					"201": {"$ref": "#/components/responses/Pet"},
+					"204": {"description": "No content."}
+				}
+			}
+		},
+		"/pets/{petId}": {
+			"parameters": [{"name": "petId", "in": "path"}],
+			"get": {
+				"operationId": "showPet",
+				"responses": {"200": {"$ref": "#/components/responses/Pet"}}
+			}
+		},
+		"/health": {
+			"get": {"responses": {"200": {"content": {"text/plain": {"schema": {"type": "string"}}}}}}
+		}
+	},
+	"components": {
+		"responses": {
+			"Pet": {"content": {"application/vnd.pet+json; charset=utf-8": {"schema": {"$ref": "#/components/schemas/Pet"}}}}
+		},
+		"schemas": {
+			"Pet": {
+				"type": "object",
+				"required": ["id", "name"],
+				"properties": {
+					"id": {"type": "integer"},
+					"name": {"type": "string"},
+					"tag": {"type": "string", "nullable": true}
+				}
+			},
+			"Error": {"type": "object"}
+		}
+	}
+}`
+
+const petSchema = `{
+	"type": "object",
+	"required": ["id", "name"],
+	"properties": {
+		"id": {"type": "integer"},
+		"name": {"type": "string"},
+		"tag": {"type": ["string", "null"]}
+	}
+}`
+
+func withDialect(t *testing.T, schema, title string) map[string]any {
+	s := unmarshal(t, schema)
+	s["$schema"] = jsonSchemaDialect
+	s["title"] = title
+	return s
+}
+
+func TestFromOpenAPI(t *testing.T) {
+	cases := []struct {
+		name string
+		opts OpenAPIImportOptions
+		want []ImportedSchema
+	}{
+		{
+			name: "default template",
+			want: []ImportedSchema{
+				{Resource: "/pets", Source: "GET /pets 200", Schema: withDialect(t, `{"type": "array", "items": `+petSchema+`}`, "/pets")},
+				{Resource: "/pets/{petId}", Source: "GET /pets/{petId} 200", Schema: withDialect(t, petSchema, "/pets/{petId}")},
+			},
+		},
+		{
+			name: "template and mapping",
+			opts: OpenAPIImportOptions{
+				Template: "petstore{path}/{method}",
+				Mapping:  map[string]string{"showPet": "", "POST /pets 201": "pet"},
+			},
+			want: []ImportedSchema{
+				{Resource: "petstore/pets/get", Source: "GET /pets 200", Schema: withDialect(t, `{"type": "array", "items": `+petSchema+`}`, "petstore/pets/get")},
+				{Resource: "pet", Source: "POST /pets 201", Schema: withDialect(t, petSchema, "pet")},
+			},
+		},
+		{
+			name: "same schema for the same resource",
+			opts: OpenAPIImportOptions{Mapping: map[string]string{"listPets": "", "POST /pets": "pet", "GET /pets/{petId}": "pet"}},
+			want: []ImportedSchema{
+				{Resource: "pet", Source: "POST /pets 201", Schema: withDialect(t, petSchema, "pet")},
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := FromOpenAPI(unmarshal(t, petstore), tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("FromOpenAPI() got a diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestFromOpenAPIErrors(t *testing.T) {
+	cases := []struct {
+		doc  string
+		opts OpenAPIImportOptions
+		want string
+	}{
+		{doc: `{"swagger": "2.0"}`, want: `unsupported OpenAPI version ""`},
+		{doc: petstore, opts: OpenAPIImportOptions{Template: "pets"}, want: "resource pets is mapped from both GET /pets 200 and GET /pets/{petId} 200"},
+		{
+			doc:  `{"openapi": "3.1.0", "paths": {"/a": {"get": {"responses": {"200": {"$ref": "#/components/responses/A"}}}}}}`,
+			want: `GET /a 200: failed to resolve $ref "#/components/responses/A"`,
+		},
+		{
+			doc:  `{"openapi": "3.1.0", "paths": {"/a": {"get": {"responses": {"200": {"content": {"application/json": {"schema": true}}}}}}}}`,
+			want: "GET /a 200: schema is not an object",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.want, func(t *testing.T) {
+			_, err := FromOpenAPI(unmarshal(t, tc.doc), tc.opts)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("FromOpenAPI() got error %v, want %s", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestFromJSONSchemas(t *testing.T) {
+	docs := Documents{
+		"users.schema.json": unmarshal(t, `{"$id": "u", "type": "object", "properties": {"pet": {"$ref": "defs/pet.json"}}}`),
+		"defs/pet.json":     unmarshal(t, `{"title": "Pet", "type": "object"}`),
+	}
+	got, err := FromJSONSchemas(docs, []string{"users.schema.json", "defs/pet.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ImportedSchema{
+		{Resource: "users", Source: "users.schema.json", Schema: withDialect(t, `{"type": "object", "properties": {"pet": {"title": "Pet", "type": "object"}}}`, "users")},
+		{Resource: "pet", Source: "defs/pet.json", Schema: withDialect(t, `{"type": "object"}`, "Pet")},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("FromJSONSchemas() got a diff: %s", diff)
+	}
+
+	if _, err := FromJSONSchemas(docs, []string{"missing.json"}); err == nil {
+		t.Errorf("FromJSONSchemas() of a missing document got no error")
+	}
+	docs["pet.schema.json"] = map[string]any{}
+	if _, err := FromJSONSchemas(docs, []string{"defs/pet.json", "pet.schema.json"}); err == nil {
+		t.Errorf("FromJSONSchemas() of two documents for a resource got no error")
+	}
+	docs["bad.json"] = map[string]any{"$ref": "#/nope"}
+	if _, err := FromJSONSchemas(docs, []string{"bad.json"}); err == nil {
+		t.Errorf("FromJSONSchemas() of a bad $ref got no error")
+	}
+}
+
+func TestResourceFromFile(t *testing.T) {
+	cases := map[string]string{
+		"users.json":                      "users",
+		"a/users.schema.json":             "users",
+		"%2Fapi%2Fv1%2Fusers.schema.json": "/api/v1/users",
+		"/tmp/schemas/orders.v2.yaml":     "orders.v2",
+		"/tmp/schemas/no-extension":       "no-extension",
+	}
+	for name, want := range cases {
+		if got := ResourceFromFile(name); got != want {
+			t.Errorf("ResourceFromFile(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package schemaconv
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// OpenAPIVersion is the version of the OpenAPI documents written.
+const OpenAPIVersion = "3.1.0"
+
+// jsonSchemaDialect is the dialect of the schemas learned by Haven.
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// Extensions added to the component schemas.
+const (
+	ExtensionResource = "x-haven-resource"
+	ExtensionVersion  = "x-haven-version"
+)
+
+var pathParam = regexp.MustCompile(`^\{([^{}/]+)\}$`)
+
+// OpenAPIOptions configures an OpenAPI document.
+type OpenAPIOptions struct {
+	Title   string
+	Version string
+	// Paths adds a GET operation returning the schema for every resource named after a URL
+	// path, e.g. /api/v1/payments.
+	Paths bool
+}
+
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type OpenAPIComponents struct {
+	Schemas map[string]map[string]any `json:"schemas"`
+}
+
+// OpenAPIDocument is an OpenAPI 3.1 document.
+type OpenAPIDocument struct {
+	OpenAPI           string                    `json:"openapi"`
+	Info              OpenAPIInfo               `json:"info"`
+	JSONSchemaDialect string                    `json:"jsonSchemaDialect"`
+	Paths             map[string]map[string]any `json:"paths,omitempty"`
+	Components        OpenAPIComponents         `json:"components"`
+}
+
+// componentSchema returns a copy of the schema for the components of a document. The $id
+// Haven gives to every schema is dropped since ids must be unique in a document, and the
+// dialect is set for the whole document.
+func componentSchema(s Schema) map[string]any {
+	schema := make(map[string]any, len(s.Schema)+2)
+	for k, v := range s.Schema {
+		if k == "$id" || k == "$schema" {
+			continue
+		}
+		schema[k] = v
+	}
+	schema[ExtensionResource] = s.Resource
+	schema[ExtensionVersion] = s.Version
+	return schema
+}
+
+// pathItem returns the path item of a resource named after a URL path, declaring the
+// parameters of {templated} segments.
+func pathItem(resource, component string) map[string]any {
+	var params []any
+	for _, segment := range strings.Split(resource, "/") {
+		if m := pathParam.FindStringSubmatch(segment); m != nil {
+			params = append(params, map[string]any{
+				"name":     m[1],
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]any{"type": "string"},
+			})
+		}
+	}
+	operation := map[string]any{
+		"operationId": "get" + component,
+		"responses": map[string]any{
+			"200": map[string]any{
+				"description": fmt.Sprintf("A %s payload.", resource),
+				"content": map[string]any{
+					"application/json": map[string]any{
+						"schema": map[string]any{"$ref": "#/components/schemas/" + component},
+					},
+				},
+			},
+		},
+	}
+	if len(params) > 0 {
+		operation["parameters"] = params
+	}
+	return map[string]any{"get": operation}
+}
+
+// OpenAPI returns an OpenAPI document with each schema as a component named after its
+// resource.
+func OpenAPI(schemas []Schema, opts OpenAPIOptions) *OpenAPIDocument {
+	doc := &OpenAPIDocument{
+		OpenAPI:           OpenAPIVersion,
+		Info:              OpenAPIInfo{Title: opts.Title, Version: opts.Version},
+		JSONSchemaDialect: jsonSchemaDialect,
+		Components:        OpenAPIComponents{Schemas: make(map[string]map[string]any)},
+	}
+	ns := names{}
+	for _, s := range schemas {
+		component := ns.unique(Identifier(s.Resource))
+		doc.Components.Schemas[component] = componentSchema(s)
+		if !opts.Paths || !strings.HasPrefix(s.Resource, "/") {
+			continue
+		}
+		if doc.Paths == nil {
+			doc.Paths = make(map[string]map[string]any)
+		}
+		doc.Paths[s.Resource] = pathItem(s.Resource, component)
+	}
+	return doc
+}
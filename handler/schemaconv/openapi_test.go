@@ -0,0 +1,59 @@
+package schemaconv
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestOpenAPI(t *testing.T) {
+	schemas := []Schema{
+		{Resource: "/api/v1/orders/{order_id}/items", Version: 2, Schema: unmarshal(t, `{"$id": "x", "$schema": "y", "type": "array"}`)},
+		{Resource: "pets", Version: 1, Schema: unmarshal(t, `{"type": "object"}`)},
+		{Resource: "Pets", Version: 1, Schema: unmarshal(t, `{"type": "string"}`)},
+	}
+	doc := OpenAPI(schemas, OpenAPIOptions{Title: "Schemas", Version: "2", Paths: true})
+	want := `{
+		"openapi": "3.1.0",
+		"info": {"title": "Schemas", "version": "2"},
+		"jsonSchemaDialect": "https://json-schema.org/draft/2020-12/schema",
+		"paths": {
+			"/api/v1/orders/{order_id}/items": {
+				"get": {
+					"operationId": "getApiV1OrdersOrderIdItems",
+					"parameters": [{"name": "order_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+					"responses": {
+						"200": {
+							"description": "A /api/v1/orders/{order_id}/items payload.",
+							"content": {"application/json": {"schema": {"$ref": "#/components/schemas/ApiV1OrdersOrderIdItems"}}}
+						}
+					}
+				}
+			}
+		},
+		"components": {
+			"schemas": {
+				"ApiV1OrdersOrderIdItems": {"type": "array", "x-haven-resource": "/api/v1/orders/{order_id}/items", "x-haven-version": 2},
+				"Pets": {"type": "object", "x-haven-resource": "pets", "x-haven-version": 1},
+				"Pets2": {"type": "string", "x-haven-resource": "Pets", "x-haven-version": 1}
+			}
+		}
+	}`
+	got, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(unmarshal(t, want), unmarshal(t, string(got))); diff != "" {
+		t.Errorf("OpenAPI() got a diff: %s", diff)
+	}
+	// The schemas given are not modified.
+	if _, ok := schemas[0].Schema["$id"]; !ok {
+		t.Errorf("OpenAPI() modified the schema")
+	}
+
+	doc = OpenAPI(schemas, OpenAPIOptions{})
+	if doc.Paths != nil {
+		t.Errorf("OpenAPI() without paths got paths %v", doc.Paths)
+	}
+}
@@ -0,0 +1,265 @@
+package schemaconv
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Well known types representing JSON values without a schema.
+const (
+	protoValue  = "google.protobuf.Value"
+	protoStruct = "google.protobuf.Struct"
+	protoImport = "google/protobuf/struct.proto"
+)
+
+// protoScalars are the scalar types of the generated fields, messages have presence already.
+var protoScalars = map[string]bool{"string": true, "double": true, "int64": true, "bool": true}
+
+var (
+	protoIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	protoFieldChars = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+)
+
+type protoGenerator struct {
+	names   names
+	pending []pendingType
+	// paths are the schema paths of the pending messages, for errors.
+	paths   map[string]string
+	imports map[string]bool
+	// numbers are the field numbers of the objects of the resource being converted, by schema
+	// path.
+	numbers map[string]*protoNumbers
+}
+
+// protoNumbers are the field numbers of the properties an object has had in any version.
+type protoNumbers struct {
+	byName map[string]int
+	names  []string
+}
+
+// number returns the number of the property, assigning the next one if it is new.
+func (pn *protoNumbers) number(name string) int {
+	if n, ok := pn.byName[name]; ok {
+		return n
+	}
+	pn.names = append(pn.names, name)
+	pn.byName[name] = len(pn.names)
+	return len(pn.names)
+}
+
+// numberFields assigns numbers to the properties of the objects of the schema that do not have
+// one yet, in order.
+func (g *protoGenerator) numberFields(n *Node, path string) {
+	if len(n.Properties) > 0 {
+		pn, ok := g.numbers[path]
+		if !ok {
+			pn = &protoNumbers{byName: map[string]int{}}
+			g.numbers[path] = pn
+		}
+		for _, p := range n.Properties {
+			pn.number(p.Name)
+		}
+	}
+	for _, p := range n.Properties {
+		g.numberFields(p.Node, path+"/properties/"+escapePointer(p.Name))
+	}
+	if n.Items != nil {
+		g.numberFields(n.Items, path+"/items")
+	}
+}
+
+// typeOf returns the protobuf type of the node at path and whether it is repeated, queueing
+// the messages it needs. name is the name of the message if the node is an object with
+// properties.
+func (g *protoGenerator) typeOf(n *Node, name, path string) (string, bool, error) {
+	if len(n.Types) != 1 {
+		g.imports[protoImport] = true
+		return protoValue, false, nil
+	}
+	switch n.Types[0] {
+	case TypeString:
+		return "string", false, nil
+	case TypeNumber:
+		return "double", false, nil
+	case TypeInteger:
+		return "int64", false, nil
+	case TypeBoolean:
+		return "bool", false, nil
+	case TypeArray:
+		if n.Items == nil {
+			g.imports[protoImport] = true
+			return protoValue, true, nil
+		}
+		typ, repeated, err := g.typeOf(n.Items, name+"Item", path+"/items")
+		if err != nil {
+			return "", false, err
+		}
+		if repeated {
+			return "", false, errorf(path+"/items", "arrays of arrays can not be represented in protobuf")
+		}
+		if n.Items.Nullable && typ != protoValue {
+			return "", false, errorf(path+"/items", "null array items can not be represented in protobuf")
+		}
+		return typ, true, nil
+	}
+	if len(n.Properties) == 0 {
+		g.imports[protoImport] = true
+		return protoStruct, false, nil
+	}
+	if !protoIdentifier.MatchString(name) {
+		return "", false, errorf(path, "%q is not a valid protobuf message name", name)
+	}
+	name = g.names.unique(name)
+	g.pending = append(g.pending, pendingType{name: name, node: n})
+	g.paths[name] = path
+	return name, false, nil
+}
+
+// protoFieldName turns a property name into a field name, e.g. "created-at" into
+// "created_at".
+func protoFieldName(name string) string {
+	field := strings.Trim(protoFieldChars.ReplaceAllString(name, "_"), "_")
+	if field == "" || unicode.IsDigit(rune(field[0])) {
+		field = "x_" + field
+	}
+	return field
+}
+
+// protoJSONName returns the JSON name protobuf gives to a field by default, e.g. "createdAt"
+// for "created_at".
+func protoJSONName(field string) string {
+	var b strings.Builder
+	upper := false
+	for _, r := range field {
+		if r == '_' {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (g *protoGenerator) writeMessage(b *bytes.Buffer, s pendingType) error {
+	path := g.paths[s.name]
+	numbers := g.numbers[path]
+	fmt.Fprintf(b, "message %s {\n", s.name)
+	fields := names{}
+	present := map[string]bool{}
+	for _, p := range s.node.Properties {
+		propPath := path + "/properties/" + escapePointer(p.Name)
+		typ, repeated, err := g.typeOf(p.Node, s.name+Identifier(p.Name), propPath)
+		if err != nil {
+			return err
+		}
+		label := ""
+		switch {
+		case repeated:
+			label = "repeated "
+		case (p.Node.Nullable || !p.Required) && protoScalars[typ]:
+			// Scalars need explicit presence to tell missing and null values from zero values.
+			label = "optional "
+		}
+		field := fields.unique(protoFieldName(p.Name))
+		present[p.Name] = true
+		option := ""
+		if protoJSONName(field) != p.Name {
+			option = fmt.Sprintf(" [json_name = %s]", strconv.Quote(p.Name))
+		}
+		fmt.Fprintf(b, "  %s%s %s = %d%s;\n", label, typ, field, numbers.number(p.Name), option)
+	}
+	// The numbers and names of removed properties must not be reused.
+	var reservedNumbers, reservedNames []string
+	for i, name := range numbers.names {
+		if present[name] {
+			continue
+		}
+		reservedNumbers = append(reservedNumbers, strconv.Itoa(i+1))
+		if field := protoFieldName(name); !fields[field] {
+			fields[field] = true
+			reservedNames = append(reservedNames, strconv.Quote(field))
+		}
+	}
+	if len(reservedNumbers) > 0 {
+		fmt.Fprintf(b, "  reserved %s;\n", strings.Join(reservedNumbers, ", "))
+	}
+	if len(reservedNames) > 0 {
+		fmt.Fprintf(b, "  reserved %s;\n", strings.Join(reservedNames, ", "))
+	}
+	b.WriteString("}\n")
+	return nil
+}
+
+// Proto returns a proto3 file of package pkg with a message for each schema. Objects become
+// messages named after the resource and the path of the property, arrays become repeated
+// fields and optional or nullable scalars become optional fields. Unions of several types and
+// values of any type become google.protobuf.Value, objects without properties
+// google.protobuf.Struct. Schemas that are not objects and constructs protobuf can not
+// represent, such as arrays of arrays, are reported as an *Error.
+//
+// Fields are numbered in the order properties first appear in the History of the resource and
+// then in its schema, so messages of different versions are wire compatible. The numbers and
+// names of removed properties are reserved.
+func Proto(pkg string, schemas []Schema) ([]byte, error) {
+	g := &protoGenerator{names: names{}, paths: map[string]string{}, imports: map[string]bool{}}
+	var messages bytes.Buffer
+	for _, s := range schemas {
+		g.numbers = map[string]*protoNumbers{}
+		for i, schema := range s.History {
+			n, err := Parse(schema)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse schema history %d of %s: %w", i, s.Resource, err)
+			}
+			g.numberFields(n, "")
+		}
+		n, err := Parse(s.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse schema of %s: %w", s.Resource, err)
+		}
+		g.numberFields(n, "")
+		if !n.Is(TypeObject) || len(n.Properties) == 0 {
+			return nil, fmt.Errorf("failed to convert schema of %s: %w", s.Resource, errorf("", "only objects with properties can be represented as protobuf messages"))
+		}
+		name, _, err := g.typeOf(n, Identifier(s.Resource), "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert schema of %s: %w", s.Resource, err)
+		}
+		fmt.Fprintf(&messages, "\n// %s is the schema of resource %s.\n", name, commentText(s.Resource))
+		for i := 0; len(g.pending) > 0; i++ {
+			m := g.pending[0]
+			g.pending = g.pending[1:]
+			if i > 0 {
+				messages.WriteString("\n")
+			}
+			if err := g.writeMessage(&messages, m); err != nil {
+				return nil, fmt.Errorf("failed to convert schema of %s: %w", s.Resource, err)
+			}
+		}
+	}
+
+	var b bytes.Buffer
+	generated(&b, "//", schemas)
+	fmt.Fprintf(&b, "\nsyntax = \"proto3\";\n\npackage %s;\n", pkg)
+	imports := make([]string, 0, len(g.imports))
+	for imp := range g.imports {
+		imports = append(imports, imp)
+	}
+	sort.Strings(imports)
+	if len(imports) > 0 {
+		b.WriteString("\n")
+	}
+	for _, imp := range imports {
+		fmt.Fprintf(&b, "import %s;\n", strconv.Quote(imp))
+	}
+	b.Write(messages.Bytes())
+	return b.Bytes(), nil
+}
@@ -0,0 +1,153 @@
+package schemaconv
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestProto(t *testing.T) {
+	schemas := []Schema{
+		{Resource: "/api/v1/users", Version: 3, Schema: unmarshal(t, usersSchema)},
+		{Resource: "events", Schema: unmarshal(t, `{
+			"type": "object",
+			"required": ["id"],
+			"properties": {
+				"id": {"type": "integer"},
+				"created-at": {"type": "string"},
+				"2fa": {"type": "boolean"},
+				"data": {"type": "object"},
+				"items": {"type": "array", "items": {"type": "object", "properties": {"n": {"type": "number"}}}}
+			}
+		}`)},
+	}
+	want := `// Code generated by haven from the schemas of the resources below. DO NOT EDIT.
+//   /api/v1/users version 3
+//   events
+
+syntax = "proto3";
+
+package models;
+
+import "google/protobuf/struct.proto";
+
+// ApiV1Users is the schema of resource /api/v1/users.
+message ApiV1Users {
+  ApiV1UsersAddress address = 1;
+  google.protobuf.Value age = 2;
+  optional string created_at = 3 [json_name = "created_at"];
+  repeated google.protobuf.Value mixed = 4;
+  optional string name = 5;
+  optional double score = 6;
+  repeated string tags = 7;
+}
+
+message ApiV1UsersAddress {
+  string city = 1;
+  optional string zip = 2;
+}
+
+// Events is the schema of resource events.
+message Events {
+  optional bool x_2fa = 1 [json_name = "2fa"];
+  optional string created_at = 2 [json_name = "created-at"];
+  google.protobuf.Struct data = 3;
+  int64 id = 4;
+  repeated EventsItemsItem items = 5;
+}
+
+message EventsItemsItem {
+  optional double n = 1;
+}
+`
+	got, err := Proto("models", schemas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Proto() got a diff: %s", diff)
+	}
+
+	// Imports are only added when needed.
+	got, err = Proto("a.b", []Schema{{Resource: "a", Schema: unmarshal(t, `{"properties": {"a": {"type": "string"}}}`)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "// Code generated by haven from the schemas of the resources below. DO NOT EDIT.\n//   a\n\nsyntax = \"proto3\";\n\npackage a.b;\n\n// A is the schema of resource a.\nmessage A {\n  optional string a = 1;\n}\n"
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Proto() got a diff: %s", diff)
+	}
+}
+
+func TestProtoHistory(t *testing.T) {
+	s := Schema{
+		Resource: "orders",
+		History: []map[string]any{
+			unmarshal(t, `{"properties": {"id": {"type": "integer"}, "lines": {"type": "array", "items": {"properties": {"sku": {"type": "string"}}}}}}`),
+			unmarshal(t, `{"properties": {"id": {"type": "integer"}, "lines": {"type": "array", "items": {"properties": {"sku": {"type": "string"}, "qty": {"type": "integer"}}}}, "note": {"type": "string"}}}`),
+		},
+		Schema: unmarshal(t, `{"properties": {"id": {"type": "integer"}, "created": {"type": "string"}, "lines": {"type": "array", "items": {"properties": {"qty": {"type": "integer"}}}}}}`),
+	}
+	want := `// Code generated by haven from the schemas of the resources below. DO NOT EDIT.
+//   orders
+
+syntax = "proto3";
+
+package models;
+
+// Orders is the schema of resource orders.
+message Orders {
+  optional string created = 4;
+  optional int64 id = 1;
+  repeated OrdersLinesItem lines = 2;
+  reserved 3;
+  reserved "note";
+}
+
+message OrdersLinesItem {
+  optional int64 qty = 2;
+  reserved 1;
+  reserved "sku";
+}
+`
+	got, err := Proto("models", []Schema{s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Proto() got a diff: %s", diff)
+	}
+
+	s.History = append(s.History, map[string]any{"type": "x"})
+	if _, err := Proto("models", []Schema{s}); err == nil {
+		t.Error("Proto() with an invalid history got no error")
+	}
+}
+
+func TestProtoErrors(t *testing.T) {
+	cases := []struct {
+		schema string
+		want   string
+	}{
+		{schema: `{"type": "array", "items": {"type": "string"}}`, want: "(root): only objects with properties can be represented as protobuf messages"},
+		{schema: `{"type": "object"}`, want: "(root): only objects with properties can be represented as protobuf messages"},
+		{
+			schema: `{"properties": {"a": {"type": "array", "items": {"type": "array", "items": {"type": "string"}}}}}`,
+			want:   "/properties/a/items: arrays of arrays can not be represented in protobuf",
+		},
+		{
+			schema: `{"properties": {"a": {"type": "array", "items": {"type": ["null", "string"]}}}}`,
+			want:   "/properties/a/items: null array items can not be represented in protobuf",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.want, func(t *testing.T) {
+			_, err := Proto("models", []Schema{{Resource: "a", Schema: unmarshal(t, tc.schema)}})
+			var convErr *Error
+			if !errors.As(err, &convErr) || convErr.Error() != tc.want {
+				t.Errorf("Proto() got error %v, want %s", err, tc.want)
+			}
+		})
+	}
+}
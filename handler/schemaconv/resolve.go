@@ -0,0 +1,144 @@
+package schemaconv
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Documents are JSON documents by name, e.g. the files of a JSON Schema bundle. A $ref to
+// another document is resolved relative to the name of the referencing one, like a relative
+// URL.
+type Documents map[string]any
+
+// lookup returns the value at the JSON pointer of the document.
+func (d Documents) lookup(doc, pointer string) (any, error) {
+	v, ok := d[doc]
+	if !ok {
+		return nil, fmt.Errorf("document %q not found", doc)
+	}
+	if pointer == "" {
+		return v, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("unsupported pointer %q", pointer)
+	}
+	for _, token := range strings.Split(pointer[1:], "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		switch node := v.(type) {
+		case map[string]any:
+			if v, ok = node[token]; !ok {
+				return nil, fmt.Errorf("%s#%s not found", doc, pointer)
+			}
+		case []any:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, fmt.Errorf("%s#%s not found", doc, pointer)
+			}
+			v = node[i]
+		default:
+			return nil, fmt.Errorf("%s#%s not found", doc, pointer)
+		}
+	}
+	return v, nil
+}
+
+// target returns the document and pointer a $ref in doc points to.
+func target(doc, ref string) (string, string, error) {
+	file, fragment, _ := strings.Cut(ref, "#")
+	if strings.Contains(file, "://") {
+		return "", "", fmt.Errorf("remote $ref %q is not supported", ref)
+	}
+	pointer, err := url.PathUnescape(fragment)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid $ref %q: %v", ref, err)
+	}
+	if file == "" {
+		return doc, pointer, nil
+	}
+	if strings.HasPrefix(file, "/") {
+		return path.Clean(file), pointer, nil
+	}
+	return path.Join(path.Dir(doc), file), pointer, nil
+}
+
+// resolve returns a copy of v with every $ref inlined. stack holds the references being
+// resolved to detect cycles.
+func (d Documents) resolve(v any, doc string, stack []string) (any, error) {
+	switch node := v.(type) {
+	case map[string]any:
+		resolved := make(map[string]any, len(node))
+		if ref, ok := node["$ref"].(string); ok {
+			targetDoc, pointer, err := target(doc, ref)
+			if err != nil {
+				return nil, err
+			}
+			key := targetDoc + "#" + pointer
+			for _, k := range stack {
+				if k == key {
+					return nil, fmt.Errorf("recursive $ref %q can not be inlined", ref)
+				}
+			}
+			referenced, err := d.lookup(targetDoc, pointer)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve $ref %q: %v", ref, err)
+			}
+			inlined, err := d.resolve(referenced, targetDoc, append(stack, key))
+			if err != nil {
+				return nil, err
+			}
+			m, ok := inlined.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("$ref %q is not a schema", ref)
+			}
+			for k, v := range m {
+				if k == "$id" || k == "$schema" || k == "$defs" || k == "definitions" {
+					continue
+				}
+				resolved[k] = v
+			}
+		}
+		// Keywords next to a $ref take precedence over the referenced ones.
+		for k, v := range node {
+			if k == "$ref" {
+				continue
+			}
+			r, err := d.resolve(v, doc, stack)
+			if err != nil {
+				return nil, err
+			}
+			resolved[k] = r
+		}
+		return resolved, nil
+	case []any:
+		resolved := make([]any, len(node))
+		for i, item := range node {
+			r, err := d.resolve(item, doc, stack)
+			if err != nil {
+				return nil, err
+			}
+			resolved[i] = r
+		}
+		return resolved, nil
+	}
+	return v, nil
+}
+
+// Resolve returns a copy of the schema in the document with every $ref inlined. Recursive
+// references can't be inlined and are an error. The definitions of the schema are dropped
+// since nothing refers to them anymore.
+func (d Documents) Resolve(doc string, schema any) (map[string]any, error) {
+	resolved, err := d.resolve(schema, doc, nil)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := resolved.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("schema is not an object")
+	}
+	delete(m, "$defs")
+	delete(m, "definitions")
+	return m, nil
+}
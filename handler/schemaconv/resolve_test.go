@@ -0,0 +1,86 @@
+package schemaconv
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestResolve(t *testing.T) {
+	docs := Documents{
+		"schemas/users.json": unmarshal(t, `{
+			"$id": "users",
+			"type": "object",
+			"properties": {
+				"address": {"$ref": "common/address.json"},
+				"tags": {"type": "array", "items": {"$ref": "#/$defs/tag"}},
+				"nick": {"$ref": "#/$defs/tag", "description": "Nickname."}
+			},
+			"$defs": {"tag": {"type": "string", "description": "A tag."}}
+		}`),
+		"schemas/common/address.json": unmarshal(t, `{
+			"$id": "address",
+			"type": "object",
+			"properties": {"city": {"$ref": "../users.json#/$defs/tag"}, "zip": {"$ref": "address.json#/definitions/zip"}},
+			"definitions": {"zip": {"type": "string"}}
+		}`),
+	}
+	got, err := docs.Resolve("schemas/users.json", docs["schemas/users.json"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := unmarshal(t, `{
+		"$id": "users",
+		"type": "object",
+		"properties": {
+			"address": {
+				"type": "object",
+				"properties": {"city": {"type": "string", "description": "A tag."}, "zip": {"type": "string"}}
+			},
+			"tags": {"type": "array", "items": {"type": "string", "description": "A tag."}},
+			"nick": {"type": "string", "description": "Nickname."}
+		}
+	}`)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Resolve() got a diff: %s", diff)
+	}
+	// The documents are not modified.
+	if _, ok := docs["schemas/users.json"].(map[string]any)["$defs"]; !ok {
+		t.Errorf("Resolve() modified the document")
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	cases := []struct {
+		schema string
+		want   string
+	}{
+		{schema: `{"$ref": "#/$defs/a"}`, want: `failed to resolve $ref "#/$defs/a": doc.json#/$defs/a not found`},
+		{schema: `{"$ref": "other.json"}`, want: `document "other.json" not found`},
+		{schema: `{"$ref": "https://example.com/a.json"}`, want: `remote $ref "https://example.com/a.json" is not supported`},
+		{schema: `{"$ref": "#a"}`, want: `unsupported pointer "a"`},
+		{schema: `{"$ref": "#/%zz"}`, want: `invalid $ref "#/%zz"`},
+		{schema: `{"$ref": "#/$defs/a/1", "$defs": {"a": [1]}}`, want: `doc.json#/$defs/a/1 not found`},
+		{schema: `{"$ref": "#/$defs/a/0", "$defs": {"a": [1]}}`, want: `$ref "#/$defs/a/0" is not a schema`},
+		{schema: `{"$ref": "#/type/a", "type": "object"}`, want: `doc.json#/type/a not found`},
+		{
+			schema: `{"properties": {"next": {"$ref": "#/$defs/node"}}, "$defs": {"node": {"properties": {"next": {"$ref": "#/$defs/node"}}}}}`,
+			want:   `recursive $ref "#/$defs/node" can not be inlined`,
+		},
+		{schema: `{"anyOf": [{"$ref": "#/x"}]}`, want: `doc.json#/x not found`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.want, func(t *testing.T) {
+			docs := Documents{"doc.json": unmarshal(t, tc.schema)}
+			_, err := docs.Resolve("doc.json", docs["doc.json"])
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Resolve() got error %v, want %s", err, tc.want)
+			}
+		})
+	}
+
+	if _, err := (Documents{}).Resolve("", []any{}); err == nil {
+		t.Errorf("Resolve() of an array got no error")
+	}
+}
@@ -0,0 +1,283 @@
+// Package schemaconv converts the JSON schemas learned by Haven into other type systems.
+//
+// Schemas are first parsed into a Node, which flattens the constructs produced by
+// jsonutils.CreateSchema and jsonutils.ExpandSchema (type arrays such as ["null", "string"]
+// and anyOf unions) into the set of JSON types a value may have.
+package schemaconv
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// JSON types.
+const (
+	TypeString  = "string"
+	TypeNumber  = "number"
+	TypeInteger = "integer"
+	TypeBoolean = "boolean"
+	TypeObject  = "object"
+	TypeArray   = "array"
+	TypeNull    = "null"
+)
+
+// Node is a parsed schema.
+type Node struct {
+	// Types are the non null JSON types of the value, sorted. Empty means any value unless
+	// Nullable is set, in which case the value is always null.
+	Types []string
+	// Nullable is set if the value may be null.
+	Nullable bool
+	// Properties of object values, sorted by name.
+	Properties []Property
+	// Items is the schema of the items of array values, nil for any item.
+	Items *Node
+}
+
+// Property is a property of an object schema.
+type Property struct {
+	Name     string
+	Required bool
+	Node     *Node
+}
+
+// Is reports whether the value has the single JSON type typ.
+func (n *Node) Is(typ string) bool {
+	return len(n.Types) == 1 && n.Types[0] == typ
+}
+
+// Any reports whether the value can be of any type, including null.
+func (n *Node) Any() bool {
+	return len(n.Types) == 0 && !n.Nullable
+}
+
+// Error is a schema construct that can not be converted.
+type Error struct {
+	// Path is the JSON pointer of the construct in the schema.
+	Path   string
+	Reason string
+}
+
+func (e *Error) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "(root)"
+	}
+	return fmt.Sprintf("%s: %s", path, e.Reason)
+}
+
+func errorf(path, format string, args ...any) error {
+	return &Error{Path: path, Reason: fmt.Sprintf(format, args...)}
+}
+
+// Parse parses the schema of a resource.
+func Parse(schema map[string]any) (*Node, error) {
+	return parse(schema, "")
+}
+
+func parse(schema map[string]any, path string) (*Node, error) {
+	if _, ok := schema["$ref"]; ok {
+		return nil, errorf(path, "$ref is not supported")
+	}
+	n := &Node{}
+	types := make(map[string]bool)
+	switch t := schema["type"].(type) {
+	case nil:
+	case string:
+		types[t] = true
+	case []any:
+		for _, v := range t {
+			s, ok := v.(string)
+			if !ok {
+				return nil, errorf(path+"/type", "type %v is not a string", v)
+			}
+			types[s] = true
+		}
+	default:
+		return nil, errorf(path+"/type", "type %v is not a string or an array", t)
+	}
+	for typ := range types {
+		switch typ {
+		case TypeString, TypeNumber, TypeInteger, TypeBoolean, TypeObject, TypeArray, TypeNull:
+		default:
+			return nil, errorf(path+"/type", "unknown type %q", typ)
+		}
+	}
+
+	if props, ok := schema["properties"]; ok {
+		m, ok := props.(map[string]any)
+		if !ok {
+			return nil, errorf(path+"/properties", "properties is not an object")
+		}
+		required := make(map[string]bool)
+		switch r := schema["required"].(type) {
+		case []any:
+			for _, name := range r {
+				if s, ok := name.(string); ok {
+					required[s] = true
+				}
+			}
+		case []string:
+			for _, name := range r {
+				required[name] = true
+			}
+		}
+		for name, v := range m {
+			propPath := path + "/properties/" + escapePointer(name)
+			s, ok := v.(map[string]any)
+			if !ok {
+				return nil, errorf(propPath, "property schema is not an object")
+			}
+			prop, err := parse(s, propPath)
+			if err != nil {
+				return nil, err
+			}
+			n.Properties = append(n.Properties, Property{Name: name, Required: required[name], Node: prop})
+		}
+		sort.Slice(n.Properties, func(i, j int) bool { return n.Properties[i].Name < n.Properties[j].Name })
+		if len(types) == 0 {
+			types[TypeObject] = true
+		}
+	}
+	if items, ok := schema["items"]; ok {
+		s, ok := items.(map[string]any)
+		if !ok {
+			return nil, errorf(path+"/items", "items is not a schema")
+		}
+		item, err := parse(s, path+"/items")
+		if err != nil {
+			return nil, err
+		}
+		n.Items = item
+		if len(types) == 0 {
+			types[TypeArray] = true
+		}
+	}
+
+	anyVariant := false
+	objectVariants := 0
+	for _, keyword := range []string{"anyOf", "oneOf"} {
+		variants, ok := schema[keyword]
+		if !ok {
+			continue
+		}
+		list, ok := variants.([]any)
+		if !ok {
+			return nil, errorf(path+"/"+keyword, "%s is not an array", keyword)
+		}
+		for i, v := range list {
+			variantPath := fmt.Sprintf("%s/%s/%d", path, keyword, i)
+			s, ok := v.(map[string]any)
+			if !ok {
+				return nil, errorf(variantPath, "variant is not a schema")
+			}
+			variant, err := parse(s, variantPath)
+			if err != nil {
+				return nil, err
+			}
+			if variant.Any() {
+				// A variant accepting anything makes the union accept anything.
+				anyVariant = true
+			}
+			for _, typ := range variant.Types {
+				types[typ] = true
+			}
+			n.Nullable = n.Nullable || variant.Nullable
+			n.merge(variant, objectVariants == 0)
+			if len(variant.Properties) > 0 {
+				objectVariants++
+			}
+		}
+	}
+
+	if types[TypeNull] {
+		n.Nullable = true
+		delete(types, TypeNull)
+	}
+	if anyVariant {
+		return &Node{}, nil
+	}
+	if types[TypeInteger] && types[TypeNumber] {
+		delete(types, TypeInteger)
+	}
+	for typ := range types {
+		n.Types = append(n.Types, typ)
+	}
+	sort.Strings(n.Types)
+	return n, nil
+}
+
+// merge adds the properties and items of a union variant to the node. Properties are only
+// required if every object variant requires them.
+func (n *Node) merge(variant *Node, firstObject bool) {
+	if variant.Items != nil && n.Items == nil {
+		n.Items = variant.Items
+	}
+	if len(variant.Properties) == 0 {
+		return
+	}
+	if firstObject {
+		n.Properties = append(n.Properties, variant.Properties...)
+		return
+	}
+	inVariant := make(map[string]Property)
+	for _, p := range variant.Properties {
+		inVariant[p.Name] = p
+	}
+	for i, p := range n.Properties {
+		vp, ok := inVariant[p.Name]
+		n.Properties[i].Required = p.Required && ok && vp.Required
+		delete(inVariant, p.Name)
+	}
+	for _, p := range variant.Properties {
+		if _, ok := inVariant[p.Name]; ok {
+			p.Required = false
+			n.Properties = append(n.Properties, p)
+		}
+	}
+	sort.Slice(n.Properties, func(i, j int) bool { return n.Properties[i].Name < n.Properties[j].Name })
+}
+
+func escapePointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+// Identifier turns a resource or property name into an exported identifier, e.g.
+// "/api/v1/payments" into "ApiV1Payments" and "created_at" into "CreatedAt".
+func Identifier(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	id := b.String()
+	if id == "" {
+		return "X"
+	}
+	if unicode.IsDigit([]rune(id)[0]) {
+		return "X" + id
+	}
+	return id
+}
+
+// names hands out unique identifiers.
+type names map[string]bool
+
+func (ns names) unique(id string) string {
+	candidate := id
+	for i := 2; ns[candidate]; i++ {
+		candidate = fmt.Sprintf("%s%d", id, i)
+	}
+	ns[candidate] = true
+	return candidate
+}
@@ -0,0 +1,143 @@
+package schemaconv
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// usersSchema was learned by Haven from a few payloads.
+const usersSchema = `{
+	"$id": "https://movinglake.com/haven.schema.json",
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"additionalProperties": false,
+	"title": "/api/v1/users",
+	"type": "object",
+	"required": ["address", "age", "mixed", "name", "tags"],
+	"properties": {
+		"address": {
+			"type": "object",
+			"required": ["city"],
+			"properties": {"city": {"type": "string"}, "zip": {"type": "string"}}
+		},
+		"age": {"type": ["number", "string"]},
+		"created_at": {"type": "string"},
+		"mixed": {"type": "array", "items": {"anyOf": [{"type": "number"}, {"type": "string"}]}},
+		"name": {"type": ["null", "string"]},
+		"score": {"type": "number"},
+		"tags": {"type": "array", "items": {"type": "string"}}
+	}
+}`
+
+func unmarshal(t *testing.T, s string) map[string]any {
+	t.Helper()
+	var schema map[string]any
+	if err := json.Unmarshal([]byte(s), &schema); err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		name   string
+		schema string
+		want   *Node
+	}{
+		{name: "empty", schema: `{}`, want: &Node{}},
+		{name: "nullable", schema: `{"type": ["string", "null"]}`, want: &Node{Types: []string{"string"}, Nullable: true}},
+		{name: "only null", schema: `{"type": "null"}`, want: &Node{Nullable: true}},
+		{name: "integer and number", schema: `{"type": ["integer", "number"]}`, want: &Node{Types: []string{"number"}}},
+		{
+			name:   "any of",
+			schema: `{"anyOf": [{"type": "null"}, {"type": "string"}, {"type": "array", "items": {"type": "number"}}]}`,
+			want:   &Node{Types: []string{"array", "string"}, Nullable: true, Items: &Node{Types: []string{"number"}}},
+		},
+		{name: "any of anything", schema: `{"anyOf": [{"type": "null"}, {}]}`, want: &Node{}},
+		{
+			name: "one of objects",
+			schema: `{"oneOf": [
+				{"type": "object", "required": ["a", "b"], "properties": {"a": {"type": "string"}, "b": {"type": "string"}}},
+				{"type": "object", "required": ["a"], "properties": {"a": {"type": "string"}}}
+			]}`,
+			want: &Node{Types: []string{"object"}, Properties: []Property{
+				{Name: "a", Required: true, Node: &Node{Types: []string{"string"}}},
+				{Name: "b", Node: &Node{Types: []string{"string"}}},
+			}},
+		},
+		{
+			name:   "implicit types",
+			schema: `{"properties": {"a": {"items": {}}}}`,
+			want:   &Node{Types: []string{"object"}, Properties: []Property{{Name: "a", Node: &Node{Types: []string{"array"}, Items: &Node{}}}}},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Parse(unmarshal(t, tc.schema))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Parse() got a diff: %s", diff)
+			}
+		})
+	}
+
+	// Schemas fresh from CreateSchema have []string required properties.
+	got, err := Parse(map[string]any{
+		"type":       "object",
+		"required":   []string{"a"},
+		"properties": map[string]any{"a": map[string]any{"type": "string"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Properties[0].Required {
+		t.Errorf("Parse() did not read []string required properties")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := []struct {
+		schema string
+		want   string
+	}{
+		{schema: `{"$ref": "#/$defs/a"}`, want: "(root): $ref is not supported"},
+		{schema: `{"type": 1}`, want: "/type: type 1 is not a string or an array"},
+		{schema: `{"type": [1]}`, want: "/type: type 1 is not a string"},
+		{schema: `{"type": "date"}`, want: `/type: unknown type "date"`},
+		{schema: `{"properties": []}`, want: "/properties: properties is not an object"},
+		{schema: `{"properties": {"a/b": {"type": "string"}, "c": "string"}}`, want: "/properties/c: property schema is not an object"},
+		{schema: `{"properties": {"a/b": {"type": "str"}}}`, want: `/properties/a~1b/type: unknown type "str"`},
+		{schema: `{"items": []}`, want: "/items: items is not a schema"},
+		{schema: `{"items": {"$ref": "#"}}`, want: "/items: $ref is not supported"},
+		{schema: `{"anyOf": {}}`, want: "/anyOf: anyOf is not an array"},
+		{schema: `{"oneOf": [1]}`, want: "/oneOf/0: variant is not a schema"},
+		{schema: `{"anyOf": [{"type": "x"}]}`, want: `/anyOf/0/type: unknown type "x"`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.want, func(t *testing.T) {
+			_, err := Parse(unmarshal(t, tc.schema))
+			if err == nil || err.Error() != tc.want {
+				t.Errorf("Parse() got error %v, want %s", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestIdentifier(t *testing.T) {
+	cases := map[string]string{
+		"/api/v1/payments": "ApiV1Payments",
+		"created_at":       "CreatedAt",
+		"userID":           "UserID",
+		"2fa":              "X2fa",
+		"$":                "X",
+		"año":              "Año",
+	}
+	for name, want := range cases {
+		if got := Identifier(name); got != want {
+			t.Errorf("Identifier(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package schemaconv
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var tsIdentifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+type tsGenerator struct {
+	names   names
+	pending []pendingType
+}
+
+// typeOf returns the TypeScript type of the node, queueing the interfaces it needs.
+func (g *tsGenerator) typeOf(n *Node, name string) string {
+	if n.Any() {
+		return "unknown"
+	}
+	var union []string
+	for _, typ := range n.Types {
+		switch typ {
+		case TypeString:
+			union = append(union, "string")
+		case TypeNumber, TypeInteger:
+			union = append(union, "number")
+		case TypeBoolean:
+			union = append(union, "boolean")
+		case TypeArray:
+			item := "unknown"
+			if n.Items != nil {
+				item = g.typeOf(n.Items, name+"Item")
+			}
+			if strings.Contains(item, " ") {
+				item = "(" + item + ")"
+			}
+			union = append(union, item+"[]")
+		case TypeObject:
+			if len(n.Properties) == 0 {
+				union = append(union, "Record<string, unknown>")
+				continue
+			}
+			iface := g.names.unique(name)
+			g.pending = append(g.pending, pendingType{name: iface, node: n})
+			union = append(union, iface)
+		}
+	}
+	if n.Nullable {
+		union = append(union, "null")
+	}
+	return strings.Join(union, " | ")
+}
+
+func (g *tsGenerator) writeInterface(b *bytes.Buffer, s pendingType) {
+	fmt.Fprintf(b, "export interface %s {\n", s.name)
+	for _, p := range s.node.Properties {
+		key := p.Name
+		if !tsIdentifier.MatchString(key) {
+			key = strconv.Quote(key)
+		}
+		if !p.Required {
+			key += "?"
+		}
+		fmt.Fprintf(b, "  %s: %s;\n", key, g.typeOf(p.Node, s.name+Identifier(p.Name)))
+	}
+	b.WriteString("}\n")
+}
+
+// TypeScript returns a TypeScript module exporting a type for each schema. Objects become
+// interfaces with optional properties for the ones not required, and unions of several types
+// become union types.
+func TypeScript(schemas []Schema) ([]byte, error) {
+	var b bytes.Buffer
+	generated(&b, "//", schemas)
+	g := &tsGenerator{names: names{}}
+	for _, s := range schemas {
+		n, err := Parse(s.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse schema of %s: %w", s.Resource, err)
+		}
+		name := g.names.unique(Identifier(s.Resource))
+		fmt.Fprintf(&b, "\n/** %s is the schema of resource %s. */\n", name, commentText(s.Resource))
+		if len(n.Properties) > 0 && n.Is(TypeObject) {
+			g.writeInterface(&b, pendingType{name: name, node: n})
+		} else {
+			fmt.Fprintf(&b, "export type %s = %s;\n", name, g.typeOf(n, name))
+		}
+		for len(g.pending) > 0 {
+			s := g.pending[0]
+			g.pending = g.pending[1:]
+			b.WriteString("\n")
+			g.writeInterface(&b, s)
+		}
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,63 @@
+package schemaconv
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTypeScript(t *testing.T) {
+	schemas := []Schema{
+		{Resource: "/api/v1/users", Version: 3, Schema: unmarshal(t, usersSchema)},
+		{Resource: "events", Version: 2, Schema: unmarshal(t, `{
+			"type": "array",
+			"items": {"type": ["object", "null"], "required": ["kind"], "properties": {
+				"kind": {"type": "string"},
+				"data-id": {"anyOf": [{"type": "number"}, {"type": "array", "items": {"type": ["string", "number"]}}]},
+				"extra": {"type": "object"},
+				"raw": {}
+			}}
+		}`)},
+	}
+	want := `// Code generated by haven from the schemas of the resources below. DO NOT EDIT.
+//   /api/v1/users version 3
+//   events version 2
+
+/** ApiV1Users is the schema of resource /api/v1/users. */
+export interface ApiV1Users {
+  address: ApiV1UsersAddress;
+  age: number | string;
+  created_at?: string;
+  mixed: (number | string)[];
+  name: string | null;
+  score?: number;
+  tags: string[];
+}
+
+export interface ApiV1UsersAddress {
+  city: string;
+  zip?: string;
+}
+
+/** Events is the schema of resource events. */
+export type Events = (EventsItem | null)[];
+
+export interface EventsItem {
+  "data-id"?: (number | string)[] | number;
+  extra?: Record<string, unknown>;
+  kind: string;
+  raw?: unknown;
+}
+`
+	got, err := TypeScript(schemas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("TypeScript() got a diff: %s", diff)
+	}
+
+	if _, err := TypeScript([]Schema{{Resource: "a", Schema: unmarshal(t, `{"type": "x"}`)}}); err == nil {
+		t.Errorf("TypeScript() of an invalid schema got no error")
+	}
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"movinglake.com/haven/handler/schemaconv"
+	"movinglake.com/haven/wrappers"
+)
+
+// Formats of the schemas returned by /api/v1/get_schema.
+const (
+	FormatJSONSchema = "json"
+	FormatAvro       = "avro"
+	FormatProto      = "proto"
+)
+
+// DefaultProtoPackage is the package of the generated .proto files.
+const DefaultProtoPackage = "models"
+
+var protoPackage = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+// AvroSchema returns the Avro schema of the resource.
+func (h *HavenAPIHandler) AvroSchema(name string) (any, error) {
+	schema, err := h.ResourceSchema(name)
+	if err != nil {
+		return nil, err
+	}
+	avro, err := schemaconv.Avro(*schema)
+	if err != nil {
+		return nil, newAPIError(http.StatusUnprocessableEntity, "%v", err)
+	}
+	return avro, nil
+}
+
+// ProtoSchema returns a .proto file of package pkg with the messages of the resource.
+func (h *HavenAPIHandler) ProtoSchema(name, pkg string) ([]byte, error) {
+	if !protoPackage.MatchString(pkg) {
+		return nil, newAPIError(http.StatusBadRequest, "invalid proto package name: %q", pkg)
+	}
+	schema, res, err := h.resourceSchema(name)
+	if err != nil {
+		return nil, err
+	}
+	if schema.History, err = h.schemaHistory(res); err != nil {
+		return nil, err
+	}
+	proto, err := schemaconv.Proto(pkg, []schemaconv.Schema{*schema})
+	if err != nil {
+		return nil, newAPIError(http.StatusUnprocessableEntity, "%v", err)
+	}
+	return proto, nil
+}
+
+// schemaHistory returns the schemas of the versions of the resource, oldest first.
+func (h *HavenAPIHandler) schemaHistory(res *wrappers.Resource) ([]map[string]any, error) {
+	versions, err := h.db.GetResourceVersions(res.ID)
+	if err != nil {
+		return nil, newAPIError(http.StatusInternalServerError, "failed to get resource versions from db: %v", err)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	history := make([]map[string]any, 0, len(versions))
+	for _, v := range versions {
+		schema := make(map[string]any)
+		if err := json.Unmarshal([]byte(v.NewSchema), &schema); err != nil {
+			return nil, newAPIError(http.StatusInternalServerError, "failed to unmarshal schema of version %d: %v", v.Version, err)
+		}
+		history = append(history, schema)
+	}
+	return history, nil
+}
+
+// convertedSchema responds with the schema of the resource in the ?format= format: the Avro
+// schema JSON or a .proto file in the ?package= package.
+func (h *HavenAPIHandler) convertedSchema(c *gin.Context, format string) {
+	var response APIResponse
+	name := c.Params.ByName("name")
+	switch format {
+	case FormatAvro:
+		avro, err := h.AvroSchema(name)
+		if err != nil {
+			response.Error = err.Error()
+			c.JSON(statusCode(err), response)
+			return
+		}
+		c.JSON(http.StatusOK, avro)
+	case FormatProto:
+		proto, err := h.ProtoSchema(name, c.DefaultQuery("package", DefaultProtoPackage))
+		if err != nil {
+			response.Error = err.Error()
+			c.JSON(statusCode(err), response)
+			return
+		}
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", proto)
+	default:
+		response.Error = fmt.Sprintf("unknown format: %s", format)
+		c.JSON(http.StatusBadRequest, response)
+	}
+}
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestGetSchemaFormats(t *testing.T) {
+	db, router := newBundleRouter()
+	postJSON(router, "/api/v1/add_payload", AddPayloadRequest{Resource: "users", Payload: map[string]any{"name": "Ann", "tags": []any{"a"}}})
+	postJSON(router, "/api/v1/set_schema", SetSchemaRequest{Resource: "any", Schema: map[string]any{"type": "object"}})
+	postJSON(router, "/api/v1/set_schema", SetSchemaRequest{Resource: "dashes", Schema: map[string]any{"properties": map[string]any{"a-b": map[string]any{"type": "string"}}}})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, path, nil))
+		return response
+	}
+
+	response := get("/api/v1/get_schema/users?format=avro")
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	var avro map[string]any
+	json.Unmarshal(response.Body.Bytes(), &avro)
+	assert.Equal(t, "record", avro["type"])
+	assert.Equal(t, "Users", avro["name"])
+	assert.Equal(t, []any{
+		map[string]any{"name": "name", "type": "string"},
+		map[string]any{"name": "tags", "type": map[string]any{"type": "array", "items": "string"}},
+	}, avro["fields"])
+
+	response = get("/api/v1/get_schema/users?format=proto&package=acme.users")
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	assert.Equal(t, "text/plain; charset=utf-8", response.Header().Get("Content-Type"))
+	assert.Contains(t, response.Body.String(), "package acme.users;\n")
+	assert.Contains(t, response.Body.String(), "message Users {\n  string name = 1;\n  repeated string tags = 2;\n}\n")
+
+	// Fields keep their numbers in later versions and the numbers of removed ones are reserved.
+	postJSON(router, "/api/v1/add_payload", AddPayloadRequest{Resource: "users", Payload: map[string]any{"name": "Bob", "age": 30}})
+	response = get("/api/v1/get_schema/users?format=proto")
+	assert.Contains(t, response.Body.String(), "message Users {\n  optional double age = 3;\n  string name = 1;\n  repeated string tags = 2;\n}\n")
+	postJSON(router, "/api/v1/set_schema", SetSchemaRequest{Resource: "users", Schema: map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"name": map[string]any{"type": "string"}, "email": map[string]any{"type": "string"}},
+	}})
+	response = get("/api/v1/get_schema/users?format=proto")
+	assert.Contains(t, response.Body.String(), "message Users {\n  optional string email = 4;\n  optional string name = 1;\n  reserved 2, 3;\n  reserved \"tags\", \"age\";\n}\n")
+
+	// JSON Schema stays the default.
+	response = get("/api/v1/get_schema/users?format=json")
+	var resp GetSchemaResponse
+	json.Unmarshal(response.Body.Bytes(), &resp)
+	assert.Equal(t, "object", resp.Schema["type"])
+
+	cases := []struct {
+		name     string
+		path     string
+		dbErrors map[string]error
+		wantCode int
+	}{
+		{name: "unknown format", path: "/api/v1/get_schema/users?format=xml", wantCode: http.StatusBadRequest},
+		{name: "bad package", path: "/api/v1/get_schema/users?format=proto&package=a-b", wantCode: http.StatusBadRequest},
+		{name: "not found", path: "/api/v1/get_schema/nope?format=avro", wantCode: http.StatusNotFound},
+		{name: "avro can't represent", path: "/api/v1/get_schema/dashes?format=avro", wantCode: http.StatusUnprocessableEntity},
+		{name: "proto can't represent", path: "/api/v1/get_schema/any?format=proto", wantCode: http.StatusUnprocessableEntity},
+		{name: "db fails", path: "/api/v1/get_schema/users?format=proto", dbErrors: map[string]error{"GetResource": gorm.ErrInvalidDB}, wantCode: http.StatusInternalServerError},
+		{name: "versions fail", path: "/api/v1/get_schema/users?format=proto", dbErrors: map[string]error{"GetResourceVersions": gorm.ErrInvalidDB}, wantCode: http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db.Errors = tc.dbErrors
+			response := get(tc.path)
+			assert.Equal(t, tc.wantCode, response.Code, response.Body.String())
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"movinglake.com/haven/handler/jsonutils"
+	"movinglake.com/haven/handler/schemaconv"
+)
+
+// Schema import actions reported per resource.
+const (
+	SchemaImportCreated = "created"
+	SchemaImportExists  = "exists"
+)
+
+type ImportSchemasRequest struct {
+	// OpenAPI is an OpenAPI 3 document whose JSON responses become resources.
+	OpenAPI map[string]any `json:"openapi"`
+	// Schemas are JSON Schema documents by file name. $refs between them are resolved
+	// relative to their names.
+	Schemas map[string]any `json:"schemas"`
+	// Resources are the names of the Schemas documents that become resources, all of them if
+	// empty.
+	Resources []string `json:"resources"`
+	// Template and Mapping name the resources of OpenAPI responses, see
+	// schemaconv.OpenAPIImportOptions.
+	Template string            `json:"template"`
+	Mapping  map[string]string `json:"mapping"`
+	DryRun   bool              `json:"dry_run"`
+}
+
+type SchemaImportResult struct {
+	Resource string `json:"resource"`
+	Source   string `json:"source"`
+	Action   string `json:"action"`
+}
+
+type ImportSchemasResponse struct {
+	APIResponse
+	Results []SchemaImportResult `json:"results"`
+}
+
+// ReadSchemas returns the schemas of the OpenAPI document or the JSON Schema documents of the
+// request.
+func ReadSchemas(request *ImportSchemasRequest) ([]schemaconv.ImportedSchema, error) {
+	if (request.OpenAPI == nil) == (request.Schemas == nil) {
+		return nil, newAPIError(http.StatusBadRequest, "either an openapi document or schemas are required")
+	}
+	var imported []schemaconv.ImportedSchema
+	var err error
+	if request.OpenAPI != nil {
+		imported, err = schemaconv.FromOpenAPI(request.OpenAPI, schemaconv.OpenAPIImportOptions{
+			Template: request.Template,
+			Mapping:  request.Mapping,
+		})
+	} else {
+		resources := request.Resources
+		if len(resources) == 0 {
+			for name := range request.Schemas {
+				resources = append(resources, name)
+			}
+			sort.Strings(resources)
+		}
+		imported, err = schemaconv.FromJSONSchemas(request.Schemas, resources)
+	}
+	if err != nil {
+		return nil, newAPIError(http.StatusBadRequest, "%v", err)
+	}
+	return imported, nil
+}
+
+// ImportSchemas creates a resource for every imported schema whose resource does not exist.
+// Existing resources are left untouched. All the schemas are checked before creating any.
+func (h *HavenAPIHandler) ImportSchemas(imported []schemaconv.ImportedSchema, dryRun bool) ([]SchemaImportResult, error) {
+	for _, s := range imported {
+		if s.Resource == "" {
+			return nil, newAPIError(http.StatusBadRequest, "%s: resource name is empty", s.Source)
+		}
+		if _, err := jsonutils.CompileSchema(s.Schema); err != nil {
+			return nil, newAPIError(http.StatusBadRequest, "%s: invalid schema for %s: %v", s.Source, s.Resource, err)
+		}
+	}
+	results := []SchemaImportResult{}
+	for _, s := range imported {
+		result := SchemaImportResult{Resource: s.Resource, Source: s.Source, Action: SchemaImportCreated}
+		existing, err := h.db.GetResource(s.Resource, nil)
+		if err != nil {
+			return results, newAPIError(http.StatusInternalServerError, "failed to get resource from db: %v", err)
+		}
+		if existing != nil {
+			result.Action = SchemaImportExists
+		} else if !dryRun {
+			if _, err := h.storeSchema(s.Resource, s.Schema, SourceImport); err != nil {
+				return results, err
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// importSchemas creates resources from an OpenAPI document or JSON Schema documents.
+func (h *HavenAPIHandler) importSchemas(c *gin.Context) {
+	var request ImportSchemasRequest
+	var response ImportSchemasResponse
+	if err := c.ShouldBindBodyWithJSON(&request); err != nil {
+		response.Error = fmt.Sprintf("failed to parse json request: %v", err)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+	imported, err := ReadSchemas(&request)
+	if err != nil {
+		response.Error = err.Error()
+		c.JSON(statusCode(err), response)
+		return
+	}
+	results, err := h.ImportSchemas(imported, request.DryRun)
+	response.Results = results
+	if err != nil {
+		response.Error = err.Error()
+		c.JSON(statusCode(err), response)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+const petstore = `{
+	"openapi": "3.1.0",
+	"paths": {
+		"/pets": {
+			"get": {"responses": {"200": {"content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Pet"}}}}}}},
+			"post": {"operationId": "createPet", "responses": {"201": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Pet"}}}}}}
+		}
+	},
+	"components": {
+		"schemas": {
+			"Pet": {"type": "object", "required": ["name"], "properties": {"name": {"type": "string"}}}
+		}
+	}
+}`
+
+func TestImportSchemas(t *testing.T) {
+	var openapi map[string]any
+	json.Unmarshal([]byte(petstore), &openapi)
+	db, router := newBundleRouter()
+	postJSON(router, "/api/v1/set_schema", SetSchemaRequest{Resource: "pet", Schema: map[string]any{"type": "object"}})
+
+	request := ImportSchemasRequest{OpenAPI: openapi, Mapping: map[string]string{"createPet": "pet"}, DryRun: true}
+	response := postJSON(router, "/api/v1/import_schemas", request)
+	assert.Equal(t, http.StatusOK, response.Code)
+	var resp ImportSchemasResponse
+	json.Unmarshal(response.Body.Bytes(), &resp)
+	want := []SchemaImportResult{
+		{Resource: "/pets", Source: "GET /pets 200", Action: SchemaImportCreated},
+		{Resource: "pet", Source: "POST /pets 201", Action: SchemaImportExists},
+	}
+	assert.Equal(t, want, resp.Results)
+	_, ok := db.Resource["/pets"]
+	assert.False(t, ok)
+
+	request.DryRun = false
+	response = postJSON(router, "/api/v1/import_schemas", request)
+	assert.Equal(t, http.StatusOK, response.Code)
+	json.Unmarshal(response.Body.Bytes(), &resp)
+	assert.Equal(t, want, resp.Results)
+	pets := db.Resource["/pets"]
+	assert.Equal(t, uint(1), pets.Version)
+	assert.Contains(t, pets.Schema, `"items":{"properties":{"name":{"type":"string"}},"required":["name"],"type":"object"}`)
+	assert.Equal(t, `{"type":"object"}`, db.Resource["pet"].Schema)
+
+	// Imported schemas are used to validate payloads.
+	response = postJSON(router, "/api/v1/validate_payload", ValidatePayloadRequest{Resource: "/pets", Payload: []any{map[string]any{}}})
+	var validation ValidatePayloadResponse
+	json.Unmarshal(response.Body.Bytes(), &validation)
+	assert.False(t, validation.Valid)
+
+	// JSON Schema documents.
+	response = postJSON(router, "/api/v1/import_schemas", ImportSchemasRequest{
+		Schemas: map[string]any{
+			"users.schema.json": map[string]any{"type": "object", "properties": map[string]any{"pet": map[string]any{"$ref": "defs/pet.json"}}},
+			"defs/pet.json":     map[string]any{"type": "object"},
+		},
+		Resources: []string{"users.schema.json"},
+	})
+	assert.Equal(t, http.StatusOK, response.Code)
+	json.Unmarshal(response.Body.Bytes(), &resp)
+	assert.Equal(t, []SchemaImportResult{{Resource: "users", Source: "users.schema.json", Action: SchemaImportCreated}}, resp.Results)
+	assert.Contains(t, db.Resource["users"].Schema, `"pet":{"type":"object"}`)
+}
+
+func TestImportSchemasErrors(t *testing.T) {
+	var openapi map[string]any
+	json.Unmarshal([]byte(petstore), &openapi)
+	cases := []struct {
+		name     string
+		body     any
+		dbErrors map[string]error
+		wantCode int
+	}{
+		{name: "bad json", body: "nope", wantCode: http.StatusBadRequest},
+		{name: "nothing to import", body: ImportSchemasRequest{}, wantCode: http.StatusBadRequest},
+		{name: "both kinds", body: ImportSchemasRequest{OpenAPI: openapi, Schemas: map[string]any{}}, wantCode: http.StatusBadRequest},
+		{name: "bad openapi", body: ImportSchemasRequest{OpenAPI: map[string]any{"swagger": "2.0"}}, wantCode: http.StatusBadRequest},
+		{name: "bad ref", body: ImportSchemasRequest{Schemas: map[string]any{"a.json": map[string]any{"$ref": "b.json"}}}, wantCode: http.StatusBadRequest},
+		{name: "empty name", body: ImportSchemasRequest{OpenAPI: openapi, Template: "{operationId}"}, wantCode: http.StatusBadRequest},
+		{name: "invalid schema", body: ImportSchemasRequest{Schemas: map[string]any{"a.json": map[string]any{"type": 1}}}, wantCode: http.StatusBadRequest},
+		{name: "db read fails", body: ImportSchemasRequest{OpenAPI: openapi}, dbErrors: map[string]error{"GetResource": gorm.ErrInvalidDB}, wantCode: http.StatusInternalServerError},
+		{name: "db save fails", body: ImportSchemasRequest{OpenAPI: openapi}, dbErrors: map[string]error{"Save": gorm.ErrInvalidDB}, wantCode: http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, router := newBundleRouter()
+			db.Errors = tc.dbErrors
+			response := postJSON(router, "/api/v1/import_schemas", tc.body)
+			assert.Equal(t, tc.wantCode, response.Code, response.Body.String())
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"movinglake.com/haven/wrappers"
+)
+
+// Events of the /api/v1/events stream.
+const (
+	StreamVersionAdded     = "version_added"
+	StreamValidationFailed = "validation_failed"
+)
+
+var streamEvents = map[string]bool{StreamVersionAdded: true, StreamValidationFailed: true}
+
+const (
+	// streamBuffer is the number of events kept for a subscriber that is not reading. Events
+	// beyond it are dropped for that subscriber.
+	streamBuffer = 64
+	// streamHeartbeat is how often idle streams get a comment, so proxies keep them open.
+	streamHeartbeat = 30 * time.Second
+	// maxStreamErrors limits the errors of validation_failed events.
+	maxStreamErrors = 10
+)
+
+// StreamEvent is an event of the /api/v1/events stream.
+type StreamEvent struct {
+	Event     string `json:"event"`
+	Namespace string `json:"namespace"`
+	Resource  string `json:"resource"`
+	// Version is the version added, or the version validated against.
+	Version uint `json:"version"`
+	// Failed is the number of payloads that failed validation, and Errors their errors.
+	Failed uint          `json:"failed,omitempty"`
+	Errors []StreamError `json:"errors,omitempty"`
+	At     time.Time     `json:"at"`
+}
+
+type StreamError struct {
+	Type string `json:"type"`
+	Path string `json:"path"`
+}
+
+// eventBroker fans the stream events out to the subscribed streams.
+type eventBroker struct {
+	mu   sync.Mutex
+	subs map[chan StreamEvent]bool
+}
+
+func newEventBroker() *eventBroker {
+	return &eventBroker{subs: make(map[chan StreamEvent]bool)}
+}
+
+func (b *eventBroker) subscribe() chan StreamEvent {
+	ch := make(chan StreamEvent, streamBuffer)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs[ch] = true
+	return ch
+}
+
+func (b *eventBroker) unsubscribe(ch chan StreamEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subs, ch)
+}
+
+// publish sends the event to every subscriber without blocking, subscribers with a full
+// buffer miss it.
+func (b *eventBroker) publish(ev StreamEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+			log.Printf("event stream is full, dropping %s of resource %s", ev.Event, ev.Resource)
+		}
+	}
+}
+
+// publishValidations streams the failures of validation results.
+func (h *HavenAPIHandler) publishValidations(res *wrappers.Resource, inc wrappers.ValidationIncrement) {
+	if inc.Failed == 0 {
+		return
+	}
+	ev := StreamEvent{
+		Event:     StreamValidationFailed,
+		Namespace: res.Namespace,
+		Resource:  res.Name,
+		Version:   inc.Version,
+		Failed:    inc.Failed,
+		At:        inc.At,
+	}
+	for i, e := range inc.Errors {
+		if i == maxStreamErrors {
+			break
+		}
+		ev.Errors = append(ev.Errors, StreamError{Type: e.Type, Path: e.Path})
+	}
+	h.events.publish(ev)
+}
+
+// streamEvents streams the schema events of the namespace as Server-Sent Events until the
+// client goes away. They can be filtered by one or more ?resource= and ?event=.
+func (h *HavenAPIHandler) streamEvents(c *gin.Context) {
+	resources := make(map[string]bool)
+	for _, r := range c.QueryArray("resource") {
+		resources[r] = true
+	}
+	events := make(map[string]bool)
+	for _, e := range c.QueryArray("event") {
+		if !streamEvents[e] {
+			c.JSON(http.StatusBadRequest, APIResponse{Error: fmt.Sprintf("unknown event %q", e)})
+			return
+		}
+		events[e] = true
+	}
+	ch := h.events.subscribe()
+	defer h.events.unsubscribe(ch)
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	// The comment tells clients the subscription is in place.
+	io.WriteString(c.Writer, ": connected\n\n")
+	c.Writer.Flush()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-heartbeat.C:
+			io.WriteString(w, ": ping\n\n")
+		case ev := <-ch:
+			if ev.Namespace == h.namespace && (len(resources) == 0 || resources[ev.Resource]) && (len(events) == 0 || events[ev.Event]) {
+				c.SSEvent(ev.Event, ev)
+			}
+		}
+		return true
+	})
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"movinglake.com/haven/wrappers"
+)
+
+// readStreamEvent returns the next event of an SSE stream, skipping comments.
+func readStreamEvent(t *testing.T, r *bufio.Reader) (string, StreamEvent) {
+	var name string
+	var ev StreamEvent
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed to read stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			name = line[len("event:"):]
+		case strings.HasPrefix(line, "data:"):
+			assert.NoError(t, json.Unmarshal([]byte(line[len("data:"):]), &ev))
+		case line == "" && name != "":
+			return name, ev
+		}
+	}
+}
+
+// openStream connects to the event stream and waits for the subscription to be in place.
+func openStream(t *testing.T, url string) *bufio.Reader {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("failed to open stream: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	r := bufio.NewReader(resp.Body)
+	line, err := r.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, ": connected\n", line)
+	return r
+}
+
+func TestStreamEvents(t *testing.T) {
+	db := wrappers.NewTestDB()
+	handler := NewHavenAPIHandler(db, nil)
+	router := gin.Default()
+	handler.RegisterRoutes(router)
+	server := httptest.NewServer(router)
+	// Streams are closed before the server, which waits for them.
+	t.Cleanup(server.Close)
+
+	users := openStream(t, server.URL+"/api/v1/events?resource=users")
+	failures := openStream(t, server.URL+"/api/v1/events?event=validation_failed")
+
+	postJSON(router, "/api/v1/add_payload", AddPayloadRequest{Resource: "orders", Payload: map[string]any{"id": 1}})
+	postJSON(router, "/api/v1/add_payload", AddPayloadRequest{Resource: "users", Payload: map[string]any{"name": "Ann"}})
+	postJSON(router, "/api/v1/validate_payload", ValidatePayloadRequest{Resource: "users", Payload: map[string]any{"name": 1}})
+
+	name, ev := readStreamEvent(t, users)
+	assert.Equal(t, StreamVersionAdded, name)
+	assert.Equal(t, "users", ev.Resource)
+	assert.Equal(t, uint(1), ev.Version)
+	name, ev = readStreamEvent(t, users)
+	assert.Equal(t, StreamValidationFailed, name)
+	assert.Equal(t, uint(1), ev.Failed)
+	assert.Equal(t, 1, len(ev.Errors))
+	assert.Equal(t, "invalid_type", ev.Errors[0].Type)
+
+	name, ev = readStreamEvent(t, failures)
+	assert.Equal(t, StreamValidationFailed, name)
+	assert.Equal(t, "users", ev.Resource)
+
+	resp, err := http.Get(server.URL + "/api/v1/events?event=proposal_created")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestEventBroker(t *testing.T) {
+	b := newEventBroker()
+	ch := b.subscribe()
+	for i := 0; i < streamBuffer+1; i++ {
+		b.publish(StreamEvent{Event: StreamVersionAdded, Version: uint(i), At: time.Now()})
+	}
+	// Slow subscribers miss events instead of blocking the publisher.
+	assert.Equal(t, streamBuffer, len(ch))
+	b.unsubscribe(ch)
+	b.publish(StreamEvent{Event: StreamVersionAdded})
+	assert.Equal(t, streamBuffer, len(ch))
+}
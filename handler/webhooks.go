@@ -0,0 +1,390 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"movinglake.com/haven/handler/notifications"
+	"movinglake.com/haven/wrappers"
+)
+
+// Events posted to webhook subscriptions.
+const (
+	WebhookResourceCreated = "resource_created"
+	WebhookVersionAdded    = notifications.EventVersionAdded
+)
+
+// Headers of the requests posted to webhook subscriptions, besides the
+// notifications.SignatureHeader.
+const (
+	WebhookEventHeader    = "X-Haven-Event"
+	WebhookDeliveryHeader = "X-Haven-Delivery"
+)
+
+var webhookEvents = map[string]bool{WebhookResourceCreated: true, WebhookVersionAdded: true}
+
+// WebhookEvent is the body posted to webhook subscriptions.
+type WebhookEvent struct {
+	Event     string                   `json:"event"`
+	Namespace string                   `json:"namespace"`
+	Resource  string                   `json:"resource"`
+	Version   ResourceVersionsResponse `json:"version"`
+	// CreatedAt is when the event happened, deliveries retried later keep it.
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WebhookSubscription struct {
+	ID  uint   `json:"id"`
+	URL string `json:"url"`
+	// Signed tells whether the subscription has a secret, which is never returned.
+	Signed    bool      `json:"signed"`
+	Events    []string  `json:"events"`
+	Resource  string    `json:"resource"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type GetWebhooksResponse struct {
+	APIResponse
+	Webhooks []WebhookSubscription `json:"webhooks"`
+}
+
+// SetWebhookRequest creates a webhook subscription, or replaces the one with the ID if set.
+type SetWebhookRequest struct {
+	ID  uint   `json:"id"`
+	URL string `json:"url"`
+	// Secret signs the bodies posted. Replacing a subscription without one keeps its secret,
+	// unless RemoveSecret is set.
+	Secret       string `json:"secret"`
+	RemoveSecret bool   `json:"remove_secret"`
+	// Events are the events posted, empty posts every event.
+	Events []string `json:"events"`
+	// Resource is a glob matching the resources whose events are posted, empty matches all.
+	Resource string `json:"resource"`
+}
+
+type SetWebhookResponse struct {
+	APIResponse
+	Webhook WebhookSubscription `json:"webhook"`
+}
+
+type DeleteWebhookRequest struct {
+	ID uint `json:"id"`
+}
+
+type DeleteWebhookResponse struct {
+	APIResponse
+	Deleted int64 `json:"deleted"`
+}
+
+type WebhookDelivery struct {
+	ID            uint       `json:"id"`
+	Event         string     `json:"event"`
+	Resource      string     `json:"resource"`
+	Status        string     `json:"status"`
+	Attempts      uint       `json:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	ResponseCode  int        `json:"response_code"`
+	LastError     string     `json:"last_error"`
+	DeliveredAt   *time.Time `json:"delivered_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+type GetWebhookDeliveriesResponse struct {
+	APIResponse
+	Deliveries []WebhookDelivery `json:"deliveries"`
+}
+
+func newWebhookSubscription(s wrappers.WebhookSubscriptions) WebhookSubscription {
+	sub := WebhookSubscription{
+		ID:        s.ID,
+		URL:       s.URL,
+		Signed:    s.Secret != "",
+		Events:    []string{},
+		Resource:  s.Resource,
+		CreatedAt: s.CreatedAt,
+		UpdatedAt: s.UpdatedAt,
+	}
+	if s.Events != "" {
+		sub.Events = strings.Split(s.Events, ",")
+	}
+	return sub
+}
+
+func newWebhookDelivery(row wrappers.WebhookDeliveries) WebhookDelivery {
+	return WebhookDelivery{
+		ID:            row.ID,
+		Event:         row.Event,
+		Resource:      row.Resource,
+		Status:        row.Status,
+		Attempts:      row.Attempts,
+		NextAttemptAt: row.NextAttemptAt,
+		ResponseCode:  row.ResponseCode,
+		LastError:     row.LastError,
+		DeliveredAt:   row.DeliveredAt,
+		CreatedAt:     row.CreatedAt,
+	}
+}
+
+// subscribed reports whether the subscription posts the event of the resource.
+func subscribed(s wrappers.WebhookSubscriptions, event, resource string) bool {
+	if s.Events != "" && !strings.Contains(","+s.Events+",", ","+event+",") {
+		return false
+	}
+	if s.Resource == "" {
+		return true
+	}
+	re, err := resourcePattern(s.Resource, false)
+	if err != nil {
+		log.Printf("invalid resource pattern %q of webhook %d: %v", s.Resource, s.ID, err)
+		return false
+	}
+	return re.MatchString(resource)
+}
+
+// enqueueWebhooks writes the events of a new version to the deliveries of the subscriptions in
+// the transaction. The first version of a resource also creates it.
+func (h *HavenAPIHandler) enqueueWebhooks(rv *wrappers.ResourceVersions, tx *gorm.DB) error {
+	subs, err := h.db.GetWebhookSubscriptions()
+	if err != nil {
+		return newAPIError(http.StatusInternalServerError, "failed to get webhooks from db: %v", err)
+	}
+	if len(subs) == 0 {
+		return nil
+	}
+	v := *rv
+	if v.ResourceID == 0 {
+		v.ResourceID = int(v.Resource.ID)
+	}
+	version, err := newResourceVersionsResponse(v)
+	if err != nil {
+		return newAPIError(http.StatusInternalServerError, "%v", err)
+	}
+	events := []string{WebhookVersionAdded}
+	if rv.Version == 1 {
+		events = []string{WebhookResourceCreated, WebhookVersionAdded}
+	}
+	now := time.Now()
+	for _, event := range events {
+		body, err := json.Marshal(WebhookEvent{Event: event, Namespace: h.namespace, Resource: rv.Resource.Name, Version: version, CreatedAt: now.UTC()})
+		if err != nil {
+			return newAPIError(http.StatusInternalServerError, "failed to marshal webhook event: %v", err)
+		}
+		for _, s := range subs {
+			if !subscribed(s, event, rv.Resource.Name) {
+				continue
+			}
+			row := &wrappers.WebhookDeliveries{
+				SubscriptionID: s.ID,
+				Event:          event,
+				Resource:       rv.Resource.Name,
+				Body:           string(body),
+				Status:         wrappers.DeliveryPending,
+				NextAttemptAt:  now,
+			}
+			if err := h.db.Save(row, tx); err != nil {
+				return newAPIError(http.StatusInternalServerError, "failed to save webhook delivery: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// deliverWebhook posts a webhook delivery and records the result, scheduling a retry or
+// dead-lettering it if it failed.
+func (h *HavenAPIHandler) deliverWebhook(cfg OutboxConfig, row *wrappers.WebhookDeliveries, now time.Time) error {
+	header := http.Header{}
+	header.Set(WebhookEventHeader, row.Event)
+	header.Set(WebhookDeliveryHeader, strconv.FormatUint(uint64(row.ID), 10))
+	code, err := notifications.PostSigned(row.Subscription.URL, row.Subscription.Secret, []byte(row.Body), header)
+	row.Attempts++
+	row.ResponseCode = code
+	switch {
+	case err == nil:
+		row.Status = wrappers.DeliveryDelivered
+		row.DeliveredAt = &now
+		row.LastError = ""
+	case row.Attempts >= cfg.MaxAttempts:
+		log.Printf("giving up on webhook delivery %d after %d attempts: %v", row.ID, row.Attempts, err)
+		row.Status = wrappers.DeliveryDead
+		row.LastError = err.Error()
+	default:
+		log.Printf("failed to deliver webhook %d: %v", row.ID, err)
+		row.NextAttemptAt = now.Add(cfg.backoff(row.Attempts))
+		row.LastError = err.Error()
+	}
+	// The subscription is only loaded, saving it would update it.
+	row.Subscription = wrappers.WebhookSubscriptions{}
+	return h.db.Save(row, nil)
+}
+
+// DeliverWebhooks posts the webhook deliveries due at now and returns how many were
+// attempted.
+func (h *HavenAPIHandler) DeliverWebhooks(cfg OutboxConfig, now time.Time) (int, error) {
+	rows, err := h.db.ClaimDueWebhookDeliveries(now, cfg.Lease, cfg.BatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim due webhook deliveries: %w", err)
+	}
+	for i := range rows {
+		if err := h.deliverWebhook(cfg, &rows[i], now); err != nil {
+			return i, fmt.Errorf("failed to save webhook delivery %d: %w", rows[i].ID, err)
+		}
+	}
+	return len(rows), nil
+}
+
+// SetWebhook creates or replaces a webhook subscription.
+func (h *HavenAPIHandler) SetWebhook(request SetWebhookRequest) (*wrappers.WebhookSubscriptions, error) {
+	u, err := url.Parse(request.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, newAPIError(http.StatusBadRequest, "invalid webhook url %q", request.URL)
+	}
+	for _, e := range request.Events {
+		if !webhookEvents[e] {
+			return nil, newAPIError(http.StatusBadRequest, "unknown webhook event %q", e)
+		}
+	}
+	if _, err := resourcePattern(request.Resource, false); err != nil {
+		return nil, newAPIError(http.StatusBadRequest, "invalid resource pattern %q: %v", request.Resource, err)
+	}
+	if request.Secret != "" && request.RemoveSecret {
+		return nil, newAPIError(http.StatusBadRequest, "secret and remove_secret are exclusive")
+	}
+	sub := &wrappers.WebhookSubscriptions{}
+	if request.ID != 0 {
+		existing, err := h.db.GetWebhookSubscription(request.ID)
+		if err != nil {
+			return nil, newAPIError(http.StatusInternalServerError, "failed to get webhook from db: %v", err)
+		}
+		if existing == nil {
+			return nil, newAPIError(http.StatusNotFound, "webhook not found: %d", request.ID)
+		}
+		sub = existing
+	}
+	sub.URL = request.URL
+	if request.Secret != "" || request.RemoveSecret {
+		sub.Secret = request.Secret
+	}
+	sub.Events = strings.Join(request.Events, ",")
+	sub.Resource = request.Resource
+	if err := h.db.Save(sub, nil); err != nil {
+		return nil, newAPIError(http.StatusInternalServerError, "failed to save webhook: %v", err)
+	}
+	return sub, nil
+}
+
+// getWebhooks lists the webhook subscriptions.
+func (h *HavenAPIHandler) getWebhooks(c *gin.Context) {
+	var response GetWebhooksResponse
+	subs, err := h.db.GetWebhookSubscriptions()
+	if err != nil {
+		response.Error = fmt.Sprintf("failed to get webhooks from db: %v", err)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+	response.Webhooks = make([]WebhookSubscription, len(subs))
+	for i, s := range subs {
+		response.Webhooks[i] = newWebhookSubscription(s)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// setWebhook creates or replaces a webhook subscription.
+func (h *HavenAPIHandler) setWebhook(c *gin.Context) {
+	var request SetWebhookRequest
+	var response SetWebhookResponse
+	if err := c.ShouldBindBodyWithJSON(&request); err != nil {
+		response.Error = fmt.Sprintf("failed to parse json request: %v", err)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+	sub, err := h.SetWebhook(request)
+	if err != nil {
+		response.Error = err.Error()
+		c.JSON(statusCode(err), response)
+		return
+	}
+	response.Webhook = newWebhookSubscription(*sub)
+	c.JSON(http.StatusOK, response)
+}
+
+// deleteWebhook deletes a webhook subscription and its deliveries.
+func (h *HavenAPIHandler) deleteWebhook(c *gin.Context) {
+	var request DeleteWebhookRequest
+	var response DeleteWebhookResponse
+	if err := c.ShouldBindBodyWithJSON(&request); err != nil {
+		response.Error = fmt.Sprintf("failed to parse json request: %v", err)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+	deleted, err := h.db.DeleteWebhookSubscription(request.ID)
+	if err != nil {
+		response.Error = fmt.Sprintf("failed to delete webhook: %v", err)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+	if deleted == 0 {
+		response.Error = fmt.Sprintf("webhook not found: %d", request.ID)
+		c.JSON(http.StatusNotFound, response)
+		return
+	}
+	response.Deleted = deleted
+	c.JSON(http.StatusOK, response)
+}
+
+// getWebhookDeliveries lists the deliveries of a webhook subscription, newest first. It can be
+// filtered by ?resource= and ?status= and paginated with ?limit= and ?offset=.
+func (h *HavenAPIHandler) getWebhookDeliveries(c *gin.Context) {
+	var response GetWebhookDeliveriesResponse
+	id, err := strconv.ParseUint(c.Params.ByName("id"), 10, 32)
+	if err != nil {
+		response.Error = fmt.Sprintf("failed to parse id: %v", err)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+	filter := wrappers.OutboxFilter{Resource: c.Query("resource"), Status: c.Query("status")}
+	if v := c.Query("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil {
+			response.Error = fmt.Sprintf("failed to parse limit: %v", err)
+			c.JSON(http.StatusBadRequest, response)
+			return
+		}
+	}
+	if v := c.Query("offset"); v != "" {
+		if filter.Offset, err = strconv.Atoi(v); err != nil {
+			response.Error = fmt.Sprintf("failed to parse offset: %v", err)
+			c.JSON(http.StatusBadRequest, response)
+			return
+		}
+	}
+	sub, err := h.db.GetWebhookSubscription(uint(id))
+	if err != nil {
+		response.Error = fmt.Sprintf("failed to get webhook from db: %v", err)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+	if sub == nil {
+		response.Error = fmt.Sprintf("webhook not found: %d", id)
+		c.JSON(http.StatusNotFound, response)
+		return
+	}
+	rows, err := h.db.GetWebhookDeliveries(sub.ID, filter)
+	if err != nil {
+		response.Error = fmt.Sprintf("failed to get webhook deliveries from db: %v", err)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+	response.Deliveries = []WebhookDelivery{}
+	for _, row := range rows {
+		response.Deliveries = append(response.Deliveries, newWebhookDelivery(row))
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"movinglake.com/haven/handler/notifications"
+	"movinglake.com/haven/wrappers"
+)
+
+type webhookRequest struct {
+	path   string
+	header http.Header
+	body   []byte
+}
+
+func getWebhookDeliveries(router *gin.Engine, path string) (int, GetWebhookDeliveriesResponse) {
+	request := httptest.NewRequest(http.MethodGet, "/api/v1/get_webhook_deliveries/"+path, nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	var deliveries GetWebhookDeliveriesResponse
+	json.Unmarshal(response.Body.Bytes(), &deliveries)
+	return response.Code, deliveries
+}
+
+func TestWebhooks(t *testing.T) {
+	requests := make(chan webhookRequest, 10)
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- webhookRequest{path: r.URL.Path, header: r.Header, body: body}
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer server.Close()
+
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	handler := NewHavenAPIHandler(db, nil)
+	router := gin.Default()
+	handler.RegisterRoutes(router)
+	cfg := OutboxConfig{Backoff: time.Minute, MaxBackoff: time.Hour, MaxAttempts: 2, BatchSize: 10}
+
+	for _, request := range []SetWebhookRequest{
+		{URL: "ftp://example.com"},
+		{URL: "/hooks"},
+		{URL: server.URL, Events: []string{"resource_locked"}},
+	} {
+		response := postJSON(router, "/api/v1/set_webhook", request)
+		assert.Equal(t, http.StatusBadRequest, response.Code, request.URL)
+	}
+	response := postJSON(router, "/api/v1/set_webhook", SetWebhookRequest{ID: 42, URL: server.URL})
+	assert.Equal(t, http.StatusNotFound, response.Code)
+
+	response = postJSON(router, "/api/v1/set_webhook", SetWebhookRequest{URL: server.URL, Secret: "s3cr3t", Resource: "users"})
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	var created SetWebhookResponse
+	json.Unmarshal(response.Body.Bytes(), &created)
+	assert.True(t, created.Webhook.Signed)
+	assert.Equal(t, []string{}, created.Webhook.Events)
+	response = postJSON(router, "/api/v1/set_webhook", SetWebhookRequest{URL: server.URL + "/versions", Events: []string{WebhookVersionAdded}})
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+
+	// The first version creates the resource.
+	postJSON(router, "/api/v1/add_payload", AddPayloadRequest{Resource: "users", Payload: map[string]any{"name": "Ann"}})
+	postJSON(router, "/api/v1/add_payload", AddPayloadRequest{Resource: "users", Payload: map[string]any{"name": "Ann", "age": 30}})
+	postJSON(router, "/api/v1/set_schema", SetSchemaRequest{Resource: "orders", Schema: map[string]any{"type": "object"}})
+	attempted, err := handler.DeliverWebhooks(cfg, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 6, attempted)
+
+	var events []string
+	for i := 0; i < attempted; i++ {
+		r := <-requests
+		var ev WebhookEvent
+		assert.NoError(t, json.Unmarshal(r.body, &ev))
+		assert.Equal(t, ev.Event, r.header.Get(WebhookEventHeader))
+		assert.NotEmpty(t, r.header.Get(WebhookDeliveryHeader))
+		if r.path == "/versions" {
+			assert.Empty(t, r.header.Get(notifications.SignatureHeader))
+		} else {
+			assert.Equal(t, notifications.Sign("s3cr3t", r.body), r.header.Get(notifications.SignatureHeader))
+		}
+		events = append(events, fmt.Sprintf("%s %s %d", ev.Event, ev.Resource, ev.Version.Version))
+		if ev.Resource == "users" && ev.Version.Version == 2 {
+			assert.Equal(t, map[string]any{"type": "number"}, ev.Version.NewSchema["properties"].(map[string]any)["age"])
+			assert.NotEmpty(t, ev.Version.OldSchema)
+			assert.NotZero(t, ev.Version.ReferencePayload)
+		}
+	}
+	assert.ElementsMatch(t, []string{
+		"resource_created users 1",
+		"version_added users 1",
+		"version_added users 1",
+		"version_added users 2",
+		"version_added users 2",
+		"version_added orders 1",
+	}, events)
+
+	// Failed deliveries are retried, then dead-lettered.
+	status.Store(http.StatusServiceUnavailable)
+	postJSON(router, "/api/v1/set_schema", SetSchemaRequest{Resource: "orders", Schema: map[string]any{"type": "array"}})
+	now := time.Now()
+	for _, at := range []time.Time{now, now.Add(30 * time.Second), now.Add(time.Minute)} {
+		handler.DeliverWebhooks(cfg, at)
+	}
+	assert.Equal(t, 2, len(requests))
+	code, deliveries := getWebhookDeliveries(router, "2?status=dead")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, len(deliveries.Deliveries))
+	dead := deliveries.Deliveries[0]
+	assert.Equal(t, "orders", dead.Resource)
+	assert.Equal(t, uint(2), dead.Attempts)
+	assert.Equal(t, http.StatusServiceUnavailable, dead.ResponseCode)
+	assert.Contains(t, dead.LastError, "503")
+
+	_, deliveries = getWebhookDeliveries(router, "1")
+	assert.Equal(t, 3, len(deliveries.Deliveries))
+	for _, d := range deliveries.Deliveries {
+		assert.Equal(t, wrappers.DeliveryDelivered, d.Status)
+		assert.Equal(t, http.StatusOK, d.ResponseCode)
+	}
+	_, deliveries = getWebhookDeliveries(router, "2?limit=1&offset=1")
+	assert.Equal(t, 1, len(deliveries.Deliveries))
+	code, _ = getWebhookDeliveries(router, "42")
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _ = getWebhookDeliveries(router, "2?limit=x")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	response = postJSON(router, "/api/v1/delete_webhook", DeleteWebhookRequest{ID: 2})
+	assert.Equal(t, http.StatusOK, response.Code)
+	response = postJSON(router, "/api/v1/delete_webhook", DeleteWebhookRequest{ID: 2})
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	request := httptest.NewRequest(http.MethodGet, "/api/v1/get_webhooks", nil)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	var webhooks GetWebhooksResponse
+	json.Unmarshal(recorder.Body.Bytes(), &webhooks)
+	assert.Equal(t, 1, len(webhooks.Webhooks))
+	for _, d := range db.WebhookDeliveries {
+		assert.Equal(t, uint(1), d.SubscriptionID, "deliveries of deleted webhooks are deleted")
+	}
+
+	// Replacing a subscription keeps its secret unless it is removed.
+	response = postJSON(router, "/api/v1/set_webhook", SetWebhookRequest{ID: 1, URL: server.URL + "/users"})
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	assert.Equal(t, "s3cr3t", db.Webhooks[1].Secret)
+	response = postJSON(router, "/api/v1/set_webhook", SetWebhookRequest{ID: 1, URL: server.URL, Secret: "other", RemoveSecret: true})
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	response = postJSON(router, "/api/v1/set_webhook", SetWebhookRequest{ID: 1, URL: server.URL, RemoveSecret: true})
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	json.Unmarshal(response.Body.Bytes(), &created)
+	assert.False(t, created.Webhook.Signed)
+	assert.Empty(t, db.Webhooks[1].Secret)
+}
+
+func TestImportWebhooks(t *testing.T) {
+	db := wrappers.NewTestDB().(*wrappers.TestDB)
+	handler := NewHavenAPIHandler(db, nil)
+	router := gin.Default()
+	handler.RegisterRoutes(router)
+	response := postJSON(router, "/api/v1/set_webhook", SetWebhookRequest{URL: "http://example.com/hook"})
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+
+	// Imports don't notify, but their versions are posted to webhooks.
+	response = postJSON(router, "/api/v1/import_schemas", ImportSchemasRequest{Schemas: map[string]any{
+		"pets.json": map[string]any{"type": "object"},
+	}})
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	schema := map[string]any{"type": "array"}
+	bundle := Bundle{FormatVersion: BundleFormatVersion, Resources: []BundleResource{
+		{Name: "orders", Schema: schema, Version: 1, Versions: []BundleVersion{{Version: 1, NewSchema: schema}}},
+		{Name: "pets", Schema: schema, Version: 1},
+	}}
+	response = postJSON(router, "/api/v1/import?mode=replace", bundle)
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+
+	var events []string
+	for _, d := range db.WebhookDeliveries {
+		events = append(events, d.Event+" "+d.Resource)
+	}
+	assert.ElementsMatch(t, []string{
+		"resource_created pets",
+		"version_added pets",
+		"resource_created orders",
+		"version_added orders",
+		"version_added pets",
+	}, events)
+}
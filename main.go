@@ -1,32 +1,71 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"movinglake.com/haven/cli"
+	"movinglake.com/haven/consumer"
+	"movinglake.com/haven/gitsync"
 	"movinglake.com/haven/handler"
 	"movinglake.com/haven/wrappers"
 )
 
-func main() {
-	// Load dotenv.
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
-
-	// Get vars from env.
+// connectDB connects to the DB configured in the environment.
+func connectDB() (wrappers.DB, error) {
 	dbName := os.Getenv("DB_NAME")
 	dbUser := os.Getenv("DB_USER")
 	dbPass := os.Getenv("DB_PASS")
 	dbHost := os.Getenv("DB_HOST")
 	dbStr := fmt.Sprintf("host=%s user=%s dbname=%s password=%s", dbHost, dbUser, dbName, dbPass)
+	return wrappers.NewDB(dbStr)
+}
+
+func main() {
+	// Load dotenv. The environment may also be set without one, e.g. in CI.
+	err := godotenv.Load()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Fatalf("Error loading .env file: %v", err)
+	}
+
+	// Run subcommands.
+	if len(os.Args) > 1 {
+		env := cli.Env{
+			Stdout:    os.Stdout,
+			Stderr:    os.Stderr,
+			ConnectDB: connectDB,
+		}
+		switch os.Args[1] {
+		case "import":
+			os.Exit(cli.RunImport(os.Args[2:], env))
+		case "validate":
+			os.Exit(cli.RunValidate(os.Args[2:], env))
+		case "bundle":
+			os.Exit(cli.RunBundle(os.Args[2:], env))
+		case "sync":
+			os.Exit(cli.RunSync(os.Args[2:], env))
+		case "codegen":
+			os.Exit(cli.RunCodegen(os.Args[2:], env))
+		case "import-schemas":
+			os.Exit(cli.RunImportSchemas(os.Args[2:], env))
+		case "create-api-key":
+			os.Exit(cli.RunCreateAPIKey(os.Args[2:], env))
+		default:
+			fmt.Fprintf(os.Stderr, "unknown command %q, available commands: import, validate, bundle, sync, codegen, import-schemas, create-api-key\n", os.Args[1])
+			os.Exit(2)
+		}
+	}
 
 	// Create DB connection.
-	db, err := wrappers.NewDB(dbStr)
+	db, err := connectDB()
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -37,15 +76,108 @@ func main() {
 	}
 
 	nc := &handler.NotificationsConfig{
-		SlackToken:     os.Getenv("SLACK_TOKEN"),
-		SlackChannelID: os.Getenv("SLACK_CHANNEL"),
+		SlackToken:          os.Getenv("SLACK_TOKEN"),
+		SlackChannelID:      os.Getenv("SLACK_CHANNEL"),
+		WebhookURL:          os.Getenv("NOTIFY_WEBHOOK_URL"),
+		WebhookSecret:       os.Getenv("NOTIFY_WEBHOOK_SECRET"),
+		SMTPAddr:            os.Getenv("SMTP_ADDR"),
+		SMTPUsername:        os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:        os.Getenv("SMTP_PASSWORD"),
+		SMTPFrom:            os.Getenv("SMTP_FROM"),
+		TeamsWebhookURL:     os.Getenv("TEAMS_WEBHOOK_URL"),
+		PagerDutyRoutingKey: os.Getenv("PAGERDUTY_ROUTING_KEY"),
+		BaseURL:             os.Getenv("HAVEN_URL"),
+	}
+	if to := os.Getenv("SMTP_TO"); to != "" {
+		for _, addr := range strings.Split(to, ",") {
+			nc.SMTPTo = append(nc.SMTPTo, strings.TrimSpace(addr))
+		}
 	}
 
 	apiHandler := handler.NewHavenAPIHandler(db, nc)
 	htmlHandler := handler.NewHavenHTMLHandler(db)
+	// Require API keys, created with `haven create-api-key`, unless explicitly disabled.
+	if os.Getenv("HAVEN_INSECURE_NO_AUTH") == "true" {
+		log.Print("WARNING: HAVEN_INSECURE_NO_AUTH is set, anyone reaching Haven can read and change schemas and settings.")
+	} else {
+		apiHandler.RequireAPIKeys()
+		htmlHandler.RequireAPIKeys()
+		if keys, err := db.GetAPIKeys(); err == nil && len(keys) == 0 {
+			log.Print("No API keys exist yet, create the first one with `haven create-api-key -name ops -scopes admin`.")
+		}
+	}
+
+	// Deliver the notifications written to the outbox.
+	go apiHandler.RunOutbox(context.Background(), handler.DefaultOutboxConfig)
+	// Evaluate the alert rules on the validation counters.
+	go apiHandler.RunAlerts(context.Background(), handler.DefaultAlertInterval)
+	// Batch the notifications of digest routes.
+	go apiHandler.RunDigests(context.Background(), handler.DefaultDigestInterval)
+
+	// Mirror the schemas to git if a working tree is configured.
+	var syncer *gitsync.Syncer
+	if dir := os.Getenv("SCHEMA_SYNC_DIR"); dir != "" {
+		syncer = gitsync.New(gitsync.Config{
+			Dir:    dir,
+			Remote: os.Getenv("SCHEMA_SYNC_REMOTE"),
+			Branch: os.Getenv("SCHEMA_SYNC_BRANCH"),
+		}, apiHandler)
+		if err := syncer.Init(); err != nil {
+			log.Fatal(err)
+		}
+		apiHandler.OnVersion(syncer.VersionAdded)
+		go syncer.Run(context.Background())
+	}
+
+	// Consume topics if a broker is configured.
+	if brokers := os.Getenv("KAFKA_BROKERS"); brokers != "" {
+		topics, err := consumer.ParseTopics(os.Getenv("KAFKA_TOPICS"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		for i := range topics {
+			topics[i].RecordFailures = os.Getenv("KAFKA_RECORD_FAILURES") == "true"
+		}
+		groupID := os.Getenv("KAFKA_GROUP_ID")
+		if groupID == "" {
+			groupID = "haven"
+		}
+		namespace := os.Getenv("KAFKA_NAMESPACE")
+		if namespace == "" {
+			namespace = wrappers.DefaultNamespace
+		}
+		if !handler.ValidNamespace(namespace) {
+			log.Fatalf("invalid KAFKA_NAMESPACE %q", namespace)
+		}
+		reader := consumer.NewKafkaReader(strings.Split(brokers, ","), groupID, consumer.TopicNames(topics))
+		c := consumer.New(reader, apiHandler.InNamespace(namespace), topics)
+		if c.DeadLetterTopic = os.Getenv("KAFKA_DEAD_LETTER_TOPIC"); c.DeadLetterTopic != "" {
+			c.DeadLetter = consumer.NewKafkaWriter(strings.Split(brokers, ","))
+		}
+		if attempts := os.Getenv("KAFKA_MAX_ATTEMPTS"); attempts != "" {
+			if c.MaxAttempts, err = strconv.Atoi(attempts); err != nil {
+				log.Fatalf("invalid KAFKA_MAX_ATTEMPTS %q: %v", attempts, err)
+			}
+			if c.DeadLetter == nil {
+				log.Fatal("KAFKA_MAX_ATTEMPTS requires KAFKA_DEAD_LETTER_TOPIC")
+			}
+		}
+		go func() {
+			defer reader.Close()
+			if c.DeadLetter != nil {
+				defer c.DeadLetter.Close()
+			}
+			if err := c.Run(context.Background()); err != nil {
+				log.Fatal(err)
+			}
+		}()
+	}
 
 	r := gin.Default()
 	apiHandler.RegisterRoutes(r)
+	if syncer != nil {
+		syncer.RegisterRoutes(r, apiHandler.RequireScope(handler.ScopeAdmin))
+	}
 	htmlHandler.RegisterRoutes(r, "templates/*", "web_resources")
 	r.Run() // listen and serve on 0.0.0.0:8080
 }
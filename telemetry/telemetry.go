@@ -0,0 +1,137 @@
+// Package telemetry holds the Prometheus metrics Haven exposes on /metrics.
+package telemetry
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "haven"
+
+var (
+	// HTTPRequests counts the served requests by method, route and status code.
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests served by route.",
+	}, []string{"method", "route", "code"})
+
+	// HTTPRequestDuration observes the latency of the served requests by method and route.
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// Validations counts payload validations by namespace, resource and result (valid or
+	// invalid).
+	Validations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "validations_total",
+		Help:      "Number of payload validations by namespace, resource and result.",
+	}, []string{"namespace", "resource", "result"})
+
+	// SchemaVersions counts new schema versions by namespace, resource and source (payload or
+	// set_schema).
+	SchemaVersions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "schema_versions_total",
+		Help:      "Number of new schema versions by namespace, resource and source.",
+	}, []string{"namespace", "resource", "source"})
+
+	// ExpansionFailures counts payloads that could not be applied to the schema of a resource
+	// by namespace and resource.
+	ExpansionFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "schema_expansion_failures_total",
+		Help:      "Number of payloads that failed to expand the schema by namespace and resource.",
+	}, []string{"namespace", "resource"})
+
+	// DBTransactionDuration observes the duration of DB transactions by outcome (commit or rollback).
+	DBTransactionDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_transaction_duration_seconds",
+		Help:      "Duration of DB transactions by outcome.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"outcome"})
+
+	// NotificationErrors counts failed notification sends by sender.
+	NotificationErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notification_errors_total",
+		Help:      "Number of notifications that failed to be sent by sender.",
+	}, []string{"sender"})
+
+	// NotificationDeadLetters counts the notifications given up after the maximum number of
+	// delivery attempts by sender.
+	NotificationDeadLetters = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notification_dead_letters_total",
+		Help:      "Number of notifications dead-lettered after failing every delivery attempt by sender.",
+	}, []string{"sender"})
+
+	// UnroutedNotifications counts the notifications dropped because they match no notification
+	// route by event.
+	UnroutedNotifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_unrouted_total",
+		Help:      "Number of notifications dropped because they match no notification route by event.",
+	}, []string{"event"})
+
+	// ConsumedRecords counts the records read by the consumer by topic and outcome
+	// (processed, skipped, retried or dead_lettered).
+	ConsumedRecords = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "consumed_records_total",
+		Help:      "Number of records read from the message broker by topic and outcome.",
+	}, []string{"topic", "outcome"})
+
+	// GitSyncErrors counts the failed attempts to write versions to the git working tree.
+	GitSyncErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "git_sync_errors_total",
+		Help:      "Number of failed attempts to write schema versions to the git working tree.",
+	})
+
+	// GitSyncPending is the number of versions waiting to be written to the git working tree.
+	GitSyncPending = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "git_sync_pending",
+		Help:      "Number of schema versions waiting to be written to the git working tree.",
+	})
+)
+
+// Middleware records the count and latency of every request by the route it matched.
+// Requests that match no route are recorded under the "unmatched" route.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		HTTPRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		HTTPRequestDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
+
+// ObserveTransaction records the duration of a DB transaction that started at start.
+func ObserveTransaction(start time.Time, err error) {
+	outcome := "commit"
+	if err != nil {
+		outcome = "rollback"
+	}
+	DBTransactionDuration.WithLabelValues(outcome).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,57 @@
+package telemetry
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware())
+	router.GET("/api/v1/get_schema/:name", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{})
+	})
+	router.GET("/metrics", Handler())
+
+	before := testutil.ToFloat64(HTTPRequests.WithLabelValues("GET", "/api/v1/get_schema/:name", "200"))
+	unmatchedBefore := testutil.ToFloat64(HTTPRequests.WithLabelValues("GET", "unmatched", "404"))
+	for _, path := range []string{"/api/v1/get_schema/users", "/api/v1/get_schema/pets", "/nowhere"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	if got := testutil.ToFloat64(HTTPRequests.WithLabelValues("GET", "/api/v1/get_schema/:name", "200")) - before; got != 2 {
+		t.Errorf("expected 2 requests for the route, got %v", got)
+	}
+	if got := testutil.ToFloat64(HTTPRequests.WithLabelValues("GET", "unmatched", "404")) - unmatchedBefore; got != 1 {
+		t.Errorf("expected 1 unmatched request, got %v", got)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	for _, want := range []string{
+		`haven_http_requests_total{code="200",method="GET",route="/api/v1/get_schema/:name"}`,
+		`haven_http_request_duration_seconds_bucket{method="GET",route="/api/v1/get_schema/:name"`,
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("expected metrics output to contain %s", want)
+		}
+	}
+}
+
+func TestObserveTransaction(t *testing.T) {
+	ObserveTransaction(time.Now(), nil)
+	ObserveTransaction(time.Now(), errors.New("boom"))
+	if got := testutil.CollectAndCount(DBTransactionDuration); got != 2 {
+		t.Errorf("expected a series per outcome, got %d", got)
+	}
+}
@@ -7,18 +7,33 @@ import (
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+	"movinglake.com/haven/telemetry"
 
 	_ "github.com/lib/pq"
 )
 
+// DefaultNamespace is the namespace of the resources and settings created without one.
+const DefaultNamespace = "default"
+
 // Resource table stores the schema for a resource. E.g:
 // Name: guesty.com/api/v2/reservations
 // Schema: {json-schema}
+// Names are unique within a namespace.
 type Resource struct {
 	gorm.Model
-	Name    string `gorm:"index:idx_name,unique"`
-	Schema  string
-	Version uint
+	Namespace string `gorm:"uniqueIndex:idx_namespace_name;default:default"`
+	Name      string `gorm:"uniqueIndex:idx_namespace_name"`
+	Schema    string
+	Version   uint
+	// QuarantineLimit is the maximum number of quarantined payloads kept for the
+	// resource. Zero means the server default is used.
+	QuarantineLimit uint
+	// SampleRate is the fraction of streamed payloads that get validated. Zero validates
+	// all of them.
+	SampleRate float64
+	// SampleKeyPath is the dot separated path of the payload field hashed to decide whether
+	// a streamed payload is sampled. When empty the whole payload is hashed.
+	SampleKeyPath string
 }
 
 // ResourceVersions table stores how the schema has evolved over time. It also references
@@ -41,6 +56,235 @@ type ReferencePayloads struct {
 	Payload    string
 }
 
+// QuarantinedPayloads stores payloads that failed validation together with the
+// validation errors they produced and the resource version they were checked against.
+// The time of the validation is the CreatedAt field.
+type QuarantinedPayloads struct {
+	gorm.Model
+	ResourceID int      `gorm:"index"`
+	Resource   Resource `gorm:"constraint:OnDelete:CASCADE;"`
+	Version    uint
+	Payload    string
+	Errors     string
+}
+
+// QuarantineFilter narrows down the quarantined payloads returned by the DB.
+// Empty fields are ignored.
+type QuarantineFilter struct {
+	ResourceID uint
+	ErrorType  string
+	Path       string
+	Contains   string
+	Since      time.Time
+	Until      time.Time
+	Limit      int
+	Offset     int
+}
+
+// Granularities of the validation metric buckets.
+const (
+	GranularityMinute = "minute"
+	GranularityHour   = "hour"
+)
+
+// Granularities maps each supported bucket granularity to its duration.
+var Granularities = map[string]time.Duration{
+	GranularityMinute: time.Minute,
+	GranularityHour:   time.Hour,
+}
+
+// ValidationCounts counts the validations of a resource version within a time bucket.
+// Received counts every payload seen, including the ones skipped by sampling, while Total
+// counts the validated ones.
+type ValidationCounts struct {
+	ID          uint      `gorm:"primarykey"`
+	ResourceID  int       `gorm:"uniqueIndex:idx_validation_counts"`
+	Version     uint      `gorm:"uniqueIndex:idx_validation_counts"`
+	Granularity string    `gorm:"uniqueIndex:idx_validation_counts"`
+	Bucket      time.Time `gorm:"uniqueIndex:idx_validation_counts"`
+	Received    uint
+	Total       uint
+	Failed      uint
+}
+
+// ValidationErrorCounts counts the validation errors of a resource version by error type
+// and path within a time bucket.
+type ValidationErrorCounts struct {
+	ID          uint      `gorm:"primarykey"`
+	ResourceID  int       `gorm:"uniqueIndex:idx_validation_error_counts"`
+	Version     uint      `gorm:"uniqueIndex:idx_validation_error_counts"`
+	Granularity string    `gorm:"uniqueIndex:idx_validation_error_counts"`
+	Bucket      time.Time `gorm:"uniqueIndex:idx_validation_error_counts"`
+	ErrorType   string    `gorm:"uniqueIndex:idx_validation_error_counts"`
+	Path        string    `gorm:"uniqueIndex:idx_validation_error_counts"`
+	Count       uint
+}
+
+// NotificationRoutes maps notifications to senders. A notification is sent through every
+// route it matches, or through every sender if there are no routes.
+type NotificationRoutes struct {
+	gorm.Model
+	// Namespace is the namespace of the resources the route applies to.
+	Namespace string `gorm:"index;default:default"`
+	// Resource is a glob matching resource names, where * matches any characters including
+	// slashes, or a regular expression if Regex is set. Empty matches all resources.
+	Resource string
+	Regex    bool
+	// EventType and Severity restrict the route to an event type and severity, empty matches
+	// any.
+	EventType string
+	Severity  string
+	// Sender is the name of the sender, e.g. slack.
+	Sender string
+	// Channel overrides the destination of the sender, e.g. the Slack channel ID or the email
+	// recipients. Empty uses the configured one.
+	Channel string
+	// Digest batches the new versions going through the route into one summary per resource
+	// sent at most every Digest. Zero sends them right away.
+	Digest time.Duration
+}
+
+// Delivery statuses of outbox notifications.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+	// DeliveryDigest notifications wait to be summarized in a digest until NextAttemptAt, and
+	// are DeliveryDigested once the digest is in the outbox.
+	DeliveryDigest   = "digest"
+	DeliveryDigested = "digested"
+)
+
+// NotificationOutbox stores a notification to deliver through a sender. Rows are written in
+// the transaction of the event they are about and delivered by a background worker, which
+// retries failed deliveries until they are dead-lettered.
+type NotificationOutbox struct {
+	gorm.Model
+	Namespace string `gorm:"index;default:default"`
+	Resource  string `gorm:"index"`
+	Event     string
+	Sender    string
+	// Channel is the destination of the sender, empty for the configured one.
+	Channel string
+	// Notification is the JSON encoded notification.
+	Notification  string
+	Status        string    `gorm:"index:idx_outbox_due"`
+	NextAttemptAt time.Time `gorm:"index:idx_outbox_due"`
+	Attempts      uint
+	LastError     string
+	DeliveredAt   *time.Time
+}
+
+// OutboxFilter narrows down the outbox notifications returned by the DB. Empty fields are
+// ignored.
+type OutboxFilter struct {
+	Resource string
+	Status   string
+	Limit    int
+	Offset   int
+}
+
+// AlertRules are conditions on the validation counters of a resource that notify when they
+// start and stop holding. State, Value and ChangedAt are kept by the alert evaluator.
+type AlertRules struct {
+	gorm.Model
+	ResourceID int      `gorm:"index"`
+	Resource   Resource `gorm:"constraint:OnDelete:CASCADE;"`
+	// Kind is error_rate or error_path.
+	Kind string
+	// Threshold is the error rate, between 0 and 1, or the number of errors above which the
+	// rule fires.
+	Threshold float64
+	// Window is how far back the validation counters are looked at.
+	Window time.Duration
+	// MinValidations is the number of validations below which error_rate rules don't fire.
+	MinValidations uint
+	// ErrorType and Path select the errors counted by error_path rules. An empty ErrorType
+	// counts errors of any type.
+	ErrorType string
+	Path      string
+	State     string
+	Value     float64
+	ChangedAt *time.Time
+}
+
+// WebhookSubscriptions are URLs schema events are posted to.
+type WebhookSubscriptions struct {
+	gorm.Model
+	// Namespace is the namespace of the resources whose events are posted.
+	Namespace string `gorm:"index;default:default"`
+	URL       string
+	// Secret signs the bodies posted to the URL, empty posts them unsigned.
+	Secret string
+	// Events is the comma separated list of events posted, empty posts every event.
+	Events string
+	// Resource is a glob matching the resources whose events are posted, empty matches all
+	// resources.
+	Resource string
+}
+
+// WebhookDeliveries store the events to post to a webhook subscription and the outcome of the
+// last attempt. They are written in the transaction of the event and retried like the
+// notification outbox.
+type WebhookDeliveries struct {
+	gorm.Model
+	SubscriptionID uint                 `gorm:"index"`
+	Subscription   WebhookSubscriptions `gorm:"constraint:OnDelete:CASCADE;"`
+	Event          string
+	Resource       string
+	// Body is the JSON body posted.
+	Body          string
+	Status        string    `gorm:"index:idx_webhook_due"`
+	NextAttemptAt time.Time `gorm:"index:idx_webhook_due"`
+	Attempts      uint
+	// ResponseCode is the HTTP status of the last attempt, zero if there was no response.
+	ResponseCode int
+	LastError    string
+	DeliveredAt  *time.Time
+}
+
+// APIKeys authenticate API requests. Only the SHA-256 of a key is stored, the key itself is
+// shown once when it is created.
+type APIKeys struct {
+	gorm.Model
+	// Namespace is the only namespace the key can access, empty for every namespace.
+	Namespace string
+	Name      string
+	// Prefix is the start of the key, shown to tell keys apart.
+	Prefix string
+	Hash   string `gorm:"uniqueIndex"`
+	// Scopes is the comma separated list of scopes granted to the key.
+	Scopes    string
+	RevokedAt *time.Time
+}
+
+// ValidationErrorKey identifies a validation error counter.
+type ValidationErrorKey struct {
+	Type string
+	Path string
+}
+
+// ValidationIncrement describes the validations to be added to the counters.
+type ValidationIncrement struct {
+	ResourceID uint
+	Version    uint
+	At         time.Time
+	Received   uint
+	Total      uint
+	Failed     uint
+	// Errors holds one key per validation error found.
+	Errors []ValidationErrorKey
+}
+
+// Buckets returns the start of the bucket of every granularity the time at falls in.
+func Buckets(at time.Time) map[string]time.Time {
+	buckets := make(map[string]time.Time)
+	for g, d := range Granularities {
+		buckets[g] = at.UTC().Truncate(d)
+	}
+	return buckets
+}
+
 type DB interface {
 	GetResource(resource string, optTx *gorm.DB) (*Resource, error)
 	GetAllResources() ([]Resource, error)
@@ -53,10 +297,38 @@ type DB interface {
 	Save(value interface{}, optTx *gorm.DB) error
 	SelectResourceForUpdate(resourceName string, optTx *gorm.DB) (*Resource, error)
 	Transaction(f func(tx *gorm.DB) error) error
+	GetQuarantinedPayloads(filter QuarantineFilter) ([]QuarantinedPayloads, error)
+	TrimQuarantinedPayloads(resourceID uint, keep uint, optTx *gorm.DB) error
+	PurgeQuarantinedPayloads(resourceID uint, before time.Time) (int64, error)
+	IncrementValidationCounts(inc ValidationIncrement, optTx *gorm.DB) error
+	GetValidationCounts(resourceID uint, granularity string, since time.Time) ([]ValidationCounts, error)
+	GetValidationErrorCounts(resourceID uint, granularity string, since time.Time) ([]ValidationErrorCounts, error)
+	GetNotificationRoutes() ([]NotificationRoutes, error)
+	GetNotificationRoute(id uint) (*NotificationRoutes, error)
+	DeleteNotificationRoute(id uint) (int64, error)
+	ClaimDueNotifications(now time.Time, lease time.Duration, limit int) ([]NotificationOutbox, error)
+	MarkDigested(ids []uint, optTx *gorm.DB) (int64, error)
+	GetOutboxNotifications(filter OutboxFilter) ([]NotificationOutbox, error)
+	GetOutboxNotification(id uint) (*NotificationOutbox, error)
+	GetAlertRules(resourceID uint) ([]AlertRules, error)
+	GetAlertRule(id uint) (*AlertRules, error)
+	DeleteAlertRule(id uint) (int64, error)
+	GetWebhookSubscriptions() ([]WebhookSubscriptions, error)
+	GetWebhookSubscription(id uint) (*WebhookSubscriptions, error)
+	DeleteWebhookSubscription(id uint) (int64, error)
+	ClaimDueWebhookDeliveries(now time.Time, lease time.Duration, limit int) ([]WebhookDeliveries, error)
+	GetWebhookDeliveries(subscriptionID uint, filter OutboxFilter) ([]WebhookDeliveries, error)
+	GetAPIKeys() ([]APIKeys, error)
+	GetAPIKey(id uint) (*APIKeys, error)
+	GetAPIKeyByHash(hash string) (*APIKeys, error)
+	GetNamespaces() ([]string, error)
+	WithNamespace(namespace string) DB
 }
 
 type DBImpl struct {
 	conn *gorm.DB
+	// namespace restricts the DB to the rows of a namespace, see WithNamespace.
+	namespace string
 }
 
 func NewDB(connStr string) (DB, error) {
@@ -82,14 +354,82 @@ func NewDB(connStr string) (DB, error) {
 
 	// Migrate the schema
 	db.AutoMigrate(&Resource{})
+	// Names used to be unique across namespaces.
+	if db.Migrator().HasIndex(&Resource{}, "idx_name") {
+		db.Migrator().DropIndex(&Resource{}, "idx_name")
+	}
 	db.AutoMigrate(&ReferencePayloads{})
 	db.AutoMigrate(&ResourceVersions{})
+	db.AutoMigrate(&QuarantinedPayloads{})
+	db.AutoMigrate(&ValidationCounts{})
+	db.AutoMigrate(&ValidationErrorCounts{})
+	db.AutoMigrate(&NotificationRoutes{})
+	db.AutoMigrate(&NotificationOutbox{})
+	db.AutoMigrate(&AlertRules{})
+	db.AutoMigrate(&WebhookSubscriptions{})
+	db.AutoMigrate(&WebhookDeliveries{})
+	db.AutoMigrate(&APIKeys{})
 
 	return &DBImpl{
 		conn: db,
 	}, nil
 }
 
+// WithNamespace returns the DB restricted to a namespace. Resources, their versions and
+// payloads, and the notification settings of other namespaces are not found, and the rows
+// saved without a namespace are put in it. The DB returned by NewDB looks resources up by name
+// in the default namespace, and everything else in every namespace.
+func (d *DBImpl) WithNamespace(namespace string) DB {
+	return &DBImpl{conn: d.conn, namespace: namespace}
+}
+
+// inNamespace restricts the query to the rows of the namespace of the DB, if it has one.
+func (d *DBImpl) inNamespace(q *gorm.DB) *gorm.DB {
+	if d.namespace == "" {
+		return q
+	}
+	return q.Where("namespace = ?", d.namespace)
+}
+
+// ofNamespace restricts the query to the rows of the resources of the namespace of the DB, if
+// it has one.
+func (d *DBImpl) ofNamespace(q *gorm.DB) *gorm.DB {
+	if d.namespace == "" {
+		return q
+	}
+	return q.Where("resource_id IN (?)", d.conn.Model(&Resource{}).Select("id").Where("namespace = ?", d.namespace))
+}
+
+// resourceNamespace is the namespace resources are looked up by name in.
+func (d *DBImpl) resourceNamespace() string {
+	if d.namespace == "" {
+		return DefaultNamespace
+	}
+	return d.namespace
+}
+
+// setNamespace puts the rows saved without a namespace in the namespace.
+func setNamespace(value interface{}, namespace string) {
+	switch value := value.(type) {
+	case *Resource:
+		if value.Namespace == "" {
+			value.Namespace = namespace
+		}
+	case *NotificationRoutes:
+		if value.Namespace == "" {
+			value.Namespace = namespace
+		}
+	case *NotificationOutbox:
+		if value.Namespace == "" {
+			value.Namespace = namespace
+		}
+	case *WebhookSubscriptions:
+		if value.Namespace == "" {
+			value.Namespace = namespace
+		}
+	}
+}
+
 func (d *DBImpl) OpenTxn() *gorm.DB {
 	return d.conn.Begin()
 }
@@ -97,13 +437,13 @@ func (d *DBImpl) OpenTxn() *gorm.DB {
 func (d *DBImpl) GetResource(resource string, optTx *gorm.DB) (*Resource, error) {
 	r := &Resource{}
 	if optTx != nil {
-		ret := optTx.Find(r, "name = ?", resource)
+		ret := optTx.Find(r, "namespace = ? AND name = ?", d.resourceNamespace(), resource)
 		if ret.RowsAffected == 0 {
 			return nil, nil
 		}
 		return r, ret.Error
 	}
-	ret := d.conn.Find(r, "name = ?", resource)
+	ret := d.conn.Find(r, "namespace = ? AND name = ?", d.resourceNamespace(), resource)
 	if ret.RowsAffected == 0 {
 		return nil, nil
 	}
@@ -112,40 +452,56 @@ func (d *DBImpl) GetResource(resource string, optTx *gorm.DB) (*Resource, error)
 
 func (d *DBImpl) GetResourceVersion(versionID uint, optTx *gorm.DB) (ResourceVersions, error) {
 	r := ResourceVersions{}
-	ret := d.conn.Find(&r, "id = ?", versionID)
+	ret := d.ofNamespace(d.conn).Find(&r, "id = ?", versionID)
 	return r, ret.Error
 }
 
 func (d *DBImpl) TearDown() error {
-	return d.conn.Migrator().DropTable(&Resource{}, &ReferencePayloads{}, &ResourceVersions{})
+	return d.conn.Migrator().DropTable(
+		&Resource{},
+		&ReferencePayloads{},
+		&ResourceVersions{},
+		&QuarantinedPayloads{},
+		&ValidationCounts{},
+		&ValidationErrorCounts{},
+		&NotificationRoutes{},
+		&NotificationOutbox{},
+		&AlertRules{},
+		&WebhookSubscriptions{},
+		&WebhookDeliveries{},
+		&APIKeys{},
+	)
 }
 
 func (d *DBImpl) TruncateAll() error {
 	fmt.Println("Truncating tables")
-	tx := d.conn.Exec("TRUNCATE TABLE resources, reference_payloads, resource_versions;")
+	tx := d.conn.Exec("TRUNCATE TABLE resources, reference_payloads, resource_versions, quarantined_payloads, validation_counts, validation_error_counts, notification_routes, notification_outboxes, alert_rules, webhook_subscriptions, webhook_deliveries, api_keys;")
 	fmt.Println(tx.Error)
 	return tx.Commit().Error
 }
 
 func (d *DBImpl) GetAllResources() ([]Resource, error) {
 	var resources []Resource
-	ret := d.conn.Find(&resources)
+	ret := d.inNamespace(d.conn).Find(&resources)
 	return resources, ret.Error
 }
 
 func (d *DBImpl) GetResourceVersions(resourceID uint) ([]ResourceVersions, error) {
 	var versions []ResourceVersions
-	ret := d.conn.Find(&versions, "resource_id = ?", resourceID)
+	ret := d.ofNamespace(d.conn).Find(&versions, "resource_id = ?", resourceID)
 	return versions, ret.Error
 }
 
 func (d *DBImpl) GetReferencePayload(id uint) (*ReferencePayloads, error) {
 	payload := &ReferencePayloads{}
-	ret := d.conn.Find(payload, "id = ?", id)
+	ret := d.ofNamespace(d.conn).Find(payload, "id = ?", id)
 	return payload, ret.Error
 }
 
 func (d *DBImpl) Save(value interface{}, optTx *gorm.DB) error {
+	if d.namespace != "" {
+		setNamespace(value, d.namespace)
+	}
 	if optTx == nil {
 		res := d.conn.Save(value)
 		return res.Error
@@ -158,7 +514,7 @@ func (d *DBImpl) SelectResourceForUpdate(resourceName string, optTx *gorm.DB) (*
 	r := &Resource{}
 	t := optTx.Clauses(clause.Locking{
 		Strength: "UPDATE",
-	}).Find(r, "name = ?", resourceName)
+	}).Find(r, "namespace = ? AND name = ?", d.resourceNamespace(), resourceName)
 	if t.Error != nil {
 		return nil, t.Error
 	}
@@ -166,5 +522,342 @@ func (d *DBImpl) SelectResourceForUpdate(resourceName string, optTx *gorm.DB) (*
 }
 
 func (d *DBImpl) Transaction(f func(tx *gorm.DB) error) error {
-	return d.conn.Transaction(f)
+	start := time.Now()
+	err := d.conn.Transaction(f)
+	telemetry.ObserveTransaction(start, err)
+	return err
+}
+
+func (d *DBImpl) GetQuarantinedPayloads(filter QuarantineFilter) ([]QuarantinedPayloads, error) {
+	var payloads []QuarantinedPayloads
+	q := d.conn.Where("resource_id = ?", filter.ResourceID)
+	if filter.ErrorType != "" {
+		q = q.Where("errors::jsonb @> ?::jsonb", fmt.Sprintf(`[{"type": %q}]`, filter.ErrorType))
+	}
+	if filter.Path != "" {
+		q = q.Where("errors::jsonb @> ?::jsonb", fmt.Sprintf(`[{"context": {"path": %q}}]`, filter.Path))
+	}
+	if filter.Contains != "" {
+		q = q.Where("strpos(payload, ?) > 0", filter.Contains)
+	}
+	if !filter.Since.IsZero() {
+		q = q.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		q = q.Where("created_at < ?", filter.Until)
+	}
+	if filter.Limit > 0 {
+		q = q.Limit(filter.Limit)
+	}
+	if filter.Offset > 0 {
+		q = q.Offset(filter.Offset)
+	}
+	ret := q.Order("id DESC").Find(&payloads)
+	return payloads, ret.Error
+}
+
+// TrimQuarantinedPayloads deletes all but the newest keep quarantined payloads of the resource.
+func (d *DBImpl) TrimQuarantinedPayloads(resourceID uint, keep uint, optTx *gorm.DB) error {
+	conn := d.conn
+	if optTx != nil {
+		conn = optTx
+	}
+	// The id of the newest payload beyond the kept ones. It is NULL, and nothing is deleted, when
+	// there are no more than keep payloads.
+	oldest := conn.Model(&QuarantinedPayloads{}).
+		Select("id").
+		Where("resource_id = ?", resourceID).
+		Order("id DESC").
+		Offset(int(keep)).
+		Limit(1)
+	ret := conn.Unscoped().
+		Where("resource_id = ? AND id <= (?)", resourceID, oldest).
+		Delete(&QuarantinedPayloads{})
+	return ret.Error
+}
+
+// PurgeQuarantinedPayloads deletes the quarantined payloads of the resource created before the
+// given time. A zero time deletes all of them.
+func (d *DBImpl) PurgeQuarantinedPayloads(resourceID uint, before time.Time) (int64, error) {
+	q := d.conn.Unscoped().Where("resource_id = ?", resourceID)
+	if !before.IsZero() {
+		q = q.Where("created_at < ?", before)
+	}
+	ret := q.Delete(&QuarantinedPayloads{})
+	return ret.RowsAffected, ret.Error
+}
+
+// IncrementValidationCounts adds validations to the counters of every bucket granularity.
+func (d *DBImpl) IncrementValidationCounts(inc ValidationIncrement, optTx *gorm.DB) error {
+	conn := d.conn
+	if optTx != nil {
+		conn = optTx
+	}
+	errCounts := make(map[ValidationErrorKey]uint)
+	for _, e := range inc.Errors {
+		errCounts[e]++
+	}
+	for g, bucket := range Buckets(inc.At) {
+		counts := &ValidationCounts{
+			ResourceID:  int(inc.ResourceID),
+			Version:     inc.Version,
+			Granularity: g,
+			Bucket:      bucket,
+			Received:    inc.Received,
+			Total:       inc.Total,
+			Failed:      inc.Failed,
+		}
+		ret := conn.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "resource_id"}, {Name: "version"}, {Name: "granularity"}, {Name: "bucket"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"received": gorm.Expr("validation_counts.received + ?", inc.Received),
+				"total":    gorm.Expr("validation_counts.total + ?", inc.Total),
+				"failed":   gorm.Expr("validation_counts.failed + ?", inc.Failed),
+			}),
+		}).Create(counts)
+		if ret.Error != nil {
+			return ret.Error
+		}
+		for k, n := range errCounts {
+			row := &ValidationErrorCounts{
+				ResourceID:  int(inc.ResourceID),
+				Version:     inc.Version,
+				Granularity: g,
+				Bucket:      bucket,
+				ErrorType:   k.Type,
+				Path:        k.Path,
+				Count:       n,
+			}
+			ret := conn.Clauses(clause.OnConflict{
+				Columns: []clause.Column{
+					{Name: "resource_id"}, {Name: "version"}, {Name: "granularity"},
+					{Name: "bucket"}, {Name: "error_type"}, {Name: "path"},
+				},
+				DoUpdates: clause.Assignments(map[string]interface{}{
+					"count": gorm.Expr("validation_error_counts.count + ?", n),
+				}),
+			}).Create(row)
+			if ret.Error != nil {
+				return ret.Error
+			}
+		}
+	}
+	return nil
+}
+
+func (d *DBImpl) GetValidationCounts(resourceID uint, granularity string, since time.Time) ([]ValidationCounts, error) {
+	var counts []ValidationCounts
+	ret := d.conn.Order("bucket, version").Find(&counts,
+		"resource_id = ? AND granularity = ? AND bucket >= ?", resourceID, granularity, since)
+	return counts, ret.Error
+}
+
+func (d *DBImpl) GetValidationErrorCounts(resourceID uint, granularity string, since time.Time) ([]ValidationErrorCounts, error) {
+	var counts []ValidationErrorCounts
+	ret := d.conn.Order("bucket, version, error_type, path").Find(&counts,
+		"resource_id = ? AND granularity = ? AND bucket >= ?", resourceID, granularity, since)
+	return counts, ret.Error
+}
+
+func (d *DBImpl) GetNotificationRoutes() ([]NotificationRoutes, error) {
+	var routes []NotificationRoutes
+	ret := d.inNamespace(d.conn).Order("id").Find(&routes)
+	return routes, ret.Error
+}
+
+func (d *DBImpl) GetNotificationRoute(id uint) (*NotificationRoutes, error) {
+	route := &NotificationRoutes{}
+	ret := d.inNamespace(d.conn).Find(route, "id = ?", id)
+	if ret.RowsAffected == 0 {
+		return nil, ret.Error
+	}
+	return route, ret.Error
+}
+
+func (d *DBImpl) DeleteNotificationRoute(id uint) (int64, error) {
+	ret := d.inNamespace(d.conn.Unscoped()).Delete(&NotificationRoutes{}, id)
+	return ret.RowsAffected, ret.Error
+}
+
+// claimDue locks the pending rows of model due at now, skipping the ones locked by other
+// replicas, moves their next attempt to until and returns their ids, oldest first.
+func claimDue(tx *gorm.DB, model interface{}, now, until time.Time, limit int) ([]uint, error) {
+	var ids []uint
+	ret := tx.Model(model).Clauses(clause.Locking{
+		Strength: "UPDATE",
+		Options:  "SKIP LOCKED",
+	}).Where("status = ? AND next_attempt_at <= ?", DeliveryPending, now).Order("id").Limit(limit).Pluck("id", &ids)
+	if ret.Error != nil || len(ids) == 0 {
+		return nil, ret.Error
+	}
+	ret = tx.Model(model).Where("id IN ?", ids).Update("next_attempt_at", until)
+	return ids, ret.Error
+}
+
+// ClaimDueNotifications returns the pending outbox notifications due at now, oldest first.
+// They are leased for the given duration so other replicas don't deliver them too; if the
+// delivery isn't saved in time they are due again.
+func (d *DBImpl) ClaimDueNotifications(now time.Time, lease time.Duration, limit int) ([]NotificationOutbox, error) {
+	var rows []NotificationOutbox
+	err := d.conn.Transaction(func(tx *gorm.DB) error {
+		ids, err := claimDue(tx, &NotificationOutbox{}, now, now.Add(lease), limit)
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+		return tx.Order("id").Find(&rows, ids).Error
+	})
+	return rows, err
+}
+
+// MarkDigested moves the given notifications from the digest status to digested and returns
+// how many were moved. Fewer than len(ids) means another replica digested some of them.
+func (d *DBImpl) MarkDigested(ids []uint, optTx *gorm.DB) (int64, error) {
+	conn := d.conn
+	if optTx != nil {
+		conn = optTx
+	}
+	ret := conn.Model(&NotificationOutbox{}).Where("id IN ? AND status = ?", ids, DeliveryDigest).
+		Update("status", DeliveryDigested)
+	return ret.RowsAffected, ret.Error
+}
+
+func (d *DBImpl) GetOutboxNotifications(filter OutboxFilter) ([]NotificationOutbox, error) {
+	var rows []NotificationOutbox
+	q := d.inNamespace(d.conn.Model(&NotificationOutbox{}))
+	if filter.Resource != "" {
+		q = q.Where("resource = ?", filter.Resource)
+	}
+	if filter.Status != "" {
+		q = q.Where("status = ?", filter.Status)
+	}
+	if filter.Limit > 0 {
+		q = q.Limit(filter.Limit)
+	}
+	if filter.Offset > 0 {
+		q = q.Offset(filter.Offset)
+	}
+	ret := q.Order("id DESC").Find(&rows)
+	return rows, ret.Error
+}
+
+func (d *DBImpl) GetOutboxNotification(id uint) (*NotificationOutbox, error) {
+	row := &NotificationOutbox{}
+	ret := d.inNamespace(d.conn).Find(row, "id = ?", id)
+	if ret.RowsAffected == 0 {
+		return nil, ret.Error
+	}
+	return row, ret.Error
+}
+
+// GetAlertRules returns the alert rules of the resource with their resource, or the ones of
+// every resource if resourceID is zero.
+func (d *DBImpl) GetAlertRules(resourceID uint) ([]AlertRules, error) {
+	var rules []AlertRules
+	q := d.ofNamespace(d.conn.Preload("Resource")).Order("id")
+	if resourceID != 0 {
+		q = q.Where("resource_id = ?", resourceID)
+	}
+	ret := q.Find(&rules)
+	return rules, ret.Error
+}
+
+func (d *DBImpl) GetAlertRule(id uint) (*AlertRules, error) {
+	rule := &AlertRules{}
+	ret := d.ofNamespace(d.conn.Preload("Resource")).Find(rule, "id = ?", id)
+	if ret.RowsAffected == 0 {
+		return nil, ret.Error
+	}
+	return rule, ret.Error
+}
+
+func (d *DBImpl) DeleteAlertRule(id uint) (int64, error) {
+	ret := d.ofNamespace(d.conn.Unscoped()).Delete(&AlertRules{}, id)
+	return ret.RowsAffected, ret.Error
+}
+
+func (d *DBImpl) GetWebhookSubscriptions() ([]WebhookSubscriptions, error) {
+	var subs []WebhookSubscriptions
+	ret := d.inNamespace(d.conn).Order("id").Find(&subs)
+	return subs, ret.Error
+}
+
+func (d *DBImpl) GetWebhookSubscription(id uint) (*WebhookSubscriptions, error) {
+	sub := &WebhookSubscriptions{}
+	ret := d.inNamespace(d.conn).Find(sub, "id = ?", id)
+	if ret.RowsAffected == 0 {
+		return nil, ret.Error
+	}
+	return sub, ret.Error
+}
+
+// DeleteWebhookSubscription deletes the subscription together with its deliveries.
+func (d *DBImpl) DeleteWebhookSubscription(id uint) (int64, error) {
+	ret := d.inNamespace(d.conn.Unscoped()).Delete(&WebhookSubscriptions{}, id)
+	return ret.RowsAffected, ret.Error
+}
+
+// ClaimDueWebhookDeliveries returns the pending webhook deliveries due at now with their
+// subscription, oldest first. They are leased like in ClaimDueNotifications.
+func (d *DBImpl) ClaimDueWebhookDeliveries(now time.Time, lease time.Duration, limit int) ([]WebhookDeliveries, error) {
+	var rows []WebhookDeliveries
+	err := d.conn.Transaction(func(tx *gorm.DB) error {
+		ids, err := claimDue(tx, &WebhookDeliveries{}, now, now.Add(lease), limit)
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+		return tx.Preload("Subscription").Order("id").Find(&rows, ids).Error
+	})
+	return rows, err
+}
+
+// GetWebhookDeliveries returns the deliveries of a subscription, newest first.
+func (d *DBImpl) GetWebhookDeliveries(subscriptionID uint, filter OutboxFilter) ([]WebhookDeliveries, error) {
+	var rows []WebhookDeliveries
+	q := d.conn.Model(&WebhookDeliveries{}).Where("subscription_id = ?", subscriptionID)
+	if filter.Resource != "" {
+		q = q.Where("resource = ?", filter.Resource)
+	}
+	if filter.Status != "" {
+		q = q.Where("status = ?", filter.Status)
+	}
+	if filter.Limit > 0 {
+		q = q.Limit(filter.Limit)
+	}
+	if filter.Offset > 0 {
+		q = q.Offset(filter.Offset)
+	}
+	ret := q.Order("id DESC").Find(&rows)
+	return rows, ret.Error
+}
+
+func (d *DBImpl) GetAPIKeys() ([]APIKeys, error) {
+	var keys []APIKeys
+	ret := d.conn.Order("id").Find(&keys)
+	return keys, ret.Error
+}
+
+func (d *DBImpl) GetAPIKey(id uint) (*APIKeys, error) {
+	key := &APIKeys{}
+	ret := d.conn.Find(key, "id = ?", id)
+	if ret.RowsAffected == 0 {
+		return nil, ret.Error
+	}
+	return key, ret.Error
+}
+
+// GetAPIKeyByHash returns the key with the hash, revoked or not.
+func (d *DBImpl) GetAPIKeyByHash(hash string) (*APIKeys, error) {
+	key := &APIKeys{}
+	ret := d.conn.Find(key, "hash = ?", hash)
+	if ret.RowsAffected == 0 {
+		return nil, ret.Error
+	}
+	return key, ret.Error
+}
+
+// GetNamespaces returns the namespaces with resources.
+func (d *DBImpl) GetNamespaces() ([]string, error) {
+	var namespaces []string
+	ret := d.conn.Model(&Resource{}).Distinct("namespace").Order("namespace").Pluck("namespace", &namespaces)
+	return namespaces, ret.Error
 }
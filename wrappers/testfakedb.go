@@ -3,31 +3,58 @@ package wrappers
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"reflect"
+	"sort"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
 )
 
 type TestDB struct {
-	Errors            map[string]error
-	IDs               map[string]uint
+	Errors map[string]error
+	IDs    map[string]uint
+	// Resource is keyed by resourceKey.
 	Resource          map[string]Resource
 	ResourceVersions  map[uint]ResourceVersions
 	ReferencePayloads map[uint]ReferencePayloads
+	Quarantine        map[uint]QuarantinedPayloads
+	ValidationCounts  []ValidationCounts
+	ValidationErrors  []ValidationErrorCounts
+	Routes            map[uint]NotificationRoutes
+	Outbox            map[uint]NotificationOutbox
+	AlertRules        map[uint]AlertRules
+	Webhooks          map[uint]WebhookSubscriptions
+	WebhookDeliveries map[uint]WebhookDeliveries
+	APIKeys           map[uint]APIKeys
 }
 
 func NewTestDB() DB {
 	return &TestDB{
 		Errors: make(map[string]error),
 		IDs: map[string]uint{
-			"Resource":          0,
-			"ResourceVersions":  0,
-			"ReferencePayloads": 0,
+			"Resource":            0,
+			"ResourceVersions":    0,
+			"ReferencePayloads":   0,
+			"QuarantinedPayloads": 0,
+			"NotificationRoutes":  0,
+			"NotificationOutbox":  0,
+			"AlertRules":          0,
+			"Webhooks":            0,
+			"WebhookDeliveries":   0,
+			"APIKeys":             0,
 		},
 		Resource:          make(map[string]Resource),
 		ResourceVersions:  make(map[uint]ResourceVersions),
 		ReferencePayloads: make(map[uint]ReferencePayloads),
+		Quarantine:        make(map[uint]QuarantinedPayloads),
+		Routes:            make(map[uint]NotificationRoutes),
+		Outbox:            make(map[uint]NotificationOutbox),
+		AlertRules:        make(map[uint]AlertRules),
+		Webhooks:          make(map[uint]WebhookSubscriptions),
+		WebhookDeliveries: make(map[uint]WebhookDeliveries),
+		APIKeys:           make(map[uint]APIKeys),
 	}
 }
 
@@ -86,13 +113,29 @@ func (d *TestDB) TruncateAll() error {
 		return e
 	}
 	d.IDs = map[string]uint{
-		"Resource":          0,
-		"ResourceVersions":  0,
-		"ReferencePayloads": 0,
+		"Resource":            0,
+		"ResourceVersions":    0,
+		"ReferencePayloads":   0,
+		"QuarantinedPayloads": 0,
+		"NotificationRoutes":  0,
+		"NotificationOutbox":  0,
+		"AlertRules":          0,
+		"Webhooks":            0,
+		"WebhookDeliveries":   0,
+		"APIKeys":             0,
 	}
 	d.ReferencePayloads = make(map[uint]ReferencePayloads)
+	d.Quarantine = make(map[uint]QuarantinedPayloads)
+	d.ValidationCounts = nil
+	d.ValidationErrors = nil
 	d.Resource = make(map[string]Resource)
 	d.ResourceVersions = make(map[uint]ResourceVersions)
+	d.Routes = make(map[uint]NotificationRoutes)
+	d.Outbox = make(map[uint]NotificationOutbox)
+	d.AlertRules = make(map[uint]AlertRules)
+	d.Webhooks = make(map[uint]WebhookSubscriptions)
+	d.WebhookDeliveries = make(map[uint]WebhookDeliveries)
+	d.APIKeys = make(map[uint]APIKeys)
 	return nil
 }
 
@@ -150,9 +193,11 @@ func (d *TestDB) Save(value interface{}, optTx *gorm.DB) error {
 	if value == nil || reflect.ValueOf(value).IsNil() {
 		return nil
 	}
+	// The real DB defaults the namespace.
+	setNamespace(value, DefaultNamespace)
 	switch value := value.(type) {
 	case *Resource:
-		n := value.Name
+		n := resourceKey(value.Namespace, value.Name)
 		r, ok := d.Resource[n]
 		if ok { // Update.
 			value.ID = r.ID
@@ -164,7 +209,7 @@ func (d *TestDB) Save(value interface{}, optTx *gorm.DB) error {
 			value.CreatedAt = time.Now()
 			value.UpdatedAt = time.Now()
 		}
-		d.Resource[value.Name] = *value
+		d.Resource[n] = *value
 	case *ResourceVersions:
 		if value.ID != 0 { // Update.
 			r := d.ResourceVersions[value.ID]
@@ -176,6 +221,13 @@ func (d *TestDB) Save(value interface{}, optTx *gorm.DB) error {
 			value.CreatedAt = time.Now()
 			value.UpdatedAt = time.Now()
 		}
+		if value.ResourceID == 0 {
+			value.ResourceID = int(value.Resource.ID)
+		}
+		if value.ReferencePayloadID == nil && value.ReferencePayload != nil {
+			id := int(value.ReferencePayload.ID)
+			value.ReferencePayloadID = &id
+		}
 		d.ResourceVersions[value.ID] = *value
 	case *ReferencePayloads:
 		if value.ID != 0 { // Update.
@@ -188,7 +240,103 @@ func (d *TestDB) Save(value interface{}, optTx *gorm.DB) error {
 			value.CreatedAt = time.Now()
 			value.UpdatedAt = time.Now()
 		}
+		if value.ResourceID == 0 {
+			value.ResourceID = int(value.Resource.ID)
+		}
 		d.ReferencePayloads[value.ID] = *value
+	case *QuarantinedPayloads:
+		if value.ID != 0 { // Update.
+			r := d.Quarantine[value.ID]
+			value.CreatedAt = r.CreatedAt
+			value.UpdatedAt = time.Now()
+		} else { // Create.
+			d.IDs["QuarantinedPayloads"] += 1
+			value.ID = d.IDs["QuarantinedPayloads"]
+			value.CreatedAt = time.Now()
+			value.UpdatedAt = time.Now()
+		}
+		if value.ResourceID == 0 {
+			value.ResourceID = int(value.Resource.ID)
+		}
+		d.Quarantine[value.ID] = *value
+	case *NotificationRoutes:
+		if value.ID != 0 { // Update.
+			r := d.Routes[value.ID]
+			value.CreatedAt = r.CreatedAt
+			value.UpdatedAt = time.Now()
+		} else { // Create.
+			d.IDs["NotificationRoutes"] += 1
+			value.ID = d.IDs["NotificationRoutes"]
+			value.CreatedAt = time.Now()
+			value.UpdatedAt = time.Now()
+		}
+		d.Routes[value.ID] = *value
+	case *NotificationOutbox:
+		if value.ID != 0 { // Update.
+			r := d.Outbox[value.ID]
+			value.CreatedAt = r.CreatedAt
+			value.UpdatedAt = time.Now()
+		} else { // Create.
+			d.IDs["NotificationOutbox"] += 1
+			value.ID = d.IDs["NotificationOutbox"]
+			value.CreatedAt = time.Now()
+			value.UpdatedAt = time.Now()
+		}
+		d.Outbox[value.ID] = *value
+	case *AlertRules:
+		if value.ID != 0 { // Update.
+			r := d.AlertRules[value.ID]
+			value.CreatedAt = r.CreatedAt
+			value.UpdatedAt = time.Now()
+		} else { // Create.
+			d.IDs["AlertRules"] += 1
+			value.ID = d.IDs["AlertRules"]
+			value.CreatedAt = time.Now()
+			value.UpdatedAt = time.Now()
+		}
+		if value.ResourceID == 0 {
+			value.ResourceID = int(value.Resource.ID)
+		}
+		d.AlertRules[value.ID] = *value
+	case *WebhookSubscriptions:
+		if value.ID != 0 { // Update.
+			r := d.Webhooks[value.ID]
+			value.CreatedAt = r.CreatedAt
+			value.UpdatedAt = time.Now()
+		} else { // Create.
+			d.IDs["Webhooks"] += 1
+			value.ID = d.IDs["Webhooks"]
+			value.CreatedAt = time.Now()
+			value.UpdatedAt = time.Now()
+		}
+		d.Webhooks[value.ID] = *value
+	case *WebhookDeliveries:
+		if value.ID != 0 { // Update.
+			r := d.WebhookDeliveries[value.ID]
+			value.CreatedAt = r.CreatedAt
+			value.UpdatedAt = time.Now()
+		} else { // Create.
+			d.IDs["WebhookDeliveries"] += 1
+			value.ID = d.IDs["WebhookDeliveries"]
+			value.CreatedAt = time.Now()
+			value.UpdatedAt = time.Now()
+		}
+		if value.SubscriptionID == 0 {
+			value.SubscriptionID = value.Subscription.ID
+		}
+		d.WebhookDeliveries[value.ID] = *value
+	case *APIKeys:
+		if value.ID != 0 { // Update.
+			r := d.APIKeys[value.ID]
+			value.CreatedAt = r.CreatedAt
+			value.UpdatedAt = time.Now()
+		} else { // Create.
+			d.IDs["APIKeys"] += 1
+			value.ID = d.IDs["APIKeys"]
+			value.CreatedAt = time.Now()
+			value.UpdatedAt = time.Now()
+		}
+		d.APIKeys[value.ID] = *value
 	default:
 		return nil
 	}
@@ -215,3 +363,677 @@ func (d *TestDB) SelectResourceForUpdate(resourceName string, optTx *gorm.DB) (*
 func (d *TestDB) Transaction(f func(tx *gorm.DB) error) error {
 	return f(d.OpenTxn())
 }
+
+// quarantineMatches mimics the jsonb containment filters of the real DB.
+func quarantineMatches(qp QuarantinedPayloads, filter QuarantineFilter) bool {
+	if qp.ResourceID != int(filter.ResourceID) {
+		return false
+	}
+	if filter.Contains != "" && !strings.Contains(qp.Payload, filter.Contains) {
+		return false
+	}
+	if !filter.Since.IsZero() && qp.CreatedAt.Before(filter.Since) {
+		return false
+	}
+	if !filter.Until.IsZero() && !qp.CreatedAt.Before(filter.Until) {
+		return false
+	}
+	if filter.ErrorType == "" && filter.Path == "" {
+		return true
+	}
+	var errs []struct {
+		Type    string         `json:"type"`
+		Context map[string]any `json:"context"`
+	}
+	if err := json.Unmarshal([]byte(qp.Errors), &errs); err != nil {
+		return false
+	}
+	for _, e := range errs {
+		if filter.ErrorType != "" && e.Type != filter.ErrorType {
+			continue
+		}
+		if filter.Path != "" && e.Context["path"] != filter.Path {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func (d *TestDB) GetQuarantinedPayloads(filter QuarantineFilter) ([]QuarantinedPayloads, error) {
+	if e, ok := d.Errors["GetQuarantinedPayloads"]; ok && e != nil {
+		return nil, e
+	}
+	var payloads []QuarantinedPayloads
+	for _, qp := range d.Quarantine {
+		if quarantineMatches(qp, filter) {
+			payloads = append(payloads, qp)
+		}
+	}
+	sort.Slice(payloads, func(i, j int) bool {
+		return payloads[i].ID > payloads[j].ID
+	})
+	if filter.Offset > 0 {
+		if filter.Offset >= len(payloads) {
+			return nil, nil
+		}
+		payloads = payloads[filter.Offset:]
+	}
+	if filter.Limit > 0 && filter.Limit < len(payloads) {
+		payloads = payloads[:filter.Limit]
+	}
+	return payloads, nil
+}
+
+func (d *TestDB) TrimQuarantinedPayloads(resourceID uint, keep uint, optTx *gorm.DB) error {
+	if e, ok := d.Errors["TrimQuarantinedPayloads"]; ok && e != nil {
+		return e
+	}
+	payloads, _ := d.GetQuarantinedPayloads(QuarantineFilter{ResourceID: resourceID})
+	for i, qp := range payloads {
+		if uint(i) >= keep {
+			delete(d.Quarantine, qp.ID)
+		}
+	}
+	return nil
+}
+
+func (d *TestDB) PurgeQuarantinedPayloads(resourceID uint, before time.Time) (int64, error) {
+	if e, ok := d.Errors["PurgeQuarantinedPayloads"]; ok && e != nil {
+		return 0, e
+	}
+	var deleted int64
+	for id, qp := range d.Quarantine {
+		if qp.ResourceID != int(resourceID) {
+			continue
+		}
+		if !before.IsZero() && !qp.CreatedAt.Before(before) {
+			continue
+		}
+		delete(d.Quarantine, id)
+		deleted++
+	}
+	return deleted, nil
+}
+
+func (d *TestDB) IncrementValidationCounts(inc ValidationIncrement, optTx *gorm.DB) error {
+	if e, ok := d.Errors["IncrementValidationCounts"]; ok && e != nil {
+		return e
+	}
+	for g, bucket := range Buckets(inc.At) {
+		found := false
+		for i, c := range d.ValidationCounts {
+			if c.ResourceID == int(inc.ResourceID) && c.Version == inc.Version && c.Granularity == g && c.Bucket.Equal(bucket) {
+				d.ValidationCounts[i].Received += inc.Received
+				d.ValidationCounts[i].Total += inc.Total
+				d.ValidationCounts[i].Failed += inc.Failed
+				found = true
+				break
+			}
+		}
+		if !found {
+			d.ValidationCounts = append(d.ValidationCounts, ValidationCounts{
+				ID:          uint(len(d.ValidationCounts) + 1),
+				ResourceID:  int(inc.ResourceID),
+				Version:     inc.Version,
+				Granularity: g,
+				Bucket:      bucket,
+				Received:    inc.Received,
+				Total:       inc.Total,
+				Failed:      inc.Failed,
+			})
+		}
+		for _, k := range inc.Errors {
+			found := false
+			for i, c := range d.ValidationErrors {
+				if c.ResourceID == int(inc.ResourceID) && c.Version == inc.Version && c.Granularity == g &&
+					c.Bucket.Equal(bucket) && c.ErrorType == k.Type && c.Path == k.Path {
+					d.ValidationErrors[i].Count++
+					found = true
+					break
+				}
+			}
+			if !found {
+				d.ValidationErrors = append(d.ValidationErrors, ValidationErrorCounts{
+					ID:          uint(len(d.ValidationErrors) + 1),
+					ResourceID:  int(inc.ResourceID),
+					Version:     inc.Version,
+					Granularity: g,
+					Bucket:      bucket,
+					ErrorType:   k.Type,
+					Path:        k.Path,
+					Count:       1,
+				})
+			}
+		}
+	}
+	return nil
+}
+
+func (d *TestDB) GetValidationCounts(resourceID uint, granularity string, since time.Time) ([]ValidationCounts, error) {
+	if e, ok := d.Errors["GetValidationCounts"]; ok && e != nil {
+		return nil, e
+	}
+	var counts []ValidationCounts
+	for _, c := range d.ValidationCounts {
+		if c.ResourceID == int(resourceID) && c.Granularity == granularity && !c.Bucket.Before(since) {
+			counts = append(counts, c)
+		}
+	}
+	return counts, nil
+}
+
+func (d *TestDB) GetValidationErrorCounts(resourceID uint, granularity string, since time.Time) ([]ValidationErrorCounts, error) {
+	if e, ok := d.Errors["GetValidationErrorCounts"]; ok && e != nil {
+		return nil, e
+	}
+	var counts []ValidationErrorCounts
+	for _, c := range d.ValidationErrors {
+		if c.ResourceID == int(resourceID) && c.Granularity == granularity && !c.Bucket.Before(since) {
+			counts = append(counts, c)
+		}
+	}
+	return counts, nil
+}
+
+func (d *TestDB) GetNotificationRoutes() ([]NotificationRoutes, error) {
+	if e, ok := d.Errors["GetNotificationRoutes"]; ok && e != nil {
+		return nil, e
+	}
+	var routes []NotificationRoutes
+	for _, r := range d.Routes {
+		routes = append(routes, r)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i].ID < routes[j].ID
+	})
+	return routes, nil
+}
+
+func (d *TestDB) GetNotificationRoute(id uint) (*NotificationRoutes, error) {
+	if e, ok := d.Errors["GetNotificationRoute"]; ok && e != nil {
+		return nil, e
+	}
+	r, ok := d.Routes[id]
+	if !ok {
+		return nil, nil
+	}
+	return &r, nil
+}
+
+func (d *TestDB) DeleteNotificationRoute(id uint) (int64, error) {
+	if e, ok := d.Errors["DeleteNotificationRoute"]; ok && e != nil {
+		return 0, e
+	}
+	if _, ok := d.Routes[id]; !ok {
+		return 0, nil
+	}
+	delete(d.Routes, id)
+	return 1, nil
+}
+
+// outbox returns the outbox notifications by ascending ID.
+func (d *TestDB) outbox() []NotificationOutbox {
+	var rows []NotificationOutbox
+	for _, r := range d.Outbox {
+		rows = append(rows, r)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].ID < rows[j].ID
+	})
+	return rows
+}
+
+func (d *TestDB) ClaimDueNotifications(now time.Time, lease time.Duration, limit int) ([]NotificationOutbox, error) {
+	if e, ok := d.Errors["ClaimDueNotifications"]; ok && e != nil {
+		return nil, e
+	}
+	var rows []NotificationOutbox
+	for _, r := range d.outbox() {
+		if r.Status == DeliveryPending && !r.NextAttemptAt.After(now) && (limit <= 0 || len(rows) < limit) {
+			r.NextAttemptAt = now.Add(lease)
+			d.Outbox[r.ID] = r
+			rows = append(rows, r)
+		}
+	}
+	return rows, nil
+}
+
+func (d *TestDB) MarkDigested(ids []uint, optTx *gorm.DB) (int64, error) {
+	if e, ok := d.Errors["MarkDigested"]; ok && e != nil {
+		return 0, e
+	}
+	var n int64
+	for _, id := range ids {
+		if r, ok := d.Outbox[id]; ok && r.Status == DeliveryDigest {
+			r.Status = DeliveryDigested
+			d.Outbox[id] = r
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (d *TestDB) GetOutboxNotifications(filter OutboxFilter) ([]NotificationOutbox, error) {
+	if e, ok := d.Errors["GetOutboxNotifications"]; ok && e != nil {
+		return nil, e
+	}
+	var rows []NotificationOutbox
+	all := d.outbox()
+	for i := len(all) - 1; i >= 0; i-- {
+		r := all[i]
+		if (filter.Resource == "" || r.Resource == filter.Resource) && (filter.Status == "" || r.Status == filter.Status) {
+			rows = append(rows, r)
+		}
+	}
+	if filter.Offset > 0 {
+		if filter.Offset >= len(rows) {
+			return nil, nil
+		}
+		rows = rows[filter.Offset:]
+	}
+	if filter.Limit > 0 && filter.Limit < len(rows) {
+		rows = rows[:filter.Limit]
+	}
+	return rows, nil
+}
+
+func (d *TestDB) GetOutboxNotification(id uint) (*NotificationOutbox, error) {
+	if e, ok := d.Errors["GetOutboxNotification"]; ok && e != nil {
+		return nil, e
+	}
+	r, ok := d.Outbox[id]
+	if !ok {
+		return nil, nil
+	}
+	return &r, nil
+}
+
+// withResource fills the resource of an alert rule like the Preload of the real DB.
+func (d *TestDB) withResource(rule AlertRules) AlertRules {
+	for _, r := range d.Resource {
+		if int(r.ID) == rule.ResourceID {
+			rule.Resource = r
+		}
+	}
+	return rule
+}
+
+func (d *TestDB) GetAlertRules(resourceID uint) ([]AlertRules, error) {
+	if e, ok := d.Errors["GetAlertRules"]; ok && e != nil {
+		return nil, e
+	}
+	var rules []AlertRules
+	for _, r := range d.AlertRules {
+		if resourceID == 0 || r.ResourceID == int(resourceID) {
+			rules = append(rules, d.withResource(r))
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].ID < rules[j].ID
+	})
+	return rules, nil
+}
+
+func (d *TestDB) GetAlertRule(id uint) (*AlertRules, error) {
+	if e, ok := d.Errors["GetAlertRule"]; ok && e != nil {
+		return nil, e
+	}
+	r, ok := d.AlertRules[id]
+	if !ok {
+		return nil, nil
+	}
+	r = d.withResource(r)
+	return &r, nil
+}
+
+func (d *TestDB) DeleteAlertRule(id uint) (int64, error) {
+	if e, ok := d.Errors["DeleteAlertRule"]; ok && e != nil {
+		return 0, e
+	}
+	if _, ok := d.AlertRules[id]; !ok {
+		return 0, nil
+	}
+	delete(d.AlertRules, id)
+	return 1, nil
+}
+
+func (d *TestDB) GetWebhookSubscriptions() ([]WebhookSubscriptions, error) {
+	if e, ok := d.Errors["GetWebhookSubscriptions"]; ok && e != nil {
+		return nil, e
+	}
+	var subs []WebhookSubscriptions
+	for _, s := range d.Webhooks {
+		subs = append(subs, s)
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].ID < subs[j].ID
+	})
+	return subs, nil
+}
+
+func (d *TestDB) GetWebhookSubscription(id uint) (*WebhookSubscriptions, error) {
+	if e, ok := d.Errors["GetWebhookSubscription"]; ok && e != nil {
+		return nil, e
+	}
+	s, ok := d.Webhooks[id]
+	if !ok {
+		return nil, nil
+	}
+	return &s, nil
+}
+
+func (d *TestDB) DeleteWebhookSubscription(id uint) (int64, error) {
+	if e, ok := d.Errors["DeleteWebhookSubscription"]; ok && e != nil {
+		return 0, e
+	}
+	if _, ok := d.Webhooks[id]; !ok {
+		return 0, nil
+	}
+	delete(d.Webhooks, id)
+	for k, r := range d.WebhookDeliveries {
+		if r.SubscriptionID == id {
+			delete(d.WebhookDeliveries, k)
+		}
+	}
+	return 1, nil
+}
+
+// webhookDeliveries returns the webhook deliveries by ID with their subscription.
+func (d *TestDB) webhookDeliveries() []WebhookDeliveries {
+	var rows []WebhookDeliveries
+	for _, r := range d.WebhookDeliveries {
+		r.Subscription = d.Webhooks[r.SubscriptionID]
+		rows = append(rows, r)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].ID < rows[j].ID
+	})
+	return rows
+}
+
+func (d *TestDB) ClaimDueWebhookDeliveries(now time.Time, lease time.Duration, limit int) ([]WebhookDeliveries, error) {
+	if e, ok := d.Errors["ClaimDueWebhookDeliveries"]; ok && e != nil {
+		return nil, e
+	}
+	var rows []WebhookDeliveries
+	for _, r := range d.webhookDeliveries() {
+		if r.Status == DeliveryPending && !r.NextAttemptAt.After(now) && (limit <= 0 || len(rows) < limit) {
+			r.NextAttemptAt = now.Add(lease)
+			stored := d.WebhookDeliveries[r.ID]
+			stored.NextAttemptAt = r.NextAttemptAt
+			d.WebhookDeliveries[r.ID] = stored
+			rows = append(rows, r)
+		}
+	}
+	return rows, nil
+}
+
+func (d *TestDB) GetWebhookDeliveries(subscriptionID uint, filter OutboxFilter) ([]WebhookDeliveries, error) {
+	if e, ok := d.Errors["GetWebhookDeliveries"]; ok && e != nil {
+		return nil, e
+	}
+	var rows []WebhookDeliveries
+	all := d.webhookDeliveries()
+	for i := len(all) - 1; i >= 0; i-- {
+		r := all[i]
+		if r.SubscriptionID == subscriptionID && (filter.Resource == "" || r.Resource == filter.Resource) && (filter.Status == "" || r.Status == filter.Status) {
+			rows = append(rows, r)
+		}
+	}
+	if filter.Offset > 0 {
+		if filter.Offset >= len(rows) {
+			return nil, nil
+		}
+		rows = rows[filter.Offset:]
+	}
+	if filter.Limit > 0 && filter.Limit < len(rows) {
+		rows = rows[:filter.Limit]
+	}
+	return rows, nil
+}
+
+func (d *TestDB) GetAPIKeys() ([]APIKeys, error) {
+	if e, ok := d.Errors["GetAPIKeys"]; ok && e != nil {
+		return nil, e
+	}
+	var keys []APIKeys
+	for _, k := range d.APIKeys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].ID < keys[j].ID
+	})
+	return keys, nil
+}
+
+func (d *TestDB) GetAPIKey(id uint) (*APIKeys, error) {
+	if e, ok := d.Errors["GetAPIKey"]; ok && e != nil {
+		return nil, e
+	}
+	k, ok := d.APIKeys[id]
+	if !ok {
+		return nil, nil
+	}
+	return &k, nil
+}
+
+func (d *TestDB) GetAPIKeyByHash(hash string) (*APIKeys, error) {
+	if e, ok := d.Errors["GetAPIKeyByHash"]; ok && e != nil {
+		return nil, e
+	}
+	for _, k := range d.APIKeys {
+		if k.Hash == hash {
+			return &k, nil
+		}
+	}
+	return nil, nil
+}
+
+// resourceKey is the key of a resource in TestDB.Resource: its name, prefixed by
+// "<namespace>:" outside the default namespace.
+func resourceKey(namespace, name string) string {
+	if namespace == "" || namespace == DefaultNamespace {
+		return name
+	}
+	return namespace + ":" + name
+}
+
+func (d *TestDB) GetNamespaces() ([]string, error) {
+	if e, ok := d.Errors["GetNamespaces"]; ok && e != nil {
+		return nil, e
+	}
+	found := make(map[string]bool)
+	var namespaces []string
+	for _, r := range d.Resource {
+		if !found[r.Namespace] {
+			found[r.Namespace] = true
+			namespaces = append(namespaces, r.Namespace)
+		}
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+func (d *TestDB) WithNamespace(namespace string) DB {
+	return &testNamespaceDB{TestDB: d, namespace: namespace}
+}
+
+// testNamespaceDB is a TestDB restricted to a namespace, like DBImpl.WithNamespace.
+type testNamespaceDB struct {
+	*TestDB
+	namespace string
+}
+
+func (d *testNamespaceDB) WithNamespace(namespace string) DB {
+	return d.TestDB.WithNamespace(namespace)
+}
+
+// owns tells whether the resource with the ID is in the namespace. Tests may save rows without
+// their resource, those are in the default namespace.
+func (d *testNamespaceDB) owns(resourceID int) bool {
+	for _, r := range d.Resource {
+		if int(r.ID) == resourceID {
+			return r.Namespace == d.namespace
+		}
+	}
+	return d.namespace == DefaultNamespace
+}
+
+func (d *testNamespaceDB) Save(value interface{}, optTx *gorm.DB) error {
+	setNamespace(value, d.namespace)
+	return d.TestDB.Save(value, optTx)
+}
+
+func (d *testNamespaceDB) GetResource(resource string, optTx *gorm.DB) (*Resource, error) {
+	return d.TestDB.GetResource(resourceKey(d.namespace, resource), optTx)
+}
+
+func (d *testNamespaceDB) SelectResourceForUpdate(resourceName string, optTx *gorm.DB) (*Resource, error) {
+	r, err := d.TestDB.SelectResourceForUpdate(resourceKey(d.namespace, resourceName), optTx)
+	if r != nil && r.ID == 0 {
+		r.Name = resourceName
+	}
+	return r, err
+}
+
+func (d *testNamespaceDB) GetAllResources() ([]Resource, error) {
+	all, err := d.TestDB.GetAllResources()
+	var resources []Resource
+	for _, r := range all {
+		if r.Namespace == d.namespace {
+			resources = append(resources, r)
+		}
+	}
+	return resources, err
+}
+
+func (d *testNamespaceDB) GetResourceVersion(versionID uint, optTx *gorm.DB) (ResourceVersions, error) {
+	v, err := d.TestDB.GetResourceVersion(versionID, optTx)
+	if err != nil || !d.owns(v.ResourceID) {
+		return ResourceVersions{}, err
+	}
+	return v, nil
+}
+
+func (d *testNamespaceDB) GetResourceVersions(resourceID uint) ([]ResourceVersions, error) {
+	if !d.owns(int(resourceID)) {
+		return nil, nil
+	}
+	return d.TestDB.GetResourceVersions(resourceID)
+}
+
+func (d *testNamespaceDB) GetReferencePayload(id uint) (*ReferencePayloads, error) {
+	rp, err := d.TestDB.GetReferencePayload(id)
+	if err != nil || rp == nil || !d.owns(rp.ResourceID) {
+		return nil, err
+	}
+	return rp, nil
+}
+
+func (d *testNamespaceDB) GetNotificationRoutes() ([]NotificationRoutes, error) {
+	all, err := d.TestDB.GetNotificationRoutes()
+	var routes []NotificationRoutes
+	for _, r := range all {
+		if r.Namespace == d.namespace {
+			routes = append(routes, r)
+		}
+	}
+	return routes, err
+}
+
+func (d *testNamespaceDB) GetNotificationRoute(id uint) (*NotificationRoutes, error) {
+	r, err := d.TestDB.GetNotificationRoute(id)
+	if err != nil || r == nil || r.Namespace != d.namespace {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (d *testNamespaceDB) DeleteNotificationRoute(id uint) (int64, error) {
+	if r, ok := d.Routes[id]; ok && r.Namespace != d.namespace {
+		return 0, nil
+	}
+	return d.TestDB.DeleteNotificationRoute(id)
+}
+
+func (d *testNamespaceDB) GetOutboxNotifications(filter OutboxFilter) ([]NotificationOutbox, error) {
+	// Paginate after leaving the other namespaces out.
+	all, err := d.TestDB.GetOutboxNotifications(OutboxFilter{Resource: filter.Resource, Status: filter.Status})
+	var rows []NotificationOutbox
+	for _, r := range all {
+		if r.Namespace == d.namespace {
+			rows = append(rows, r)
+		}
+	}
+	if filter.Offset > 0 {
+		if filter.Offset >= len(rows) {
+			return nil, err
+		}
+		rows = rows[filter.Offset:]
+	}
+	if filter.Limit > 0 && filter.Limit < len(rows) {
+		rows = rows[:filter.Limit]
+	}
+	return rows, err
+}
+
+func (d *testNamespaceDB) GetOutboxNotification(id uint) (*NotificationOutbox, error) {
+	r, err := d.TestDB.GetOutboxNotification(id)
+	if err != nil || r == nil || r.Namespace != d.namespace {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (d *testNamespaceDB) GetAlertRules(resourceID uint) ([]AlertRules, error) {
+	all, err := d.TestDB.GetAlertRules(resourceID)
+	var rules []AlertRules
+	for _, r := range all {
+		if d.owns(r.ResourceID) {
+			rules = append(rules, r)
+		}
+	}
+	return rules, err
+}
+
+func (d *testNamespaceDB) GetAlertRule(id uint) (*AlertRules, error) {
+	r, err := d.TestDB.GetAlertRule(id)
+	if err != nil || r == nil || !d.owns(r.ResourceID) {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (d *testNamespaceDB) DeleteAlertRule(id uint) (int64, error) {
+	if r, ok := d.AlertRules[id]; ok && !d.owns(r.ResourceID) {
+		return 0, nil
+	}
+	return d.TestDB.DeleteAlertRule(id)
+}
+
+func (d *testNamespaceDB) GetWebhookSubscriptions() ([]WebhookSubscriptions, error) {
+	all, err := d.TestDB.GetWebhookSubscriptions()
+	var subs []WebhookSubscriptions
+	for _, s := range all {
+		if s.Namespace == d.namespace {
+			subs = append(subs, s)
+		}
+	}
+	return subs, err
+}
+
+func (d *testNamespaceDB) GetWebhookSubscription(id uint) (*WebhookSubscriptions, error) {
+	s, err := d.TestDB.GetWebhookSubscription(id)
+	if err != nil || s == nil || s.Namespace != d.namespace {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (d *testNamespaceDB) DeleteWebhookSubscription(id uint) (int64, error) {
+	if s, ok := d.Webhooks[id]; ok && s.Namespace != d.namespace {
+		return 0, nil
+	}
+	return d.TestDB.DeleteWebhookSubscription(id)
+}
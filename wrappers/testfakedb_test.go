@@ -157,3 +157,40 @@ func TestResourceVersions(t *testing.T) {
 		t.Fatalf("expected 2, got %d", rvs[0].ResourceID)
 	}
 }
+
+func TestNamespaces(t *testing.T) {
+	db := wrappers.NewTestDB()
+	teamA := db.WithNamespace("team-a")
+	if err := db.Save(&wrappers.Resource{Name: "users"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := teamA.Save(&wrappers.Resource{Name: "users"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	r, err := teamA.GetResource("users", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Namespace != "team-a" || r.ID != 2 {
+		t.Fatalf("expected users 2 in team-a, got %d in %s", r.ID, r.Namespace)
+	}
+	if r, _ = db.GetResource("users", nil); r.Namespace != wrappers.DefaultNamespace || r.ID != 1 {
+		t.Fatalf("expected users 1 in default, got %d in %s", r.ID, r.Namespace)
+	}
+	if err := db.Save(&wrappers.ResourceVersions{ResourceID: 2, Version: 1}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := teamA.GetResourceVersion(1, nil); v.ID != 1 {
+		t.Fatalf("expected version 1 in team-a, got %d", v.ID)
+	}
+	if v, _ := db.WithNamespace("team-b").GetResourceVersion(1, nil); v.ID != 0 {
+		t.Fatalf("expected no version in team-b, got %d", v.ID)
+	}
+	namespaces, err := db.GetNamespaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(namespaces) != 2 || namespaces[0] != wrappers.DefaultNamespace || namespaces[1] != "team-a" {
+		t.Fatalf("expected default and team-a, got %v", namespaces)
+	}
+}